@@ -0,0 +1,430 @@
+// Package evidence packages the misbehaviour that is caught by a Process into
+// Evidence that can be verified by anyone, and keeps it in a Pool until it can
+// be included in a proposal. Evidence only contains signed messages, so it can
+// be transferred to, and verified by, other parties (for example, a slashing
+// contract).
+package evidence
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/id"
+	"github.com/renproject/surge"
+)
+
+// A Kind identifies the type of misbehaviour proven by Evidence.
+type Kind uint8
+
+// Enumerate the kinds of misbehaviour that can be proven.
+const (
+	KindDoublePropose    = Kind(1)
+	KindDoublePrevote    = Kind(2)
+	KindDoublePrecommit  = Kind(3)
+	KindOutOfTurnPropose = Kind(4)
+	KindAmnesia          = Kind(5)
+)
+
+// String implements the Stringer interface for the Kind type.
+func (kind Kind) String() string {
+	switch kind {
+	case KindDoublePropose:
+		return "DoublePropose"
+	case KindDoublePrevote:
+		return "DoublePrevote"
+	case KindDoublePrecommit:
+		return "DoublePrecommit"
+	case KindOutOfTurnPropose:
+		return "OutOfTurnPropose"
+	case KindAmnesia:
+		return "Amnesia"
+	default:
+		return fmt.Sprintf("Kind(%d)", uint8(kind))
+	}
+}
+
+// Evidence bundles the signed messages that prove misbehaviour. Double
+// proposals and votes are proven by two conflicting messages from the same
+// signatory, at the same Height and Round. Out of turn proposals are proven by
+// one Propose, together with the Scheduler that was used at its Height.
+// Amnesia is shown by a Precommit and a Prevote for a different Value in a
+// later Round of the same Height, from the same signatory.
+//
+// The messages are sorted, and Payloads are removed from Proposes, so that
+// Evidence of the same misbehaviour is always the same.
+type Evidence struct {
+	Kind       Kind                `json:"kind"`
+	Proposes   []process.Propose   `json:"proposes,omitempty"`
+	Prevotes   []process.Prevote   `json:"prevotes,omitempty"`
+	Precommits []process.Precommit `json:"precommits,omitempty"`
+}
+
+// NewDoubleProposeEvidence returns Evidence that the sender of the Proposes
+// proposed twice in the same Height and Round.
+func NewDoubleProposeEvidence(propose, conflicting process.Propose) Evidence {
+	propose.Payload, conflicting.Payload = nil, nil
+	proposes := []process.Propose{propose, conflicting}
+	sort.Slice(proposes, func(i, j int) bool {
+		return bytes.Compare(proposeHash(proposes[i]), proposeHash(proposes[j])) < 0
+	})
+	return Evidence{Kind: KindDoublePropose, Proposes: proposes}
+}
+
+// NewDoublePrevoteEvidence returns Evidence that the sender of the Prevotes
+// prevoted twice in the same Height and Round.
+func NewDoublePrevoteEvidence(prevote, conflicting process.Prevote) Evidence {
+	prevotes := []process.Prevote{prevote, conflicting}
+	sort.Slice(prevotes, func(i, j int) bool {
+		return bytes.Compare(prevoteHash(prevotes[i]), prevoteHash(prevotes[j])) < 0
+	})
+	return Evidence{Kind: KindDoublePrevote, Prevotes: prevotes}
+}
+
+// NewDoublePrecommitEvidence returns Evidence that the sender of the
+// Precommits precommitted twice in the same Height and Round.
+func NewDoublePrecommitEvidence(precommit, conflicting process.Precommit) Evidence {
+	precommits := []process.Precommit{precommit, conflicting}
+	sort.Slice(precommits, func(i, j int) bool {
+		return bytes.Compare(precommitHash(precommits[i]), precommitHash(precommits[j])) < 0
+	})
+	return Evidence{Kind: KindDoublePrecommit, Precommits: precommits}
+}
+
+// NewOutOfTurnProposeEvidence returns Evidence that the sender of the Propose
+// proposed when it was not the scheduled proposer.
+func NewOutOfTurnProposeEvidence(propose process.Propose) Evidence {
+	propose.Payload = nil
+	return Evidence{Kind: KindOutOfTurnPropose, Proposes: []process.Propose{propose}}
+}
+
+// NewAmnesiaEvidence returns Evidence that the sender of the Precommit
+// prevoted for a different Value in a later Round, even though it was locked
+// on the Value of the Precommit.
+func NewAmnesiaEvidence(precommit process.Precommit, prevote process.Prevote) Evidence {
+	return Evidence{Kind: KindAmnesia, Prevotes: []process.Prevote{prevote}, Precommits: []process.Precommit{precommit}}
+}
+
+// Offender returns the signatory that misbehaved. It must only be called on
+// Evidence that has been verified.
+func (evidence Evidence) Offender() id.Signatory {
+	switch {
+	case len(evidence.Proposes) > 0:
+		return evidence.Proposes[0].From
+	case len(evidence.Prevotes) > 0:
+		return evidence.Prevotes[0].From
+	case len(evidence.Precommits) > 0:
+		return evidence.Precommits[0].From
+	default:
+		return id.Signatory{}
+	}
+}
+
+// Height returns the Height at which the misbehaviour happened. It must only
+// be called on Evidence that has been verified.
+func (evidence Evidence) Height() process.Height {
+	switch {
+	case len(evidence.Proposes) > 0:
+		return evidence.Proposes[0].Height
+	case len(evidence.Prevotes) > 0:
+		return evidence.Prevotes[0].Height
+	case len(evidence.Precommits) > 0:
+		return evidence.Precommits[0].Height
+	default:
+		return 0
+	}
+}
+
+// Round returns the Round at which the misbehaviour happened (for amnesia, the
+// Round of the Precommit). It must only be called on Evidence that has been
+// verified.
+func (evidence Evidence) Round() process.Round {
+	switch {
+	case len(evidence.Proposes) > 0:
+		return evidence.Proposes[0].Round
+	case len(evidence.Precommits) > 0:
+		return evidence.Precommits[0].Round
+	case len(evidence.Prevotes) > 0:
+		return evidence.Prevotes[0].Round
+	default:
+		return process.InvalidRound
+	}
+}
+
+// Hash of the Evidence. Evidence of the same misbehaviour always has the same
+// hash. The hash only covers the kind, the offender, the Height and Round, and
+// the content that was signed in each message (in sorted order), so it does
+// not change when messages are signed again, when their signatures are
+// malleated, or when Payloads are attached to Proposes.
+func (evidence Evidence) Hash() id.Hash {
+	hashes := make([][]byte, 0, len(evidence.Proposes)+len(evidence.Prevotes)+len(evidence.Precommits))
+	for _, propose := range evidence.Proposes {
+		hashes = append(hashes, append([]byte{byte(KindDoublePropose)}, proposeHash(propose)...))
+	}
+	for _, prevote := range evidence.Prevotes {
+		hashes = append(hashes, append([]byte{byte(KindDoublePrevote)}, prevoteHash(prevote)...))
+	}
+	for _, precommit := range evidence.Precommits {
+		hashes = append(hashes, append([]byte{byte(KindDoublePrecommit)}, precommitHash(precommit)...))
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i], hashes[j]) < 0
+	})
+
+	offender := evidence.Offender()
+	height, round := evidence.Height(), evidence.Round()
+	data := make([]byte, surge.SizeHint(uint8(evidence.Kind))+surge.SizeHint(offender)+surge.SizeHint(height)+surge.SizeHint(round))
+	buf, rem, err := surge.Marshal(uint8(evidence.Kind), data, len(data))
+	if err == nil {
+		buf, rem, err = surge.Marshal(offender, buf, rem)
+	}
+	if err == nil {
+		buf, rem, err = surge.Marshal(height, buf, rem)
+	}
+	if err == nil {
+		_, _, err = surge.Marshal(round, buf, rem)
+	}
+	if err != nil {
+		panic(fmt.Errorf("invariant violation: marshaling evidence: %v", err))
+	}
+	for _, hash := range hashes {
+		data = append(data, hash...)
+	}
+	return id.NewHash(data)
+}
+
+// Verify that the Evidence proves misbehaviour. All messages must be signed by
+// the same signatory, and conflicting messages must be for the same Height and
+// Round, but must differ in their signed content. The Scheduler is only needed
+// to verify out of turn proposals, and must be the Scheduler that was used at
+// the Height of the Propose.
+//
+// Evidence of amnesia is only verified to show that the signatory changed its
+// vote after locking. It cannot show that there was no polka that allowed the
+// signatory to unlock, so it is weaker than the other kinds of Evidence.
+func (evidence Evidence) Verify(scheduler process.Scheduler) error {
+	switch evidence.Kind {
+	case KindDoublePropose:
+		if len(evidence.Proposes) != 2 || len(evidence.Prevotes) != 0 || len(evidence.Precommits) != 0 {
+			return fmt.Errorf("bad messages: expected 2 proposes")
+		}
+		propose, conflicting := evidence.Proposes[0], evidence.Proposes[1]
+		if err := verifyConflict(propose.From, conflicting.From, propose.Height, conflicting.Height, propose.Round, conflicting.Round); err != nil {
+			return err
+		}
+		if propose.ValidRound == conflicting.ValidRound && propose.Value.Equal(&conflicting.Value) {
+			return fmt.Errorf("bad proposes: expected different values or valid rounds")
+		}
+		if err := propose.Verify(); err != nil {
+			return fmt.Errorf("verifying propose: %v", err)
+		}
+		if err := conflicting.Verify(); err != nil {
+			return fmt.Errorf("verifying conflicting propose: %v", err)
+		}
+	case KindDoublePrevote:
+		if len(evidence.Prevotes) != 2 || len(evidence.Proposes) != 0 || len(evidence.Precommits) != 0 {
+			return fmt.Errorf("bad messages: expected 2 prevotes")
+		}
+		prevote, conflicting := evidence.Prevotes[0], evidence.Prevotes[1]
+		if err := verifyConflict(prevote.From, conflicting.From, prevote.Height, conflicting.Height, prevote.Round, conflicting.Round); err != nil {
+			return err
+		}
+		if prevote.Value.Equal(&conflicting.Value) {
+			return fmt.Errorf("bad prevotes: expected different values")
+		}
+		if err := prevote.Verify(); err != nil {
+			return fmt.Errorf("verifying prevote: %v", err)
+		}
+		if err := conflicting.Verify(); err != nil {
+			return fmt.Errorf("verifying conflicting prevote: %v", err)
+		}
+	case KindDoublePrecommit:
+		if len(evidence.Precommits) != 2 || len(evidence.Proposes) != 0 || len(evidence.Prevotes) != 0 {
+			return fmt.Errorf("bad messages: expected 2 precommits")
+		}
+		precommit, conflicting := evidence.Precommits[0], evidence.Precommits[1]
+		if err := verifyConflict(precommit.From, conflicting.From, precommit.Height, conflicting.Height, precommit.Round, conflicting.Round); err != nil {
+			return err
+		}
+		if precommit.Value.Equal(&conflicting.Value) {
+			return fmt.Errorf("bad precommits: expected different values")
+		}
+		if err := precommit.Verify(); err != nil {
+			return fmt.Errorf("verifying precommit: %v", err)
+		}
+		if err := conflicting.Verify(); err != nil {
+			return fmt.Errorf("verifying conflicting precommit: %v", err)
+		}
+	case KindOutOfTurnPropose:
+		if len(evidence.Proposes) != 1 || len(evidence.Prevotes) != 0 || len(evidence.Precommits) != 0 {
+			return fmt.Errorf("bad messages: expected 1 propose")
+		}
+		if scheduler == nil {
+			return fmt.Errorf("bad scheduler: expected non-nil scheduler")
+		}
+		propose := evidence.Proposes[0]
+		if proposer := scheduler.Schedule(propose.Height, propose.Round); proposer.Equal(&propose.From) {
+			return fmt.Errorf("bad propose: expected from!=%v", proposer)
+		}
+		if err := propose.Verify(); err != nil {
+			return fmt.Errorf("verifying propose: %v", err)
+		}
+	case KindAmnesia:
+		if len(evidence.Precommits) != 1 || len(evidence.Prevotes) != 1 || len(evidence.Proposes) != 0 {
+			return fmt.Errorf("bad messages: expected 1 precommit and 1 prevote")
+		}
+		precommit, prevote := evidence.Precommits[0], evidence.Prevotes[0]
+		if !precommit.From.Equal(&prevote.From) {
+			return fmt.Errorf("bad signatories: expected from=%v, got from=%v", precommit.From, prevote.From)
+		}
+		if precommit.Height != prevote.Height {
+			return fmt.Errorf("bad heights: expected height=%v, got height=%v", precommit.Height, prevote.Height)
+		}
+		if prevote.Round <= precommit.Round {
+			return fmt.Errorf("bad rounds: expected round>%v, got round=%v", precommit.Round, prevote.Round)
+		}
+		if precommit.Value.Equal(&process.NilValue) || prevote.Value.Equal(&process.NilValue) || precommit.Value.Equal(&prevote.Value) {
+			return fmt.Errorf("bad values: expected different non-nil values")
+		}
+		if err := precommit.Verify(); err != nil {
+			return fmt.Errorf("verifying precommit: %v", err)
+		}
+		if err := prevote.Verify(); err != nil {
+			return fmt.Errorf("verifying prevote: %v", err)
+		}
+	default:
+		return fmt.Errorf("bad kind: %v", evidence.Kind)
+	}
+	return nil
+}
+
+// Equal compares two Evidences. If they are equal, then it returns true,
+// otherwise it returns false.
+func (evidence *Evidence) Equal(other *Evidence) bool {
+	if evidence.Kind != other.Kind ||
+		len(evidence.Proposes) != len(other.Proposes) ||
+		len(evidence.Prevotes) != len(other.Prevotes) ||
+		len(evidence.Precommits) != len(other.Precommits) {
+		return false
+	}
+	for i := range evidence.Proposes {
+		if !evidence.Proposes[i].Equal(&other.Proposes[i]) || evidence.Proposes[i].Signature != other.Proposes[i].Signature {
+			return false
+		}
+	}
+	for i := range evidence.Prevotes {
+		if !evidence.Prevotes[i].Equal(&other.Prevotes[i]) || evidence.Prevotes[i].Signature != other.Prevotes[i].Signature {
+			return false
+		}
+	}
+	for i := range evidence.Precommits {
+		if !evidence.Precommits[i].Equal(&other.Precommits[i]) || evidence.Precommits[i].Signature != other.Precommits[i].Signature {
+			return false
+		}
+	}
+	return true
+}
+
+// SizeHint returns the number of bytes required to represent this Evidence in
+// binary.
+func (evidence Evidence) SizeHint() int {
+	return surge.SizeHint(uint8(evidence.Kind)) +
+		surge.SizeHint(evidence.Proposes) +
+		surge.SizeHint(evidence.Prevotes) +
+		surge.SizeHint(evidence.Precommits)
+}
+
+// Marshal this Evidence into binary.
+func (evidence Evidence) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.Marshal(uint8(evidence.Kind), buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling kind=%v: %v", evidence.Kind, err)
+	}
+	buf, rem, err = surge.Marshal(evidence.Proposes, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling %v proposes: %v", len(evidence.Proposes), err)
+	}
+	buf, rem, err = surge.Marshal(evidence.Prevotes, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling %v prevotes: %v", len(evidence.Prevotes), err)
+	}
+	buf, rem, err = surge.Marshal(evidence.Precommits, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling %v precommits: %v", len(evidence.Precommits), err)
+	}
+	return buf, rem, nil
+}
+
+// Unmarshal binary into this Evidence.
+func (evidence *Evidence) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	kind := uint8(0)
+	buf, rem, err := surge.Unmarshal(&kind, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling kind: %v", err)
+	}
+	evidence.Kind = Kind(kind)
+	buf, rem, err = surge.Unmarshal(&evidence.Proposes, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling proposes: %v", err)
+	}
+	buf, rem, err = surge.Unmarshal(&evidence.Prevotes, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling prevotes: %v", err)
+	}
+	buf, rem, err = surge.Unmarshal(&evidence.Precommits, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling precommits: %v", err)
+	}
+	// Evidence without some kinds of messages is not changed by marshaling and
+	// then unmarshaling.
+	if len(evidence.Proposes) == 0 {
+		evidence.Proposes = nil
+	}
+	if len(evidence.Prevotes) == 0 {
+		evidence.Prevotes = nil
+	}
+	if len(evidence.Precommits) == 0 {
+		evidence.Precommits = nil
+	}
+	return buf, rem, nil
+}
+
+// verifyConflict returns an error unless two messages are from the same
+// signatory, at the same Height and Round.
+func verifyConflict(from, otherFrom id.Signatory, height, otherHeight process.Height, round, otherRound process.Round) error {
+	if !from.Equal(&otherFrom) {
+		return fmt.Errorf("bad signatories: expected from=%v, got from=%v", from, otherFrom)
+	}
+	if height != otherHeight {
+		return fmt.Errorf("bad heights: expected height=%v, got height=%v", height, otherHeight)
+	}
+	if round != otherRound {
+		return fmt.Errorf("bad rounds: expected round=%v, got round=%v", round, otherRound)
+	}
+	return nil
+}
+
+func proposeHash(propose process.Propose) []byte {
+	hash, err := process.NewProposeHash(propose.Height, propose.Round, propose.ValidRound, propose.Value)
+	if err != nil {
+		panic(fmt.Errorf("invariant violation: hashing propose: %v", err))
+	}
+	return hash[:]
+}
+
+func prevoteHash(prevote process.Prevote) []byte {
+	hash, err := process.NewPrevoteHash(prevote.Height, prevote.Round, prevote.Value)
+	if err != nil {
+		panic(fmt.Errorf("invariant violation: hashing prevote: %v", err))
+	}
+	return hash[:]
+}
+
+func precommitHash(precommit process.Precommit) []byte {
+	hash, err := process.NewPrecommitHash(precommit.Height, precommit.Round, precommit.Value)
+	if err != nil {
+		panic(fmt.Errorf("invariant violation: hashing precommit: %v", err))
+	}
+	return hash[:]
+}
@@ -0,0 +1,254 @@
+package evidence_test
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing/quick"
+	"time"
+
+	"github.com/renproject/hyperdrive/evidence"
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/hyperdrive/process/processutil"
+	"github.com/renproject/hyperdrive/scheduler"
+	"github.com/renproject/id"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// The Pool must be usable as the Catcher of a Process.
+var _ process.AmnesiaCatcher = &evidence.Pool{}
+
+var _ = Describe("Evidence", func() {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	Context("when marshaling and unmarshaling", func() {
+		It("should equal itself in binary", func() {
+			loop := func() bool {
+				expected := randomEvidence(r)
+				data, err := surge.ToBinary(expected)
+				Expect(err).ToNot(HaveOccurred())
+				got := evidence.Evidence{}
+				Expect(surge.FromBinary(&got, data)).To(Succeed())
+				Expect(got.Equal(&expected)).To(BeTrue())
+				Expect(got).To(Equal(expected))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should equal itself in json", func() {
+			loop := func() bool {
+				expected := randomEvidence(r)
+				data, err := json.Marshal(expected)
+				Expect(err).ToNot(HaveOccurred())
+				got := evidence.Evidence{}
+				Expect(json.Unmarshal(data, &got)).To(Succeed())
+				Expect(got.Equal(&expected)).To(BeTrue())
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+	})
+
+	Context("when double proposing, prevoting, or precommitting", func() {
+		It("should verify", func() {
+			loop := func() bool {
+				ev := randomEvidence(r)
+				if ev.Kind == evidence.KindOutOfTurnPropose {
+					return true
+				}
+				Expect(ev.Verify(nil)).To(Succeed())
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should have the same hash regardless of the order of the messages", func() {
+			loop := func() bool {
+				privKey := id.NewPrivKey()
+				prevote := signedPrevote(privKey, 1, 0, processutil.RandomGoodValue(r))
+				conflicting := signedPrevote(privKey, 1, 0, processutil.RandomGoodValue(r))
+				ev1 := evidence.NewDoublePrevoteEvidence(prevote, conflicting)
+				ev2 := evidence.NewDoublePrevoteEvidence(conflicting, prevote)
+				Expect(ev1.Hash()).To(Equal(ev2.Hash()))
+				Expect(ev1.Offender()).To(Equal(privKey.Signatory()))
+				Expect(ev1.Height()).To(Equal(process.Height(1)))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should have the same hash when messages are signed again, or have different signatures or payloads", func() {
+			loop := func() bool {
+				privKey := id.NewPrivKey()
+				propose := signedPropose(privKey, 1, 0, processutil.RandomGoodValue(r))
+				conflicting := signedPropose(privKey, 1, 0, processutil.RandomGoodValue(r))
+				ev := evidence.NewDoubleProposeEvidence(propose, conflicting)
+
+				// the offender signs the messages again
+				Expect(propose.Sign(privKey)).To(Succeed())
+				Expect(conflicting.Sign(privKey)).To(Succeed())
+				resigned := evidence.NewDoubleProposeEvidence(conflicting, propose)
+				Expect(resigned.Hash()).To(Equal(ev.Hash()))
+
+				// anyone changes the signatures and payloads of the messages
+				malleated := ev
+				malleated.Proposes = []process.Propose{ev.Proposes[0], ev.Proposes[1]}
+				malleated.Proposes[0].Signature[0]++
+				malleated.Proposes[1].Payload = []byte("payload")
+				Expect(malleated.Hash()).To(Equal(ev.Hash()))
+
+				// out of turn proposes, and amnesia, are the same
+				outOfTurn := evidence.NewOutOfTurnProposeEvidence(propose)
+				outOfTurnMalleated := outOfTurn
+				outOfTurnMalleated.Proposes = []process.Propose{outOfTurn.Proposes[0]}
+				outOfTurnMalleated.Proposes[0].Payload = []byte("payload")
+				outOfTurnMalleated.Proposes[0].Signature[1]++
+				Expect(outOfTurnMalleated.Hash()).To(Equal(outOfTurn.Hash()))
+
+				precommit := signedPrecommit(privKey, 1, 0, processutil.RandomGoodValue(r))
+				prevote := signedPrevote(privKey, 1, 1, processutil.RandomGoodValue(r))
+				amnesia := evidence.NewAmnesiaEvidence(precommit, prevote)
+				Expect(precommit.Sign(privKey)).To(Succeed())
+				Expect(prevote.Sign(privKey)).To(Succeed())
+				Expect(evidence.NewAmnesiaEvidence(precommit, prevote).Hash()).To(Equal(amnesia.Hash()))
+
+				// different misbehaviour has a different hash
+				other := evidence.NewDoubleProposeEvidence(propose, signedPropose(privKey, 1, 0, processutil.RandomGoodValue(r)))
+				Expect(other.Hash()).ToNot(Equal(ev.Hash()))
+				Expect(outOfTurn.Hash()).ToNot(Equal(ev.Hash()))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should not verify messages that do not conflict", func() {
+			privKey := id.NewPrivKey()
+			value := processutil.RandomGoodValue(r)
+
+			// the same message twice
+			precommit := signedPrecommit(privKey, 1, 0, value)
+			Expect(evidence.NewDoublePrecommitEvidence(precommit, precommit).Verify(nil)).ToNot(Succeed())
+
+			// messages at different rounds
+			conflicting := signedPrecommit(privKey, 1, 1, processutil.RandomGoodValue(r))
+			Expect(evidence.NewDoublePrecommitEvidence(precommit, conflicting).Verify(nil)).ToNot(Succeed())
+
+			// messages from different signatories
+			conflicting = signedPrecommit(id.NewPrivKey(), 1, 0, processutil.RandomGoodValue(r))
+			Expect(evidence.NewDoublePrecommitEvidence(precommit, conflicting).Verify(nil)).ToNot(Succeed())
+
+			// proposes that only differ in their payload
+			propose := signedPropose(privKey, 1, 0, value)
+			propose.Payload = []byte("payload")
+			conflictingPropose := propose
+			conflictingPropose.Payload = []byte("other payload")
+			Expect(evidence.NewDoubleProposeEvidence(propose, conflictingPropose).Verify(nil)).ToNot(Succeed())
+		})
+
+		It("should not verify messages with bad signatures", func() {
+			privKey := id.NewPrivKey()
+			prevote := signedPrevote(privKey, 1, 0, processutil.RandomGoodValue(r))
+			conflicting := signedPrevote(privKey, 1, 0, processutil.RandomGoodValue(r))
+			conflicting.Signature = prevote.Signature
+			Expect(evidence.NewDoublePrevoteEvidence(prevote, conflicting).Verify(nil)).ToNot(Succeed())
+		})
+	})
+
+	Context("when prevoting for a different value after precommitting", func() {
+		It("should only verify if the prevote is in a later round, and for a different value", func() {
+			privKey := id.NewPrivKey()
+			value := processutil.RandomGoodValue(r)
+			precommit := signedPrecommit(privKey, 1, 1, value)
+
+			Expect(evidence.NewAmnesiaEvidence(precommit, signedPrevote(privKey, 1, 2, processutil.RandomGoodValue(r))).Verify(nil)).To(Succeed())
+			Expect(evidence.NewAmnesiaEvidence(precommit, signedPrevote(privKey, 1, 0, processutil.RandomGoodValue(r))).Verify(nil)).ToNot(Succeed())
+			Expect(evidence.NewAmnesiaEvidence(precommit, signedPrevote(privKey, 1, 2, value)).Verify(nil)).ToNot(Succeed())
+			Expect(evidence.NewAmnesiaEvidence(precommit, signedPrevote(privKey, 1, 2, process.NilValue)).Verify(nil)).ToNot(Succeed())
+			Expect(evidence.NewAmnesiaEvidence(precommit, signedPrevote(privKey, 2, 2, processutil.RandomGoodValue(r))).Verify(nil)).ToNot(Succeed())
+			Expect(evidence.NewAmnesiaEvidence(precommit, signedPrevote(id.NewPrivKey(), 1, 2, processutil.RandomGoodValue(r))).Verify(nil)).ToNot(Succeed())
+		})
+	})
+
+	Context("when proposing out of turn", func() {
+		It("should only verify against a scheduler that did not schedule the proposer", func() {
+			privKey := id.NewPrivKey()
+			propose := signedPropose(privKey, 1, 0, processutil.RandomGoodValue(r))
+			ev := evidence.NewOutOfTurnProposeEvidence(propose)
+
+			Expect(ev.Verify(nil)).ToNot(Succeed())
+			Expect(ev.Verify(scheduler.NewRoundRobin([]id.Signatory{privKey.Signatory()}))).ToNot(Succeed())
+			Expect(ev.Verify(scheduler.NewRoundRobin([]id.Signatory{id.NewPrivKey().Signatory()}))).To(Succeed())
+		})
+	})
+})
+
+// randomEvidence returns random Evidence that can be verified, except for out
+// of turn proposals, which can only be verified with a scheduler.
+func randomEvidence(r *rand.Rand) evidence.Evidence {
+	privKey := id.NewPrivKey()
+	height := process.Height(1 + r.Int63n(1000))
+	round := process.Round(r.Int63n(1000))
+	switch r.Intn(5) {
+	case 0:
+		return evidence.NewDoubleProposeEvidence(
+			signedPropose(privKey, height, round, processutil.RandomGoodValue(r)),
+			signedPropose(privKey, height, round, processutil.RandomGoodValue(r)),
+		)
+	case 1:
+		return evidence.NewDoublePrevoteEvidence(
+			signedPrevote(privKey, height, round, processutil.RandomGoodValue(r)),
+			signedPrevote(privKey, height, round, processutil.RandomGoodValue(r)),
+		)
+	case 2:
+		return evidence.NewDoublePrecommitEvidence(
+			signedPrecommit(privKey, height, round, processutil.RandomGoodValue(r)),
+			signedPrecommit(privKey, height, round, processutil.RandomGoodValue(r)),
+		)
+	case 3:
+		return evidence.NewAmnesiaEvidence(
+			signedPrecommit(privKey, height, round, processutil.RandomGoodValue(r)),
+			signedPrevote(privKey, height, round+1+process.Round(r.Int63n(10)), processutil.RandomGoodValue(r)),
+		)
+	default:
+		return evidence.NewOutOfTurnProposeEvidence(
+			signedPropose(privKey, height, round, processutil.RandomGoodValue(r)),
+		)
+	}
+}
+
+func signedPropose(privKey *id.PrivKey, height process.Height, round process.Round, value process.Value) process.Propose {
+	propose := process.Propose{
+		Height:     height,
+		Round:      round,
+		ValidRound: process.InvalidRound,
+		Value:      value,
+		From:       privKey.Signatory(),
+	}
+	Expect(propose.Sign(privKey)).To(Succeed())
+	return propose
+}
+
+func signedPrevote(privKey *id.PrivKey, height process.Height, round process.Round, value process.Value) process.Prevote {
+	prevote := process.Prevote{
+		Height: height,
+		Round:  round,
+		Value:  value,
+		From:   privKey.Signatory(),
+	}
+	Expect(prevote.Sign(privKey)).To(Succeed())
+	return prevote
+}
+
+func signedPrecommit(privKey *id.PrivKey, height process.Height, round process.Round, value process.Value) process.Precommit {
+	precommit := process.Precommit{
+		Height: height,
+		Round:  round,
+		Value:  value,
+		From:   privKey.Signatory(),
+	}
+	Expect(precommit.Sign(privKey)).To(Succeed())
+	return precommit
+}
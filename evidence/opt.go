@@ -0,0 +1,34 @@
+package evidence
+
+import "go.uber.org/zap"
+
+// Options define the options of a Pool.
+type Options struct {
+	Logger *zap.Logger
+	Store  Store
+}
+
+// DefaultOptions returns the default options of a Pool. By default, there is no
+// Store, and Evidence is only kept in memory.
+func DefaultOptions() Options {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		panic(err)
+	}
+	return Options{
+		Logger: logger,
+	}
+}
+
+// WithLogger updates the logger used by the Pool to log Evidence that it fails
+// to save.
+func (opts Options) WithLogger(logger *zap.Logger) Options {
+	opts.Logger = logger
+	return opts
+}
+
+// WithStore updates the Store to which the Pool persists its Evidence.
+func (opts Options) WithStore(store Store) Options {
+	opts.Store = store
+	return opts
+}
@@ -0,0 +1,229 @@
+package evidence
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/id"
+
+	"go.uber.org/zap"
+)
+
+// A Pool keeps Evidence until it has been included in a committed proposal.
+// Evidence is deduplicated by its hash, so the same misbehaviour is only ever
+// added once, even after it has been included. A Pool implements the
+// AmnesiaCatcher interface, so it can be given to a Process (or Replica) to
+// collect Evidence of the misbehaviour that the Process catches.
+//
+// If the Pool has a Store, then new and updated entries are appended to the
+// Store whenever the Pool changes, and the Pool is restored from the Store when
+// it is created. The Store is only rewritten when Evidence is pruned. A Pool is
+// safe for concurrent use.
+type Pool struct {
+	mu      sync.Mutex
+	logger  *zap.Logger
+	store   Store
+	entries map[id.Hash]Entry
+	order   []id.Hash
+}
+
+// NewPool returns a Pool that persists its Evidence to the Store in the
+// options, and restores any Evidence that has been saved to the Store. If there
+// is no Store, then the Evidence is only kept in memory.
+func NewPool(opts Options) (*Pool, error) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	pool := &Pool{
+		logger:  logger,
+		store:   opts.Store,
+		entries: map[id.Hash]Entry{},
+	}
+	if pool.store == nil {
+		return pool, nil
+	}
+	entries, err := pool.store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading store: %v", err)
+	}
+	// Entries that were appended later replace the entries for the same
+	// Evidence that were appended earlier, but keep their place in the order.
+	for _, entry := range entries {
+		hash := entry.Evidence.Hash()
+		if _, ok := pool.entries[hash]; !ok {
+			pool.order = append(pool.order, hash)
+		}
+		pool.entries[hash] = entry
+	}
+	return pool, nil
+}
+
+// Add the Evidence to the Pool. It returns false if the Evidence is already in
+// the Pool. Evidence is not verified before it is added, so Evidence from
+// untrusted sources must be verified first.
+func (pool *Pool) Add(evidence Evidence) (bool, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	hash := evidence.Hash()
+	if _, ok := pool.entries[hash]; ok {
+		return false, nil
+	}
+	entry := Entry{Evidence: evidence}
+	if err := pool.append(entry); err != nil {
+		return false, err
+	}
+	pool.entries[hash] = entry
+	pool.order = append(pool.order, hash)
+	return true, nil
+}
+
+// Has returns true if Evidence with the given hash is in the Pool, whether or
+// not it has been included.
+func (pool *Pool) Has(hash id.Hash) bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	_, ok := pool.entries[hash]
+	return ok
+}
+
+// Pending returns, at most, the given number of Evidences that have not been
+// included, from oldest to newest. They should be included in the next
+// proposal.
+func (pool *Pool) Pending(max int) []Evidence {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pending := []Evidence{}
+	for _, hash := range pool.order {
+		if len(pending) >= max {
+			break
+		}
+		if entry := pool.entries[hash]; !entry.Included {
+			pending = append(pending, entry.Evidence)
+		}
+	}
+	return pending
+}
+
+// MarkIncluded marks the Evidences as included, so that they are no longer
+// pending. It should be called whenever a proposal that includes Evidence is
+// committed. Evidence that is not in the Pool is added, so that it is not
+// added again later.
+func (pool *Pool) MarkIncluded(evidences ...Evidence) error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	entries := make([]Entry, 0, len(evidences))
+	for _, evidence := range evidences {
+		entries = append(entries, Entry{Evidence: evidence, Included: true})
+	}
+	if err := pool.append(entries...); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		hash := entry.Evidence.Hash()
+		if _, ok := pool.entries[hash]; !ok {
+			pool.order = append(pool.order, hash)
+		}
+		pool.entries[hash] = entry
+	}
+	return nil
+}
+
+// Prune all Evidence of misbehaviour below the given Height, whether or not it
+// has been included. Pruned Evidence is forgotten, so it can be added again.
+// Pruning rewrites the Store, so it should be done periodically, not whenever
+// Evidence is added.
+func (pool *Pool) Prune(height process.Height) error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	order := make([]id.Hash, 0, len(pool.order))
+	entries := make([]Entry, 0, len(pool.order))
+	for _, hash := range pool.order {
+		if pool.entries[hash].Evidence.Height() >= height {
+			order = append(order, hash)
+			entries = append(entries, pool.entries[hash])
+		}
+	}
+	if len(order) == len(pool.order) {
+		return nil
+	}
+	if pool.store != nil {
+		if err := pool.store.Save(entries); err != nil {
+			return fmt.Errorf("saving store: %v", err)
+		}
+	}
+	for _, hash := range pool.order {
+		if pool.entries[hash].Evidence.Height() < height {
+			delete(pool.entries, hash)
+		}
+	}
+	pool.order = order
+	return nil
+}
+
+// CatchDoublePropose adds Evidence of the double propose to the Pool.
+func (pool *Pool) CatchDoublePropose(propose, conflicting process.Propose) {
+	pool.catch(NewDoubleProposeEvidence(propose, conflicting))
+}
+
+// CatchDoublePrevote adds Evidence of the double prevote to the Pool.
+func (pool *Pool) CatchDoublePrevote(prevote, conflicting process.Prevote) {
+	pool.catch(NewDoublePrevoteEvidence(prevote, conflicting))
+}
+
+// CatchDoublePrecommit adds Evidence of the double precommit to the Pool.
+func (pool *Pool) CatchDoublePrecommit(precommit, conflicting process.Precommit) {
+	pool.catch(NewDoublePrecommitEvidence(precommit, conflicting))
+}
+
+// CatchOutOfTurnPropose adds Evidence of the out of turn propose to the Pool.
+// The Process has already checked the Propose against its Scheduler.
+func (pool *Pool) CatchOutOfTurnPropose(propose process.Propose) {
+	pool.catch(NewOutOfTurnProposeEvidence(propose))
+}
+
+// CatchAmnesia adds Evidence of the amnesia to the Pool.
+func (pool *Pool) CatchAmnesia(precommit process.Precommit, prevote process.Prevote) {
+	pool.catch(NewAmnesiaEvidence(precommit, prevote))
+}
+
+// catch adds the Evidence to the Pool, if it can be verified. Messages that
+// differ only in their unsigned content (for example, the Payload of a
+// Propose) are not misbehaviour, and cannot be verified. The Process has
+// already checked an out of turn Propose against its Scheduler, so only its
+// signature is verified. Catching happens while the Process is running, so
+// Evidence that cannot be saved is logged and dropped, instead of stopping the
+// Process.
+func (pool *Pool) catch(evidence Evidence) error {
+	var err error
+	if evidence.Kind == KindOutOfTurnPropose && len(evidence.Proposes) == 1 {
+		err = evidence.Proposes[0].Verify()
+	} else {
+		err = evidence.Verify(nil)
+	}
+	if err != nil {
+		return fmt.Errorf("verifying %v evidence: %v", evidence.Kind, err)
+	}
+	if _, err := pool.Add(evidence); err != nil {
+		pool.logger.Error("adding evidence", zap.Stringer("kind", evidence.Kind), zap.Error(err))
+		return fmt.Errorf("adding %v evidence: %v", evidence.Kind, err)
+	}
+	return nil
+}
+
+// append the entries to the Store, if there is one.
+func (pool *Pool) append(entries ...Entry) error {
+	if pool.store == nil || len(entries) == 0 {
+		return nil
+	}
+	if err := pool.store.Append(entries...); err != nil {
+		return fmt.Errorf("appending to store: %v", err)
+	}
+	return nil
+}
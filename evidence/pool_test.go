@@ -0,0 +1,280 @@
+package evidence_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/renproject/hyperdrive/evidence"
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/hyperdrive/process/processutil"
+	"github.com/renproject/id"
+
+	"go.uber.org/zap"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pool", func() {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "hyperdrive-evidence")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Context("when adding evidence", func() {
+		It("should deduplicate it, even after it has been included", func() {
+			pool, err := evidence.NewPool(evidence.DefaultOptions())
+			Expect(err).ToNot(HaveOccurred())
+
+			ev := randomEvidence(r)
+			added, err := pool.Add(ev)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(added).To(BeTrue())
+			added, err = pool.Add(ev)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(added).To(BeFalse())
+			Expect(pool.Has(ev.Hash())).To(BeTrue())
+
+			Expect(pool.MarkIncluded(ev)).To(Succeed())
+			added, err = pool.Add(ev)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(added).To(BeFalse())
+		})
+
+		It("should deduplicate copies of evidence that are signed again or malleated", func() {
+			pool, err := evidence.NewPool(evidence.DefaultOptions().WithStore(evidence.NewFileStore(filepath.Join(dir, "evidence"))))
+			Expect(err).ToNot(HaveOccurred())
+
+			privKey := id.NewPrivKey()
+			propose := signedPropose(privKey, 1, 0, processutil.RandomGoodValue(r))
+			added, err := pool.Add(evidence.NewOutOfTurnProposeEvidence(propose))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(added).To(BeTrue())
+
+			// the offender signs the propose again, and anyone changes the
+			// signature and the payload
+			Expect(propose.Sign(privKey)).To(Succeed())
+			added, err = pool.Add(evidence.NewOutOfTurnProposeEvidence(propose))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(added).To(BeFalse())
+
+			propose.Signature[0]++
+			ev := evidence.NewOutOfTurnProposeEvidence(propose)
+			ev.Proposes[0].Payload = []byte("payload")
+			added, err = pool.Add(ev)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(added).To(BeFalse())
+			Expect(pool.Pending(10)).To(HaveLen(1))
+
+			// only one copy is saved
+			restored, err := evidence.NewPool(evidence.DefaultOptions().WithStore(evidence.NewFileStore(filepath.Join(dir, "evidence"))))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(restored.Pending(10)).To(HaveLen(1))
+		})
+
+		It("should expose pending evidence in order until it is included", func() {
+			pool, err := evidence.NewPool(evidence.DefaultOptions())
+			Expect(err).ToNot(HaveOccurred())
+
+			evs := make([]evidence.Evidence, 5)
+			for i := range evs {
+				evs[i] = randomEvidence(r)
+				_, err := pool.Add(evs[i])
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(pool.Pending(3)).To(Equal(evs[:3]))
+			Expect(pool.MarkIncluded(evs[0], evs[2])).To(Succeed())
+			Expect(pool.Pending(10)).To(Equal([]evidence.Evidence{evs[1], evs[3], evs[4]}))
+		})
+	})
+
+	Context("when pruning evidence", func() {
+		It("should forget evidence below the height", func() {
+			pool, err := evidence.NewPool(evidence.DefaultOptions())
+			Expect(err).ToNot(HaveOccurred())
+
+			privKey := id.NewPrivKey()
+			old := evidence.NewDoublePrevoteEvidence(
+				signedPrevote(privKey, 1, 0, processutil.RandomGoodValue(r)),
+				signedPrevote(privKey, 1, 0, processutil.RandomGoodValue(r)),
+			)
+			recent := evidence.NewDoublePrevoteEvidence(
+				signedPrevote(privKey, 2, 0, processutil.RandomGoodValue(r)),
+				signedPrevote(privKey, 2, 0, processutil.RandomGoodValue(r)),
+			)
+			for _, ev := range []evidence.Evidence{old, recent} {
+				_, err := pool.Add(ev)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(pool.Prune(2)).To(Succeed())
+			Expect(pool.Has(old.Hash())).To(BeFalse())
+			Expect(pool.Has(recent.Hash())).To(BeTrue())
+		})
+	})
+
+	Context("when using a store", func() {
+		It("should restore the evidence, and whether it has been included", func() {
+			path := filepath.Join(dir, "evidence")
+			pool, err := evidence.NewPool(evidence.DefaultOptions().WithStore(evidence.NewFileStore(path)))
+			Expect(err).ToNot(HaveOccurred())
+
+			evs := make([]evidence.Evidence, 3)
+			for i := range evs {
+				evs[i] = randomEvidence(r)
+				_, err := pool.Add(evs[i])
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(pool.MarkIncluded(evs[1])).To(Succeed())
+
+			restored, err := evidence.NewPool(evidence.DefaultOptions().WithStore(evidence.NewFileStore(path)))
+			Expect(err).ToNot(HaveOccurred())
+			for i := range evs {
+				Expect(restored.Has(evs[i].Hash())).To(BeTrue())
+			}
+			Expect(restored.Pending(10)).To(Equal([]evidence.Evidence{evs[0], evs[2]}))
+		})
+
+		It("should restore the evidence that remains after pruning, and ignore a partial entry", func() {
+			path := filepath.Join(dir, "evidence")
+			pool, err := evidence.NewPool(evidence.DefaultOptions().WithStore(evidence.NewFileStore(path)))
+			Expect(err).ToNot(HaveOccurred())
+
+			evs := make([]evidence.Evidence, 4)
+			for i := range evs {
+				evs[i] = evidence.NewDoublePrevoteEvidence(
+					process.Prevote{Height: process.Height(i + 1), Value: processutil.RandomGoodValue(r)},
+					process.Prevote{Height: process.Height(i + 1), Value: processutil.RandomGoodValue(r)},
+				)
+				_, err := pool.Add(evs[i])
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(pool.Prune(3)).To(Succeed())
+			Expect(pool.MarkIncluded(evs[2])).To(Succeed())
+
+			// a crash while appending leaves a partial entry at the end
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = f.Write([]byte{0, 0, 0, 10, 1, 2})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+
+			restored, err := evidence.NewPool(evidence.DefaultOptions().WithStore(evidence.NewFileStore(path)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(restored.Has(evs[0].Hash())).To(BeFalse())
+			Expect(restored.Has(evs[1].Hash())).To(BeFalse())
+			Expect(restored.Has(evs[2].Hash())).To(BeTrue())
+			Expect(restored.Pending(10)).To(Equal([]evidence.Evidence{evs[3]}))
+		})
+
+		It("should not add evidence that cannot be saved, and should not panic when catching it", func() {
+			pool, err := evidence.NewPool(evidence.DefaultOptions().WithLogger(zap.NewNop()).WithStore(failingStore{}))
+			Expect(err).ToNot(HaveOccurred())
+
+			ev := randomEvidence(r)
+			_, err = pool.Add(ev)
+			Expect(err).To(HaveOccurred())
+			Expect(pool.Has(ev.Hash())).To(BeFalse())
+
+			privKey := id.NewPrivKey()
+			Expect(func() {
+				pool.CatchDoublePrecommit(
+					signedPrecommit(privKey, 1, 0, processutil.RandomGoodValue(r)),
+					signedPrecommit(privKey, 1, 0, processutil.RandomGoodValue(r)),
+				)
+			}).ToNot(Panic())
+			Expect(pool.Pending(10)).To(BeEmpty())
+		})
+	})
+
+	Context("when catching misbehaviour", func() {
+		It("should add evidence of conflicting messages", func() {
+			pool, err := evidence.NewPool(evidence.DefaultOptions())
+			Expect(err).ToNot(HaveOccurred())
+
+			privKey := id.NewPrivKey()
+			precommit := signedPrecommit(privKey, 1, 0, processutil.RandomGoodValue(r))
+			conflicting := signedPrecommit(privKey, 1, 0, processutil.RandomGoodValue(r))
+			pool.CatchDoublePrecommit(precommit, conflicting)
+			pending := pool.Pending(10)
+			Expect(pending).To(HaveLen(1))
+			Expect(pending[0].Kind).To(Equal(evidence.KindDoublePrecommit))
+			Expect(pending[0].Offender()).To(Equal(privKey.Signatory()))
+			Expect(pending[0].Verify(nil)).To(Succeed())
+		})
+
+		It("should not add evidence of proposes that only differ in their payload", func() {
+			pool, err := evidence.NewPool(evidence.DefaultOptions())
+			Expect(err).ToNot(HaveOccurred())
+
+			propose := signedPropose(id.NewPrivKey(), 1, 0, processutil.RandomGoodValue(r))
+			conflicting := propose
+			conflicting.Payload = []byte("payload")
+			pool.CatchDoublePropose(propose, conflicting)
+			Expect(pool.Pending(10)).To(BeEmpty())
+		})
+
+		It("should only add evidence of out of turn proposes that are signed", func() {
+			pool, err := evidence.NewPool(evidence.DefaultOptions())
+			Expect(err).ToNot(HaveOccurred())
+
+			// a propose that was signed by someone else
+			forged := signedPropose(id.NewPrivKey(), 1, 0, processutil.RandomGoodValue(r))
+			forged.From = id.NewPrivKey().Signatory()
+			pool.CatchOutOfTurnPropose(forged)
+			unsigned := forged
+			unsigned.Signature = id.Signature{}
+			pool.CatchOutOfTurnPropose(unsigned)
+			Expect(pool.Pending(10)).To(BeEmpty())
+
+			propose := signedPropose(id.NewPrivKey(), 1, 0, processutil.RandomGoodValue(r))
+			pool.CatchOutOfTurnPropose(propose)
+			pending := pool.Pending(10)
+			Expect(pending).To(HaveLen(1))
+			Expect(pending[0].Kind).To(Equal(evidence.KindOutOfTurnPropose))
+		})
+
+		It("should be usable as the catcher of a process", func() {
+			pool, err := evidence.NewPool(evidence.DefaultOptions())
+			Expect(err).ToNot(HaveOccurred())
+
+			whoami := id.NewPrivKey().Signatory()
+			p := process.New(process.DefaultOptions(), whoami, 1, nil, nil, nil, nil, nil, nil, pool)
+			p.Start()
+
+			privKey := id.NewPrivKey()
+			p.Prevote(signedPrevote(privKey, 1, 0, processutil.RandomGoodValue(r)))
+			p.Prevote(signedPrevote(privKey, 1, 0, processutil.RandomGoodValue(r)))
+			pending := pool.Pending(10)
+			Expect(pending).To(HaveLen(1))
+			Expect(pending[0].Kind).To(Equal(evidence.KindDoublePrevote))
+		})
+	})
+})
+
+// failingStore is a Store that always fails to save entries.
+type failingStore struct{}
+
+func (failingStore) Append(...evidence.Entry) error {
+	return errors.New("disk is full")
+}
+
+func (failingStore) Save([]evidence.Entry) error {
+	return errors.New("disk is full")
+}
+
+func (failingStore) Load() ([]evidence.Entry, error) {
+	return nil, nil
+}
@@ -0,0 +1,146 @@
+package evidence
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/renproject/hyperdrive/internal/fileutil"
+	"github.com/renproject/surge"
+)
+
+// An Entry is Evidence in a Pool, and whether or not it has been included in a
+// committed proposal.
+type Entry struct {
+	Evidence Evidence `json:"evidence"`
+	Included bool     `json:"included"`
+}
+
+// SizeHint returns the number of bytes required to represent this Entry in
+// binary.
+func (entry Entry) SizeHint() int {
+	return surge.SizeHint(entry.Evidence) +
+		surge.SizeHint(entry.Included)
+}
+
+// Marshal this Entry into binary.
+func (entry Entry) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.Marshal(entry.Evidence, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling evidence: %v", err)
+	}
+	buf, rem, err = surge.Marshal(entry.Included, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling included=%v: %v", entry.Included, err)
+	}
+	return buf, rem, nil
+}
+
+// Unmarshal binary into this Entry.
+func (entry *Entry) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.Unmarshal(&entry.Evidence, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling evidence: %v", err)
+	}
+	buf, rem, err = surge.Unmarshal(&entry.Included, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling included: %v", err)
+	}
+	return buf, rem, nil
+}
+
+// A Store persists the entries of a Pool. Implementations must make sure that
+// the entries are durable before returning.
+type Store interface {
+	// Append the entries to the entries that have been saved. An entry
+	// replaces any entry for the same Evidence that was saved before it.
+	Append(...Entry) error
+	// Save the entries, replacing all entries that were saved before.
+	Save([]Entry) error
+	// Load the entries that have been saved, in the order in which they were
+	// saved. If no entries have been saved, then it returns no entries.
+	Load() ([]Entry, error)
+}
+
+// kindEntry is the kind of the frames written by a FileStore.
+const kindEntry = byte(0)
+
+// A FileStore is a Store that is backed by a single file. Every entry is
+// written as a length-prefixed and checksummed frame, so entries can be
+// appended cheaply, and an entry that is only partially written (because of a
+// crash) can be detected and ignored. The file is replaced atomically whenever
+// entries are saved. A FileStore is not safe for concurrent use.
+type FileStore struct {
+	path string
+}
+
+// NewFileStore returns a FileStore that saves entries to the file at the given
+// path. The file, and its parent directory, will be created if they do not
+// exist.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Append the entries to the end of the file.
+func (store *FileStore) Append(entries ...Entry) error {
+	data, err := marshalEntries(entries)
+	if err != nil {
+		return err
+	}
+	return fileutil.Append(store.path, data)
+}
+
+// Save the entries by atomically replacing the file.
+func (store *FileStore) Save(entries []Entry) error {
+	data, err := marshalEntries(entries)
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(store.path, data)
+}
+
+// Load the entries from the file. Reading stops at the first frame that is
+// incomplete or corrupt, because it can only have been caused by a crash while
+// appending.
+func (store *FileStore) Load() ([]Entry, error) {
+	data, err := ioutil.ReadFile(store.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading %v: %v", store.path, err)
+	}
+	entries := []Entry{}
+	for {
+		kind, payload, rest, ok := fileutil.ReadFrame(data)
+		if !ok {
+			break
+		}
+		data = rest
+		if kind != kindEntry {
+			return nil, fmt.Errorf("unexpected entry kind=%v", kind)
+		}
+		entry := Entry{}
+		if err := surge.FromBinary(&entry, payload); err != nil {
+			return nil, fmt.Errorf("unmarshaling entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// marshalEntries into consecutive frames.
+func marshalEntries(entries []Entry) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for _, entry := range entries {
+		data, err := surge.ToBinary(entry)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling entry: %v", err)
+		}
+		if err := fileutil.WriteFrame(buf, kindEntry, data); err != nil {
+			return nil, fmt.Errorf("writing entry: %v", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
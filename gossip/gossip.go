@@ -0,0 +1,445 @@
+// Package gossip disseminates messages between Replicas without requiring every
+// Replica to be connected to every other Replica. When a message is broadcast,
+// it is sent to a small number of peers (the fanout), and every peer that
+// receives the message for the first time relays it to other peers, until its
+// time-to-live runs out. Messages are deduplicated by their sender and the
+// content that is signed by their sender, so every message is delivered at
+// most once (as long as its hash is remembered), even if it is signed again or
+// its unsigned payload is changed. Only messages that are signed by one of the
+// signatories are delivered and relayed, so other senders cannot use the Gossip
+// layer to amplify their messages.
+//
+// Gossip alone does not guarantee that every message reaches every Replica.
+// However, every time that the same message is broadcast again, it is sent
+// directly to the next peers in a fixed order. Messages that are broadcast are
+// never dropped, so eventually every peer has been sent the message directly,
+// as long as the message is broadcast again. A Replica only does this when it
+// stalls and has a resend interval, so Replicas that use a Gossip layer must
+// be given a resend interval (see replica.Options.WithResendInterval).
+package gossip
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/id"
+	"github.com/renproject/surge"
+
+	"go.uber.org/zap"
+)
+
+// A Kind identifies the type of message in an Envelope.
+type Kind uint8
+
+// Enumerate the kinds of messages that can be gossiped.
+const (
+	KindPropose   = Kind(1)
+	KindPrevote   = Kind(2)
+	KindPrecommit = Kind(3)
+)
+
+// An Envelope wraps a marshaled message with the number of times that it can
+// still be relayed.
+type Envelope struct {
+	Kind Kind
+	TTL  uint8
+	Data []byte
+}
+
+// NewProposeEnvelope returns an Envelope that contains the Propose.
+func NewProposeEnvelope(ttl uint8, propose process.Propose) (Envelope, error) {
+	data, err := surge.ToBinary(propose)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("marshaling propose: %v", err)
+	}
+	return Envelope{Kind: KindPropose, TTL: ttl, Data: data}, nil
+}
+
+// NewPrevoteEnvelope returns an Envelope that contains the Prevote.
+func NewPrevoteEnvelope(ttl uint8, prevote process.Prevote) (Envelope, error) {
+	data, err := surge.ToBinary(prevote)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("marshaling prevote: %v", err)
+	}
+	return Envelope{Kind: KindPrevote, TTL: ttl, Data: data}, nil
+}
+
+// NewPrecommitEnvelope returns an Envelope that contains the Precommit.
+func NewPrecommitEnvelope(ttl uint8, precommit process.Precommit) (Envelope, error) {
+	data, err := surge.ToBinary(precommit)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("marshaling precommit: %v", err)
+	}
+	return Envelope{Kind: KindPrecommit, TTL: ttl, Data: data}, nil
+}
+
+// Hash of the message in the Envelope. It only covers the kind, the sender,
+// and the content that is signed by the sender, so the hash is the same no
+// matter how many times the message has been relayed, how its Signature is
+// encoded, or what payload is attached to it. If the message cannot be
+// unmarshaled, then the hash covers its data instead.
+func (envelope Envelope) Hash() id.Hash {
+	from, hash, err := envelope.signed()
+	if err != nil {
+		return id.NewHash(append([]byte{byte(envelope.Kind)}, envelope.Data...))
+	}
+	data := make([]byte, 0, 1+len(from)+len(hash))
+	data = append(data, byte(envelope.Kind))
+	data = append(data, from[:]...)
+	data = append(data, hash[:]...)
+	return id.NewHash(data)
+}
+
+// signed returns the sender of the message in the Envelope, and the hash of the
+// content that it signed.
+func (envelope Envelope) signed() (id.Signatory, id.Hash, error) {
+	switch envelope.Kind {
+	case KindPropose:
+		propose := process.Propose{}
+		if err := surge.FromBinary(&propose, envelope.Data); err != nil {
+			return id.Signatory{}, id.Hash{}, fmt.Errorf("unmarshaling propose: %v", err)
+		}
+		hash, err := process.NewProposeHash(propose.Height, propose.Round, propose.ValidRound, propose.Value)
+		return propose.From, hash, err
+	case KindPrevote:
+		prevote := process.Prevote{}
+		if err := surge.FromBinary(&prevote, envelope.Data); err != nil {
+			return id.Signatory{}, id.Hash{}, fmt.Errorf("unmarshaling prevote: %v", err)
+		}
+		hash, err := process.NewPrevoteHash(prevote.Height, prevote.Round, prevote.Value)
+		return prevote.From, hash, err
+	case KindPrecommit:
+		precommit := process.Precommit{}
+		if err := surge.FromBinary(&precommit, envelope.Data); err != nil {
+			return id.Signatory{}, id.Hash{}, fmt.Errorf("unmarshaling precommit: %v", err)
+		}
+		hash, err := process.NewPrecommitHash(precommit.Height, precommit.Round, precommit.Value)
+		return precommit.From, hash, err
+	default:
+		return id.Signatory{}, id.Hash{}, fmt.Errorf("unknown kind=%v", envelope.Kind)
+	}
+}
+
+// Equal compares two Envelopes. If they are equal, then it returns true,
+// otherwise it returns false.
+func (envelope *Envelope) Equal(other *Envelope) bool {
+	return envelope.Kind == other.Kind &&
+		envelope.TTL == other.TTL &&
+		string(envelope.Data) == string(other.Data)
+}
+
+// SizeHint returns the number of bytes required to represent this Envelope in
+// binary.
+func (envelope Envelope) SizeHint() int {
+	return surge.SizeHint(uint8(envelope.Kind)) +
+		surge.SizeHint(envelope.TTL) +
+		surge.SizeHint(envelope.Data)
+}
+
+// Marshal this Envelope into binary.
+func (envelope Envelope) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.Marshal(uint8(envelope.Kind), buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling kind=%v: %v", envelope.Kind, err)
+	}
+	buf, rem, err = surge.Marshal(envelope.TTL, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling ttl=%v: %v", envelope.TTL, err)
+	}
+	buf, rem, err = surge.Marshal(envelope.Data, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling data: %v", err)
+	}
+	return buf, rem, nil
+}
+
+// Unmarshal binary into this Envelope.
+func (envelope *Envelope) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	kind := uint8(0)
+	buf, rem, err := surge.Unmarshal(&kind, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling kind: %v", err)
+	}
+	envelope.Kind = Kind(kind)
+	buf, rem, err = surge.Unmarshal(&envelope.TTL, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling ttl: %v", err)
+	}
+	buf, rem, err = surge.Unmarshal(&envelope.Data, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling data: %v", err)
+	}
+	return buf, rem, nil
+}
+
+// A Sender sends Envelopes to specific peers. The peer that receives an
+// Envelope should pass it to the Receive method of its Gossip layer.
+type Sender interface {
+	Send(to id.Signatory, envelope Envelope)
+}
+
+// A Receiver receives the messages that are delivered by a Gossip layer. It is
+// implemented by the Replica.
+type Receiver interface {
+	Propose(context.Context, process.Propose)
+	Prevote(context.Context, process.Prevote)
+	Precommit(context.Context, process.Precommit)
+}
+
+// A Gossip layer is a Broadcaster that sends every message to a few peers, and
+// relays the messages that it receives to a few more peers. All messages that
+// are broadcast, or received for the first time, are delivered to a Receiver.
+// Received messages are only delivered and relayed if they are signed by their
+// sender, and their sender is one of the signatories.
+type Gossip struct {
+	opts        Options
+	peers       []id.Signatory
+	signatories map[id.Signatory]bool
+	sender      Sender
+	r           *rand.Rand
+
+	// seen maps the hashes of messages that have been delivered to the index
+	// of the next peer to which the message will be sent if it is broadcast
+	// again. seenOrder is a ring buffer of the same hashes in the order that
+	// they were added, so that the oldest hashes can be forgotten.
+	seen      map[id.Hash]int
+	seenOrder []id.Hash
+	seenNext  int
+
+	// broadcasts are the Envelopes that are waiting to be broadcast, and
+	// onBroadcast is signalled whenever one is added.
+	broadcastsMu sync.Mutex
+	broadcasts   []Envelope
+	onBroadcast  chan struct{}
+	onReceive    chan Envelope
+}
+
+// New returns a Gossip layer for the given identity. The peers are all of the
+// signatories to which messages can be sent using the Sender, and messages are
+// only accepted from the peers and the identity. The identity itself is not
+// sent messages, if it is one of the peers.
+func New(opts Options, whoami id.Signatory, peers []id.Signatory, sender Sender) *Gossip {
+	others := make([]id.Signatory, 0, len(peers))
+	signatories := make(map[id.Signatory]bool, len(peers)+1)
+	signatories[whoami] = true
+	for _, peer := range peers {
+		signatories[peer] = true
+		if !peer.Equal(&whoami) {
+			others = append(others, peer)
+		}
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	r.Shuffle(len(others), func(i, j int) {
+		others[i], others[j] = others[j], others[i]
+	})
+	return &Gossip{
+		opts:        opts,
+		peers:       others,
+		signatories: signatories,
+		sender:      sender,
+		r:           r,
+
+		seen:      make(map[id.Hash]int, opts.CacheCapacity),
+		seenOrder: make([]id.Hash, 0, opts.CacheCapacity),
+
+		onBroadcast: make(chan struct{}, 1),
+		onReceive:   make(chan Envelope, opts.QueueCapacity),
+	}
+}
+
+// Run the Gossip layer until the context is done. All messages that are
+// broadcast, or received for the first time, are delivered to the Receiver.
+func (g *Gossip) Run(ctx context.Context, receiver Receiver) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-g.onBroadcast:
+			g.broadcastsMu.Lock()
+			broadcasts := g.broadcasts
+			g.broadcasts = nil
+			g.broadcastsMu.Unlock()
+			for _, envelope := range broadcasts {
+				g.send(ctx, receiver, envelope)
+			}
+		case envelope := <-g.onReceive:
+			hash := envelope.Hash()
+			if _, ok := g.seen[hash]; ok {
+				continue
+			}
+			if !g.deliver(ctx, receiver, envelope) {
+				continue
+			}
+			g.remember(hash)
+			if envelope.TTL == 0 {
+				continue
+			}
+			envelope.TTL--
+			perm := g.r.Perm(len(g.peers))
+			for i := 0; i < g.opts.Fanout && i < len(perm); i++ {
+				g.sender.Send(g.peers[perm[i]], envelope)
+			}
+		}
+	}
+}
+
+// send an Envelope that is broadcast to the next peers. Messages that are
+// broadcast again are sent to the next peers, but they are only delivered
+// once.
+func (g *Gossip) send(ctx context.Context, receiver Receiver, envelope Envelope) {
+	hash := envelope.Hash()
+	if _, ok := g.seen[hash]; !ok {
+		g.remember(hash)
+		g.deliver(ctx, receiver, envelope)
+	}
+	if len(g.peers) == 0 {
+		return
+	}
+	next := g.seen[hash]
+	for i := 0; i < g.opts.Fanout && i < len(g.peers); i++ {
+		g.sender.Send(g.peers[next], envelope)
+		next = (next + 1) % len(g.peers)
+	}
+	if _, ok := g.seen[hash]; ok {
+		g.seen[hash] = next
+	}
+}
+
+// Receive an Envelope from a peer. If the message in the Envelope has not been
+// seen before, and it is signed by one of the signatories, then it will be
+// delivered and relayed.
+func (g *Gossip) Receive(ctx context.Context, envelope Envelope) {
+	select {
+	case <-ctx.Done():
+	case g.onReceive <- envelope:
+	}
+}
+
+// BroadcastPropose delivers the Propose to the Receiver, and sends it to the
+// next peers.
+func (g *Gossip) BroadcastPropose(propose process.Propose) {
+	envelope, err := NewProposeEnvelope(g.opts.TTL, propose)
+	if err != nil {
+		panic(fmt.Errorf("invariant violation: %v", err))
+	}
+	g.broadcast(envelope)
+}
+
+// BroadcastPrevote delivers the Prevote to the Receiver, and sends it to the
+// next peers.
+func (g *Gossip) BroadcastPrevote(prevote process.Prevote) {
+	envelope, err := NewPrevoteEnvelope(g.opts.TTL, prevote)
+	if err != nil {
+		panic(fmt.Errorf("invariant violation: %v", err))
+	}
+	g.broadcast(envelope)
+}
+
+// BroadcastPrecommit delivers the Precommit to the Receiver, and sends it to
+// the next peers.
+func (g *Gossip) BroadcastPrecommit(precommit process.Precommit) {
+	envelope, err := NewPrecommitEnvelope(g.opts.TTL, precommit)
+	if err != nil {
+		panic(fmt.Errorf("invariant violation: %v", err))
+	}
+	g.broadcast(envelope)
+}
+
+// broadcast the Envelope. Broadcasting never blocks, because it is called by
+// the Replica, and Envelopes are never dropped, because the Replica only
+// broadcasts a bounded number of messages in every Round.
+func (g *Gossip) broadcast(envelope Envelope) {
+	g.broadcastsMu.Lock()
+	g.broadcasts = append(g.broadcasts, envelope)
+	g.broadcastsMu.Unlock()
+
+	select {
+	case g.onBroadcast <- struct{}{}:
+	default:
+	}
+}
+
+// deliver the message in the Envelope to the Receiver. It returns false if the
+// message cannot be unmarshaled, is not from one of the signatories, or is not
+// signed by its sender.
+func (g *Gossip) deliver(ctx context.Context, receiver Receiver, envelope Envelope) bool {
+	if err := g.tryDeliver(ctx, receiver, envelope); err != nil {
+		g.opts.Logger.Debug("dropping message", zap.Uint8("kind", uint8(envelope.Kind)), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+func (g *Gossip) tryDeliver(ctx context.Context, receiver Receiver, envelope Envelope) error {
+	switch envelope.Kind {
+	case KindPropose:
+		propose := process.Propose{}
+		if err := surge.FromBinary(&propose, envelope.Data); err != nil {
+			return fmt.Errorf("unmarshaling propose: %v", err)
+		}
+		if err := g.verify(propose.From, propose.Verify); err != nil {
+			return err
+		}
+		receiver.Propose(ctx, propose)
+	case KindPrevote:
+		prevote := process.Prevote{}
+		if err := surge.FromBinary(&prevote, envelope.Data); err != nil {
+			return fmt.Errorf("unmarshaling prevote: %v", err)
+		}
+		if err := g.verify(prevote.From, prevote.Verify); err != nil {
+			return err
+		}
+		receiver.Prevote(ctx, prevote)
+	case KindPrecommit:
+		precommit := process.Precommit{}
+		if err := surge.FromBinary(&precommit, envelope.Data); err != nil {
+			return fmt.Errorf("unmarshaling precommit: %v", err)
+		}
+		if err := g.verify(precommit.From, precommit.Verify); err != nil {
+			return err
+		}
+		receiver.Precommit(ctx, precommit)
+	default:
+		return fmt.Errorf("unknown kind=%v", envelope.Kind)
+	}
+	return nil
+}
+
+// verify that the sender of a message is one of the signatories, and that the
+// message is signed by its sender.
+func (g *Gossip) verify(from id.Signatory, verify func() error) error {
+	if !g.signatories[from] {
+		return fmt.Errorf("verifying from=%v: not a signatory", from)
+	}
+	if err := verify(); err != nil {
+		return fmt.Errorf("verifying from=%v: %v", from, err)
+	}
+	return nil
+}
+
+// remember the hash, and forget the oldest hash if the cache is full. If the
+// message is broadcast, then it is first sent to a random peer, so that
+// different messages are sent to different peers.
+func (g *Gossip) remember(hash id.Hash) {
+	if _, ok := g.seen[hash]; ok || g.opts.CacheCapacity <= 0 {
+		return
+	}
+	if len(g.seenOrder) < g.opts.CacheCapacity {
+		g.seenOrder = append(g.seenOrder, hash)
+	} else {
+		delete(g.seen, g.seenOrder[g.seenNext])
+		g.seenOrder[g.seenNext] = hash
+		g.seenNext = (g.seenNext + 1) % g.opts.CacheCapacity
+	}
+	g.seen[hash] = 0
+	if len(g.peers) > 0 {
+		g.seen[hash] = g.r.Intn(len(g.peers))
+	}
+}
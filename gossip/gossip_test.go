@@ -0,0 +1,439 @@
+package gossip_test
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing/quick"
+	"time"
+
+	"github.com/renproject/hyperdrive/gossip"
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/hyperdrive/process/processutil"
+	"github.com/renproject/hyperdrive/replica"
+	"github.com/renproject/id"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// The Gossip layer must be usable as the Broadcaster of a Replica, and the
+// Replica must be usable as the Receiver of a Gossip layer.
+var (
+	_ process.Broadcaster = &gossip.Gossip{}
+	_ gossip.Receiver     = &replica.Replica{}
+)
+
+var _ = Describe("Gossip", func() {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	Context("when marshaling and unmarshaling envelopes", func() {
+		It("should equal itself", func() {
+			loop := func() bool {
+				envelope, err := gossip.NewPrevoteEnvelope(uint8(r.Intn(256)), processutil.RandomPrevote(r))
+				Expect(err).ToNot(HaveOccurred())
+				data, err := surge.ToBinary(envelope)
+				Expect(err).ToNot(HaveOccurred())
+				unmarshaled := gossip.Envelope{}
+				Expect(surge.FromBinary(&unmarshaled, data)).To(Succeed())
+				Expect(unmarshaled.Equal(&envelope)).To(BeTrue())
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+	})
+
+	Context("when hashing envelopes", func() {
+		It("should ignore the ttl", func() {
+			loop := func() bool {
+				precommit := processutil.RandomPrecommit(r)
+				envelope1, err := gossip.NewPrecommitEnvelope(0, precommit)
+				Expect(err).ToNot(HaveOccurred())
+				envelope2, err := gossip.NewPrecommitEnvelope(1+uint8(r.Intn(255)), precommit)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(envelope1.Hash()).To(Equal(envelope2.Hash()))
+
+				// the same data with a different kind is a different message
+				envelope2.Kind = gossip.KindPrevote
+				Expect(envelope1.Hash()).ToNot(Equal(envelope2.Hash()))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should ignore the signature and the payload", func() {
+			loop := func() bool {
+				propose := processutil.RandomPropose(r)
+				envelope1, err := gossip.NewProposeEnvelope(gossip.DefaultTTL, propose)
+				Expect(err).ToNot(HaveOccurred())
+
+				// a copy of the message with a different signature, or a
+				// different payload, is the same message
+				propose.Signature[0]++
+				propose.Payload = append(propose.Payload, byte(r.Int()))
+				envelope2, err := gossip.NewProposeEnvelope(gossip.DefaultTTL, propose)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(envelope1.Hash()).To(Equal(envelope2.Hash()))
+
+				// a different sender is a different message
+				propose.From = id.NewPrivKey().Signatory()
+				envelope2, err = gossip.NewProposeEnvelope(gossip.DefaultTTL, propose)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(envelope1.Hash()).ToNot(Equal(envelope2.Hash()))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+	})
+
+	Context("when broadcasting", func() {
+		It("should deliver every message at most once", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			n := 30
+			fanout := 3
+			network := newMockNetwork(ctx, n, gossip.DefaultOptions().WithFanout(fanout).WithTTL(2))
+
+			// the message might not reach everyone, but it must not be
+			// delivered more than once
+			propose := processutil.RandomPropose(r)
+			propose.From = network.signatories[0]
+			Expect(propose.Sign(network.privKeys[0])).To(Succeed())
+			network.gossips[0].BroadcastPropose(propose)
+			time.Sleep(100 * time.Millisecond)
+			for i := range network.receivers {
+				Expect(network.receivers[i].proposes()).To(BeNumerically("<=", 1))
+			}
+
+			// broadcasting the same message again reaches the next peers, so
+			// eventually everyone has received it exactly once
+			for i := 0; i < n/fanout; i++ {
+				network.gossips[0].BroadcastPropose(propose)
+			}
+			for i := range network.receivers {
+				Eventually(network.receivers[i].proposes).Should(Equal(1))
+			}
+			Consistently(func() int {
+				total := 0
+				for i := range network.receivers {
+					total += network.receivers[i].proposes()
+				}
+				return total
+			}).Should(Equal(n))
+		})
+
+		It("should not drop messages that are broadcast while it is busy", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			n := 4
+			network := newMockNetwork(ctx, n, gossip.DefaultOptions().WithQueueCapacity(1))
+
+			// every message is delivered to the broadcaster, even though
+			// there are more messages than the capacity of the queue
+			numPrevotes := 100
+			for i := 0; i < numPrevotes; i++ {
+				// every prevote is in a different round, so that no prevote
+				// is a duplicate of another
+				prevote := processutil.RandomPrevote(r)
+				prevote.Round = process.Round(i)
+				prevote.From = network.signatories[0]
+				Expect(prevote.Sign(network.privKeys[0])).To(Succeed())
+				network.gossips[0].BroadcastPrevote(prevote)
+			}
+			Eventually(network.receivers[0].prevotes).Should(Equal(numPrevotes))
+		})
+
+		It("should not relay messages once their ttl has run out", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			n := 30
+			fanout := 3
+			network := newMockNetwork(ctx, n, gossip.DefaultOptions().WithFanout(fanout).WithTTL(0))
+
+			// only the broadcaster, and the peers to which it sends the
+			// message, receive the message
+			prevote := processutil.RandomPrevote(r)
+			prevote.From = network.signatories[0]
+			Expect(prevote.Sign(network.privKeys[0])).To(Succeed())
+			network.gossips[0].BroadcastPrevote(prevote)
+			Eventually(func() int {
+				total := 0
+				for i := range network.receivers {
+					total += network.receivers[i].prevotes()
+				}
+				return total
+			}).Should(Equal(1 + fanout))
+			Consistently(func() int {
+				total := 0
+				for i := range network.receivers {
+					total += network.receivers[i].prevotes()
+				}
+				return total
+			}).Should(Equal(1 + fanout))
+		})
+	})
+
+	Context("when receiving", func() {
+		It("should only deliver and relay messages that are signed by a signatory", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			n := 4
+			network := newMockNetwork(ctx, n, gossip.DefaultOptions().WithFanout(n))
+			total := func() int {
+				total := 0
+				for i := range network.receivers {
+					total += network.receivers[i].precommits()
+				}
+				return total
+			}
+
+			// a message that is not signed by its sender
+			precommit := processutil.RandomPrecommit(r)
+			precommit.From = network.signatories[1]
+			envelope, err := gossip.NewPrecommitEnvelope(gossip.DefaultTTL, precommit)
+			Expect(err).ToNot(HaveOccurred())
+			network.gossips[0].Receive(ctx, envelope)
+
+			// a message that is signed by someone that is not a signatory
+			privKey := id.NewPrivKey()
+			precommit = processutil.RandomPrecommit(r)
+			precommit.From = privKey.Signatory()
+			Expect(precommit.Sign(privKey)).To(Succeed())
+			envelope, err = gossip.NewPrecommitEnvelope(gossip.DefaultTTL, precommit)
+			Expect(err).ToNot(HaveOccurred())
+			network.gossips[0].Receive(ctx, envelope)
+			Consistently(total).Should(Equal(0))
+
+			// a message that is signed by a signatory
+			precommit = processutil.RandomPrecommit(r)
+			precommit.From = network.signatories[1]
+			Expect(precommit.Sign(network.privKeys[1])).To(Succeed())
+			envelope, err = gossip.NewPrecommitEnvelope(gossip.DefaultTTL, precommit)
+			Expect(err).ToNot(HaveOccurred())
+			network.gossips[0].Receive(ctx, envelope)
+			Eventually(total).Should(Equal(n))
+
+			// a copy of the message that is signed again, or that has a
+			// different ttl, is not delivered or relayed again
+			Expect(precommit.Sign(network.privKeys[1])).To(Succeed())
+			envelope, err = gossip.NewPrecommitEnvelope(gossip.DefaultTTL-1, precommit)
+			Expect(err).ToNot(HaveOccurred())
+			network.gossips[0].Receive(ctx, envelope)
+			Consistently(total).Should(Equal(n))
+		})
+	})
+
+	Context("when replicas use gossip", func() {
+		It("should reach consensus", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			f := 2
+			n := 3*f + 1
+			targetHeight := process.Height(5)
+
+			privKeys := make([]*id.PrivKey, n)
+			signatories := make([]id.Signatory, n)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every replica sends this signal when they reach the target
+			// consensus height
+			completionSignal := make(chan bool, n)
+
+			// every replica only sends messages to two other replicas, so
+			// messages must be relayed to reach everyone
+			replicas := make([]*replica.Replica, n)
+			gossips := make([]*gossip.Gossip, n)
+			for i := range replicas {
+				replicaIndex := i
+				sender := mockSender(func(to id.Signatory, envelope gossip.Envelope) {
+					for j := range signatories {
+						if signatories[j].Equal(&to) {
+							go gossips[j].Receive(ctx, envelope)
+						}
+					}
+				})
+				gossips[i] = gossip.New(gossip.DefaultOptions().WithFanout(2).WithTTL(2), signatories[i], signatories, sender)
+
+				// replicas that fall behind, because messages did not reach
+				// them before the others moved on, catch up by syncing
+				syncer := mockSyncer{
+					requestSync: func(from process.Height) {
+						for j := range replicas {
+							if j != replicaIndex {
+								go replicas[j].SyncRequest(ctx, signatories[replicaIndex], from)
+							}
+						}
+					},
+					sync: func(to id.Signatory, certs []process.CommitCertificate) {
+						for j := range replicas {
+							if signatories[j].Equal(&to) {
+								for _, cert := range certs {
+									go replicas[j].SyncCommitCertificate(ctx, cert)
+								}
+							}
+						}
+					},
+				}
+
+				replicas[i] = replica.New(
+					replica.DefaultOptions().
+						WithPrivKey(privKeys[i]).
+						WithResendInterval(100*time.Millisecond).
+						WithSyncer(syncer).
+						WithSyncInterval(100*time.Millisecond),
+					signatories[i],
+					signatories,
+					// Proposer
+					processutil.MockProposer{
+						MockValue: func() process.Value {
+							return process.Value(id.NewHash([]byte(time.Now().String())))
+						},
+					},
+					// Validator
+					processutil.MockValidator{
+						MockValid: func(process.Value) bool {
+							return true
+						},
+					},
+					// Committer
+					processutil.CommitterCallback{
+						Callback: func(height process.Height, value process.Value) {
+							if height == targetHeight {
+								completionSignal <- true
+							}
+						},
+					},
+					// Catcher
+					nil,
+					// Broadcaster
+					gossips[i],
+					// Flusher
+					nil,
+				)
+			}
+			for i := range replicas {
+				go gossips[i].Run(ctx, replicas[i])
+				go replicas[i].Run(ctx)
+			}
+
+			for i := 0; i < n; i++ {
+				select {
+				case <-completionSignal:
+				case <-time.After(30 * time.Second):
+					Fail("failed to reach consensus")
+				}
+			}
+		})
+	})
+})
+
+// A mockNetwork connects Gossip layers to each other, and delivers their
+// messages to mock Receivers.
+type mockNetwork struct {
+	privKeys    []*id.PrivKey
+	signatories []id.Signatory
+	gossips     []*gossip.Gossip
+	receivers   []*mockReceiver
+}
+
+func newMockNetwork(ctx context.Context, n int, opts gossip.Options) mockNetwork {
+	privKeys := make([]*id.PrivKey, n)
+	signatories := make([]id.Signatory, n)
+	for i := range signatories {
+		privKeys[i] = id.NewPrivKey()
+		signatories[i] = privKeys[i].Signatory()
+	}
+	network := mockNetwork{
+		privKeys:    privKeys,
+		signatories: signatories,
+		gossips:     make([]*gossip.Gossip, n),
+		receivers:   make([]*mockReceiver, n),
+	}
+	sender := mockSender(func(to id.Signatory, envelope gossip.Envelope) {
+		for i := range signatories {
+			if signatories[i].Equal(&to) {
+				go network.gossips[i].Receive(ctx, envelope)
+			}
+		}
+	})
+	for i := range network.gossips {
+		network.gossips[i] = gossip.New(opts, signatories[i], signatories, sender)
+		network.receivers[i] = new(mockReceiver)
+	}
+	for i := range network.gossips {
+		go network.gossips[i].Run(ctx, network.receivers[i])
+	}
+	return network
+}
+
+type mockSender func(id.Signatory, gossip.Envelope)
+
+func (sender mockSender) Send(to id.Signatory, envelope gossip.Envelope) {
+	sender(to, envelope)
+}
+
+// A mockReceiver counts the messages that it receives.
+type mockReceiver struct {
+	mu            sync.Mutex
+	numProposes   int
+	numPrevotes   int
+	numPrecommits int
+}
+
+func (receiver *mockReceiver) Propose(ctx context.Context, propose process.Propose) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	receiver.numProposes++
+}
+
+func (receiver *mockReceiver) Prevote(ctx context.Context, prevote process.Prevote) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	receiver.numPrevotes++
+}
+
+func (receiver *mockReceiver) Precommit(ctx context.Context, precommit process.Precommit) {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	receiver.numPrecommits++
+}
+
+func (receiver *mockReceiver) proposes() int {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	return receiver.numProposes
+}
+
+func (receiver *mockReceiver) prevotes() int {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	return receiver.numPrevotes
+}
+
+func (receiver *mockReceiver) precommits() int {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	return receiver.numPrecommits
+}
+
+type mockSyncer struct {
+	requestSync func(process.Height)
+	sync        func(id.Signatory, []process.CommitCertificate)
+}
+
+func (syncer mockSyncer) RequestSync(from process.Height) {
+	syncer.requestSync(from)
+}
+
+func (syncer mockSyncer) Sync(to id.Signatory, certs []process.CommitCertificate) {
+	syncer.sync(to, certs)
+}
@@ -0,0 +1,85 @@
+package gossip
+
+import (
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultFanout is the number of peers to which every message is sent set
+	// by default
+	DefaultFanout = 4
+
+	// DefaultTTL is the number of times that a message can be relayed set by
+	// default
+	DefaultTTL = 3
+
+	// DefaultCacheCapacity is the number of message hashes that are
+	// remembered for deduplication set by default
+	DefaultCacheCapacity = 10000
+
+	// DefaultQueueCapacity is the number of received messages that can be
+	// waiting to be delivered set by default
+	DefaultQueueCapacity = 1000
+)
+
+// Options represent the options for a Gossip layer
+type Options struct {
+	Logger        *zap.Logger
+	Fanout        int
+	TTL           uint8
+	CacheCapacity int
+	QueueCapacity int
+}
+
+// DefaultOptions returns the default options for a Gossip layer
+func DefaultOptions() Options {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		panic(err)
+	}
+	return Options{
+		Logger:        logger,
+		Fanout:        DefaultFanout,
+		TTL:           DefaultTTL,
+		CacheCapacity: DefaultCacheCapacity,
+		QueueCapacity: DefaultQueueCapacity,
+	}
+}
+
+// WithLogger updates the logger used in the Gossip layer. Messages that are
+// dropped, because they are invalid, are logged at the debug level.
+func (opts Options) WithLogger(logger *zap.Logger) Options {
+	opts.Logger = logger
+	return opts
+}
+
+// WithFanout updates the number of peers to which every message is sent, when
+// it is broadcast or relayed
+func (opts Options) WithFanout(fanout int) Options {
+	opts.Fanout = fanout
+	return opts
+}
+
+// WithTTL updates the number of times that a message can be relayed after it
+// has been broadcast
+func (opts Options) WithTTL(ttl uint8) Options {
+	opts.TTL = ttl
+	return opts
+}
+
+// WithCacheCapacity updates the number of message hashes that are remembered
+// for deduplication. Once the capacity is reached, the oldest hashes are
+// forgotten, and messages with those hashes are delivered and relayed again if
+// they are received again.
+func (opts Options) WithCacheCapacity(capacity int) Options {
+	opts.CacheCapacity = capacity
+	return opts
+}
+
+// WithQueueCapacity updates the number of received messages that can be
+// waiting to be delivered. Once the queue is full, receiving blocks until there
+// is space in the queue, or the context is done.
+func (opts Options) WithQueueCapacity(capacity int) Options {
+	opts.QueueCapacity = capacity
+	return opts
+}
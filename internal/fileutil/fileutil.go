@@ -0,0 +1,116 @@
+// Package fileutil implements the durable file operations that are shared by
+// the write-ahead log and the evidence store. Entries are written as frames
+// that are length-prefixed and checksummed, so that a frame that is only
+// partially written (because of a crash) can be detected and ignored.
+package fileutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FrameHeaderSize is the number of bytes written before the kind and payload
+// of every frame.
+const FrameHeaderSize = 8
+
+// WriteFrame writes the length of the payload (including the kind), a checksum
+// of the payload, the kind, and the payload.
+func WriteFrame(w io.Writer, kind byte, data []byte) error {
+	payload := append([]byte{kind}, data...)
+
+	header := [FrameHeaderSize]byte{}
+	binary.BigEndian.PutUint32(header[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// ReadFrame reads the next frame from the data, and returns its kind, its
+// payload (without the kind), and the remaining data. If there is no complete
+// and valid frame, then it returns false.
+func ReadFrame(data []byte) (byte, []byte, []byte, bool) {
+	if len(data) < FrameHeaderSize {
+		return 0, nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(data[:4])
+	checksum := binary.BigEndian.Uint32(data[4:FrameHeaderSize])
+	data = data[FrameHeaderSize:]
+	if n == 0 || uint64(len(data)) < uint64(n) {
+		return 0, nil, nil, false
+	}
+	payload := data[:n]
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return 0, nil, nil, false
+	}
+	return payload[0], payload[1:], data[n:], true
+}
+
+// WriteAtomic replaces the file at the path with the data, by writing the data
+// to a temporary file, syncing it, renaming it, and syncing the parent
+// directory, so that the rename is durable. The parent directory is created if
+// it does not exist.
+func WriteAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating directory: %v", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := writeSync(tmpPath, data, os.O_TRUNC); err != nil {
+		return fmt.Errorf("writing %v: %v", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("renaming %v: %v", tmpPath, err)
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("syncing directory: %v", err)
+	}
+	return nil
+}
+
+// Append the data to the end of the file at the path, and sync it. The file,
+// and its parent directory, are created if they do not exist.
+func Append(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("creating directory: %v", err)
+	}
+	if err := writeSync(path, data, os.O_APPEND); err != nil {
+		return fmt.Errorf("appending to %v: %v", path, err)
+	}
+	return nil
+}
+
+func writeSync(path string, data []byte, flag int) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir syncs the directory at the path, so that the files that have been
+// created in it, or renamed into it, are durable.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	if err := dir.Sync(); err != nil {
+		dir.Close()
+		return err
+	}
+	return dir.Close()
+}
@@ -0,0 +1,13 @@
+package fileutil_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestFileUtil(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "File Util Suite")
+}
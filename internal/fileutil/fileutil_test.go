@@ -0,0 +1,67 @@
+package fileutil_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/renproject/hyperdrive/internal/fileutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("File util", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "hyperdrive-fileutil")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Context("when reading frames", func() {
+		It("should read the frames that were written, and stop at a partial frame", func() {
+			buf := new(bytes.Buffer)
+			Expect(fileutil.WriteFrame(buf, 1, []byte("first"))).To(Succeed())
+			Expect(fileutil.WriteFrame(buf, 2, []byte("second"))).To(Succeed())
+			data := buf.Bytes()
+			data = data[:len(data)-1]
+
+			kind, payload, rest, ok := fileutil.ReadFrame(data)
+			Expect(ok).To(BeTrue())
+			Expect(kind).To(Equal(byte(1)))
+			Expect(payload).To(Equal([]byte("first")))
+			_, _, _, ok = fileutil.ReadFrame(rest)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should not read a corrupt frame", func() {
+			buf := new(bytes.Buffer)
+			Expect(fileutil.WriteFrame(buf, 1, []byte("first"))).To(Succeed())
+			data := buf.Bytes()
+			data[len(data)-1]++
+			_, _, _, ok := fileutil.ReadFrame(data)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("when writing files", func() {
+		It("should append to, and atomically replace, the file", func() {
+			path := filepath.Join(dir, "nested", "file")
+			Expect(fileutil.Append(path, []byte("a"))).To(Succeed())
+			Expect(fileutil.Append(path, []byte("b"))).To(Succeed())
+			Expect(ioutil.ReadFile(path)).To(Equal([]byte("ab")))
+
+			Expect(fileutil.WriteAtomic(path, []byte("c"))).To(Succeed())
+			Expect(ioutil.ReadFile(path)).To(Equal([]byte("c")))
+			_, err := os.Stat(path + ".tmp")
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,458 @@
+// Package metrics implements the counters, gauges, and histograms that are
+// used to monitor Hyperdrive. Metrics are kept in a Registry, which exports
+// them in the Prometheus text format, and can be served over HTTP so that
+// they can be scraped by Prometheus.
+//
+// Only the subset of the Prometheus data model that Hyperdrive needs is
+// implemented: metrics with at most one label, and the text exposition format
+// (version 0.0.4). This is deliberately done without the Prometheus client
+// library, so that using Hyperdrive does not pull the client library, and its
+// dependencies (protobuf, and the Prometheus common and procfs packages), into
+// every application that embeds a Replica. The text format is small and
+// stable, so writing it directly costs less than the dependency, and names and
+// labels are validated when metrics are registered, so that the output can
+// always be parsed by Prometheus. Applications that already use the client
+// library can serve a Registry next to their own metrics, or scrape it from a
+// separate endpoint.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of histogram
+// buckets that are suitable for the durations of steps and commits.
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// A Registry keeps metrics, and exports them in the Prometheus text format. It
+// implements the http.Handler interface, so it can be served directly to
+// Prometheus. A Registry is safe for concurrent use.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}}
+}
+
+// NewCounter registers, and returns, a new Counter. It panics if a metric with
+// the same name has already been registered, or if the name is invalid.
+func (reg *Registry) NewCounter(name, help string) *Counter {
+	counter := &Counter{}
+	reg.register(name, help, "counter", func() []sample {
+		return []sample{{value: counter.Value()}}
+	})
+	return counter
+}
+
+// NewCounterVec registers, and returns, a new CounterVec with the given label.
+// It panics if a metric with the same name has already been registered, or if
+// the name or label is invalid.
+func (reg *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	mustBeLabel(label)
+	vec := &CounterVec{}
+	reg.register(name, help, "counter", func() []sample {
+		samples := []sample{}
+		vec.each(func(value string, child interface{}) {
+			samples = append(samples, sample{labels: labelPair(label, value), value: child.(*Counter).Value()})
+		})
+		return samples
+	})
+	return vec
+}
+
+// NewGauge registers, and returns, a new Gauge. It panics if a metric with the
+// same name has already been registered, or if the name is invalid.
+func (reg *Registry) NewGauge(name, help string) *Gauge {
+	gauge := &Gauge{}
+	reg.register(name, help, "gauge", func() []sample {
+		return []sample{{value: gauge.Value()}}
+	})
+	return gauge
+}
+
+// NewGaugeVec registers, and returns, a new GaugeVec with the given label. It
+// panics if a metric with the same name has already been registered, or if the
+// name or label is invalid.
+func (reg *Registry) NewGaugeVec(name, help, label string) *GaugeVec {
+	mustBeLabel(label)
+	vec := &GaugeVec{}
+	reg.register(name, help, "gauge", func() []sample {
+		samples := []sample{}
+		vec.each(func(value string, child interface{}) {
+			samples = append(samples, sample{labels: labelPair(label, value), value: child.(*Gauge).Value()})
+		})
+		return samples
+	})
+	return vec
+}
+
+// NewHistogram registers, and returns, a new Histogram with the given bucket
+// upper bounds, which must be sorted in increasing order. It panics if a
+// metric with the same name has already been registered, or if the name is
+// invalid.
+func (reg *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	histogram := newHistogram(buckets)
+	reg.register(name, help, "histogram", func() []sample {
+		return histogram.samples("")
+	})
+	return histogram
+}
+
+// NewHistogramVec registers, and returns, a new HistogramVec with the given
+// label and bucket upper bounds. It panics if a metric with the same name has
+// already been registered, or if the name or label is invalid. The label
+// cannot be "le", because it is used for the buckets.
+func (reg *Registry) NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	mustBeLabel(label)
+	if label == "le" {
+		panic(fmt.Errorf("registering metric: invalid label %q", label))
+	}
+	vec := &HistogramVec{buckets: buckets}
+	reg.register(name, help, "histogram", func() []sample {
+		samples := []sample{}
+		vec.each(func(value string, child interface{}) {
+			samples = append(samples, child.(*Histogram).samples(labelPair(label, value))...)
+		})
+		return samples
+	})
+	return vec
+}
+
+// WriteTo writes all metrics to the writer in the Prometheus text format.
+// Metrics are sorted by name, and their children by label value, so that the
+// output is deterministic.
+func (reg *Registry) WriteTo(w io.Writer) (int64, error) {
+	reg.mu.Lock()
+	names := make([]string, 0, len(reg.metrics))
+	for name := range reg.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		metrics = append(metrics, reg.metrics[name])
+	}
+	reg.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, metric := range metrics {
+		fmt.Fprintf(cw, "# HELP %v %v\n", metric.name, escapeHelp(metric.help))
+		fmt.Fprintf(cw, "# TYPE %v %v\n", metric.name, metric.kind)
+		for _, sample := range metric.collect() {
+			fmt.Fprintf(cw, "%v%v", metric.name, sample.suffix)
+			if sample.labels != "" {
+				fmt.Fprintf(cw, "{%v}", sample.labels)
+			}
+			fmt.Fprintf(cw, " %v\n", formatFloat(sample.value))
+		}
+	}
+	if err := cw.w.Flush(); err != nil {
+		return cw.n, fmt.Errorf("writing metrics: %v", err)
+	}
+	return cw.n, nil
+}
+
+// ServeHTTP writes all metrics to the response in the Prometheus text format.
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	reg.WriteTo(w)
+}
+
+func (reg *Registry) register(name, help, kind string, collect func() []sample) {
+	if !metricName.MatchString(name) {
+		panic(fmt.Errorf("registering metric: invalid name %q", name))
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, ok := reg.metrics[name]; ok {
+		panic(fmt.Errorf("registering metric: %v already registered", name))
+	}
+	reg.metrics[name] = metric{name: name, help: help, kind: kind, collect: collect}
+}
+
+// A Counter is a metric that can only increase. It is safe for concurrent use.
+type Counter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+// Inc increments the Counter by one.
+func (counter *Counter) Inc() {
+	counter.Add(1)
+}
+
+// Add a non-negative delta to the Counter. Negative deltas are ignored.
+func (counter *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	counter.value += delta
+}
+
+// Value returns the current value of the Counter.
+func (counter *Counter) Value() float64 {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	return counter.value
+}
+
+// A CounterVec is a set of Counters that are distinguished by the value of a
+// label. It is safe for concurrent use.
+type CounterVec struct {
+	children
+}
+
+// With returns the Counter for the label value, creating it if it does not
+// exist.
+func (vec *CounterVec) With(value string) *Counter {
+	return vec.get(value, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+// A Gauge is a metric that can increase and decrease. It is safe for
+// concurrent use.
+type Gauge struct {
+	mu    sync.Mutex
+	value float64
+}
+
+// Set the Gauge to the value.
+func (gauge *Gauge) Set(value float64) {
+	gauge.mu.Lock()
+	defer gauge.mu.Unlock()
+	gauge.value = value
+}
+
+// Add a delta, which can be negative, to the Gauge.
+func (gauge *Gauge) Add(delta float64) {
+	gauge.mu.Lock()
+	defer gauge.mu.Unlock()
+	gauge.value += delta
+}
+
+// Value returns the current value of the Gauge.
+func (gauge *Gauge) Value() float64 {
+	gauge.mu.Lock()
+	defer gauge.mu.Unlock()
+	return gauge.value
+}
+
+// A GaugeVec is a set of Gauges that are distinguished by the value of a
+// label. It is safe for concurrent use.
+type GaugeVec struct {
+	children
+}
+
+// With returns the Gauge for the label value, creating it if it does not
+// exist.
+func (vec *GaugeVec) With(value string) *Gauge {
+	return vec.get(value, func() interface{} { return &Gauge{} }).(*Gauge)
+}
+
+// Delete the Gauge for the label value, so that it is no longer exported.
+func (vec *GaugeVec) Delete(value string) {
+	vec.delete(value)
+}
+
+// A Histogram counts observations in buckets, and keeps their sum. It is safe
+// for concurrent use.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// Observe a value.
+func (histogram *Histogram) Observe(value float64) {
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+	for i, bound := range histogram.buckets {
+		if value <= bound {
+			histogram.counts[i]++
+		}
+	}
+	histogram.count++
+	histogram.sum += value
+}
+
+// Count returns the number of observations.
+func (histogram *Histogram) Count() uint64 {
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+	return histogram.count
+}
+
+// Sum returns the sum of all observations.
+func (histogram *Histogram) Sum() float64 {
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+	return histogram.sum
+}
+
+// samples returns the cumulative buckets, sum, and count of the Histogram,
+// with the labels prepended to their own labels.
+func (histogram *Histogram) samples(labels string) []sample {
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+
+	prefix := labels
+	if prefix != "" {
+		prefix += ","
+	}
+	samples := make([]sample, 0, len(histogram.buckets)+3)
+	for i, bound := range histogram.buckets {
+		samples = append(samples, sample{suffix: "_bucket", labels: prefix + labelPair("le", formatFloat(bound)), value: float64(histogram.counts[i])})
+	}
+	samples = append(samples,
+		sample{suffix: "_bucket", labels: prefix + labelPair("le", "+Inf"), value: float64(histogram.count)},
+		sample{suffix: "_sum", labels: labels, value: histogram.sum},
+		sample{suffix: "_count", labels: labels, value: float64(histogram.count)},
+	)
+	return samples
+}
+
+// A HistogramVec is a set of Histograms that are distinguished by the value of
+// a label. It is safe for concurrent use.
+type HistogramVec struct {
+	children
+	buckets []float64
+}
+
+// With returns the Histogram for the label value, creating it if it does not
+// exist.
+func (vec *HistogramVec) With(value string) *Histogram {
+	return vec.get(value, func() interface{} { return newHistogram(vec.buckets) }).(*Histogram)
+}
+
+// children are the metrics of a CounterVec, GaugeVec, or HistogramVec, keyed
+// by the value of their label. It is safe for concurrent use.
+type children struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+// get the child for the label value, creating it if it does not exist.
+func (c *children) get(value string, newChild func() interface{}) interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = map[string]interface{}{}
+	}
+	child, ok := c.values[value]
+	if !ok {
+		child = newChild()
+		c.values[value] = child
+	}
+	return child
+}
+
+// delete the child for the label value.
+func (c *children) delete(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values, value)
+}
+
+// each calls the function for every child, in order of label value.
+func (c *children) each(f func(value string, child interface{})) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	values := make([]string, 0, len(c.values))
+	for value := range c.values {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	for _, value := range values {
+		f(value, c.values[value])
+	}
+}
+
+// A metric in a Registry.
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	collect func() []sample
+}
+
+// A sample is one line of a metric in the Prometheus text format.
+type sample struct {
+	suffix string
+	labels string
+	value  float64
+}
+
+// countingWriter counts the bytes that are written, so that WriteTo can
+// return the number of bytes that it has written.
+type countingWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(data []byte) (int, error) {
+	n, err := cw.w.Write(data)
+	cw.n += int64(n)
+	return n, err
+}
+
+// metricName and labelName match the names that are allowed by the Prometheus
+// data model. Label names that begin with two underscores are reserved.
+var (
+	metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelName  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+func mustBeLabel(label string) {
+	if !labelName.MatchString(label) || strings.HasPrefix(label, "__") {
+		panic(fmt.Errorf("registering metric: invalid label %q", label))
+	}
+}
+
+func labelPair(label, value string) string {
+	return fmt.Sprintf("%v=\"%v\"", label, escapeLabel(value))
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,300 @@
+package metrics_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/renproject/hyperdrive/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// The grammar of the lines in the text exposition format, version 0.0.4.
+var (
+	commentLine = regexp.MustCompile(`^# (HELP|TYPE) ([a-zA-Z_:][a-zA-Z0-9_:]*) (.*)$`)
+	sampleLine  = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{(.*)\})? (\S+)$`)
+	labelPair   = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)="((?:[^"\\\n]|\\[\\"n])*)"(,|$)`)
+)
+
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// expectExposition expects the text to follow the text exposition format: each
+// metric has exactly one HELP, and one TYPE, line before its samples, the
+// samples belong to the metric, and the metrics are sorted by name. It returns
+// the samples, grouped by metric name.
+func expectExposition(text string) map[string][]sample {
+	Expect(text).To(HaveSuffix("\n"))
+	families := map[string][]sample{}
+	names := []string{}
+	help, kind := "", ""
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if match := commentLine.FindStringSubmatch(line); match != nil {
+			switch match[1] {
+			case "HELP":
+				Expect(families).ToNot(HaveKey(match[2]), line)
+				Expect(match[3]).To(MatchRegexp(`^([^\\\n]|\\[\\n])*$`), line)
+				names = append(names, match[2])
+				families[match[2]] = []sample{}
+				help, kind = match[2], ""
+			case "TYPE":
+				Expect(match[2]).To(Equal(help), line)
+				Expect(kind).To(BeEmpty(), line)
+				Expect(match[3]).To(BeElementOf("counter", "gauge", "histogram"), line)
+				kind = match[3]
+			}
+			continue
+		}
+
+		match := sampleLine.FindStringSubmatch(line)
+		Expect(match).ToNot(BeNil(), line)
+		Expect(kind).ToNot(BeEmpty(), line)
+		switch kind {
+		case "histogram":
+			Expect(match[1]).To(BeElementOf(help+"_bucket", help+"_sum", help+"_count"), line)
+		default:
+			Expect(match[1]).To(Equal(help), line)
+		}
+		labels := map[string]string{}
+		for rest := match[3]; rest != ""; {
+			pair := labelPair.FindStringSubmatch(rest)
+			Expect(pair).ToNot(BeNil(), line)
+			Expect(labels).ToNot(HaveKey(pair[1]), line)
+			labels[pair[1]] = pair[2]
+			rest = rest[len(pair[0]):]
+		}
+		value, err := strconv.ParseFloat(match[4], 64)
+		Expect(err).ToNot(HaveOccurred(), line)
+		families[help] = append(families[help], sample{name: match[1], labels: labels, value: value})
+	}
+	Expect(names).To(BeSortedStrings())
+	return families
+}
+
+// BeSortedStrings succeeds if the actual strings are in increasing order.
+func BeSortedStrings() OmegaMatcher {
+	return WithTransform(func(names []string) bool {
+		for i := 1; i < len(names); i++ {
+			if names[i-1] >= names[i] {
+				return false
+			}
+		}
+		return true
+	}, BeTrue())
+}
+
+var _ = Describe("Metrics", func() {
+	Context("when writing metrics", func() {
+		It("should write them in the prometheus text format", func() {
+			reg := metrics.NewRegistry()
+			counter := reg.NewCounter("test_counter_total", "A counter.")
+			gauges := reg.NewGaugeVec("test_gauge", "A gauge\nwith a label.", "name")
+			histogram := reg.NewHistogram("test_histogram", "A histogram.", []float64{1, 2})
+
+			counter.Inc()
+			counter.Add(2)
+			counter.Add(-1)
+			gauges.With("b").Set(2)
+			gauges.With(`a"\`).Add(-1.5)
+			gauges.With("c").Set(3)
+			gauges.Delete("c")
+			histogram.Observe(0.5)
+			histogram.Observe(1.5)
+			histogram.Observe(10)
+
+			buf := new(bytes.Buffer)
+			n, err := reg.WriteTo(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(int64(buf.Len())))
+			Expect(buf.String()).To(Equal(strings.Join([]string{
+				"# HELP test_counter_total A counter.",
+				"# TYPE test_counter_total counter",
+				"test_counter_total 3",
+				`# HELP test_gauge A gauge\nwith a label.`,
+				"# TYPE test_gauge gauge",
+				`test_gauge{name="a\"\\"} -1.5`,
+				`test_gauge{name="b"} 2`,
+				"# HELP test_histogram A histogram.",
+				"# TYPE test_histogram histogram",
+				`test_histogram_bucket{le="1"} 1`,
+				`test_histogram_bucket{le="2"} 2`,
+				`test_histogram_bucket{le="+Inf"} 3`,
+				"test_histogram_sum 12",
+				"test_histogram_count 3",
+				"",
+			}, "\n")))
+		})
+
+		It("should write labelled histograms", func() {
+			reg := metrics.NewRegistry()
+			histograms := reg.NewHistogramVec("test_duration_seconds", "A histogram.", "step", []float64{0.5})
+			histograms.With("propose").Observe(0.25)
+
+			buf := new(bytes.Buffer)
+			_, err := reg.WriteTo(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.String()).To(ContainSubstring(`test_duration_seconds_bucket{step="propose",le="0.5"} 1` + "\n"))
+			Expect(buf.String()).To(ContainSubstring(`test_duration_seconds_bucket{step="propose",le="+Inf"} 1` + "\n"))
+			Expect(buf.String()).To(ContainSubstring(`test_duration_seconds_sum{step="propose"} 0.25` + "\n"))
+			Expect(buf.String()).To(ContainSubstring(`test_duration_seconds_count{step="propose"} 1` + "\n"))
+		})
+	})
+
+	Context("when checking the exposition format", func() {
+		It("should write lines that follow its grammar", func() {
+			reg := metrics.NewRegistry()
+			reg.NewCounter("test_b_total", `A counter with a \ backslash.`).Add(1e21)
+			gauges := reg.NewGaugeVec("test_a", "A gauge\nwith \"quotes\".", "name")
+			histograms := reg.NewHistogramVec("test_c_seconds", "A histogram.", "step", []float64{0.001, 0.1, 1})
+
+			gauges.With("z").Set(1e-9)
+			gauges.With("a\nb").Set(-2)
+			gauges.With(`"\"`).Set(0)
+			gauges.With("").Set(0.5)
+			histograms.With("b").Observe(0.0001)
+			histograms.With("a").Observe(0.05)
+			histograms.With("a").Observe(5)
+
+			buf := new(bytes.Buffer)
+			_, err := reg.WriteTo(buf)
+			Expect(err).ToNot(HaveOccurred())
+			families := expectExposition(buf.String())
+			Expect(families).To(HaveLen(3))
+
+			// Children are sorted by label value, and label values are
+			// escaped.
+			values := []string{}
+			for _, sample := range families["test_a"] {
+				values = append(values, sample.labels["name"])
+			}
+			Expect(values).To(Equal([]string{``, `\"\\\"`, `a\nb`, `z`}))
+			Expect(families["test_a"][3].value).To(Equal(1e-9))
+			Expect(families["test_b_total"][0].value).To(Equal(1e21))
+		})
+
+		It("should write cumulative histogram buckets that end with +Inf", func() {
+			reg := metrics.NewRegistry()
+			histograms := reg.NewHistogramVec("test_seconds", "A histogram.", "step", []float64{0.5, 1, 2})
+			for _, value := range []float64{0.1, 0.5, 0.7, 1.5, 3, 100} {
+				histograms.With("a").Observe(value)
+			}
+			histograms.With("b").Observe(0.1)
+
+			buf := new(bytes.Buffer)
+			_, err := reg.WriteTo(buf)
+			Expect(err).ToNot(HaveOccurred())
+			samples := expectExposition(buf.String())["test_seconds"]
+
+			for _, step := range []string{"a", "b"} {
+				bounds, counts := []string{}, []float64{}
+				sum, count := math.NaN(), math.NaN()
+				for _, sample := range samples {
+					if sample.labels["step"] != step {
+						continue
+					}
+					switch sample.name {
+					case "test_seconds_bucket":
+						Expect(math.IsNaN(count)).To(BeTrue())
+						bounds = append(bounds, sample.labels["le"])
+						counts = append(counts, sample.value)
+					case "test_seconds_sum":
+						sum = sample.value
+					case "test_seconds_count":
+						count = sample.value
+					}
+				}
+				Expect(bounds).To(Equal([]string{"0.5", "1", "2", "+Inf"}))
+				for i := 1; i < len(counts); i++ {
+					Expect(counts[i]).To(BeNumerically(">=", counts[i-1]))
+				}
+				Expect(counts[len(counts)-1]).To(Equal(count))
+				if step == "a" {
+					Expect(counts).To(Equal([]float64{2, 3, 4, 6}))
+					Expect(sum).To(BeNumerically("~", 105.8))
+				} else {
+					Expect(counts).To(Equal([]float64{1, 1, 1, 1}))
+					Expect(sum).To(Equal(0.1))
+				}
+			}
+		})
+
+		It("should write special values as +Inf, -Inf, and NaN", func() {
+			reg := metrics.NewRegistry()
+			gauges := reg.NewGaugeVec("test_gauge", "A gauge.", "name")
+			gauges.With("a").Set(math.Inf(1))
+			gauges.With("b").Set(math.Inf(-1))
+			gauges.With("c").Set(math.NaN())
+
+			buf := new(bytes.Buffer)
+			_, err := reg.WriteTo(buf)
+			Expect(err).ToNot(HaveOccurred())
+			expectExposition(buf.String())
+			Expect(buf.String()).To(ContainSubstring(`test_gauge{name="a"} +Inf` + "\n"))
+			Expect(buf.String()).To(ContainSubstring(`test_gauge{name="b"} -Inf` + "\n"))
+			Expect(buf.String()).To(ContainSubstring(`test_gauge{name="c"} NaN` + "\n"))
+		})
+
+		It("should write nothing, but the HELP and TYPE lines, for empty vectors", func() {
+			reg := metrics.NewRegistry()
+			reg.NewCounterVec("test_total", "A counter.", "kind")
+
+			buf := new(bytes.Buffer)
+			_, err := reg.WriteTo(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(expectExposition(buf.String())["test_total"]).To(BeEmpty())
+		})
+	})
+
+	Context("when registering a metric with an invalid name or label", func() {
+		It("should panic", func() {
+			reg := metrics.NewRegistry()
+			Expect(func() { reg.NewCounter("0_total", "A counter.") }).To(Panic())
+			Expect(func() { reg.NewGauge("test-gauge", "A gauge.") }).To(Panic())
+			Expect(func() { reg.NewGaugeVec("test_gauge", "A gauge.", "a:b") }).To(Panic())
+			Expect(func() { reg.NewCounterVec("test_total", "A counter.", "__name") }).To(Panic())
+			Expect(func() { reg.NewHistogramVec("test_seconds", "A histogram.", "le", []float64{1}) }).To(Panic())
+
+			buf := new(bytes.Buffer)
+			_, err := reg.WriteTo(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.Len()).To(Equal(0))
+		})
+	})
+
+	Context("when registering the same metric twice", func() {
+		It("should panic", func() {
+			reg := metrics.NewRegistry()
+			reg.NewCounter("test_total", "A counter.")
+			Expect(func() { reg.NewGauge("test_total", "A gauge.") }).To(Panic())
+		})
+	})
+
+	Context("when scraping over http", func() {
+		It("should serve the metrics", func() {
+			reg := metrics.NewRegistry()
+			reg.NewCounterVec("test_total", "A counter.", "kind").With("a").Inc()
+
+			server := httptest.NewServer(reg)
+			defer server.Close()
+
+			resp, err := http.Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Content-Type")).To(HavePrefix("text/plain; version=0.0.4"))
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(ContainSubstring(`test_total{kind="a"} 1` + "\n"))
+		})
+	})
+})
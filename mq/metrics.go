@@ -0,0 +1,30 @@
+package mq
+
+import (
+	"github.com/renproject/hyperdrive/metrics"
+	"github.com/renproject/id"
+)
+
+// Metrics of a MessageQueue: the number of messages that are queued for every
+// sender, and the number of messages that have been dropped because the queue
+// of their sender was full.
+type Metrics struct {
+	Depth   *metrics.GaugeVec
+	Dropped *metrics.Counter
+}
+
+// NewMetrics registers the Metrics of a MessageQueue with the Registry.
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		Depth:   reg.NewGaugeVec("hyperdrive_mq_depth", "Number of messages queued for each sender.", "sender"),
+		Dropped: reg.NewCounter("hyperdrive_mq_dropped_total", "Number of messages dropped because the queue of their sender was full."),
+	}
+}
+
+// updateDepth of the queue of the sender.
+func (mq *MessageQueue) updateDepth(from id.Signatory, q []interface{}) {
+	if mq.opts.Metrics == nil {
+		return
+	}
+	mq.opts.Metrics.Depth.With(from.String()).Set(float64(depth(q)))
+}
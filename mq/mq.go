@@ -6,6 +6,8 @@ import (
 
 	"github.com/renproject/hyperdrive/process"
 	"github.com/renproject/id"
+
+	"go.uber.org/zap"
 )
 
 // A MessageQueue is used to sort incoming messages by their height and round,
@@ -15,7 +17,8 @@ import (
 // the MessageQueue will buffer messages, to prevent running out of memory.
 // However, this also means that explicit resynchronisation is needed, because
 // not all messages that are received are guaranteed to be kept. MessageQueues
-// do not handle de-duplication, and are not safe for concurrent use.
+// do not handle de-duplication, and are not safe for concurrent use. Messages
+// that are evicted because a queue is full are logged at the debug level.
 type MessageQueue struct {
 	opts        Options
 	queuesByPid map[id.Signatory][]interface{}
@@ -23,6 +26,9 @@ type MessageQueue struct {
 
 // New returns an empty MessageQueue.
 func New(opts Options) MessageQueue {
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
 	return MessageQueue{
 		opts:        opts,
 		queuesByPid: make(map[id.Signatory][]interface{}),
@@ -51,6 +57,7 @@ func (mq *MessageQueue) Consume(h process.Height, propose func(process.Propose),
 			q = q[1:]
 		}
 		mq.queuesByPid[from] = q
+		mq.updateDepth(from, q)
 	}
 	return
 }
@@ -73,6 +80,34 @@ func (mq *MessageQueue) InsertPrecommit(precommit process.Precommit) {
 	mq.insert(precommit)
 }
 
+// DropMessagesFrom removes all messages from the given sender from the
+// MessageQueue. This is used when the sender is no longer allowed to
+// participate in consensus.
+func (mq *MessageQueue) DropMessagesFrom(from id.Signatory) {
+	delete(mq.queuesByPid, from)
+	if mq.opts.Metrics != nil {
+		mq.opts.Metrics.Depth.Delete(from.String())
+	}
+}
+
+// Len returns the number of messages in the MessageQueue, from all senders.
+func (mq *MessageQueue) Len() int {
+	n := 0
+	for _, q := range mq.queuesByPid {
+		n += depth(q)
+	}
+	return n
+}
+
+// depth returns the number of messages in the queue. Queues are kept sorted,
+// with unused capacity at the end, so the depth is the index of the first
+// unused element.
+func depth(q []interface{}) int {
+	return sort.Search(len(q), func(i int) bool {
+		return q[i] == nil
+	})
+}
+
 func (mq *MessageQueue) insert(msg interface{}) {
 	// Initialise the queue for the sender of the message, to avoid nil-pointer
 	// errors. This makes the assumption that messages that have not already
@@ -111,8 +146,19 @@ func (mq *MessageQueue) insert(msg interface{}) {
 	// drop excess elements. This protects against adversaries that might seek
 	// to cause an OOM by sending messages "from the far future".
 	if len(q) > mq.opts.MaxCapacity {
+		if evicted := q[mq.opts.MaxCapacity]; evicted != nil {
+			if mq.opts.Metrics != nil {
+				mq.opts.Metrics.Dropped.Inc()
+			}
+			mq.opts.Logger.Debug("evicted message",
+				zap.Int64("height", int64(height(evicted))),
+				zap.Int64("round", int64(round(evicted))),
+				zap.Stringer("from", msgFrom),
+			)
+		}
 		q = q[:mq.opts.MaxCapacity]
 	}
+	mq.updateDepth(msgFrom, q)
 }
 
 func height(msg interface{}) process.Height {
@@ -5,11 +5,14 @@ import (
 	"testing/quick"
 	"time"
 
+	"github.com/renproject/hyperdrive/metrics"
 	"github.com/renproject/hyperdrive/mq"
 	"github.com/renproject/hyperdrive/process"
 	"github.com/renproject/hyperdrive/process/processutil"
 
 	"github.com/renproject/id"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -529,4 +532,110 @@ var _ = Describe("MQ", func() {
 			Expect(quick.Check(loop, nil)).To(Succeed())
 		})
 	})
+	Context("when we drop messages from a sender", func() {
+		It("should only drop the messages from that sender", func() {
+			loop := func() bool {
+				opts := mq.DefaultOptions()
+				queue := mq.New(opts)
+
+				// insert msgs from two senders
+				dropped := id.NewPrivKey().Signatory()
+				kept := id.NewPrivKey().Signatory()
+				msgsCount := 1 + r.Intn(20)
+				for i := 0; i < msgsCount; i++ {
+					for _, sender := range []id.Signatory{dropped, kept} {
+						switch msg := randomMsg(r, sender, process.Height(1+r.Intn(10)), processutil.RandomRound(r)).(type) {
+						case process.Propose:
+							queue.InsertPropose(msg)
+						case process.Prevote:
+							queue.InsertPrevote(msg)
+						case process.Precommit:
+							queue.InsertPrecommit(msg)
+						}
+					}
+				}
+
+				// drop the msgs from one sender, and expect only the msgs from
+				// the other sender to be consumed
+				queue.DropMessagesFrom(dropped)
+				n := queue.Consume(
+					process.Height(10),
+					func(propose process.Propose) { Expect(propose.From).To(Equal(kept)) },
+					func(prevote process.Prevote) { Expect(prevote.From).To(Equal(kept)) },
+					func(precommit process.Precommit) { Expect(precommit.From).To(Equal(kept)) },
+				)
+				Expect(n).To(Equal(msgsCount))
+
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+	})
+
+	Context("when we measure the queue", func() {
+		It("should measure the depth of every queue, the total length, and the dropped messages", func() {
+			loop := func() bool {
+				c := 5 + r.Intn(20)
+				queueMetrics := mq.NewMetrics(metrics.NewRegistry())
+				opts := mq.DefaultOptions().WithMaxCapacity(c).WithMetrics(queueMetrics)
+				queue := mq.New(opts)
+
+				// insert more messages than the capacity from one sender, and
+				// fewer messages from the other sender
+				full := id.NewPrivKey().Signatory()
+				other := id.NewPrivKey().Signatory()
+				extra := 1 + r.Intn(20)
+				for i := 0; i < c+extra; i++ {
+					queue.InsertPrevote(process.Prevote{Height: 2, Round: process.Round(i), From: full})
+				}
+				queue.InsertPrecommit(process.Precommit{Height: 1, Round: 0, From: other})
+				queue.InsertPrecommit(process.Precommit{Height: 2, Round: 0, From: other})
+				Expect(queueMetrics.Depth.With(full.String()).Value()).To(Equal(float64(c)))
+				Expect(queueMetrics.Depth.With(other.String()).Value()).To(Equal(float64(2)))
+				Expect(queueMetrics.Dropped.Value()).To(Equal(float64(extra)))
+				Expect(queue.Len()).To(Equal(c + 2))
+
+				// consuming messages reduces the depth
+				queue.Consume(1, func(process.Propose) {}, func(process.Prevote) {}, func(process.Precommit) {})
+				Expect(queueMetrics.Depth.With(full.String()).Value()).To(Equal(float64(c)))
+				Expect(queueMetrics.Depth.With(other.String()).Value()).To(Equal(float64(1)))
+				Expect(queue.Len()).To(Equal(c + 1))
+				queue.Consume(2, func(process.Propose) {}, func(process.Prevote) {}, func(process.Precommit) {})
+				Expect(queueMetrics.Depth.With(full.String()).Value()).To(Equal(float64(0)))
+				Expect(queueMetrics.Depth.With(other.String()).Value()).To(Equal(float64(0)))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+	})
+
+	Context("when we log the queue", func() {
+		It("should log every message that is evicted from a full queue", func() {
+			loop := func() bool {
+				c := 5 + r.Intn(20)
+				core, logs := observer.New(zap.DebugLevel)
+				opts := mq.DefaultOptions().WithMaxCapacity(c).WithLogger(zap.New(core))
+				queue := mq.New(opts)
+
+				// messages are inserted in order, so the messages from the
+				// latest rounds are evicted
+				from := id.NewPrivKey().Signatory()
+				extra := 1 + r.Intn(20)
+				for i := 0; i < c+extra; i++ {
+					queue.InsertPrevote(process.Prevote{Height: 2, Round: process.Round(i), From: from})
+				}
+				Expect(logs.FilterMessage("evicted message").Len()).To(Equal(extra))
+				for i, entry := range logs.All() {
+					Expect(entry.Level).To(Equal(zap.DebugLevel))
+					Expect(entry.ContextMap()).To(Equal(map[string]interface{}{
+						"height": int64(2),
+						"round":  int64(c + i),
+						"from":   from.String(),
+					}))
+				}
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+	})
 })
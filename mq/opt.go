@@ -6,6 +6,7 @@ import "go.uber.org/zap"
 type Options struct {
 	Logger      *zap.Logger
 	MaxCapacity int
+	Metrics     *Metrics
 }
 
 // DefaultOptions returns the default options as used by the Message Queue
@@ -31,3 +32,10 @@ func (opts Options) WithMaxCapacity(capacity int) Options {
 	opts.MaxCapacity = capacity
 	return opts
 }
+
+// WithMetrics updates the Metrics of the Message Queue. By default, there are
+// no Metrics.
+func (opts Options) WithMetrics(metrics *Metrics) Options {
+	opts.Metrics = metrics
+	return opts
+}
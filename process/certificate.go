@@ -0,0 +1,206 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/renproject/id"
+	"github.com/renproject/surge"
+)
+
+// A CommitCertificate proves that a Value was committed at a Height. It holds
+// the Precommits, from at least 2f+1 Processes, that caused the Value to be
+// committed. Because Precommits are signed by the Processes that broadcast
+// them, a CommitCertificate can be checked independently of the Process that
+// produced it.
+//
+// If the Value was proposed with a Payload, then the CommitCertificate also
+// carries the Payload. The Payload is not covered by the Precommits, so it must
+// be checked against the Value before it is used.
+type CommitCertificate struct {
+	Height     Height      `json:"height"`
+	Round      Round       `json:"round"`
+	Value      Value       `json:"value"`
+	Precommits []Precommit `json:"precommits"`
+	Payload    []byte      `json:"payload,omitempty"`
+}
+
+// Equal compares two CommitCertificates. If they are equal, then it returns
+// true, otherwise it returns false. The Precommits must be in the same order
+// for the CommitCertificates to be considered equal, and their signatures are
+// not checked for equality.
+func (cert CommitCertificate) Equal(other *CommitCertificate) bool {
+	if cert.Height != other.Height ||
+		cert.Round != other.Round ||
+		!cert.Value.Equal(&other.Value) ||
+		!bytes.Equal(cert.Payload, other.Payload) ||
+		len(cert.Precommits) != len(other.Precommits) {
+		return false
+	}
+	for i := range cert.Precommits {
+		if !cert.Precommits[i].Equal(&other.Precommits[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// SizeHint returns the number of bytes required to represent this
+// CommitCertificate in binary.
+func (cert CommitCertificate) SizeHint() int {
+	return surge.SizeHint(cert.Height) +
+		surge.SizeHint(cert.Round) +
+		surge.SizeHint(cert.Value) +
+		surge.SizeHint(cert.Precommits) +
+		surge.SizeHint(cert.Payload)
+}
+
+// Marshal this CommitCertificate into binary.
+func (cert CommitCertificate) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.Marshal(cert.Height, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling height=%v: %v", cert.Height, err)
+	}
+	buf, rem, err = surge.Marshal(cert.Round, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling round=%v: %v", cert.Round, err)
+	}
+	buf, rem, err = surge.Marshal(cert.Value, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling value=%v: %v", cert.Value, err)
+	}
+	buf, rem, err = surge.Marshal(cert.Precommits, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling %v precommits: %v", len(cert.Precommits), err)
+	}
+	buf, rem, err = surge.Marshal(cert.Payload, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling %v bytes of payload: %v", len(cert.Payload), err)
+	}
+	return buf, rem, nil
+}
+
+// Unmarshal binary into this CommitCertificate.
+func (cert *CommitCertificate) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.Unmarshal(&cert.Height, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling height: %v", err)
+	}
+	buf, rem, err = surge.Unmarshal(&cert.Round, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling round: %v", err)
+	}
+	buf, rem, err = surge.Unmarshal(&cert.Value, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling value: %v", err)
+	}
+	buf, rem, err = surge.Unmarshal(&cert.Precommits, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling precommits: %v", err)
+	}
+	buf, rem, err = surge.Unmarshal(&cert.Payload, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling payload: %v", err)
+	}
+	// CommitCertificates without a Payload are not changed by marshaling and
+	// then unmarshaling.
+	if len(cert.Payload) == 0 {
+		cert.Payload = nil
+	}
+	return buf, rem, nil
+}
+
+// A CertificateReport describes the result of verifying the Precommits in a
+// CommitCertificate. Each field holds the indices of the Precommits, in the
+// CommitCertificate, that were found to be in that category. Every Precommit is
+// put into exactly one category.
+type CertificateReport struct {
+	// Valid Precommits are from a known signatory, and have a valid signature
+	// for the Height, Round, and Value of the CommitCertificate.
+	Valid []int `json:"valid"`
+	// Invalid Precommits are from a known signatory, but are not for the
+	// Height, Round, and Value of the CommitCertificate, or do not have a valid
+	// signature from their sender.
+	Invalid []int `json:"invalid"`
+	// Duplicated Precommits are valid, but are from a signatory that already
+	// has a valid Precommit earlier in the CommitCertificate.
+	Duplicated []int `json:"duplicated"`
+	// Unknown Precommits are from a signatory that is not in the signatory
+	// set, or that has no voting power.
+	Unknown []int `json:"unknown"`
+}
+
+// VerifyCommitCertificate checks that a CommitCertificate proves that its Value
+// was committed by the given signatory set. The signatory set is assumed to
+// tolerate f = n/3 faults, where n is the number of distinct signatories, and
+// so the CommitCertificate must contain valid Precommits from at least 2f+1
+// distinct signatories. It returns a CertificateReport describing every
+// Precommit in the CommitCertificate, and an error if there are not enough
+// valid Precommits. This function does not need a running Process, and can be
+// used by light clients.
+func VerifyCommitCertificate(cert CommitCertificate, signatories []id.Signatory) (CertificateReport, error) {
+	votingPower := make(VotingPower, len(signatories))
+	for _, signatory := range signatories {
+		votingPower[signatory] = 1
+	}
+	report := verifyPrecommits(cert, votingPower)
+	if cert.Value.Equal(&NilValue) {
+		return report, fmt.Errorf("nil value cannot be committed")
+	}
+	f := len(votingPower) / 3
+	if len(report.Valid) < 2*f+1 {
+		return report, fmt.Errorf("insufficient precommits: expected at least %v, got %v", 2*f+1, len(report.Valid))
+	}
+	return report, nil
+}
+
+// VerifyWeightedCommitCertificate checks that a CommitCertificate proves that
+// its Value was committed by signatories with the given voting power. The
+// CommitCertificate must contain valid Precommits from distinct signatories
+// that, together, have more than 2/3 of the total voting power. Signatories
+// with no voting power are treated as unknown. It returns a CertificateReport
+// describing every Precommit in the CommitCertificate, and an error if there
+// is not enough voting power in the valid Precommits.
+func VerifyWeightedCommitCertificate(cert CommitCertificate, votingPower VotingPower) (CertificateReport, error) {
+	report := verifyPrecommits(cert, votingPower)
+	if cert.Value.Equal(&NilValue) {
+		return report, fmt.Errorf("nil value cannot be committed")
+	}
+	power := uint64(0)
+	for _, i := range report.Valid {
+		power += votingPower[cert.Precommits[i].From]
+	}
+	total := votingPower.Total()
+	if 3*power <= 2*total {
+		return report, fmt.Errorf("insufficient voting power: expected more than 2/3 of %v, got %v", total, power)
+	}
+	return report, nil
+}
+
+// verifyPrecommits puts every Precommit in the CommitCertificate into exactly
+// one category of a CertificateReport. Signatories with no voting power are
+// unknown.
+func verifyPrecommits(cert CommitCertificate, votingPower VotingPower) CertificateReport {
+	report := CertificateReport{}
+	seen := make(map[id.Signatory]bool, len(cert.Precommits))
+	for i, precommit := range cert.Precommits {
+		if votingPower[precommit.From] == 0 {
+			report.Unknown = append(report.Unknown, i)
+			continue
+		}
+		if precommit.Height != cert.Height ||
+			precommit.Round != cert.Round ||
+			!precommit.Value.Equal(&cert.Value) ||
+			precommit.Verify() != nil {
+			report.Invalid = append(report.Invalid, i)
+			continue
+		}
+		if seen[precommit.From] {
+			report.Duplicated = append(report.Duplicated, i)
+			continue
+		}
+		seen[precommit.From] = true
+		report.Valid = append(report.Valid, i)
+	}
+	return report
+}
@@ -0,0 +1,242 @@
+package process_test
+
+import (
+	"math/rand"
+	"testing/quick"
+	"time"
+
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/hyperdrive/process/processutil"
+	"github.com/renproject/id"
+	"github.com/renproject/surge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CommitCertificate", func() {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	Context("when unmarshaling fuzz", func() {
+		It("should not panic", func() {
+			f := func(fuzz []byte) bool {
+				cert := process.CommitCertificate{}
+				Expect(surge.FromBinary(&cert, fuzz)).ToNot(Succeed())
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+	})
+
+	Context("when marshaling and then unmarshaling", func() {
+		It("should equal itself", func() {
+			loop := func() bool {
+				expected := processutil.RandomCommitCertificate(r)
+				data, err := surge.ToBinary(expected)
+				Expect(err).ToNot(HaveOccurred())
+				got := process.CommitCertificate{}
+				Expect(surge.FromBinary(&got, data)).To(Succeed())
+				Expect(got.Equal(&expected)).To(BeTrue())
+				for i := range got.Precommits {
+					Expect(got.Precommits[i].Signature).To(Equal(expected.Precommits[i].Signature))
+				}
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should return an error when not enough bytes (marshaling)", func() {
+			loop := func() bool {
+				expected := processutil.RandomCommitCertificate(r)
+				sizeAvailable := r.Intn(expected.SizeHint())
+				buf := make([]byte, sizeAvailable)
+				_, _, err := expected.Marshal(buf, sizeAvailable)
+				Expect(err).To(HaveOccurred())
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should return an error when not enough bytes (unmarshaling)", func() {
+			loop := func() bool {
+				expected := processutil.RandomCommitCertificate(r)
+				sizeHint := expected.SizeHint()
+				buf := make([]byte, sizeHint)
+				_, _, err := expected.Marshal(buf, sizeHint)
+				Expect(err).ToNot(HaveOccurred())
+
+				var unmarshalled process.CommitCertificate
+				sizeAvailable := r.Intn(sizeHint)
+				_, _, err = unmarshalled.Unmarshal(buf[:sizeAvailable], sizeAvailable)
+				Expect(err).To(HaveOccurred())
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+	})
+
+	Context("when verifying", func() {
+		// setup returns a signatory set of n = 3f+1 signatories, their private
+		// keys, and a CommitCertificate containing valid precommits from the
+		// first 2f+1 of them.
+		setup := func(f int) ([]id.Signatory, []id.PrivKey, process.CommitCertificate) {
+			privKeys := make([]id.PrivKey, 3*f+1)
+			signatories := make([]id.Signatory, 3*f+1)
+			for i := range privKeys {
+				privKeys[i] = *id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+			cert := process.CommitCertificate{
+				Height: processutil.RandomHeight(r),
+				Round:  processutil.RandomRound(r),
+				Value:  processutil.RandomGoodValue(r),
+			}
+			for i := 0; i < 2*f+1; i++ {
+				cert.Precommits = append(cert.Precommits, signedPrecommit(cert.Height, cert.Round, cert.Value, &privKeys[i]))
+			}
+			return signatories, privKeys, cert
+		}
+
+		Context("when there are 2f+1 valid precommits", func() {
+			It("should succeed", func() {
+				loop := func() bool {
+					f := 1 + r.Intn(5)
+					signatories, _, cert := setup(f)
+					report, err := process.VerifyCommitCertificate(cert, signatories)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(len(report.Valid)).To(Equal(2*f + 1))
+					Expect(report.Invalid).To(BeEmpty())
+					Expect(report.Duplicated).To(BeEmpty())
+					Expect(report.Unknown).To(BeEmpty())
+					return true
+				}
+				Expect(quick.Check(loop, &quick.Config{MaxCount: 10})).To(Succeed())
+			})
+		})
+
+		Context("when there are less than 2f+1 valid precommits", func() {
+			It("should return an error", func() {
+				loop := func() bool {
+					f := 1 + r.Intn(5)
+					signatories, _, cert := setup(f)
+					cert.Precommits = cert.Precommits[:2*f]
+					report, err := process.VerifyCommitCertificate(cert, signatories)
+					Expect(err).To(HaveOccurred())
+					Expect(len(report.Valid)).To(Equal(2 * f))
+					return true
+				}
+				Expect(quick.Check(loop, &quick.Config{MaxCount: 10})).To(Succeed())
+			})
+		})
+
+		Context("when the value is nil", func() {
+			It("should return an error", func() {
+				f := 1 + r.Intn(5)
+				signatories, privKeys, cert := setup(f)
+				cert.Value = process.NilValue
+				for i := range cert.Precommits {
+					cert.Precommits[i] = signedPrecommit(cert.Height, cert.Round, cert.Value, &privKeys[i])
+				}
+				_, err := process.VerifyCommitCertificate(cert, signatories)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("when there are invalid, duplicated, and unknown precommits", func() {
+			It("should report each of them and exclude them from the quorum", func() {
+				loop := func() bool {
+					f := 1 + r.Intn(5)
+					signatories, privKeys, cert := setup(f)
+
+					// A precommit for another value, a precommit with a
+					// signature from the wrong signatory, a duplicate of a
+					// valid precommit, and a precommit from an unknown
+					// signatory.
+					otherValue := processutil.RandomGoodValue(r)
+					wrongValue := signedPrecommit(cert.Height, cert.Round, otherValue, &privKeys[3*f])
+					wrongSignature := signedPrecommit(cert.Height, cert.Round, cert.Value, &privKeys[3*f])
+					wrongSignature.From = signatories[3*f-1]
+					duplicate := signedPrecommit(cert.Height, cert.Round, cert.Value, &privKeys[0])
+					unknown := signedPrecommit(cert.Height, cert.Round, cert.Value, id.NewPrivKey())
+
+					n := len(cert.Precommits)
+					cert.Precommits = append(cert.Precommits, wrongValue, wrongSignature, duplicate, unknown)
+					report, err := process.VerifyCommitCertificate(cert, signatories)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(len(report.Valid)).To(Equal(2*f + 1))
+					Expect(report.Invalid).To(Equal([]int{n, n + 1}))
+					Expect(report.Duplicated).To(Equal([]int{n + 2}))
+					Expect(report.Unknown).To(Equal([]int{n + 3}))
+
+					// Without one of the valid precommits there is no longer a
+					// quorum, because the other precommits do not count
+					// towards it.
+					cert.Precommits = append(cert.Precommits[:1], cert.Precommits[2:]...)
+					_, err = process.VerifyCommitCertificate(cert, signatories)
+					Expect(err).To(HaveOccurred())
+					return true
+				}
+				Expect(quick.Check(loop, &quick.Config{MaxCount: 10})).To(Succeed())
+			})
+		})
+
+		Context("when verifying with voting power", func() {
+			It("should require more than 2/3 of the total voting power", func() {
+				f := 1 + r.Intn(5)
+				signatories, _, cert := setup(f)
+
+				// The first signatory has exactly 2/3 of the total voting
+				// power, so its precommit alone is not enough, but its
+				// precommit with any other precommit is enough.
+				votingPower := process.VotingPower{}
+				for _, signatory := range signatories[1:] {
+					votingPower[signatory] = 1
+				}
+				votingPower[signatories[0]] = uint64(2 * (len(signatories) - 1))
+
+				certWithOne := cert
+				certWithOne.Precommits = cert.Precommits[:1]
+				_, err := process.VerifyWeightedCommitCertificate(certWithOne, votingPower)
+				Expect(err).To(HaveOccurred())
+
+				certWithTwo := cert
+				certWithTwo.Precommits = cert.Precommits[:2]
+				report, err := process.VerifyWeightedCommitCertificate(certWithTwo, votingPower)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(report.Valid).To(Equal([]int{0, 1}))
+
+				// Without the first signatory, all other precommits are not
+				// enough.
+				certWithoutFirst := cert
+				certWithoutFirst.Precommits = cert.Precommits[1:]
+				_, err = process.VerifyWeightedCommitCertificate(certWithoutFirst, votingPower)
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("should treat signatories with no voting power as unknown", func() {
+				f := 1 + r.Intn(5)
+				signatories, _, cert := setup(f)
+				votingPower := process.VotingPower{}
+				for _, signatory := range signatories {
+					votingPower[signatory] = 1
+				}
+				votingPower[signatories[0]] = 0
+
+				report, err := process.VerifyWeightedCommitCertificate(cert, votingPower)
+				Expect(err).To(HaveOccurred())
+				Expect(report.Unknown).To(Equal([]int{0}))
+			})
+		})
+	})
+})
+
+func signedPrecommit(height process.Height, round process.Round, value process.Value, privKey *id.PrivKey) process.Precommit {
+	precommit := process.Precommit{
+		Height: height,
+		Round:  round,
+		Value:  value,
+		From:   privKey.Signatory(),
+	}
+	Expect(precommit.Sign(privKey)).To(Succeed())
+	return precommit
+}
@@ -0,0 +1,216 @@
+package process
+
+import (
+	"github.com/renproject/id"
+)
+
+// An AmnesiaCatcher is a Catcher that also catches Processes that forget
+// their lock. If the Catcher given to a Process implements this interface, and
+// the Process keeps a history of votes (see Options.HistoryHeights), then
+// CatchAmnesia will be called whenever a Process precommits a Value and then
+// prevotes a different Value in a later Round of the same Height, without
+// there being a polka for the different Value in the Rounds in between.
+//
+// Amnesia can only be caught with the Prevotes that have been received, so it
+// is possible that a correct Process is caught when some Prevotes have been
+// lost. It should be treated as a strong suspicion, not as proof.
+type AmnesiaCatcher interface {
+	Catcher
+	CatchAmnesia(Precommit, Prevote)
+}
+
+// DefaultHistoryRounds is the number of Rounds, before and after the latest
+// Round of a Height, for which votes are kept in the history when neither the
+// history Rounds nor the round retention are set.
+const DefaultHistoryRounds = 10
+
+// A history of the Prevotes and Precommits received in recent Heights. Unlike
+// the message logs, it is not reset when the Process moves to the next Height,
+// so that equivocation can be caught in Heights that the Process has already
+// left, and amnesia can be caught across Rounds. Only the Rounds near the
+// latest Round of each Height are kept, so that the history stays bounded even
+// when signatories sign votes for many Rounds.
+type history struct {
+	heights int
+	rounds  int
+	logs    map[Height]*heightHistory
+}
+
+// A heightHistory is the history of one Height. It also remembers the
+// thresholds that were used at the Height, so that polkas can be found after
+// the Process has been reconfigured, and the latest Round of the Process at the
+// Height, around which votes are kept.
+type heightHistory struct {
+	round            Round
+	f                int
+	votingPower      VotingPower
+	totalVotingPower uint64
+
+	prevotes   map[Round]map[id.Signatory]Prevote
+	precommits map[Round]map[id.Signatory]Precommit
+}
+
+func newHistory(heights, rounds int) *history {
+	return &history{
+		heights: heights,
+		rounds:  rounds,
+		logs:    map[Height]*heightHistory{},
+	}
+}
+
+// historyAt returns the history of the Height, if the Height is recent enough
+// to be kept. The history of the current Height is created when it is first
+// needed, and the Rounds that are too far from the current Round are pruned
+// from it. The histories of past Heights are never created, because the
+// thresholds that were used at those Heights are not known.
+func (p *Process) historyAt(height Height) (*heightHistory, bool) {
+	if p.history == nil || height > p.CurrentHeight || height <= p.CurrentHeight-Height(p.history.heights) {
+		return nil, false
+	}
+	for h := range p.history.logs {
+		if h <= p.CurrentHeight-Height(p.history.heights) {
+			delete(p.history.logs, h)
+		}
+	}
+	log, ok := p.history.logs[height]
+	if !ok && height == p.CurrentHeight {
+		log = &heightHistory{
+			f:                p.f,
+			votingPower:      p.votingPower,
+			totalVotingPower: p.totalVotingPower,
+
+			prevotes:   map[Round]map[id.Signatory]Prevote{},
+			precommits: map[Round]map[id.Signatory]Precommit{},
+		}
+		p.history.logs[height] = log
+		ok = true
+	}
+	if ok && height == p.CurrentHeight && log.round != p.CurrentRound {
+		log.round = p.CurrentRound
+		log.prune(p.history.rounds)
+	}
+	return log, ok
+}
+
+// withinRounds returns true if the Round is no more than the number of
+// history Rounds away from the latest Round of the Height.
+func (log *heightHistory) withinRounds(round Round, rounds int) bool {
+	return round >= log.round-Round(rounds) && round <= log.round+Round(rounds)
+}
+
+// prune the votes of the Rounds that are too far from the latest Round of the
+// Height.
+func (log *heightHistory) prune(rounds int) {
+	for round := range log.prevotes {
+		if !log.withinRounds(round, rounds) {
+			delete(log.prevotes, round)
+		}
+	}
+	for round := range log.precommits {
+		if !log.withinRounds(round, rounds) {
+			delete(log.precommits, round)
+		}
+	}
+}
+
+// recordPrevote in the history, and catch double prevotes in past Heights, and
+// amnesia in any recent Height. Double prevotes in the current Height are
+// caught by insertPrevote. Prevotes from Rounds that are too far from the latest
+// Round of their Height are ignored.
+func (p *Process) recordPrevote(prevote Prevote) {
+	log, ok := p.historyAt(prevote.Height)
+	if !ok || !log.withinRounds(prevote.Round, p.history.rounds) {
+		return
+	}
+	if _, ok := log.prevotes[prevote.Round]; !ok {
+		log.prevotes[prevote.Round] = map[id.Signatory]Prevote{}
+	}
+	if existingPrevote, ok := log.prevotes[prevote.Round][prevote.From]; ok {
+		if prevote.Height != p.CurrentHeight && !prevote.Equal(&existingPrevote) {
+			if p.catcher != nil {
+				p.catcher.CatchDoublePrevote(prevote, existingPrevote)
+			}
+		}
+		return
+	}
+	log.prevotes[prevote.Round][prevote.From] = prevote
+
+	for round, precommits := range log.precommits {
+		if round >= prevote.Round {
+			continue
+		}
+		if precommit, ok := precommits[prevote.From]; ok {
+			p.tryCatchAmnesia(log, precommit, prevote)
+		}
+	}
+}
+
+// recordPrecommit in the history, and catch double precommits in past
+// Heights, and amnesia in any recent Height. Double precommits in the current
+// Height are caught by insertPrecommit. Precommits from Rounds that are too far
+// from the latest Round of their Height are ignored.
+func (p *Process) recordPrecommit(precommit Precommit) {
+	log, ok := p.historyAt(precommit.Height)
+	if !ok || !log.withinRounds(precommit.Round, p.history.rounds) {
+		return
+	}
+	if _, ok := log.precommits[precommit.Round]; !ok {
+		log.precommits[precommit.Round] = map[id.Signatory]Precommit{}
+	}
+	if existingPrecommit, ok := log.precommits[precommit.Round][precommit.From]; ok {
+		if precommit.Height != p.CurrentHeight && !precommit.Equal(&existingPrecommit) {
+			if p.catcher != nil {
+				p.catcher.CatchDoublePrecommit(precommit, existingPrecommit)
+			}
+		}
+		return
+	}
+	log.precommits[precommit.Round][precommit.From] = precommit
+
+	for round, prevotes := range log.prevotes {
+		if round <= precommit.Round {
+			continue
+		}
+		if prevote, ok := prevotes[precommit.From]; ok {
+			p.tryCatchAmnesia(log, precommit, prevote)
+		}
+	}
+}
+
+// tryCatchAmnesia catches the sender of the Precommit and the later Prevote,
+// if it locked on one Value and then prevoted for a different Value without a
+// polka to unlock it. A locked Process can only prevote for a different Value
+// when there has been a polka for that Value in a Round since it locked (see
+// L28 of the consensus algorithm).
+func (p *Process) tryCatchAmnesia(log *heightHistory, precommit Precommit, prevote Prevote) {
+	if precommit.Value.Equal(&NilValue) || prevote.Value.Equal(&NilValue) || precommit.Value.Equal(&prevote.Value) {
+		return
+	}
+	for round := precommit.Round; round < prevote.Round; round++ {
+		if log.hasPolka(round, prevote.Value) {
+			return
+		}
+	}
+	if catcher, ok := p.catcher.(AmnesiaCatcher); ok {
+		catcher.CatchAmnesia(precommit, prevote)
+	}
+}
+
+// hasPolka returns true if a supermajority prevoted for the Value in the
+// Round, using the thresholds of the Height.
+func (log *heightHistory) hasPolka(round Round, value Value) bool {
+	power := uint64(0)
+	for from, prevote := range log.prevotes[round] {
+		if prevote.Value.Equal(&value) {
+			if log.votingPower == nil {
+				power++
+			} else {
+				power += log.votingPower[from]
+			}
+		}
+	}
+	if log.votingPower == nil {
+		return power >= uint64(2*log.f+1)
+	}
+	return 3*power > 2*log.totalVotingPower
+}
@@ -0,0 +1,21 @@
+package process
+
+import (
+	"go.uber.org/zap"
+)
+
+// debug logs a transition decision of the Process, together with its current
+// Height, Round, and Step. The fields are only built when the logger is
+// enabled for debug messages, so that logging is cheap when it is disabled.
+func (p *Process) debug(msg string, fields ...zap.Field) {
+	if p.logger == nil {
+		return
+	}
+	if entry := p.logger.Check(zap.DebugLevel, msg); entry != nil {
+		entry.Write(append([]zap.Field{
+			zap.Int64("height", int64(p.CurrentHeight)),
+			zap.Int64("round", int64(p.CurrentRound)),
+			zap.Stringer("step", p.CurrentStep),
+		}, fields...)...)
+	}
+}
@@ -1,6 +1,7 @@
 package process
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/renproject/id"
@@ -10,6 +11,10 @@ import (
 // A Propose message is sent by the proposer Process at most once per Round. The
 // Scheduler interfaces determines which Process is the proposer at any given
 // Height and Round.
+//
+// A Propose can also carry the Payload that was proposed, when the Value is the
+// hash of the Payload. The Payload is not signed, because it is bound to the
+// Propose by the Value, and it is ignored by the Process.
 type Propose struct {
 	Height     Height       `json:"height"`
 	Round      Round        `json:"round"`
@@ -17,6 +22,7 @@ type Propose struct {
 	Value      Value        `json:"value"`
 	From       id.Signatory `json:"from"`
 	Signature  id.Signature `json:"signature"`
+	Payload    []byte       `json:"payload,omitempty"`
 }
 
 // NewProposeHash receives fields of a propose message and hashes the message
@@ -47,6 +53,40 @@ func NewProposeHashWithBuffer(height Height, round Round, validRound Round, valu
 	return id.NewHash(data), nil
 }
 
+// Sign the Propose using the given private key. The signatory of the private
+// key must be equal to the From field, otherwise the Propose will not pass
+// verification.
+func (propose *Propose) Sign(privKey *id.PrivKey) error {
+	hash, err := NewProposeHash(propose.Height, propose.Round, propose.ValidRound, propose.Value)
+	if err != nil {
+		return fmt.Errorf("hashing propose: %v", err)
+	}
+	signature, err := privKey.Sign(&hash)
+	if err != nil {
+		return fmt.Errorf("signing propose: %v", err)
+	}
+	propose.Signature = signature
+	return nil
+}
+
+// Verify that the Signature of the Propose was produced by the From field. If
+// the Signature is malformed, or was produced by a different signatory, then an
+// error is returned.
+func (propose Propose) Verify() error {
+	hash, err := NewProposeHash(propose.Height, propose.Round, propose.ValidRound, propose.Value)
+	if err != nil {
+		return fmt.Errorf("hashing propose: %v", err)
+	}
+	signatory, err := propose.Signature.Signatory(&hash)
+	if err != nil {
+		return fmt.Errorf("recovering signatory: %v", err)
+	}
+	if !signatory.Equal(&propose.From) {
+		return fmt.Errorf("bad signatory: expected from=%v, got signatory=%v", propose.From, signatory)
+	}
+	return nil
+}
+
 // Equal compares two Proposes. If they are equal, then it return true,
 // otherwise it returns false. The signatures are not checked for equality,
 // because signatures include randomness.
@@ -55,7 +95,8 @@ func (propose Propose) Equal(other *Propose) bool {
 		propose.Round == other.Round &&
 		propose.ValidRound == other.ValidRound &&
 		propose.Value.Equal(&other.Value) &&
-		propose.From.Equal(&other.From)
+		propose.From.Equal(&other.From) &&
+		bytes.Equal(propose.Payload, other.Payload)
 }
 
 // SizeHint returns the number of bytes required to represent this message in
@@ -66,7 +107,8 @@ func (propose Propose) SizeHint() int {
 		surge.SizeHint(propose.ValidRound) +
 		surge.SizeHint(propose.Value) +
 		surge.SizeHint(propose.From) +
-		surge.SizeHint(propose.Signature)
+		surge.SizeHint(propose.Signature) +
+		surge.SizeHint(propose.Payload)
 }
 
 // Marshal this message into binary.
@@ -95,6 +137,10 @@ func (propose Propose) Marshal(buf []byte, rem int) ([]byte, int, error) {
 	if err != nil {
 		return buf, rem, fmt.Errorf("marshaling signature=%v: %v", propose.Signature, err)
 	}
+	buf, rem, err = surge.Marshal(propose.Payload, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling %v bytes of payload: %v", len(propose.Payload), err)
+	}
 	return buf, rem, nil
 }
 
@@ -124,6 +170,15 @@ func (propose *Propose) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
 	if err != nil {
 		return buf, rem, fmt.Errorf("unmarshaling signature: %v", err)
 	}
+	buf, rem, err = surge.Unmarshal(&propose.Payload, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling payload: %v", err)
+	}
+	// Proposes without a Payload are not changed by marshaling and then
+	// unmarshaling.
+	if len(propose.Payload) == 0 {
+		propose.Payload = nil
+	}
 	return buf, rem, nil
 }
 
@@ -164,6 +219,40 @@ func NewPrevoteHashWithBuffer(height Height, round Round, value Value, data []by
 	return id.NewHash(data), nil
 }
 
+// Sign the Prevote using the given private key. The signatory of the private
+// key must be equal to the From field, otherwise the Prevote will not pass
+// verification.
+func (prevote *Prevote) Sign(privKey *id.PrivKey) error {
+	hash, err := NewPrevoteHash(prevote.Height, prevote.Round, prevote.Value)
+	if err != nil {
+		return fmt.Errorf("hashing prevote: %v", err)
+	}
+	signature, err := privKey.Sign(&hash)
+	if err != nil {
+		return fmt.Errorf("signing prevote: %v", err)
+	}
+	prevote.Signature = signature
+	return nil
+}
+
+// Verify that the Signature of the Prevote was produced by the From field. If
+// the Signature is malformed, or was produced by a different signatory, then an
+// error is returned.
+func (prevote Prevote) Verify() error {
+	hash, err := NewPrevoteHash(prevote.Height, prevote.Round, prevote.Value)
+	if err != nil {
+		return fmt.Errorf("hashing prevote: %v", err)
+	}
+	signatory, err := prevote.Signature.Signatory(&hash)
+	if err != nil {
+		return fmt.Errorf("recovering signatory: %v", err)
+	}
+	if !signatory.Equal(&prevote.From) {
+		return fmt.Errorf("bad signatory: expected from=%v, got signatory=%v", prevote.From, signatory)
+	}
+	return nil
+}
+
 // Equal compares two Prevotes. If they are equal, then it return true,
 // otherwise it returns false. The signatures are not checked for equality,
 // because signatures include randomness.
@@ -271,6 +360,40 @@ func NewPrecommitHashWithBuffer(height Height, round Round, value Value, data []
 	return id.NewHash(data), nil
 }
 
+// Sign the Precommit using the given private key. The signatory of the private
+// key must be equal to the From field, otherwise the Precommit will not pass
+// verification.
+func (precommit *Precommit) Sign(privKey *id.PrivKey) error {
+	hash, err := NewPrecommitHash(precommit.Height, precommit.Round, precommit.Value)
+	if err != nil {
+		return fmt.Errorf("hashing precommit: %v", err)
+	}
+	signature, err := privKey.Sign(&hash)
+	if err != nil {
+		return fmt.Errorf("signing precommit: %v", err)
+	}
+	precommit.Signature = signature
+	return nil
+}
+
+// Verify that the Signature of the Precommit was produced by the From field. If
+// the Signature is malformed, or was produced by a different signatory, then an
+// error is returned.
+func (precommit Precommit) Verify() error {
+	hash, err := NewPrecommitHash(precommit.Height, precommit.Round, precommit.Value)
+	if err != nil {
+		return fmt.Errorf("hashing precommit: %v", err)
+	}
+	signatory, err := precommit.Signature.Signatory(&hash)
+	if err != nil {
+		return fmt.Errorf("recovering signatory: %v", err)
+	}
+	if !signatory.Equal(&precommit.From) {
+		return fmt.Errorf("bad signatory: expected from=%v, got signatory=%v", precommit.From, signatory)
+	}
+	return nil
+}
+
 // Equal compares two Precommits. If they are equal, then it return true,
 // otherwise it returns false. The signatures are not checked for equality,
 // because signatures include randomness.
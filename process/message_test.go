@@ -30,7 +30,7 @@ var _ = Describe("Propose", func() {
 		r := rand.New(rand.NewSource(time.Now().UnixNano()))
 
 		It("should equal itself", func() {
-			f := func(height process.Height, round, validRound process.Round, value process.Value, from id.Signatory, signature id.Signature) bool {
+			f := func(height process.Height, round, validRound process.Round, value process.Value, from id.Signatory, signature id.Signature, payload []byte) bool {
 				expected := process.Propose{
 					Height:     height,
 					Round:      round,
@@ -38,6 +38,7 @@ var _ = Describe("Propose", func() {
 					Value:      value,
 					From:       from,
 					Signature:  signature,
+					Payload:    payload,
 				}
 				data, err := surge.ToBinary(expected)
 				Expect(err).ToNot(HaveOccurred())
@@ -204,6 +205,59 @@ var _ = Describe("Propose", func() {
 			Expect(quick.Check(loop, nil)).To(Succeed())
 		})
 	})
+
+	Context("when signing and verifying", func() {
+		It("should verify the signed propose", func() {
+			f := func(height process.Height, round, validRound process.Round, value process.Value) bool {
+				privKey := id.NewPrivKey()
+				msg := process.Propose{
+					Height:     height,
+					Round:      round,
+					ValidRound: validRound,
+					Value:      value,
+					From:       privKey.Signatory(),
+				}
+				Expect(msg.Sign(privKey)).To(Succeed())
+				Expect(msg.Verify()).To(Succeed())
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should not verify the propose when signed by someone else", func() {
+			f := func(height process.Height, round, validRound process.Round, value process.Value) bool {
+				msg := process.Propose{
+					Height:     height,
+					Round:      round,
+					ValidRound: validRound,
+					Value:      value,
+					From:       id.NewPrivKey().Signatory(),
+				}
+				Expect(msg.Sign(id.NewPrivKey())).To(Succeed())
+				Expect(msg.Verify()).ToNot(Succeed())
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should not verify the propose when it has been modified", func() {
+			f := func(height process.Height, round, validRound process.Round, value process.Value) bool {
+				privKey := id.NewPrivKey()
+				msg := process.Propose{
+					Height:     height,
+					Round:      round,
+					ValidRound: validRound,
+					Value:      value,
+					From:       privKey.Signatory(),
+				}
+				Expect(msg.Sign(privKey)).To(Succeed())
+				msg.Round++
+				Expect(msg.Verify()).ToNot(Succeed())
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+	})
 })
 
 var _ = Describe("Prevote", func() {
@@ -268,6 +322,56 @@ var _ = Describe("Prevote", func() {
 			Expect(quick.Check(f, nil)).To(Succeed())
 		})
 	})
+
+	Context("when signing and verifying", func() {
+		It("should verify the signed prevote", func() {
+			f := func(height process.Height, round process.Round, value process.Value) bool {
+				privKey := id.NewPrivKey()
+				msg := process.Prevote{
+					Height: height,
+					Round:  round,
+					Value:  value,
+					From:   privKey.Signatory(),
+				}
+				Expect(msg.Sign(privKey)).To(Succeed())
+				Expect(msg.Verify()).To(Succeed())
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should not verify the prevote when signed by someone else", func() {
+			f := func(height process.Height, round process.Round, value process.Value) bool {
+				msg := process.Prevote{
+					Height: height,
+					Round:  round,
+					Value:  value,
+					From:   id.NewPrivKey().Signatory(),
+				}
+				Expect(msg.Sign(id.NewPrivKey())).To(Succeed())
+				Expect(msg.Verify()).ToNot(Succeed())
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should not verify the prevote when it has been modified", func() {
+			f := func(height process.Height, round process.Round, value process.Value) bool {
+				privKey := id.NewPrivKey()
+				msg := process.Prevote{
+					Height: height,
+					Round:  round,
+					Value:  value,
+					From:   privKey.Signatory(),
+				}
+				Expect(msg.Sign(privKey)).To(Succeed())
+				msg.Round++
+				Expect(msg.Verify()).ToNot(Succeed())
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+	})
 })
 
 var _ = Describe("Precommit", func() {
@@ -332,4 +436,54 @@ var _ = Describe("Precommit", func() {
 			Expect(quick.Check(f, nil)).To(Succeed())
 		})
 	})
+
+	Context("when signing and verifying", func() {
+		It("should verify the signed precommit", func() {
+			f := func(height process.Height, round process.Round, value process.Value) bool {
+				privKey := id.NewPrivKey()
+				msg := process.Precommit{
+					Height: height,
+					Round:  round,
+					Value:  value,
+					From:   privKey.Signatory(),
+				}
+				Expect(msg.Sign(privKey)).To(Succeed())
+				Expect(msg.Verify()).To(Succeed())
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should not verify the precommit when signed by someone else", func() {
+			f := func(height process.Height, round process.Round, value process.Value) bool {
+				msg := process.Precommit{
+					Height: height,
+					Round:  round,
+					Value:  value,
+					From:   id.NewPrivKey().Signatory(),
+				}
+				Expect(msg.Sign(id.NewPrivKey())).To(Succeed())
+				Expect(msg.Verify()).ToNot(Succeed())
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+
+		It("should not verify the precommit when it has been modified", func() {
+			f := func(height process.Height, round process.Round, value process.Value) bool {
+				privKey := id.NewPrivKey()
+				msg := process.Precommit{
+					Height: height,
+					Round:  round,
+					Value:  value,
+					From:   privKey.Signatory(),
+				}
+				Expect(msg.Sign(privKey)).To(Succeed())
+				msg.Round++
+				Expect(msg.Verify()).ToNot(Succeed())
+				return true
+			}
+			Expect(quick.Check(f, nil)).To(Succeed())
+		})
+	})
 })
@@ -0,0 +1,84 @@
+package process
+
+import (
+	"go.uber.org/zap"
+)
+
+// An Observer is notified about the internal state transitions of a Process.
+// It is intended for monitoring and debugging, and must not be used to drive
+// the consensus algorithm. Observers are called by the goroutine that runs the
+// Process, so they must not block, and must not call the Process.
+type Observer interface {
+	// OnStepChanged is called whenever the Process moves to a new Step,
+	// including when it starts a new Round.
+	OnStepChanged(Height, Round, Step)
+	// OnLocked is called whenever the Process locks on a Value, or on the same
+	// Value in a later Round.
+	OnLocked(Height, Round, Value)
+	// OnValidValueUpdated is called whenever the valid Value, or valid Round,
+	// of the Process changes.
+	OnValidValueUpdated(Height, Round, Value)
+	// OnRoundSkipped is called whenever the Process skips from its current
+	// Round to a future Round, because it has received messages from f+1
+	// Processes in the future Round.
+	OnRoundSkipped(height Height, from, to Round)
+	// OnTimeoutScheduled is called whenever the Process schedules a timeout
+	// for a Step.
+	OnTimeoutScheduled(Height, Round, Step)
+}
+
+// setStep of the Process, and notify the Observer.
+func (p *Process) setStep(step Step) {
+	p.CurrentStep = step
+	p.debug("moved to step")
+	if p.observer != nil {
+		p.observer.OnStepChanged(p.CurrentHeight, p.CurrentRound, step)
+	}
+}
+
+// lock the Process on the Value, and notify the Observer if the lock has
+// changed.
+func (p *Process) lock(round Round, value Value) {
+	if round == p.LockedRound && value.Equal(&p.LockedValue) {
+		return
+	}
+	p.LockedValue = value
+	p.LockedRound = round
+	p.debug("locked", zap.Stringer("value", value), zap.Int64("lockedRound", int64(round)))
+	if p.observer != nil {
+		p.observer.OnLocked(p.CurrentHeight, round, value)
+	}
+}
+
+// updateValid updates the valid Value of the Process, and notifies the
+// Observer if the valid Value has changed.
+func (p *Process) updateValid(round Round, value Value) {
+	if round == p.ValidRound && value.Equal(&p.ValidValue) {
+		return
+	}
+	p.ValidValue = value
+	p.ValidRound = round
+	p.debug("updated valid value", zap.Stringer("value", value), zap.Int64("validRound", int64(round)))
+	if p.observer != nil {
+		p.observer.OnValidValueUpdated(p.CurrentHeight, round, value)
+	}
+}
+
+// scheduleTimeout for the Step in the current Round, and notify the Observer.
+// The Process must have a Timer.
+func (p *Process) scheduleTimeout(step Step) {
+	switch step {
+	case Proposing:
+		p.timer.TimeoutPropose(p.CurrentHeight, p.CurrentRound)
+	case Prevoting:
+		p.timer.TimeoutPrevote(p.CurrentHeight, p.CurrentRound)
+	case Precommitting:
+		p.timer.TimeoutPrecommit(p.CurrentHeight, p.CurrentRound)
+	default:
+		return
+	}
+	p.debug("scheduled timeout", zap.Stringer("timeout", step))
+	if p.observer != nil {
+		p.observer.OnTimeoutScheduled(p.CurrentHeight, p.CurrentRound, step)
+	}
+}
@@ -0,0 +1,84 @@
+package process
+
+import (
+	"go.uber.org/zap"
+)
+
+// Options represent the options for a Process.
+type Options struct {
+	VotingPower    VotingPower
+	HistoryHeights int
+	HistoryRounds  int
+	RoundRetention int
+	Observer       Observer
+	Logger         *zap.Logger
+}
+
+// DefaultOptions returns the default options for a Process. By default, there
+// is no VotingPower, and every Process has an equal vote. No history of votes
+// is kept, all Rounds are kept in the message logs, and there is no Observer
+// or logger.
+func DefaultOptions() Options {
+	return Options{}
+}
+
+// WithVotingPower updates the voting power of the Processes participating in
+// consensus. When voting power is set, it is used instead of f to determine
+// when the thresholds required by the consensus algorithm have been reached.
+func (opts Options) WithVotingPower(votingPower VotingPower) Options {
+	opts.VotingPower = votingPower
+	return opts
+}
+
+// WithHistoryHeights updates the number of recent Heights, including the
+// current Height, for which the Prevotes and Precommits are kept. The history
+// is used to catch double votes in Heights that the Process has already left,
+// and amnesia across Rounds (see AmnesiaCatcher). When it is zero, no history
+// is kept.
+func (opts Options) WithHistoryHeights(heights int) Options {
+	opts.HistoryHeights = heights
+	return opts
+}
+
+// WithHistoryRounds updates the number of Rounds, before and after the latest
+// Round of each Height, for which the Prevotes and Precommits are kept in the
+// history. Votes from other Rounds are ignored, so that the history is bounded
+// even when signatories sign votes for many Rounds. When it is zero, the round
+// retention is used, or DefaultHistoryRounds if there is no round retention.
+func (opts Options) WithHistoryRounds(rounds int) Options {
+	opts.HistoryRounds = rounds
+	return opts
+}
+
+// WithRoundRetention updates the number of Rounds, before and after the current
+// Round, that are kept in the message logs. Messages from other Rounds are
+// dropped, unless they are needed by the consensus algorithm (the LockedRound,
+// the ValidRound, the ValidRounds referenced by Proposes, and the Rounds in
+// which the Propose has been precommitted by at least f+1 Processes). This
+// bounds the size of the State when consensus cannot be reached for many
+// Rounds. The retention must be large enough for the Process to see the
+// messages of Processes that are ahead of it, otherwise it will not be able to
+// skip to their Round. A Round that is pruned before the Process has received
+// the Propose and f+1 Precommits for its Value can still be committed by other
+// Processes, and then the Process can only catch up using their
+// CommitCertificate (see FastForward), so a positive retention requires a way
+// of syncing, such as a Replica with a Syncer. When it is zero, all Rounds are
+// kept.
+func (opts Options) WithRoundRetention(retention int) Options {
+	opts.RoundRetention = retention
+	return opts
+}
+
+// WithObserver updates the Observer that is notified about the state
+// transitions of the Process.
+func (opts Options) WithObserver(observer Observer) Options {
+	opts.Observer = observer
+	return opts
+}
+
+// WithLogger updates the logger used to log the transition decisions of the
+// Process. They are logged at the debug level.
+func (opts Options) WithLogger(logger *zap.Logger) Options {
+	opts.Logger = logger
+	return opts
+}
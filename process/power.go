@@ -0,0 +1,32 @@
+package process
+
+import (
+	"github.com/renproject/id"
+)
+
+// VotingPower maps the signatories of Processes to the weight of their votes.
+// Signatories that are not present in the map have no voting power. The total
+// voting power must be less than 1/3 of the maximum uint64, so that thresholds
+// can be computed without overflow.
+type VotingPower map[id.Signatory]uint64
+
+// Total returns the sum of the voting power of all signatories.
+func (votingPower VotingPower) Total() uint64 {
+	total := uint64(0)
+	for _, power := range votingPower {
+		total += power
+	}
+	return total
+}
+
+// Copy returns a deep copy of this VotingPower.
+func (votingPower VotingPower) Copy() VotingPower {
+	if votingPower == nil {
+		return nil
+	}
+	copied := make(VotingPower, len(votingPower))
+	for signatory, power := range votingPower {
+		copied[signatory] = power
+	}
+	return copied
+}
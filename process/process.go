@@ -7,10 +7,13 @@
 package process
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
 
 	"github.com/renproject/id"
 	"github.com/renproject/surge"
+	"go.uber.org/zap"
 )
 
 // A Timer is used to schedule timeout events.
@@ -44,6 +47,17 @@ type Proposer interface {
 	Propose(Height, Round) Value
 }
 
+// An AsyncProposer is a Proposer that can propose Values without blocking the
+// Process. If the Proposer given to a Process implements this interface, then
+// ProposeAsync will be called instead of Propose, and the Value must be given
+// back to the Process using its OnPropose method. While the Process waits for
+// the Value, it times out like any other Process that is waiting for a
+// Propose.
+type AsyncProposer interface {
+	Proposer
+	ProposeAsync(Height, Round)
+}
+
 // A Broadcaster is used to broadcast Propose, Prevote, and Precommit messages
 // to all Processes in the consensus algorithm, including the Process that
 // initiated the broadcast. It is assumed that all messages between correct
@@ -72,6 +86,15 @@ type Committer interface {
 	Commit(Height, Value)
 }
 
+// A CertifiedCommitter is a Committer that also receives the CommitCertificate
+// that justifies each committed Value. If the Committer given to a Process
+// implements this interface, then CommitWithProof will be called instead of
+// Commit.
+type CertifiedCommitter interface {
+	Committer
+	CommitWithProof(CommitCertificate)
+}
+
 // A Catcher is used to catch bad behaviour in other Processes. For example,
 // when the same Process sends two different Proposes at the same Height and
 // Round.
@@ -90,7 +113,9 @@ type Catcher interface {
 // All messages from previous and future Heights will be ignored. The component
 // using the Process should buffer all messages from future Heights so that they
 // are not lost. It is assumed that this component will also handle the
-// authentication and rate-limiting of messages.
+// authentication and rate-limiting of messages. If the Process keeps a
+// history, then votes from recent previous Heights are used to catch
+// misbehaviour, but are otherwise ignored.
 //
 // Processes are not safe for concurrent use. All methods must be called by the
 // same goroutine that allocates and starts the Process.
@@ -101,6 +126,15 @@ type Process struct {
 	// f is the maximum number of malicious adversaries that the Process can
 	// withstand while still maintaining safety and liveliness.
 	f int
+	// votingPower of every Process, and the sum of all voting power. When the
+	// voting power is nil, every Process has a voting power of one, and f is
+	// used to determine thresholds.
+	votingPower      VotingPower
+	totalVotingPower uint64
+	// reconfiguration that will be applied when the Process reaches the
+	// Height of the reconfiguration. It is nil when there is no pending
+	// reconfiguration.
+	reconfiguration *reconfiguration
 
 	// Input interface that provide data to the Process.
 	timer     Timer
@@ -113,13 +147,38 @@ type Process struct {
 	committer   Committer
 	catcher     Catcher
 
+	// observer is notified about state transitions. It is nil when there is
+	// no Observer.
+	observer Observer
+	// logger logs the transition decisions of the Process. It is nil when
+	// there is no logger.
+	logger *zap.Logger
+	// roundRetention is the number of Rounds, before and after the current
+	// Round, that are kept in the message logs. It is zero when all Rounds are
+	// kept.
+	roundRetention int
+	// history of recent votes, used to catch misbehaviour across Heights and
+	// Rounds. It is nil when no history is kept.
+	history *history
+
 	// State of the Process.
 	State `json:"state"`
 }
 
 // New returns a new Process that is in the default State with empty message
-// logs.
+// logs. If the options contain VotingPower, then thresholds are reached when
+// more than 2/3 (or more than 1/3) of the total voting power has been
+// received, and f is ignored. Otherwise, thresholds are reached when 2f+1 (or
+// f+1) messages have been received. If the options contain a number of
+// history Heights, then the Process keeps the votes of that many recent
+// Heights, from the Rounds near the latest Round of each Height, to catch
+// misbehaviour that cannot be caught with the message logs.
+// If the options contain a round retention, then messages from Rounds that are
+// too far from the current Round are dropped from the message logs. If the
+// options contain a logger, then the transition decisions of the Process are
+// logged at the debug level.
 func New(
+	opts Options,
 	whoami id.Signatory,
 	f int,
 	timer Timer,
@@ -130,10 +189,30 @@ func New(
 	committer Committer,
 	catcher Catcher,
 ) Process {
+	var history *history
+	if opts.HistoryHeights > 0 {
+		rounds := opts.HistoryRounds
+		if rounds <= 0 {
+			rounds = opts.RoundRetention
+		}
+		if rounds <= 0 {
+			rounds = DefaultHistoryRounds
+		}
+		history = newHistory(opts.HistoryHeights, rounds)
+	}
+	// The logger is only used by debug, so the caller that is logged is the
+	// caller of debug.
+	var logger *zap.Logger
+	if opts.Logger != nil {
+		logger = opts.Logger.WithOptions(zap.AddCallerSkip(1))
+	}
 	return Process{
 		whoami: whoami,
 		f:      f,
 
+		votingPower:      opts.VotingPower.Copy(),
+		totalVotingPower: opts.VotingPower.Total(),
+
 		timer:     timer,
 		scheduler: scheduler,
 		proposer:  proposer,
@@ -143,6 +222,11 @@ func New(
 		committer:   committer,
 		catcher:     catcher,
 
+		observer:       opts.Observer,
+		logger:         logger,
+		roundRetention: opts.RoundRetention,
+		history:        history,
+
 		State: DefaultState(),
 	}
 }
@@ -192,6 +276,7 @@ func (p *Process) Propose(propose Propose) {
 // broadcast). All conditions that could be opened by the receipt of a Prevote
 // message will be tried.
 func (p *Process) Prevote(prevote Prevote) {
+	p.recordPrevote(prevote)
 	if !p.insertPrevote(prevote) {
 		return
 	}
@@ -208,6 +293,7 @@ func (p *Process) Prevote(prevote Prevote) {
 // broadcast). All conditions that could be opened by the receipt of a Precommit
 // message will be tried.
 func (p *Process) Precommit(precommit Precommit) {
+	p.recordPrecommit(precommit)
 	if !p.insertPrecommit(precommit) {
 		return
 	}
@@ -227,6 +313,103 @@ func (p *Process) Start() {
 	p.StartRound(0)
 }
 
+// Resume the Process, instead of starting it, after its State has been
+// restored from a write-ahead log. The given messages must be all of the
+// messages that the Process broadcast after its State was saved. Because the
+// State might have been saved before these messages were broadcast, the
+// current Round, current Step, LockedValue, and LockedRound are updated to be
+// consistent with them. This guarantees that the Process will not broadcast
+// conflicting messages after resuming. The messages are then broadcast again,
+// in case they were not delivered, and the timeout for the current Step is
+// scheduled again.
+func (p *Process) Resume(proposes []Propose, prevotes []Prevote, precommits []Precommit) {
+	defer func() {
+		p.tryPrecommitUponSufficientPrevotes()
+		p.tryPrecommitNilUponSufficientPrevotes()
+		p.tryPrevoteUponPropose()
+		p.tryPrevoteUponSufficientPrevotes()
+		p.tryTimeoutPrecommitUponSufficientPrecommits()
+		p.tryTimeoutPrevoteUponSufficientPrevotes()
+	}()
+
+	// Move to the latest Round in which the Process broadcast a message. This
+	// can only be later than the current Round if the Process started a new
+	// Round, and proposed, before the State was saved.
+	for _, propose := range proposes {
+		if propose.Height == p.CurrentHeight && propose.Round > p.CurrentRound {
+			p.CurrentRound = propose.Round
+			p.CurrentStep = Proposing
+		}
+	}
+	for _, prevote := range prevotes {
+		if prevote.Height == p.CurrentHeight && prevote.Round > p.CurrentRound {
+			p.CurrentRound = prevote.Round
+			p.CurrentStep = Proposing
+		}
+	}
+	for _, precommit := range precommits {
+		if precommit.Height == p.CurrentHeight && precommit.Round > p.CurrentRound {
+			p.CurrentRound = precommit.Round
+			p.CurrentStep = Proposing
+		}
+	}
+
+	p.pruneRounds()
+
+	// Move past the Steps for which the Process has already broadcast a
+	// message in the current Round, and lock on any Value that the Process
+	// precommitted.
+	for _, prevote := range prevotes {
+		if prevote.Height == p.CurrentHeight && prevote.Round == p.CurrentRound && p.CurrentStep < Prevoting {
+			p.CurrentStep = Prevoting
+		}
+	}
+	for _, precommit := range precommits {
+		if precommit.Height != p.CurrentHeight {
+			continue
+		}
+		if precommit.Round == p.CurrentRound {
+			p.CurrentStep = Precommitting
+		}
+		if !precommit.Value.Equal(&NilValue) && precommit.Round > p.LockedRound {
+			p.lock(precommit.Round, precommit.Value)
+			if precommit.Round > p.ValidRound {
+				p.updateValid(precommit.Round, precommit.Value)
+			}
+		}
+	}
+	if p.observer != nil {
+		p.observer.OnStepChanged(p.CurrentHeight, p.CurrentRound, p.CurrentStep)
+	}
+
+	// Broadcast all messages again, so that they are eventually delivered
+	// (including to this Process).
+	if p.broadcaster != nil {
+		for _, propose := range proposes {
+			if propose.Height == p.CurrentHeight {
+				p.broadcaster.BroadcastPropose(propose)
+			}
+		}
+		for _, prevote := range prevotes {
+			if prevote.Height == p.CurrentHeight {
+				p.broadcaster.BroadcastPrevote(prevote)
+			}
+		}
+		for _, precommit := range precommits {
+			if precommit.Height == p.CurrentHeight {
+				p.broadcaster.BroadcastPrecommit(precommit)
+			}
+		}
+	}
+
+	// Timeouts are not saved, so the timeout for the current Step must be
+	// scheduled again. Scheduling a timeout more than once is safe, because
+	// timeouts are ignored once the Process has moved on.
+	if p.timer != nil {
+		p.scheduleTimeout(p.CurrentStep)
+	}
+}
+
 // StartRound will progress the Process to a new Round. It does not asssume that
 // the Height has changed. Since this changes the current Round and the current
 // Step, most of the condition methods will be retried at the end (by way of
@@ -259,7 +442,8 @@ func (p *Process) StartRound(round Round) {
 	// Roound, or changing the current Step to Proposing, because StartRound is
 	// the only location where this logic happens.
 	p.CurrentRound = round
-	p.CurrentStep = Proposing
+	p.setStep(Proposing)
+	p.pruneRounds()
 
 	// If we are not the proposer, then we trigger the propose timeout.
 	// We proceed only if we have a scheduler impl, because if not, we never
@@ -268,7 +452,7 @@ func (p *Process) StartRound(round Round) {
 		proposer := p.scheduler.Schedule(p.CurrentHeight, p.CurrentRound)
 		if !p.whoami.Equal(&proposer) {
 			if p.timer != nil {
-				p.timer.TimeoutPropose(p.CurrentHeight, p.CurrentRound)
+				p.scheduleTimeout(Proposing)
 			}
 			return
 		}
@@ -276,10 +460,18 @@ func (p *Process) StartRound(round Round) {
 		// If we are the proposer, then we emit a propose.
 		proposeValue := p.ValidValue
 		if proposeValue.Equal(&NilValue) {
+			if proposer, ok := p.proposer.(AsyncProposer); ok {
+				proposer.ProposeAsync(p.CurrentHeight, p.CurrentRound)
+				if p.timer != nil {
+					p.scheduleTimeout(Proposing)
+				}
+				return
+			}
 			if p.proposer != nil {
 				proposeValue = p.proposer.Propose(p.CurrentHeight, p.CurrentRound)
 			}
 		}
+		p.debug("proposing", zap.Stringer("value", proposeValue), zap.Int64("validRound", int64(p.ValidRound)))
 		if p.broadcaster != nil {
 			p.broadcaster.BroadcastPropose(Propose{
 				Height:     p.CurrentHeight,
@@ -292,6 +484,29 @@ func (p *Process) StartRound(round Round) {
 	}
 }
 
+// OnPropose is used to give the Process the Value that was proposed
+// asynchronously by its AsyncProposer. The Value is only broadcast if the
+// Process is still waiting for it: Values for a Height or Round that the
+// Process has left, or that arrive after the Process has timed out, are
+// ignored. It must be called at most once for every call to ProposeAsync.
+func (p *Process) OnPropose(height Height, round Round, value Value) {
+	if height != p.CurrentHeight || round != p.CurrentRound || p.CurrentStep != Proposing {
+		return
+	}
+	if _, ok := p.ProposeLogs[round]; ok {
+		return
+	}
+	if p.broadcaster != nil {
+		p.broadcaster.BroadcastPropose(Propose{
+			Height:     p.CurrentHeight,
+			Round:      p.CurrentRound,
+			ValidRound: p.ValidRound,
+			Value:      value,
+			From:       p.whoami,
+		})
+	}
+}
+
 // OnTimeoutPropose is used to notify the Process that a timeout has been
 // activated. It must only be called after the TimeoutPropose method in the
 // Timer has been called.
@@ -303,6 +518,7 @@ func (p *Process) StartRound(round Round) {
 //			currentStep ← prevote
 func (p *Process) OnTimeoutPropose(height Height, round Round) {
 	if height == p.CurrentHeight && round == p.CurrentRound && p.CurrentStep == Proposing {
+		p.debug("timed out waiting for propose")
 		if p.broadcaster != nil {
 			p.broadcaster.BroadcastPrevote(Prevote{
 				Height: p.CurrentHeight,
@@ -326,6 +542,7 @@ func (p *Process) OnTimeoutPropose(height Height, round Round) {
 //			currentStep ← precommitting
 func (p *Process) OnTimeoutPrevote(height Height, round Round) {
 	if height == p.CurrentHeight && round == p.CurrentRound && p.CurrentStep == Prevoting {
+		p.debug("timed out waiting for prevotes")
 		if p.broadcaster != nil {
 			p.broadcaster.BroadcastPrecommit(Precommit{
 				Height: p.CurrentHeight,
@@ -348,6 +565,7 @@ func (p *Process) OnTimeoutPrevote(height Height, round Round) {
 //			StartRound(currentRound + 1)
 func (p *Process) OnTimeoutPrecommit(height Height, round Round) {
 	if height == p.CurrentHeight && round == p.CurrentRound {
+		p.debug("timed out waiting for precommits")
 		p.StartRound(round + 1)
 	}
 }
@@ -425,13 +643,13 @@ func (p *Process) tryPrevoteUponSufficientPrevotes() {
 		return
 	}
 
-	prevotesInValidRound := 0
+	prevotesInValidRound := uint64(0)
 	for _, prevote := range p.PrevoteLogs[propose.ValidRound] {
 		if prevote.Value.Equal(&propose.Value) {
-			prevotesInValidRound++
+			prevotesInValidRound += p.power(prevote.From)
 		}
 	}
-	if prevotesInValidRound < 2*p.f+1 {
+	if !p.hasSupermajority(prevotesInValidRound) {
 		return
 	}
 
@@ -474,9 +692,13 @@ func (p *Process) tryTimeoutPrevoteUponSufficientPrevotes() {
 	if p.CurrentStep != Prevoting {
 		return
 	}
-	if len(p.PrevoteLogs[p.CurrentRound]) == 2*p.f+1 {
+	prevotes := uint64(0)
+	for _, prevote := range p.PrevoteLogs[p.CurrentRound] {
+		prevotes += p.power(prevote.From)
+	}
+	if p.hasSupermajority(prevotes) {
 		if p.timer != nil {
-			p.timer.TimeoutPrevote(p.CurrentHeight, p.CurrentRound)
+			p.scheduleTimeout(Prevoting)
 			p.setOnceFlag(p.CurrentRound, OnceFlagTimeoutPrevoteUponSufficientPrevotes)
 		}
 	}
@@ -510,19 +732,18 @@ func (p *Process) tryPrecommitUponSufficientPrevotes() {
 	if !ok {
 		return
 	}
-	prevotesForValue := 0
+	prevotesForValue := uint64(0)
 	for _, prevote := range p.PrevoteLogs[p.CurrentRound] {
 		if prevote.Value.Equal(&propose.Value) {
-			prevotesForValue++
+			prevotesForValue += p.power(prevote.From)
 		}
 	}
-	if prevotesForValue < 2*p.f+1 {
+	if !p.hasSupermajority(prevotesForValue) {
 		return
 	}
 
 	if p.CurrentStep == Prevoting {
-		p.LockedValue = propose.Value
-		p.LockedRound = p.CurrentRound
+		p.lock(p.CurrentRound, propose.Value)
 		if p.broadcaster != nil {
 			p.broadcaster.BroadcastPrecommit(Precommit{
 				Height: p.CurrentHeight,
@@ -540,8 +761,7 @@ func (p *Process) tryPrecommitUponSufficientPrevotes() {
 			p.tryPrevoteUponSufficientPrevotes()
 		}()
 	}
-	p.ValidValue = propose.Value
-	p.ValidRound = p.CurrentRound
+	p.updateValid(p.CurrentRound, propose.Value)
 	p.setOnceFlag(p.CurrentRound, OnceFlagPrecommitUponSufficientPrevotes)
 }
 
@@ -558,13 +778,13 @@ func (p *Process) tryPrecommitNilUponSufficientPrevotes() {
 	if p.CurrentStep != Prevoting {
 		return
 	}
-	prevotesForNil := 0
+	prevotesForNil := uint64(0)
 	for _, prevote := range p.PrevoteLogs[p.CurrentRound] {
 		if prevote.Value.Equal(&NilValue) {
-			prevotesForNil++
+			prevotesForNil += p.power(prevote.From)
 		}
 	}
-	if prevotesForNil == 2*p.f+1 {
+	if p.hasSupermajority(prevotesForNil) {
 		if p.broadcaster != nil {
 			p.broadcaster.BroadcastPrecommit(Precommit{
 				Height: p.CurrentHeight,
@@ -590,9 +810,13 @@ func (p *Process) tryTimeoutPrecommitUponSufficientPrecommits() {
 	if p.checkOnceFlag(p.CurrentRound, OnceFlagTimeoutPrecommitUponSufficientPrecommits) {
 		return
 	}
-	if len(p.PrecommitLogs[p.CurrentRound]) == 2*p.f+1 {
+	precommits := uint64(0)
+	for _, precommit := range p.PrecommitLogs[p.CurrentRound] {
+		precommits += p.power(precommit.From)
+	}
+	if p.hasSupermajority(precommits) {
 		if p.timer != nil {
-			p.timer.TimeoutPrecommit(p.CurrentHeight, p.CurrentRound)
+			p.scheduleTimeout(Precommitting)
 			p.setOnceFlag(p.CurrentRound, OnceFlagTimeoutPrecommitUponSufficientPrecommits)
 		}
 	}
@@ -625,32 +849,57 @@ func (p *Process) tryCommitUponSufficientPrecommits(round Round) {
 	if !ok {
 		return
 	}
-	precommitsForValue := 0
+	precommitsForValue := uint64(0)
 	for _, precommit := range p.PrecommitLogs[round] {
 		if precommit.Value.Equal(&propose.Value) {
-			precommitsForValue++
+			precommitsForValue += p.power(precommit.From)
 		}
 	}
-	if precommitsForValue == 2*p.f+1 {
-		p.committer.Commit(p.CurrentHeight, propose.Value)
-		p.CurrentHeight++
-
-		// Reset lockedRound, lockedValue, validRound, and validValue to initial
-		// values.
-		p.LockedValue = NilValue
-		p.LockedRound = InvalidRound
-		p.ValidValue = NilValue
-		p.ValidRound = InvalidRound
+	if p.hasSupermajority(precommitsForValue) {
+		p.commit(p.commitCertificate(round, propose.Value))
+	}
+}
 
-		// Empty message logs in preparation for the new Height.
-		p.ProposeLogs = map[Round]Propose{}
-		p.PrevoteLogs = map[Round]map[id.Signatory]Prevote{}
-		p.PrecommitLogs = map[Round]map[id.Signatory]Precommit{}
-		p.OnceFlags = map[Round]OnceFlag{}
+// FastForward the Process by committing the Value in a CommitCertificate that
+// was produced by other Processes, and moving to the next Height. This is used
+// to catch up with other Processes when messages have been missed. The
+// CommitCertificate must be for the current Height, otherwise it is ignored.
+// The Process does not verify the CommitCertificate, so it must be verified
+// before calling this method (see VerifyCommitCertificate).
+func (p *Process) FastForward(cert CommitCertificate) {
+	if cert.Height != p.CurrentHeight {
+		return
+	}
+	p.commit(cert)
+}
 
-		// Start from the first Round in the new Height.
-		p.StartRound(0)
+// commit the Value in the CommitCertificate, and then move to the first Round
+// of the next Height.
+func (p *Process) commit(cert CommitCertificate) {
+	p.debug("committing", zap.Stringer("value", cert.Value), zap.Int64("commitRound", int64(cert.Round)))
+	if committer, ok := p.committer.(CertifiedCommitter); ok {
+		committer.CommitWithProof(cert)
+	} else {
+		p.committer.Commit(cert.Height, cert.Value)
 	}
+	p.CurrentHeight++
+	p.tryReconfigure()
+
+	// Reset lockedRound, lockedValue, validRound, and validValue to initial
+	// values.
+	p.LockedValue = NilValue
+	p.LockedRound = InvalidRound
+	p.ValidValue = NilValue
+	p.ValidRound = InvalidRound
+
+	// Empty message logs in preparation for the new Height.
+	p.ProposeLogs = map[Round]Propose{}
+	p.PrevoteLogs = map[Round]map[id.Signatory]Prevote{}
+	p.PrecommitLogs = map[Round]map[id.Signatory]Precommit{}
+	p.OnceFlags = map[Round]OnceFlag{}
+
+	// Start from the first Round in the new Height.
+	p.StartRound(0)
 }
 
 // L55:
@@ -668,14 +917,28 @@ func (p *Process) trySkipToFutureRound(round Round) {
 		return
 	}
 
-	msgsInRound := 0
-	if _, ok := p.ProposeLogs[round]; ok {
-		msgsInRound = 1
+	// Processes are only counted once, even if they have sent more than one
+	// message in the Round.
+	senders := map[id.Signatory]struct{}{}
+	if propose, ok := p.ProposeLogs[round]; ok {
+		senders[propose.From] = struct{}{}
+	}
+	for from := range p.PrevoteLogs[round] {
+		senders[from] = struct{}{}
+	}
+	for from := range p.PrecommitLogs[round] {
+		senders[from] = struct{}{}
+	}
+	msgsInRound := uint64(0)
+	for from := range senders {
+		msgsInRound += p.power(from)
 	}
-	msgsInRound += len(p.PrevoteLogs[round])
-	msgsInRound += len(p.PrecommitLogs[round])
 
-	if msgsInRound == p.f+1 {
+	if p.hasMinority(msgsInRound) {
+		p.debug("skipping to future round", zap.Int64("to", int64(round)))
+		if p.observer != nil {
+			p.observer.OnRoundSkipped(p.CurrentHeight, p.CurrentRound, round)
+		}
 		p.StartRound(round)
 	}
 }
@@ -686,6 +949,9 @@ func (p *Process) insertPropose(propose Propose) bool {
 	if propose.Height != p.CurrentHeight {
 		return false
 	}
+	if !p.retainRound(propose.Round) {
+		return false
+	}
 
 	if p.scheduler != nil {
 		proposer := p.scheduler.Schedule(propose.Height, propose.Round)
@@ -705,8 +971,12 @@ func (p *Process) insertPropose(propose Propose) bool {
 			// Proposes at the same Height and Round. Even though we only
 			// explicitly check the Round, we know that the Proposes will have the
 			// same Height, because we only keep message logs for message with the
-			// same Height as the current Height of the Process.
-			if !propose.Equal(&existingPropose) {
+			// same Height as the current Height of the Process. Proposes that
+			// only differ in their Payload are not different, because the
+			// Payload is not signed.
+			withPayload := existingPropose
+			withPayload.Payload = propose.Payload
+			if !propose.Equal(&withPayload) {
 				if p.catcher != nil {
 					p.catcher.CatchDoublePropose(propose, existingPropose)
 				}
@@ -718,6 +988,7 @@ func (p *Process) insertPropose(propose Propose) bool {
 	// By never inserting a Propose that is not valid, we can avoid the validity
 	// checks elsewhere in the Process.
 	if p.validator != nil && !p.validator.Valid(propose.Value) {
+		p.debug("prevoting nil for invalid propose", zap.Stringer("value", propose.Value), zap.Stringer("from", propose.From))
 		if p.broadcaster != nil {
 			p.broadcaster.BroadcastPrevote(Prevote{
 				Height: p.CurrentHeight,
@@ -740,6 +1011,9 @@ func (p *Process) insertPrevote(prevote Prevote) bool {
 	if prevote.Height != p.CurrentHeight {
 		return false
 	}
+	if !p.retainRound(prevote.Round) {
+		return false
+	}
 	if _, ok := p.PrevoteLogs[prevote.Round]; !ok {
 		p.PrevoteLogs[prevote.Round] = map[id.Signatory]Prevote{}
 	}
@@ -770,6 +1044,9 @@ func (p *Process) insertPrecommit(precommit Precommit) bool {
 	if precommit.Height != p.CurrentHeight {
 		return false
 	}
+	if !p.retainRound(precommit.Round) {
+		return false
+	}
 	if _, ok := p.PrecommitLogs[precommit.Round]; !ok {
 		p.PrecommitLogs[precommit.Round] = map[id.Signatory]Precommit{}
 	}
@@ -793,10 +1070,97 @@ func (p *Process) insertPrecommit(precommit Precommit) bool {
 	return true
 }
 
+// commitCertificate returns a CommitCertificate for the given Value at the
+// current Height and the given Round. It contains all of the Precommits for the
+// Value that have been received in the Round, sorted by their sender so that
+// the CommitCertificate is deterministic.
+func (p *Process) commitCertificate(round Round, value Value) CommitCertificate {
+	precommits := make([]Precommit, 0, len(p.PrecommitLogs[round]))
+	for _, precommit := range p.PrecommitLogs[round] {
+		if precommit.Value.Equal(&value) {
+			precommits = append(precommits, precommit)
+		}
+	}
+	sort.Slice(precommits, func(i, j int) bool {
+		return bytes.Compare(precommits[i].From[:], precommits[j].From[:]) < 0
+	})
+	cert := CommitCertificate{
+		Height:     p.CurrentHeight,
+		Round:      round,
+		Value:      value,
+		Precommits: precommits,
+	}
+	if propose, ok := p.ProposeLogs[round]; ok && propose.Value.Equal(&value) {
+		cert.Payload = propose.Payload
+	}
+	return cert
+}
+
+// Reconfigure the Process so that, once it reaches the given Height, it uses
+// the given f, voting power, and Scheduler for all remaining Heights. The
+// reconfiguration happens atomically when the Process commits the Value at the
+// previous Height, before it starts the first Round of the new Height. Only
+// one reconfiguration can be pending at a time, and calling Reconfigure again
+// replaces the pending reconfiguration. The Height must be greater than the
+// current Height.
+func (p *Process) Reconfigure(height Height, f int, votingPower VotingPower, scheduler Scheduler) {
+	if height <= p.CurrentHeight {
+		panic(fmt.Errorf("invalid reconfiguration height: expected height>%v, got height=%v", p.CurrentHeight, height))
+	}
+	p.reconfiguration = &reconfiguration{
+		height:      height,
+		f:           f,
+		votingPower: votingPower.Copy(),
+		scheduler:   scheduler,
+	}
+}
+
+// tryReconfigure applies the pending reconfiguration if the Process has
+// reached its Height.
+func (p *Process) tryReconfigure() {
+	if p.reconfiguration == nil || p.reconfiguration.height > p.CurrentHeight {
+		return
+	}
+	p.f = p.reconfiguration.f
+	p.votingPower = p.reconfiguration.votingPower
+	p.totalVotingPower = p.reconfiguration.votingPower.Total()
+	p.scheduler = p.reconfiguration.scheduler
+	p.reconfiguration = nil
+}
+
+// power returns the voting power of a Process. When there is no voting power,
+// every Process has a voting power of one.
+func (p *Process) power(signatory id.Signatory) uint64 {
+	if p.votingPower == nil {
+		return 1
+	}
+	return p.votingPower[signatory]
+}
+
+// hasSupermajority returns true if the given voting power is sufficient to
+// meet a 2f+1 threshold. When there is voting power, this is more than 2/3 of
+// the total voting power.
+func (p *Process) hasSupermajority(power uint64) bool {
+	if p.votingPower == nil {
+		return power >= uint64(2*p.f+1)
+	}
+	return 3*power > 2*p.totalVotingPower
+}
+
+// hasMinority returns true if the given voting power is sufficient to meet an
+// f+1 threshold. When there is voting power, this is more than 1/3 of the total
+// voting power.
+func (p *Process) hasMinority(power uint64) bool {
+	if p.votingPower == nil {
+		return power >= uint64(p.f+1)
+	}
+	return 3*power > p.totalVotingPower
+}
+
 // stepToPrevoting puts the Process into the Prevoting Step. This will also try
 // other methods that might now have passing conditions.
 func (p *Process) stepToPrevoting() {
-	p.CurrentStep = Prevoting
+	p.setStep(Prevoting)
 
 	// Because the current Step of the Process has changed, new conditions might
 	// be open, so we try the relevant ones. Once flags protect us against
@@ -809,7 +1173,7 @@ func (p *Process) stepToPrevoting() {
 // stepToPrecommitting puts the Process into the Precommitting Step. This will
 // also try other methods that might now have passing conditions.
 func (p *Process) stepToPrecommitting() {
-	p.CurrentStep = Precommitting
+	p.setStep(Precommitting)
 
 	// Because the current Step of the Process has changed, new conditions might
 	// be open, so we try the relevant ones. Once flags protect us against
@@ -838,3 +1202,11 @@ const (
 	OnceFlagTimeoutPrevoteUponSufficientPrevotes     = OnceFlag(2)
 	OnceFlagPrecommitUponSufficientPrevotes          = OnceFlag(4)
 )
+
+// A reconfiguration of a Process that will be applied at a future Height.
+type reconfiguration struct {
+	height      Height
+	f           int
+	votingPower VotingPower
+	scheduler   Scheduler
+}
@@ -2,6 +2,7 @@ package process_test
 
 import (
 	"bytes"
+	"fmt"
 	"math/rand"
 	"testing/quick"
 	"time"
@@ -12,6 +13,8 @@ import (
 	"github.com/renproject/hyperdrive/timer"
 	"github.com/renproject/id"
 	"github.com/renproject/surge"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -94,7 +97,7 @@ var _ = Describe("Process", func() {
 
 		It("should start the zeroeth round on start", func() {
 			f := func() bool {
-				p := process.New(id.NewPrivKey().Signatory(), 33, nil, nil, nil, nil, nil, nil, nil)
+				p := process.New(process.DefaultOptions(), id.NewPrivKey().Signatory(), 33, nil, nil, nil, nil, nil, nil, nil)
 				p.Start()
 				Expect(p.CurrentRound).To(Equal(process.Round(0)))
 				Expect(p.CurrentHeight).To(Equal(process.Height(1)))
@@ -107,7 +110,7 @@ var _ = Describe("Process", func() {
 		It("should set the current round to that round and set the current step to proposing", func() {
 			f := func() bool {
 				round := processutil.RandomRound(r)
-				p := process.New(id.NewPrivKey().Signatory(), 33, nil, nil, nil, nil, nil, nil, nil)
+				p := process.New(process.DefaultOptions(), id.NewPrivKey().Signatory(), 33, nil, nil, nil, nil, nil, nil, nil)
 				p.StartRound(round)
 				Expect(p.CurrentRound).To(Equal(round))
 				Expect(p.CurrentStep).To(Equal(process.Proposing))
@@ -133,7 +136,7 @@ var _ = Describe("Process", func() {
 								Expect(proposal.Value).To(Equal(value))
 							},
 						}
-						p := process.New(whoami, 33, nil, scheduler, nil, nil, broadcaster, nil, nil)
+						p := process.New(process.DefaultOptions(), whoami, 33, nil, scheduler, nil, nil, broadcaster, nil, nil)
 						p.State.ValidValue = value
 						p.StartRound(round)
 						return true
@@ -159,13 +162,83 @@ var _ = Describe("Process", func() {
 								Expect(proposal.Value).To(Equal(value))
 							},
 						}
-						p := process.New(whoami, 33, nil, scheduler, proposer, nil, broadcaster, nil, nil)
+						p := process.New(process.DefaultOptions(), whoami, 33, nil, scheduler, proposer, nil, broadcaster, nil, nil)
 						p.StartRound(round)
 						return true
 					}
 					Expect(quick.Check(f, nil)).To(Succeed())
 				})
 			})
+
+			Context("when our proposer is asynchronous", func() {
+				It("should only propose the value if it is still waiting for it", func() {
+					f := func() bool {
+						round := processutil.RandomRound(r)
+						for round == process.InvalidRound {
+							round = processutil.RandomRound(r)
+						}
+						whoami := id.NewPrivKey().Signatory()
+						scheduler := scheduler.NewRoundRobin([]id.Signatory{whoami})
+						value := processutil.RandomGoodValue(r)
+
+						requested := 0
+						proposer := processutil.AsyncProposerCallback{
+							Callback: func(height process.Height, r process.Round) {
+								Expect(height).To(Equal(process.Height(1)))
+								Expect(r).To(Equal(round))
+								requested++
+							},
+						}
+						var proposes []process.Propose
+						broadcaster := processutil.BroadcasterCallbacks{
+							BroadcastProposeCallback: func(propose process.Propose) {
+								proposes = append(proposes, propose)
+							},
+						}
+						p := process.New(process.DefaultOptions(), whoami, 33, nil, scheduler, proposer, nil, broadcaster, nil, nil)
+						p.StartRound(round)
+						Expect(requested).To(Equal(1))
+						Expect(proposes).To(BeEmpty())
+
+						// values for other heights and rounds are ignored
+						p.OnPropose(2, round, value)
+						p.OnPropose(1, round+1, value)
+						Expect(proposes).To(BeEmpty())
+
+						// the value for the current height and round is
+						// proposed
+						p.OnPropose(1, round, value)
+						Expect(proposes).To(HaveLen(1))
+						Expect(proposes[0].Height).To(Equal(process.Height(1)))
+						Expect(proposes[0].Round).To(Equal(round))
+						Expect(proposes[0].Value).To(Equal(value))
+						Expect(proposes[0].From.Equal(&whoami)).To(BeTrue())
+						return true
+					}
+					Expect(quick.Check(f, nil)).To(Succeed())
+				})
+
+				It("should not propose the value after timing out", func() {
+					f := func() bool {
+						whoami := id.NewPrivKey().Signatory()
+						scheduler := scheduler.NewRoundRobin([]id.Signatory{whoami})
+						proposes := 0
+						broadcaster := processutil.BroadcasterCallbacks{
+							BroadcastProposeCallback: func(propose process.Propose) {
+								proposes++
+							},
+						}
+						p := process.New(process.DefaultOptions(), whoami, 33, nil, scheduler, processutil.AsyncProposerCallback{}, nil, broadcaster, nil, nil)
+						p.StartRound(0)
+						p.OnTimeoutPropose(1, 0)
+						Expect(p.CurrentStep).To(Equal(process.Prevoting))
+						p.OnPropose(1, 0, processutil.RandomGoodValue(r))
+						Expect(proposes).To(Equal(0))
+						return true
+					}
+					Expect(quick.Check(f, nil)).To(Succeed())
+				})
+			})
 		})
 
 		Context("when we are not the proposer", func() {
@@ -185,7 +258,7 @@ var _ = Describe("Process", func() {
 					onProposeTimeoutChan := make(chan timer.Timeout, 2)
 					timer := timer.NewLinearTimer(timerOptions, onProposeTimeoutChan, nil, nil)
 
-					p := process.New(whoami, 33, timer, scheduler, nil, nil, nil, nil, nil)
+					p := process.New(process.DefaultOptions(), whoami, 33, timer, scheduler, nil, nil, nil, nil, nil)
 					p.StartRound(round)
 
 					timeout := <-onProposeTimeoutChan
@@ -231,7 +304,7 @@ var _ = Describe("Process", func() {
 							onProposeTimeoutChan := make(chan timer.Timeout, 2)
 							timer := timer.NewLinearTimer(timerOptions, onProposeTimeoutChan, nil, nil)
 
-							p := process.New(whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
+							p := process.New(process.DefaultOptions(), whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
 							p.OnTimeoutPropose(process.Height(1), round)
 							return true
 						}
@@ -262,7 +335,7 @@ var _ = Describe("Process", func() {
 							onProposeTimeoutChan := make(chan timer.Timeout, 2)
 							timer := timer.NewLinearTimer(timerOptions, onProposeTimeoutChan, nil, nil)
 
-							p := process.New(whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
+							p := process.New(process.DefaultOptions(), whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
 							p.State.CurrentStep = process.Prevoting
 							p.OnTimeoutPropose(process.Height(1), round)
 							return true
@@ -292,7 +365,7 @@ var _ = Describe("Process", func() {
 							WithTimeoutScaling(0)
 						onProposeTimeoutChan := make(chan timer.Timeout, 2)
 						timer := timer.NewLinearTimer(timerOptions, onProposeTimeoutChan, nil, nil)
-						p := process.New(whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
+						p := process.New(process.DefaultOptions(), whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
 
 						// set the current round
 						p.State.CurrentRound = round
@@ -331,7 +404,7 @@ var _ = Describe("Process", func() {
 						WithTimeoutScaling(0)
 					onProposeTimeoutChan := make(chan timer.Timeout, 2)
 					timer := timer.NewLinearTimer(timerOptions, onProposeTimeoutChan, nil, nil)
-					p := process.New(whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
+					p := process.New(process.DefaultOptions(), whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
 
 					// when a new process starts, it starts at height == 1
 					// timeout for some other height not equal to 1
@@ -379,7 +452,7 @@ var _ = Describe("Process", func() {
 							onPrevoteTimeoutChan := make(chan timer.Timeout, 2)
 							timer := timer.NewLinearTimer(timerOptions, nil, onPrevoteTimeoutChan, nil)
 
-							p := process.New(whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
+							p := process.New(process.DefaultOptions(), whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
 							p.State.CurrentStep = process.Prevoting
 							p.State.CurrentRound = round
 							p.OnTimeoutPrevote(process.Height(1), round)
@@ -411,7 +484,7 @@ var _ = Describe("Process", func() {
 							onPrevoteTimeoutChan := make(chan timer.Timeout, 2)
 							timer := timer.NewLinearTimer(timerOptions, nil, onPrevoteTimeoutChan, nil)
 
-							p := process.New(whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
+							p := process.New(process.DefaultOptions(), whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
 							someOtherStep := processutil.RandomStep(r)
 							for someOtherStep == process.Prevoting {
 								someOtherStep = processutil.RandomStep(r)
@@ -448,7 +521,7 @@ var _ = Describe("Process", func() {
 						onPrevoteTimeoutChan := make(chan timer.Timeout, 2)
 						timer := timer.NewLinearTimer(timerOptions, nil, onPrevoteTimeoutChan, nil)
 
-						p := process.New(whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
+						p := process.New(process.DefaultOptions(), whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
 						p.State.CurrentStep = process.Prevoting
 						p.State.CurrentRound = round
 						someOtherRound := processutil.RandomRound(r)
@@ -485,7 +558,7 @@ var _ = Describe("Process", func() {
 					onPrevoteTimeoutChan := make(chan timer.Timeout, 2)
 					timer := timer.NewLinearTimer(timerOptions, nil, onPrevoteTimeoutChan, nil)
 
-					p := process.New(whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
+					p := process.New(process.DefaultOptions(), whoami, 33, timer, nil, nil, nil, broadcaster, nil, nil)
 					p.State.CurrentStep = process.Prevoting
 					p.State.CurrentRound = round
 					someOtherHeight := processutil.RandomHeight(r)
@@ -517,7 +590,7 @@ var _ = Describe("Process", func() {
 							round = processutil.RandomRound(r)
 						}
 						whoami := id.NewPrivKey().Signatory()
-						p := process.New(whoami, 33, nil, nil, nil, nil, nil, nil, nil)
+						p := process.New(process.DefaultOptions(), whoami, 33, nil, nil, nil, nil, nil, nil, nil)
 						p.State.CurrentStep = processutil.RandomStep(r)
 						p.State.CurrentRound = round
 
@@ -537,7 +610,7 @@ var _ = Describe("Process", func() {
 							round = processutil.RandomRound(r)
 						}
 						whoami := id.NewPrivKey().Signatory()
-						p := process.New(whoami, 33, nil, nil, nil, nil, nil, nil, nil)
+						p := process.New(process.DefaultOptions(), whoami, 33, nil, nil, nil, nil, nil, nil, nil)
 						p.State.CurrentRound = round
 						p.State.CurrentStep = processutil.RandomStep(r)
 						someOtherRound := processutil.RandomRound(r)
@@ -563,7 +636,7 @@ var _ = Describe("Process", func() {
 						round = processutil.RandomRound(r)
 					}
 					whoami := id.NewPrivKey().Signatory()
-					p := process.New(whoami, 33, nil, nil, nil, nil, nil, nil, nil)
+					p := process.New(process.DefaultOptions(), whoami, 33, nil, nil, nil, nil, nil, nil, nil)
 					p.State.CurrentStep = processutil.RandomStep(r)
 					p.State.CurrentRound = round
 					someOtherHeight := processutil.RandomHeight(r)
@@ -616,7 +689,7 @@ var _ = Describe("Process", func() {
 								scheduler := scheduler.NewRoundRobin([]id.Signatory{scheduledProposer})
 								validator := processutil.MockValidator{MockValid: func(process.Value) bool { return true }}
 
-								p := process.New(whoami, 33, nil, scheduler, nil, validator, broadcaster, nil, nil)
+								p := process.New(process.DefaultOptions(), whoami, 33, nil, scheduler, nil, validator, broadcaster, nil, nil)
 								p.StartRound(round)
 
 								p.State.CurrentStep = process.Proposing
@@ -658,7 +731,7 @@ var _ = Describe("Process", func() {
 								scheduler := scheduler.NewRoundRobin([]id.Signatory{scheduledProposer})
 								validator := processutil.MockValidator{MockValid: func(process.Value) bool { return true }}
 
-								p := process.New(whoami, 33, nil, scheduler, nil, validator, broadcaster, nil, nil)
+								p := process.New(process.DefaultOptions(), whoami, 33, nil, scheduler, nil, validator, broadcaster, nil, nil)
 								p.StartRound(round)
 
 								someValidRound := processutil.RandomRound(r)
@@ -704,7 +777,7 @@ var _ = Describe("Process", func() {
 								scheduler := scheduler.NewRoundRobin([]id.Signatory{scheduledProposer})
 								validator := processutil.MockValidator{MockValid: func(process.Value) bool { return true }}
 
-								p := process.New(whoami, 33, nil, scheduler, nil, validator, broadcaster, nil, nil)
+								p := process.New(process.DefaultOptions(), whoami, 33, nil, scheduler, nil, validator, broadcaster, nil, nil)
 								p.StartRound(round)
 								someValidRound := processutil.RandomRound(r)
 								for someValidRound == process.InvalidRound {
@@ -749,7 +822,7 @@ var _ = Describe("Process", func() {
 							scheduler := scheduler.NewRoundRobin([]id.Signatory{scheduledProposer})
 							validator := processutil.MockValidator{MockValid: func(process.Value) bool { return false }}
 
-							p := process.New(whoami, 33, nil, scheduler, nil, validator, broadcaster, nil, nil)
+							p := process.New(process.DefaultOptions(), whoami, 33, nil, scheduler, nil, validator, broadcaster, nil, nil)
 							p.StartRound(round)
 							p.State.CurrentStep = process.Proposing
 							p.Propose(process.Propose{
@@ -786,7 +859,7 @@ var _ = Describe("Process", func() {
 						scheduler := scheduler.NewRoundRobin([]id.Signatory{scheduledProposer})
 						validator := processutil.MockValidator{MockValid: func(process.Value) bool { return true }}
 
-						p := process.New(whoami, 33, nil, scheduler, nil, validator, broadcaster, nil, nil)
+						p := process.New(process.DefaultOptions(), whoami, 33, nil, scheduler, nil, validator, broadcaster, nil, nil)
 						p.StartRound(round)
 						someOtherStep := processutil.RandomStep(r)
 						for someOtherStep == process.Proposing {
@@ -823,7 +896,7 @@ var _ = Describe("Process", func() {
 					}
 					scheduler := scheduler.NewRoundRobin([]id.Signatory{id.NewPrivKey().Signatory()})
 
-					p := process.New(whoami, 33, nil, scheduler, nil, nil, broadcaster, nil, nil)
+					p := process.New(process.DefaultOptions(), whoami, 33, nil, scheduler, nil, nil, broadcaster, nil, nil)
 					p.StartRound(round)
 					p.State.CurrentStep = process.Proposing
 					p.Propose(process.Propose{
@@ -856,7 +929,7 @@ var _ = Describe("Process", func() {
 					}
 					scheduler := scheduler.NewRoundRobin([]id.Signatory{id.NewPrivKey().Signatory()})
 
-					p := process.New(whoami, 33, nil, scheduler, nil, nil, broadcaster, nil, nil)
+					p := process.New(process.DefaultOptions(), whoami, 33, nil, scheduler, nil, nil, broadcaster, nil, nil)
 					p.StartRound(round)
 					p.State.CurrentStep = process.Proposing
 					prevState := p.State
@@ -954,7 +1027,7 @@ var _ = Describe("Process", func() {
 											},
 										}
 										// create process and start this round
-										p := process.New(whoami, f, nil, mockScheduler, nil, mockValidator, broadcaster, nil, nil)
+										p := process.New(process.DefaultOptions(), whoami, f, nil, mockScheduler, nil, mockValidator, broadcaster, nil, nil)
 										p.StartRound(currentRound)
 										p.State.LockedRound = lockedRound
 
@@ -1022,7 +1095,7 @@ var _ = Describe("Process", func() {
 											},
 										}
 										// create process and start this round
-										p := process.New(whoami, f, nil, mockScheduler, nil, mockValidator, broadcaster, nil, nil)
+										p := process.New(process.DefaultOptions(), whoami, f, nil, mockScheduler, nil, mockValidator, broadcaster, nil, nil)
 										p.StartRound(currentRound)
 										p.State.LockedRound = lockedRound
 										p.State.LockedValue = proposedValue
@@ -1097,7 +1170,7 @@ var _ = Describe("Process", func() {
 											},
 										}
 										// create process and start this round
-										p := process.New(whoami, f, nil, mockScheduler, nil, mockValidator, broadcaster, nil, nil)
+										p := process.New(process.DefaultOptions(), whoami, f, nil, mockScheduler, nil, mockValidator, broadcaster, nil, nil)
 										p.StartRound(currentRound)
 										p.State.LockedRound = lockedRound
 										p.State.LockedValue = lockedValue
@@ -1168,7 +1241,7 @@ var _ = Describe("Process", func() {
 										},
 									}
 									// create process and start this round
-									p := process.New(whoami, f, nil, mockScheduler, nil, mockValidator, broadcaster, nil, nil)
+									p := process.New(process.DefaultOptions(), whoami, f, nil, mockScheduler, nil, mockValidator, broadcaster, nil, nil)
 									p.StartRound(currentRound)
 									p.State.LockedRound = lockedRound
 									p.State.LockedValue = proposedValue
@@ -1237,7 +1310,7 @@ var _ = Describe("Process", func() {
 									},
 								}
 								// create process and start this round
-								p := process.New(whoami, f, nil, mockScheduler, nil, mockValidator, broadcaster, nil, nil)
+								p := process.New(process.DefaultOptions(), whoami, f, nil, mockScheduler, nil, mockValidator, broadcaster, nil, nil)
 								p.StartRound(currentRound)
 								p.State.LockedRound = lockedRound
 								p.State.LockedValue = proposedValue
@@ -1290,7 +1363,7 @@ var _ = Describe("Process", func() {
 							Expect(true).ToNot(BeTrue())
 						},
 					}
-					p := process.New(whoami, f, nil, mockScheduler, nil, mockValidator, broadcaster, nil, nil)
+					p := process.New(process.DefaultOptions(), whoami, f, nil, mockScheduler, nil, mockValidator, broadcaster, nil, nil)
 					p.StartRound(round)
 
 					for t := 0; t < 2*f+1; t++ {
@@ -1349,8 +1422,10 @@ var _ = Describe("Process", func() {
 					// own process components
 					whoami := id.NewPrivKey().Signatory()
 					f := 10 + (r.Int() % 5)
+					clock := timer.NewManualClock(time.Now())
 					timerOptions := timer.
 						DefaultOptions().
+						WithClock(clock).
 						WithTimeout(1 * time.Millisecond).
 						WithTimeoutScaling(0)
 					onPrevoteTimeoutChan := make(chan timer.Timeout, 2)
@@ -1358,7 +1433,7 @@ var _ = Describe("Process", func() {
 
 					// instantiate a new process
 					// and start round
-					p := process.New(whoami, f, timer, nil, nil, nil, nil, nil, nil)
+					p := process.New(process.DefaultOptions(), whoami, f, timer, nil, nil, nil, nil, nil, nil)
 					p.StartRound(currentRound)
 					// set the current step to be prevoting
 					p.State.CurrentStep = process.Prevoting
@@ -1368,6 +1443,7 @@ var _ = Describe("Process", func() {
 						prevoteMsg := randomValidPrevoteMsg(r, id.NewPrivKey().Signatory(), process.Height(1), currentRound)
 						p.Prevote(prevoteMsg)
 
+						clock.Advance(time.Millisecond)
 						time.Sleep(5 * time.Millisecond)
 						select {
 						case _ = <-onPrevoteTimeoutChan:
@@ -1382,20 +1458,19 @@ var _ = Describe("Process", func() {
 					prevoteMsg := randomValidPrevoteMsg(r, id.NewPrivKey().Signatory(), process.Height(1), currentRound)
 					p.Prevote(prevoteMsg)
 
-					time.Sleep(5 * time.Millisecond)
-					select {
-					case timeout := <-onPrevoteTimeoutChan:
-						Expect(timeout.Round).To(Equal(currentRound))
-						Expect(timeout.Height).To(Equal(process.Height(1)))
-					default:
-						// we do expect to receive a scheduled timeout
-						Expect(true).ToNot(BeTrue())
-					}
+					// the timeout is emitted once it has passed
+					Eventually(clock.Waiting).Should(Equal(1))
+					clock.Advance(time.Millisecond)
+					Eventually(func() int { return len(onPrevoteTimeoutChan) }).Should(Equal(1))
+					timeout := <-onPrevoteTimeoutChan
+					Expect(timeout.Round).To(Equal(currentRound))
+					Expect(timeout.Height).To(Equal(process.Height(1)))
 
 					// should not schedule a timeout again (that the once flags work)
 					prevoteMsg = randomValidPrevoteMsg(r, id.NewPrivKey().Signatory(), process.Height(1), currentRound)
 					p.Prevote(prevoteMsg)
 
+					clock.Advance(time.Millisecond)
 					time.Sleep(5 * time.Millisecond)
 					select {
 					case _ = <-onPrevoteTimeoutChan:
@@ -1432,7 +1507,7 @@ var _ = Describe("Process", func() {
 
 					// instantiate a new process
 					// and start round
-					p := process.New(whoami, f, timer, nil, nil, nil, nil, nil, nil)
+					p := process.New(process.DefaultOptions(), whoami, f, timer, nil, nil, nil, nil, nil, nil)
 					p.StartRound(currentRound)
 					// set the current step to not be prevoting
 					someOtherStep := processutil.RandomStep(r)
@@ -1541,7 +1616,7 @@ var _ = Describe("Process", func() {
 							scheduler := scheduler.NewRoundRobin([]id.Signatory{scheduledProposer})
 
 							// instantiate a new process and its state
-							p := process.New(whoami, f, nil, scheduler, nil, nil, broadcaster, nil, nil)
+							p := process.New(process.DefaultOptions(), whoami, f, nil, scheduler, nil, nil, broadcaster, nil, nil)
 							p.State.CurrentHeight = currentHeight
 							p.StartRound(currentRound)
 							p.State.CurrentStep = process.Prevoting
@@ -1643,7 +1718,7 @@ var _ = Describe("Process", func() {
 							scheduler := scheduler.NewRoundRobin([]id.Signatory{scheduledProposer})
 
 							// instantiate a new process and its state
-							p := process.New(whoami, f, nil, scheduler, nil, nil, broadcaster, nil, nil)
+							p := process.New(process.DefaultOptions(), whoami, f, nil, scheduler, nil, nil, broadcaster, nil, nil)
 							p.State.CurrentHeight = currentHeight
 							p.StartRound(currentRound)
 							p.State.CurrentStep = process.Precommitting
@@ -1730,7 +1805,7 @@ var _ = Describe("Process", func() {
 						scheduler := scheduler.NewRoundRobin([]id.Signatory{scheduledProposer})
 
 						// instantiate a new process and its state
-						p := process.New(whoami, f, nil, scheduler, nil, nil, broadcaster, nil, nil)
+						p := process.New(process.DefaultOptions(), whoami, f, nil, scheduler, nil, nil, broadcaster, nil, nil)
 						p.State.CurrentHeight = currentHeight
 						p.StartRound(currentRound)
 						p.State.CurrentStep = process.Proposing
@@ -1803,7 +1878,7 @@ var _ = Describe("Process", func() {
 					validator := processutil.MockValidator{MockValid: func(process.Value) bool { return false }}
 
 					// instantiate a new process and its state
-					p := process.New(whoami, f, nil, scheduler, nil, validator, broadcaster, nil, nil)
+					p := process.New(process.DefaultOptions(), whoami, f, nil, scheduler, nil, validator, broadcaster, nil, nil)
 					p.State.CurrentHeight = currentHeight
 					p.StartRound(currentRound)
 					p.State.CurrentStep = process.Prevoting
@@ -1886,7 +1961,7 @@ var _ = Describe("Process", func() {
 						},
 					}
 					f := 5 + (r.Int() % 10)
-					p := process.New(whoami, f, nil, nil, nil, nil, broadcaster, nil, nil)
+					p := process.New(process.DefaultOptions(), whoami, f, nil, nil, nil, nil, broadcaster, nil, nil)
 					p.StartRound(currentRound)
 
 					// the process is in the Prevoting step
@@ -1936,7 +2011,7 @@ var _ = Describe("Process", func() {
 						},
 					}
 					f := 5 + (r.Int() % 10)
-					p := process.New(whoami, f, nil, nil, nil, nil, broadcaster, nil, nil)
+					p := process.New(process.DefaultOptions(), whoami, f, nil, nil, nil, nil, broadcaster, nil, nil)
 					p.StartRound(currentRound)
 
 					// the process is NOT in the Prevoting step
@@ -1996,15 +2071,17 @@ var _ = Describe("Process", func() {
 				}
 				// parameters for the process
 				f := 10 + (r.Int() % 5)
+				clock := timer.NewManualClock(time.Now())
 				timerOptions := timer.
 					DefaultOptions().
+					WithClock(clock).
 					WithTimeout(1 * time.Millisecond).
 					WithTimeoutScaling(0)
 				onPrecommitTimeoutChan := make(chan timer.Timeout, 2)
 				timer := timer.NewLinearTimer(timerOptions, nil, nil, onPrecommitTimeoutChan)
 
 				// intantiate the process
-				p := process.New(id.NewPrivKey().Signatory(), f, timer, nil, nil, nil, nil, nil, nil)
+				p := process.New(process.DefaultOptions(), id.NewPrivKey().Signatory(), f, timer, nil, nil, nil, nil, nil, nil)
 				p.StartRound(currentRound)
 
 				// set the process to be at any random step
@@ -2015,6 +2092,7 @@ var _ = Describe("Process", func() {
 					msg := randomValidPrecommitMsg(r, process.Height(1), currentRound)
 					p.Precommit(msg)
 
+					clock.Advance(time.Millisecond)
 					time.Sleep(5 * time.Millisecond)
 					select {
 					case _ = <-onPrecommitTimeoutChan:
@@ -2029,20 +2107,20 @@ var _ = Describe("Process", func() {
 				msg := randomValidPrecommitMsg(r, process.Height(1), currentRound)
 				p.Precommit(msg)
 
-				time.Sleep(5 * time.Millisecond)
-				select {
-				case timeout := <-onPrecommitTimeoutChan:
-					Expect(timeout.Height).To(Equal(process.Height(1)))
-					Expect(timeout.Round).To(Equal(currentRound))
-				default:
-					Expect(true).ToNot(BeTrue())
-				}
+				// the timeout is emitted once it has passed
+				Eventually(clock.Waiting).Should(Equal(1))
+				clock.Advance(time.Millisecond)
+				Eventually(func() int { return len(onPrecommitTimeoutChan) }).Should(Equal(1))
+				timeout := <-onPrecommitTimeoutChan
+				Expect(timeout.Height).To(Equal(process.Height(1)))
+				Expect(timeout.Round).To(Equal(currentRound))
 
 				// sending further messages should not schedule another timeout
 				// (once flags should prevent this)
 				msg = randomValidPrecommitMsg(r, process.Height(1), currentRound)
 				p.Precommit(msg)
 
+				clock.Advance(time.Millisecond)
 				time.Sleep(5 * time.Millisecond)
 				select {
 				case _ = <-onPrecommitTimeoutChan:
@@ -2074,7 +2152,7 @@ var _ = Describe("Process", func() {
 				timer := timer.NewLinearTimer(timerOptions, nil, nil, onPrecommitTimeoutChan)
 
 				// intantiate the process
-				p := process.New(id.NewPrivKey().Signatory(), f, timer, nil, nil, nil, nil, nil, nil)
+				p := process.New(process.DefaultOptions(), id.NewPrivKey().Signatory(), f, timer, nil, nil, nil, nil, nil, nil)
 				p.StartRound(currentRound)
 
 				// set the process to be at any random step
@@ -2130,7 +2208,7 @@ var _ = Describe("Process", func() {
 				timer := timer.NewLinearTimer(timerOptions, nil, nil, onPrecommitTimeoutChan)
 
 				// intantiate the process
-				p := process.New(id.NewPrivKey().Signatory(), f, timer, nil, nil, nil, nil, nil, nil)
+				p := process.New(process.DefaultOptions(), id.NewPrivKey().Signatory(), f, timer, nil, nil, nil, nil, nil, nil)
 				p.StartRound(currentRound)
 
 				// set the process to be at any random step
@@ -2230,7 +2308,7 @@ var _ = Describe("Process", func() {
 
 						// instantiate a new process at the current round and height
 						// and at any valid step
-						p := process.New(whoami, f, nil, scheduler, nil, validator, nil, committer, nil)
+						p := process.New(process.DefaultOptions(), whoami, f, nil, scheduler, nil, validator, nil, committer, nil)
 						p.StartRound(currentRound)
 						p.State.CurrentHeight = currentHeight
 						p.State.CurrentStep = process.Step(r.Int() % 3)
@@ -2290,7 +2368,7 @@ var _ = Describe("Process", func() {
 
 						// instantiate a new process at the current round and height
 						// and at any valid step
-						p := process.New(whoami, f, nil, nil, nil, nil, nil, committer, nil)
+						p := process.New(process.DefaultOptions(), whoami, f, nil, nil, nil, nil, nil, committer, nil)
 						p.StartRound(currentRound)
 						p.State.CurrentHeight = currentHeight
 						p.State.CurrentStep = process.Step(r.Int() % 3)
@@ -2328,6 +2406,71 @@ var _ = Describe("Process", func() {
 					}
 					Expect(quick.Check(loop, nil)).To(Succeed())
 				})
+
+				It("should commit with a certificate of the 2f+1 precommits (with a certified committer)", func() {
+					loop := func() bool {
+						currentHeight := process.Height(r.Int63())
+						currentRound := process.Round(r.Int63())
+						proposedValue := processutil.RandomValue(r)
+						for proposedValue == process.NilValue {
+							proposedValue = processutil.RandomValue(r)
+						}
+						whoami := id.NewPrivKey().Signatory()
+						f := 5 + (r.Int() % 10)
+						var cert *process.CommitCertificate
+						committer := processutil.CertifiedCommitterCallback{
+							Callback: func(commitCert process.CommitCertificate) {
+								cert = &commitCert
+							},
+						}
+
+						// instantiate a new process at the current round and height
+						p := process.New(process.DefaultOptions(), whoami, f, nil, nil, nil, nil, nil, committer, nil)
+						p.StartRound(currentRound)
+						p.State.CurrentHeight = currentHeight
+
+						// feed the process with 2f+1 precommit messages, and some
+						// precommit messages for other values that must not be
+						// included in the certificate
+						precommits := make(map[id.Signatory]process.Precommit, 2*f+1)
+						for t := 0; t < 2*f+1; t++ {
+							msg := randomValidPrecommitMsg(r, currentHeight, currentRound, proposedValue)
+							precommits[msg.From] = msg
+							p.Precommit(msg)
+						}
+						for t := 0; t < f; t++ {
+							p.Precommit(randomValidPrecommitMsg(r, currentHeight, currentRound, process.NilValue))
+						}
+
+						// feed the process with a propose message, with a
+						// payload that must be included in the certificate
+						payload := processutil.RandomPayload(r)
+						p.Propose(process.Propose{
+							Height:     currentHeight,
+							Round:      currentRound,
+							ValidRound: processutil.RandomRound(r),
+							Value:      proposedValue,
+							From:       id.NewPrivKey().Signatory(),
+							Payload:    payload,
+						})
+
+						Expect(p.State.CurrentHeight).To(Equal(currentHeight + 1))
+						Expect(cert).ToNot(BeNil())
+						Expect(cert.Height).To(Equal(currentHeight))
+						Expect(cert.Round).To(Equal(currentRound))
+						Expect(cert.Value).To(Equal(proposedValue))
+						Expect(cert.Payload).To(Equal(payload))
+						Expect(len(cert.Precommits)).To(Equal(2*f + 1))
+						for i, precommit := range cert.Precommits {
+							Expect(precommit).To(Equal(precommits[precommit.From]))
+							if i > 0 {
+								Expect(bytes.Compare(cert.Precommits[i-1].From[:], precommit.From[:])).To(Equal(-1))
+							}
+						}
+						return true
+					}
+					Expect(quick.Check(loop, nil)).To(Succeed())
+				})
 			})
 
 			Context("when the 2f+1 precommits are not all towards the same value", func() {
@@ -2359,7 +2502,7 @@ var _ = Describe("Process", func() {
 
 						// instantiate a new process at the current round and height
 						// and at any valid step
-						p := process.New(whoami, f, nil, nil, nil, nil, broadcaster, committer, nil)
+						p := process.New(process.DefaultOptions(), whoami, f, nil, nil, nil, nil, broadcaster, committer, nil)
 						p.StartRound(currentRound)
 						p.State.CurrentHeight = currentHeight
 						p.State.CurrentStep = process.Step(r.Int() % 3)
@@ -2418,7 +2561,7 @@ var _ = Describe("Process", func() {
 
 						// instantiate a new process at the current round and height
 						// and at any valid step
-						p := process.New(whoami, f, nil, scheduler, nil, nil, nil, committer, nil)
+						p := process.New(process.DefaultOptions(), whoami, f, nil, scheduler, nil, nil, nil, committer, nil)
 						p.StartRound(currentRound)
 						p.State.CurrentHeight = currentHeight
 						p.State.CurrentStep = process.Step(r.Int() % 3)
@@ -2469,7 +2612,7 @@ var _ = Describe("Process", func() {
 
 						// instantiate a new process at the current round and height
 						// and at any valid step
-						p := process.New(whoami, f, nil, nil, nil, validator, nil, committer, nil)
+						p := process.New(process.DefaultOptions(), whoami, f, nil, nil, nil, validator, nil, committer, nil)
 						p.StartRound(currentRound)
 						p.State.CurrentHeight = currentHeight
 						p.State.CurrentStep = process.Step(r.Int() % 3)
@@ -2542,7 +2685,7 @@ var _ = Describe("Process", func() {
 				f := 5 + (r.Int() % 10)
 
 				// instantiate a new process
-				p := process.New(whoami, f, nil, nil, nil, nil, nil, nil, nil)
+				p := process.New(process.DefaultOptions(), whoami, f, nil, nil, nil, nil, nil, nil, nil)
 				p.StartRound(currentRound)
 				p.State.CurrentHeight = currentHeight
 
@@ -2577,7 +2720,7 @@ var _ = Describe("Process", func() {
 				f := 5 + (r.Int() % 10)
 
 				// instantiate a new process
-				p := process.New(whoami, f, nil, nil, nil, nil, nil, nil, nil)
+				p := process.New(process.DefaultOptions(), whoami, f, nil, nil, nil, nil, nil, nil, nil)
 				p.StartRound(currentRound)
 				p.State.CurrentHeight = currentHeight
 
@@ -2642,7 +2785,7 @@ var _ = Describe("Process", func() {
 				f := 5 + (r.Int() % 10)
 
 				// instantiate a new process
-				p := process.New(whoami, f, nil, nil, nil, nil, nil, nil, nil)
+				p := process.New(process.DefaultOptions(), whoami, f, nil, nil, nil, nil, nil, nil, nil)
 				p.StartRound(currentRound)
 				p.State.CurrentHeight = currentHeight
 
@@ -2669,7 +2812,7 @@ var _ = Describe("Process", func() {
 				f := 5 + (r.Int() % 10)
 
 				// instantiate a new process
-				p := process.New(whoami, f, nil, nil, nil, nil, nil, nil, nil)
+				p := process.New(process.DefaultOptions(), whoami, f, nil, nil, nil, nil, nil, nil, nil)
 				p.StartRound(currentRound)
 				p.State.CurrentHeight = currentHeight
 
@@ -2696,7 +2839,7 @@ var _ = Describe("Process", func() {
 				f := 5 + (r.Int() % 10)
 
 				// instantiate a new process
-				p := process.New(whoami, f, nil, nil, nil, nil, nil, nil, nil)
+				p := process.New(process.DefaultOptions(), whoami, f, nil, nil, nil, nil, nil, nil, nil)
 				p.StartRound(currentRound)
 				p.State.CurrentHeight = currentHeight
 
@@ -2731,7 +2874,7 @@ var _ = Describe("Process", func() {
 				f := 5 + (r.Int() % 10)
 
 				// instantiate a new process
-				p := process.New(whoami, f, nil, nil, nil, nil, nil, nil, nil)
+				p := process.New(process.DefaultOptions(), whoami, f, nil, nil, nil, nil, nil, nil, nil)
 				p.StartRound(currentRound)
 				p.State.CurrentHeight = currentHeight
 
@@ -2798,7 +2941,7 @@ var _ = Describe("Process", func() {
 						},
 					}
 					scheduler := scheduler.NewRoundRobin([]id.Signatory{doubleSender})
-					p := process.New(whoami, 33, nil, scheduler, nil, nil, nil, nil, catcher)
+					p := process.New(process.DefaultOptions(), whoami, 33, nil, scheduler, nil, nil, nil, nil, catcher)
 					p.StartRound(round)
 
 					// receive the first propose msg
@@ -2871,7 +3014,7 @@ var _ = Describe("Process", func() {
 							Expect(true).ToNot(BeTrue())
 						},
 					}
-					p := process.New(whoami, 33, nil, nil, nil, nil, nil, nil, catcher)
+					p := process.New(process.DefaultOptions(), whoami, 33, nil, nil, nil, nil, nil, nil, catcher)
 					p.StartRound(round)
 					p.State.CurrentStep = process.Prevoting
 
@@ -2958,7 +3101,7 @@ var _ = Describe("Process", func() {
 							Expect(true).ToNot(BeTrue())
 						},
 					}
-					p := process.New(whoami, 33, nil, nil, nil, nil, nil, nil, catcher)
+					p := process.New(process.DefaultOptions(), whoami, 33, nil, nil, nil, nil, nil, nil, catcher)
 					p.StartRound(round)
 					p.State.CurrentStep = process.Precommitting
 
@@ -3046,7 +3189,7 @@ var _ = Describe("Process", func() {
 						},
 					}
 					scheduler := scheduler.NewRoundRobin([]id.Signatory{scheduledSender})
-					p := process.New(whoami, 33, nil, scheduler, nil, nil, nil, nil, catcher)
+					p := process.New(process.DefaultOptions(), whoami, 33, nil, scheduler, nil, nil, nil, nil, catcher)
 					p.StartRound(round)
 
 					// receive propose msg from the scheduled sender
@@ -3075,4 +3218,820 @@ var _ = Describe("Process", func() {
 			})
 		})
 	})
+	Context("when keeping a history", func() {
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+		Context("when receiving two different votes at a previous height", func() {
+			It("should catch the double vote, if the height is recent", func() {
+				loop := func() bool {
+					doubleSender := id.NewPrivKey().Signatory()
+					doublePrevotes, doublePrecommits := 0, 0
+					catcher := processutil.CatcherCallbacks{
+						CatchDoublePrevoteCallback: func(prevote1 process.Prevote, prevote2 process.Prevote) {
+							Expect(prevote1.From.Equal(&doubleSender)).To(BeTrue())
+							Expect(prevote2.Height).To(Equal(process.Height(1)))
+							doublePrevotes++
+						},
+						CatchDoublePrecommitCallback: func(precommit1 process.Precommit, precommit2 process.Precommit) {
+							Expect(precommit1.From.Equal(&doubleSender)).To(BeTrue())
+							Expect(precommit2.Height).To(Equal(process.Height(1)))
+							doublePrecommits++
+						},
+					}
+					heights := 2 + r.Intn(10)
+					opts := process.DefaultOptions().WithHistoryHeights(heights)
+					p := process.New(opts, id.NewPrivKey().Signatory(), 33, nil, nil, nil, nil, nil, nil, catcher)
+					p.Start()
+
+					round := process.Round(r.Intn(10))
+					p.Prevote(process.Prevote{Height: 1, Round: round, Value: processutil.RandomGoodValue(r), From: doubleSender})
+					p.Precommit(process.Precommit{Height: 1, Round: round, Value: processutil.RandomGoodValue(r), From: doubleSender})
+
+					// move to a recent height, and catch the double votes
+					p.State.CurrentHeight = process.Height(1 + r.Intn(heights))
+					p.Prevote(process.Prevote{Height: 1, Round: round, Value: processutil.RandomGoodValue(r), From: doubleSender})
+					p.Precommit(process.Precommit{Height: 1, Round: round, Value: processutil.RandomGoodValue(r), From: doubleSender})
+					Expect(doublePrevotes).To(Equal(1))
+					Expect(doublePrecommits).To(Equal(1))
+
+					// move past the history, and forget the votes
+					p.State.CurrentHeight = process.Height(1 + heights)
+					p.Prevote(process.Prevote{Height: 1, Round: round, Value: processutil.RandomGoodValue(r), From: doubleSender})
+					p.Precommit(process.Precommit{Height: 1, Round: round, Value: processutil.RandomGoodValue(r), From: doubleSender})
+					Expect(doublePrevotes).To(Equal(1))
+					Expect(doublePrecommits).To(Equal(1))
+					return true
+				}
+				Expect(quick.Check(loop, nil)).To(Succeed())
+			})
+
+			It("should not catch the double vote, if there is no history", func() {
+				doubleSender := id.NewPrivKey().Signatory()
+				catcher := processutil.CatcherCallbacks{
+					CatchDoublePrevoteCallback: func(prevote1 process.Prevote, prevote2 process.Prevote) {
+						// this should never happen
+						Expect(true).ToNot(BeTrue())
+					},
+				}
+				p := process.New(process.DefaultOptions(), id.NewPrivKey().Signatory(), 33, nil, nil, nil, nil, nil, nil, catcher)
+				p.Start()
+				p.Prevote(process.Prevote{Height: 1, Round: 0, Value: processutil.RandomGoodValue(r), From: doubleSender})
+				p.State.CurrentHeight = 2
+				p.Prevote(process.Prevote{Height: 1, Round: 0, Value: processutil.RandomGoodValue(r), From: doubleSender})
+			})
+		})
+
+		Context("when receiving votes for many rounds", func() {
+			It("should only keep the rounds near the latest round of each height", func() {
+				loop := func() bool {
+					doubleSender := id.NewPrivKey().Signatory()
+					doublePrevotes := 0
+					catcher := processutil.CatcherCallbacks{
+						CatchDoublePrevoteCallback: func(prevote1 process.Prevote, prevote2 process.Prevote) {
+							Expect(prevote1.From.Equal(&doubleSender)).To(BeTrue())
+							doublePrevotes++
+						},
+					}
+					rounds := 1 + r.Intn(5)
+					opts := process.DefaultOptions().WithHistoryHeights(2).WithHistoryRounds(rounds)
+					p := process.New(opts, id.NewPrivKey().Signatory(), 33, nil, nil, nil, nil, nil, nil, catcher)
+					p.Start()
+
+					// prevotes far from the current round are not kept
+					latest := process.Round(rounds + r.Intn(10))
+					p.StartRound(latest)
+					for round := process.Round(0); round <= latest+process.Round(2*rounds); round++ {
+						p.Prevote(process.Prevote{Height: 1, Round: round, Value: processutil.RandomGoodValue(r), From: doubleSender})
+					}
+
+					// move to the next height, and only catch the double votes
+					// near the latest round
+					p.State.CurrentHeight = 2
+					for round := process.Round(0); round <= latest+process.Round(2*rounds); round++ {
+						p.Prevote(process.Prevote{Height: 1, Round: round, Value: processutil.RandomGoodValue(r), From: doubleSender})
+					}
+					Expect(doublePrevotes).To(Equal(2*rounds + 1))
+					return true
+				}
+				Expect(quick.Check(loop, nil)).To(Succeed())
+			})
+		})
+
+		Context("when a process prevotes for a different value after precommitting", func() {
+			It("should catch the amnesia, unless there was a polka for the different value", func() {
+				loop := func() bool {
+					f := 1 + r.Intn(10)
+					forgetful := id.NewPrivKey().Signatory()
+					amnesia := 0
+					catcher := processutil.CatcherCallbacks{
+						CatchAmnesiaCallback: func(precommit process.Precommit, prevote process.Prevote) {
+							Expect(precommit.From.Equal(&forgetful)).To(BeTrue())
+							Expect(prevote.From.Equal(&forgetful)).To(BeTrue())
+							Expect(prevote.Round > precommit.Round).To(BeTrue())
+							amnesia++
+						},
+					}
+					opts := process.DefaultOptions().WithHistoryHeights(1)
+					p := process.New(opts, id.NewPrivKey().Signatory(), f, nil, nil, nil, nil, nil, nil, catcher)
+					p.Start()
+
+					lockedValue := processutil.RandomGoodValue(r)
+					otherValue := processutil.RandomGoodValue(r)
+
+					// nil prevotes, and prevotes for the locked value, are
+					// allowed
+					p.Precommit(process.Precommit{Height: 1, Round: 0, Value: lockedValue, From: forgetful})
+					p.Prevote(process.Prevote{Height: 1, Round: 1, Value: process.NilValue, From: forgetful})
+					p.Prevote(process.Prevote{Height: 1, Round: 2, Value: lockedValue, From: forgetful})
+					Expect(amnesia).To(Equal(0))
+
+					// prevotes for another value are caught, regardless of the
+					// order in which the messages are received
+					p.Prevote(process.Prevote{Height: 1, Round: 4, Value: otherValue, From: forgetful})
+					Expect(amnesia).To(Equal(1))
+					p.Precommit(process.Precommit{Height: 1, Round: 3, Value: lockedValue, From: forgetful})
+					Expect(amnesia).To(Equal(2))
+
+					// prevotes for another value are allowed after a polka for
+					// that value
+					for i := 0; i < 2*f+1; i++ {
+						p.Prevote(process.Prevote{Height: 1, Round: 5, Value: otherValue, From: id.NewPrivKey().Signatory()})
+					}
+					p.Precommit(process.Precommit{Height: 1, Round: 5, Value: lockedValue, From: forgetful})
+					p.Prevote(process.Prevote{Height: 1, Round: 6, Value: otherValue, From: forgetful})
+					Expect(amnesia).To(Equal(2))
+					return true
+				}
+				Expect(quick.Check(loop, nil)).To(Succeed())
+			})
+		})
+	})
+
+	Context("when retaining rounds", func() {
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+		It("should only keep the rounds near the current round", func() {
+			loop := func() bool {
+				retention := 1 + r.Intn(5)
+				opts := process.DefaultOptions().WithRoundRetention(retention)
+				p := process.New(opts, id.NewPrivKey().Signatory(), 33, nil, nil, nil, nil, nil, nil, nil)
+				p.Start()
+
+				// many rounds of nil votes
+				for round := process.Round(0); round < 100; round++ {
+					p.StartRound(round)
+					for i := 0; i < 10; i++ {
+						from := id.NewPrivKey().Signatory()
+						futureRound := round + process.Round(r.Intn(2*retention))
+						p.Prevote(process.Prevote{Height: 1, Round: futureRound, Value: process.NilValue, From: from})
+						p.Precommit(process.Precommit{Height: 1, Round: futureRound, Value: process.NilValue, From: from})
+					}
+					for logRound := range p.PrevoteLogs {
+						Expect(logRound >= round-process.Round(retention)).To(BeTrue())
+						Expect(logRound <= round+process.Round(retention)).To(BeTrue())
+					}
+					for logRound := range p.PrecommitLogs {
+						Expect(logRound >= round-process.Round(retention)).To(BeTrue())
+						Expect(logRound <= round+process.Round(retention)).To(BeTrue())
+					}
+					Expect(len(p.PrevoteLogs) <= 2*retention+1).To(BeTrue())
+				}
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should keep all rounds when there is no retention", func() {
+			p := process.New(process.DefaultOptions(), id.NewPrivKey().Signatory(), 33, nil, nil, nil, nil, nil, nil, nil)
+			p.Start()
+			for round := process.Round(0); round < 100; round++ {
+				p.StartRound(round)
+				p.Prevote(process.Prevote{Height: 1, Round: round, Value: process.NilValue, From: id.NewPrivKey().Signatory()})
+			}
+			Expect(p.PrevoteLogs).To(HaveLen(100))
+		})
+
+		It("should keep the locked round, and unlock with a propose that references it", func() {
+			loop := func() bool {
+				retention := 1 + r.Intn(5)
+				f := 1 + r.Intn(10)
+				whoami := id.NewPrivKey().Signatory()
+				proposer := id.NewPrivKey().Signatory()
+				value := processutil.RandomGoodValue(r)
+				prevoted := process.NilValue
+				broadcaster := processutil.BroadcasterCallbacks{
+					BroadcastPrevoteCallback: func(prevote process.Prevote) {
+						if prevote.From.Equal(&whoami) {
+							prevoted = prevote.Value
+						}
+					},
+				}
+				opts := process.DefaultOptions().WithRoundRetention(retention)
+				p := process.New(opts, whoami, f, nil, scheduler.NewRoundRobin([]id.Signatory{proposer}), nil, nil, broadcaster, nil, nil)
+				p.Start()
+
+				// lock on the value in round 0
+				p.Propose(process.Propose{Height: 1, Round: 0, ValidRound: process.InvalidRound, Value: value, From: proposer})
+				for i := 0; i < 2*f+1; i++ {
+					p.Prevote(process.Prevote{Height: 1, Round: 0, Value: value, From: id.NewPrivKey().Signatory()})
+				}
+				Expect(p.LockedRound).To(Equal(process.Round(0)))
+
+				// the locked round is kept, even when the process has moved
+				// far away from it
+				laterRound := process.Round(1 + retention + r.Intn(10))
+				p.StartRound(laterRound)
+				Expect(p.PrevoteLogs).To(HaveKey(process.Round(0)))
+
+				// so the polka in the locked round can be used to prevote for
+				// a propose that references it
+				prevoted = process.NilValue
+				p.Propose(process.Propose{Height: 1, Round: laterRound, ValidRound: 0, Value: value, From: proposer})
+				Expect(prevoted).To(Equal(value))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should keep the valid rounds referenced by proposes", func() {
+			loop := func() bool {
+				retention := 1 + r.Intn(5)
+				proposer := id.NewPrivKey().Signatory()
+				opts := process.DefaultOptions().WithRoundRetention(retention)
+				p := process.New(opts, id.NewPrivKey().Signatory(), 33, nil, scheduler.NewRoundRobin([]id.Signatory{proposer}), nil, nil, nil, nil, nil)
+				p.Start()
+
+				// a propose references a round at the edge of the retention,
+				// which would otherwise be pruned when the process moves to
+				// the next round
+				round := process.Round(retention + r.Intn(10))
+				validRound := round - process.Round(retention)
+				p.StartRound(validRound)
+				p.Prevote(process.Prevote{Height: 1, Round: validRound, Value: processutil.RandomGoodValue(r), From: id.NewPrivKey().Signatory()})
+				p.StartRound(round)
+				p.Propose(process.Propose{Height: 1, Round: round, ValidRound: validRound, Value: processutil.RandomGoodValue(r), From: proposer})
+				p.StartRound(round + 1)
+				Expect(p.PrevoteLogs).To(HaveKey(validRound))
+
+				// once the propose is pruned, so is the round that it
+				// references
+				p.StartRound(round + 1 + process.Round(retention))
+				Expect(p.ProposeLogs).ToNot(HaveKey(round))
+				Expect(p.PrevoteLogs).ToNot(HaveKey(validRound))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should keep the rounds in which a propose might still be committed, and commit it late", func() {
+			loop := func() bool {
+				retention := 1 + r.Intn(5)
+				f := 1 + r.Intn(10)
+				proposer := id.NewPrivKey().Signatory()
+				value := processutil.RandomGoodValue(r)
+				committed := process.NilValue
+				committer := processutil.CommitterCallback{
+					Callback: func(height process.Height, v process.Value) {
+						Expect(height).To(Equal(process.Height(1)))
+						committed = v
+					},
+				}
+				opts := process.DefaultOptions().WithRoundRetention(retention)
+				newProcess := func() process.Process {
+					p := process.New(opts, id.NewPrivKey().Signatory(), f, nil, scheduler.NewRoundRobin([]id.Signatory{proposer}), nil, nil, nil, committer, nil)
+					p.Start()
+					p.Propose(process.Propose{Height: 1, Round: 0, ValidRound: process.InvalidRound, Value: value, From: proposer})
+					return p
+				}
+
+				// a round in which the value has been precommitted by less
+				// than f+1 processes is pruned
+				p := newProcess()
+				for i := 0; i < f; i++ {
+					p.Precommit(process.Precommit{Height: 1, Round: 0, Value: value, From: id.NewPrivKey().Signatory()})
+				}
+				laterRound := process.Round(1 + retention + r.Intn(10))
+				p.StartRound(laterRound)
+				Expect(p.ProposeLogs).ToNot(HaveKey(process.Round(0)))
+				Expect(p.PrecommitLogs).ToNot(HaveKey(process.Round(0)))
+
+				// a round in which the value has been precommitted by f+1
+				// processes is kept, even when the process has moved far away
+				// from it
+				p = newProcess()
+				for i := 0; i < f+1; i++ {
+					p.Precommit(process.Precommit{Height: 1, Round: 0, Value: value, From: id.NewPrivKey().Signatory()})
+				}
+				p.StartRound(laterRound)
+				Expect(p.ProposeLogs).To(HaveKey(process.Round(0)))
+				Expect(p.PrecommitLogs).To(HaveKey(process.Round(0)))
+
+				// so the value is committed once the late precommits arrive
+				for i := 0; i < f; i++ {
+					Expect(committed).To(Equal(process.NilValue))
+					p.Precommit(process.Precommit{Height: 1, Round: 0, Value: value, From: id.NewPrivKey().Signatory()})
+				}
+				Expect(committed).To(Equal(value))
+				Expect(p.CurrentHeight).To(Equal(process.Height(2)))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+	})
+
+	Context("when observing", func() {
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+		It("should notify the observer about steps, locks, valid values, and timeouts", func() {
+			loop := func() bool {
+				f := 1 + r.Intn(10)
+				proposer := id.NewPrivKey().Signatory()
+				value := processutil.RandomGoodValue(r)
+
+				events := []string{}
+				observer := processutil.ObserverCallbacks{
+					OnStepChangedCallback: func(height process.Height, round process.Round, step process.Step) {
+						Expect(height).To(Equal(process.Height(1)))
+						Expect(round).To(Equal(process.Round(0)))
+						events = append(events, fmt.Sprintf("step %v", step))
+					},
+					OnLockedCallback: func(height process.Height, round process.Round, locked process.Value) {
+						Expect(round).To(Equal(process.Round(0)))
+						Expect(locked).To(Equal(value))
+						events = append(events, "locked")
+					},
+					OnValidValueUpdatedCallback: func(height process.Height, round process.Round, valid process.Value) {
+						Expect(round).To(Equal(process.Round(0)))
+						Expect(valid).To(Equal(value))
+						events = append(events, "valid")
+					},
+					OnTimeoutScheduledCallback: func(height process.Height, round process.Round, step process.Step) {
+						events = append(events, fmt.Sprintf("timeout %v", step))
+					},
+				}
+				timer := timer.NewLinearTimer(timer.DefaultOptions(), make(chan timer.Timeout, 1), make(chan timer.Timeout, 1), make(chan timer.Timeout, 1))
+				opts := process.DefaultOptions().WithObserver(observer)
+				p := process.New(opts, id.NewPrivKey().Signatory(), f, timer, scheduler.NewRoundRobin([]id.Signatory{proposer}), nil, nil, nil, nil, nil)
+				p.Start()
+				Expect(events).To(Equal([]string{"step propose", "timeout propose"}))
+
+				events = events[:0]
+				p.Propose(process.Propose{Height: 1, Round: 0, ValidRound: process.InvalidRound, Value: value, From: proposer})
+				Expect(events).To(Equal([]string{"step prevote"}))
+
+				events = events[:0]
+				for i := 0; i < 2*f+1; i++ {
+					p.Prevote(process.Prevote{Height: 1, Round: 0, Value: value, From: id.NewPrivKey().Signatory()})
+				}
+				Expect(events).To(Equal([]string{"locked", "step precommit", "valid"}))
+
+				events = events[:0]
+				for i := 0; i < 2*f+1; i++ {
+					p.Precommit(process.Precommit{Height: 1, Round: 0, Value: process.NilValue, From: id.NewPrivKey().Signatory()})
+				}
+				Expect(events).To(Equal([]string{"timeout precommit"}))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should notify the observer about skipped rounds", func() {
+			loop := func() bool {
+				f := 1 + r.Intn(10)
+				futureRound := process.Round(1 + r.Intn(100))
+				skipped := 0
+				observer := processutil.ObserverCallbacks{
+					OnRoundSkippedCallback: func(height process.Height, from, to process.Round) {
+						Expect(height).To(Equal(process.Height(1)))
+						Expect(from).To(Equal(process.Round(0)))
+						Expect(to).To(Equal(futureRound))
+						skipped++
+					},
+				}
+				opts := process.DefaultOptions().WithObserver(observer)
+				p := process.New(opts, id.NewPrivKey().Signatory(), f, nil, nil, nil, nil, nil, nil, nil)
+				p.Start()
+				for i := 0; i < f+1; i++ {
+					p.Prevote(process.Prevote{Height: 1, Round: futureRound, Value: process.NilValue, From: id.NewPrivKey().Signatory()})
+				}
+				Expect(skipped).To(Equal(1))
+				Expect(p.CurrentRound).To(Equal(futureRound))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+	})
+
+	Context("when logging", func() {
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+		It("should log its transition decisions with its height, round, and step", func() {
+			loop := func() bool {
+				f := 1 + r.Intn(10)
+				proposer := id.NewPrivKey().Signatory()
+				value := processutil.RandomGoodValue(r)
+
+				core, logs := observer.New(zap.DebugLevel)
+				opts := process.DefaultOptions().WithLogger(zap.New(core))
+				p := process.New(opts, id.NewPrivKey().Signatory(), f, nil, scheduler.NewRoundRobin([]id.Signatory{proposer}), nil, nil, nil, nil, nil)
+				p.Start()
+				p.Propose(process.Propose{Height: 1, Round: 0, ValidRound: process.InvalidRound, Value: value, From: proposer})
+				for i := 0; i < 2*f+1; i++ {
+					p.Prevote(process.Prevote{Height: 1, Round: 0, Value: value, From: id.NewPrivKey().Signatory()})
+				}
+
+				messages := []string{}
+				steps := []interface{}{}
+				for _, entry := range logs.All() {
+					Expect(entry.Level).To(Equal(zap.DebugLevel))
+					Expect(entry.ContextMap()).To(And(
+						HaveKeyWithValue("height", int64(1)),
+						HaveKeyWithValue("round", int64(0)),
+					))
+					messages = append(messages, entry.Message)
+					steps = append(steps, entry.ContextMap()["step"])
+				}
+				Expect(messages).To(Equal([]string{"moved to step", "moved to step", "locked", "moved to step", "updated valid value"}))
+				Expect(steps).To(Equal([]interface{}{"propose", "prevote", "prevote", "precommit", "precommit"}))
+				Expect(logs.FilterMessage("locked").All()[0].ContextMap()).To(And(
+					HaveKeyWithValue("value", value.String()),
+					HaveKeyWithValue("lockedRound", int64(0)),
+				))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should not log without a logger", func() {
+			p := process.New(process.DefaultOptions(), id.NewPrivKey().Signatory(), 1, nil, nil, nil, nil, nil, nil, nil)
+			p.Start()
+			p.OnTimeoutPrecommit(1, 0)
+			Expect(p.CurrentRound).To(Equal(process.Round(1)))
+		})
+	})
+
+	Context("when using voting power", func() {
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+		// setup returns the voting power of n signatories, where the first
+		// signatory has as much voting power as all other signatories
+		// combined, and every other signatory has a voting power of one.
+		setup := func(n int) ([]id.Signatory, process.VotingPower) {
+			signatories := make([]id.Signatory, n)
+			votingPower := process.VotingPower{}
+			for i := range signatories {
+				signatories[i] = id.NewPrivKey().Signatory()
+				votingPower[signatories[i]] = 1
+			}
+			votingPower[signatories[0]] = uint64(n - 1)
+			return signatories, votingPower
+		}
+
+		Context("when receiving precommits", func() {
+			It("should commit only when more than 2/3 of the voting power has precommitted", func() {
+				loop := func() bool {
+					n := 4 + r.Intn(10)
+					signatories, votingPower := setup(n)
+					currentHeight := process.Height(1 + r.Int63n(1000))
+					proposedValue := processutil.RandomGoodValue(r)
+
+					committed := false
+					committer := processutil.CommitterCallback{
+						Callback: func(height process.Height, value process.Value) {
+							Expect(height).To(Equal(currentHeight))
+							Expect(value).To(Equal(proposedValue))
+							committed = true
+						},
+					}
+					opts := process.DefaultOptions().WithVotingPower(votingPower)
+					p := process.New(opts, signatories[0], 0, nil, nil, nil, nil, nil, committer, nil)
+					p.CurrentHeight = currentHeight
+					p.Start()
+					p.Propose(process.Propose{
+						Height:     currentHeight,
+						Round:      0,
+						ValidRound: process.InvalidRound,
+						Value:      proposedValue,
+						From:       signatories[1],
+					})
+
+					// Precommits from every signatory except the first have
+					// exactly half of the voting power, which is not enough,
+					// even though it is more than 2f+1 precommits.
+					for _, signatory := range signatories[1:] {
+						p.Precommit(process.Precommit{
+							Height: currentHeight,
+							Round:  0,
+							Value:  proposedValue,
+							From:   signatory,
+						})
+					}
+					Expect(committed).To(BeFalse())
+
+					// The precommit from the first signatory is enough.
+					p.Precommit(process.Precommit{
+						Height: currentHeight,
+						Round:  0,
+						Value:  proposedValue,
+						From:   signatories[0],
+					})
+					Expect(committed).To(BeTrue())
+					Expect(p.CurrentHeight).To(Equal(currentHeight + 1))
+					return true
+				}
+				Expect(quick.Check(loop, nil)).To(Succeed())
+			})
+		})
+
+		Context("when receiving messages from a future round", func() {
+			It("should skip to the future round only when more than 1/3 of the voting power has sent messages", func() {
+				loop := func() bool {
+					n := 4 + r.Intn(10)
+					signatories, votingPower := setup(n)
+					currentRound := process.Round(r.Int63n(1000))
+					futureRound := currentRound + 1 + process.Round(r.Int63n(1000))
+
+					opts := process.DefaultOptions().WithVotingPower(votingPower)
+					p := process.New(opts, id.NewPrivKey().Signatory(), 0, nil, nil, nil, nil, nil, nil, nil)
+					p.StartRound(currentRound)
+
+					// Messages from one signatory with a voting power of one
+					// are not enough, even when it sends every kind of message.
+					p.Prevote(process.Prevote{
+						Height: p.CurrentHeight,
+						Round:  futureRound,
+						Value:  processutil.RandomValue(r),
+						From:   signatories[1],
+					})
+					p.Precommit(process.Precommit{
+						Height: p.CurrentHeight,
+						Round:  futureRound,
+						Value:  processutil.RandomValue(r),
+						From:   signatories[1],
+					})
+					Expect(p.CurrentRound).To(Equal(currentRound))
+
+					// A message from the first signatory is enough.
+					p.Prevote(process.Prevote{
+						Height: p.CurrentHeight,
+						Round:  futureRound,
+						Value:  processutil.RandomValue(r),
+						From:   signatories[0],
+					})
+					Expect(p.CurrentRound).To(Equal(futureRound))
+					return true
+				}
+				Expect(quick.Check(loop, nil)).To(Succeed())
+			})
+		})
+
+		Context("when receiving messages from signatories with no voting power", func() {
+			It("should not count them towards any threshold", func() {
+				loop := func() bool {
+					_, votingPower := setup(4 + r.Intn(10))
+					currentRound := process.Round(r.Int63n(1000))
+
+					opts := process.DefaultOptions().WithVotingPower(votingPower)
+					p := process.New(opts, id.NewPrivKey().Signatory(), 0, nil, nil, nil, nil, nil, nil, nil)
+					p.StartRound(currentRound)
+
+					for t := 0; t < 10; t++ {
+						p.Prevote(process.Prevote{
+							Height: p.CurrentHeight,
+							Round:  currentRound + 1,
+							Value:  processutil.RandomValue(r),
+							From:   id.NewPrivKey().Signatory(),
+						})
+					}
+					Expect(p.CurrentRound).To(Equal(currentRound))
+					return true
+				}
+				Expect(quick.Check(loop, nil)).To(Succeed())
+			})
+		})
+	})
+	Context("when reconfiguring", func() {
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+		It("should panic if the height is not in the future", func() {
+			p := process.New(process.DefaultOptions(), id.NewPrivKey().Signatory(), 1, nil, nil, nil, nil, nil, nil, nil)
+			p.CurrentHeight = process.Height(1 + r.Int63n(1000))
+			Expect(func() {
+				p.Reconfigure(p.CurrentHeight, 1, nil, nil)
+			}).To(Panic())
+			Expect(func() {
+				p.Reconfigure(p.CurrentHeight-1, 1, nil, nil)
+			}).To(Panic())
+		})
+
+		It("should use the new configuration once the height is reached", func() {
+			loop := func() bool {
+				currentHeight := process.Height(1 + r.Int63n(1000))
+				oldF := 1 + r.Intn(5)
+				newF := oldF + 1 + r.Intn(5)
+
+				commits := map[process.Height]process.Value{}
+				committer := processutil.CommitterCallback{
+					Callback: func(height process.Height, value process.Value) {
+						commits[height] = value
+					},
+				}
+				p := process.New(process.DefaultOptions(), id.NewPrivKey().Signatory(), oldF, nil, nil, nil, nil, nil, committer, nil)
+				p.CurrentHeight = currentHeight
+				p.Start()
+				p.Reconfigure(currentHeight+1, newF, nil, nil)
+
+				// commitWith sends a propose, and the given number of
+				// precommits, for a new value at the current height
+				commitWith := func(precommits int) process.Value {
+					value := processutil.RandomGoodValue(r)
+					p.Propose(process.Propose{
+						Height:     p.CurrentHeight,
+						Round:      p.CurrentRound,
+						ValidRound: process.InvalidRound,
+						Value:      value,
+						From:       id.NewPrivKey().Signatory(),
+					})
+					for t := 0; t < precommits; t++ {
+						p.Precommit(process.Precommit{
+							Height: p.CurrentHeight,
+							Round:  p.CurrentRound,
+							Value:  value,
+							From:   id.NewPrivKey().Signatory(),
+						})
+					}
+					return value
+				}
+
+				// 2f+1 precommits are enough before the reconfiguration
+				value := commitWith(2*oldF + 1)
+				Expect(commits[currentHeight]).To(Equal(value))
+				Expect(p.CurrentHeight).To(Equal(currentHeight + 1))
+
+				// 2f+1 precommits, using the old f, are not enough after the
+				// reconfiguration
+				commitWith(2*oldF + 1)
+				Expect(commits).ToNot(HaveKey(currentHeight + 1))
+				Expect(p.CurrentHeight).To(Equal(currentHeight + 1))
+
+				// 2f+1 precommits, using the new f, are enough after the
+				// reconfiguration
+				p.StartRound(p.CurrentRound + 1)
+				value = commitWith(2*newF + 1)
+				Expect(commits[currentHeight+1]).To(Equal(value))
+				Expect(p.CurrentHeight).To(Equal(currentHeight + 2))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+	})
+	Context("when resuming", func() {
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+		// setup returns a process that has been restored from a random
+		// height and round, in the proposing step, along with the slices
+		// that record everything it broadcasts
+		setup := func() (*process.Process, *[]process.Prevote, *[]process.Precommit) {
+			prevotes := []process.Prevote{}
+			precommits := []process.Precommit{}
+			broadcaster := processutil.BroadcasterCallbacks{
+				BroadcastPrevoteCallback: func(prevote process.Prevote) {
+					prevotes = append(prevotes, prevote)
+				},
+				BroadcastPrecommitCallback: func(precommit process.Precommit) {
+					precommits = append(precommits, precommit)
+				},
+			}
+			whoami := id.NewPrivKey().Signatory()
+			p := process.New(process.DefaultOptions(), whoami, 1+r.Intn(10), nil, nil, nil, nil, broadcaster, nil, nil)
+			p.CurrentHeight = process.Height(1 + r.Int63n(1000))
+			p.CurrentRound = process.Round(r.Int63n(1000))
+			p.CurrentStep = process.Proposing
+			return &p, &prevotes, &precommits
+		}
+
+		It("should move to the latest round in which it broadcast a message", func() {
+			loop := func() bool {
+				p, _, _ := setup()
+				currentRound := p.CurrentRound
+				p.Resume([]process.Propose{{
+					Height:     p.CurrentHeight,
+					Round:      currentRound + 1,
+					ValidRound: process.InvalidRound,
+					Value:      processutil.RandomGoodValue(r),
+				}}, nil, nil)
+				Expect(p.CurrentRound).To(Equal(currentRound + 1))
+				Expect(p.CurrentStep).To(Equal(process.Proposing))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should not prevote again after it has prevoted", func() {
+			loop := func() bool {
+				p, prevotes, _ := setup()
+				prevote := process.Prevote{
+					Height: p.CurrentHeight,
+					Round:  p.CurrentRound,
+					Value:  process.NilValue,
+					From:   id.NewPrivKey().Signatory(),
+				}
+				p.Resume(nil, []process.Prevote{prevote}, nil)
+				Expect(p.CurrentStep).To(Equal(process.Prevoting))
+				Expect(*prevotes).To(Equal([]process.Prevote{prevote}))
+
+				// receiving a propose must not cause a different prevote
+				p.Propose(process.Propose{
+					Height:     p.CurrentHeight,
+					Round:      p.CurrentRound,
+					ValidRound: process.InvalidRound,
+					Value:      processutil.RandomGoodValue(r),
+				})
+				Expect(*prevotes).To(Equal([]process.Prevote{prevote}))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should lock on the value that it precommitted", func() {
+			loop := func() bool {
+				p, _, precommits := setup()
+				precommit := process.Precommit{
+					Height: p.CurrentHeight,
+					Round:  p.CurrentRound,
+					Value:  processutil.RandomGoodValue(r),
+					From:   id.NewPrivKey().Signatory(),
+				}
+				p.Resume(nil, nil, []process.Precommit{precommit})
+				Expect(p.CurrentStep).To(Equal(process.Precommitting))
+				Expect(p.LockedValue).To(Equal(precommit.Value))
+				Expect(p.LockedRound).To(Equal(precommit.Round))
+				Expect(p.ValidValue).To(Equal(precommit.Value))
+				Expect(p.ValidRound).To(Equal(precommit.Round))
+				Expect(*precommits).To(Equal([]process.Precommit{precommit}))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should ignore messages from other heights", func() {
+			loop := func() bool {
+				p, prevotes, precommits := setup()
+				state := p.State.Clone()
+				p.Resume(nil, []process.Prevote{{
+					Height: p.CurrentHeight - 1,
+					Round:  p.CurrentRound,
+					Value:  processutil.RandomGoodValue(r),
+				}}, []process.Precommit{{
+					Height: p.CurrentHeight - 1,
+					Round:  p.CurrentRound + 1,
+					Value:  processutil.RandomGoodValue(r),
+				}})
+				Expect(p.State.Equal(&state)).To(BeTrue())
+				Expect(*prevotes).To(BeEmpty())
+				Expect(*precommits).To(BeEmpty())
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+	})
+	Context("when fast-forwarding", func() {
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+		It("should commit the certificate at the current height and move to the next height", func() {
+			loop := func() bool {
+				currentHeight := process.Height(1 + r.Int63n(1000))
+				var committed *process.CommitCertificate
+				committer := processutil.CertifiedCommitterCallback{
+					Callback: func(cert process.CommitCertificate) {
+						committed = &cert
+					},
+				}
+				p := process.New(process.DefaultOptions(), id.NewPrivKey().Signatory(), 1, nil, nil, nil, nil, nil, committer, nil)
+				p.CurrentHeight = currentHeight
+				p.StartRound(process.Round(r.Int63n(1000)))
+				p.LockedValue = processutil.RandomGoodValue(r)
+				p.LockedRound = p.CurrentRound
+
+				// a certificate for another height is ignored
+				cert := processutil.RandomCommitCertificate(r)
+				cert.Height = currentHeight + 1
+				p.FastForward(cert)
+				Expect(committed).To(BeNil())
+				Expect(p.CurrentHeight).To(Equal(currentHeight))
+
+				// a certificate for the current height is committed
+				cert.Height = currentHeight
+				p.FastForward(cert)
+				Expect(committed).ToNot(BeNil())
+				Expect(committed.Equal(&cert)).To(BeTrue())
+				Expect(p.CurrentHeight).To(Equal(currentHeight + 1))
+				Expect(p.CurrentRound).To(Equal(process.Round(0)))
+				Expect(p.LockedValue).To(Equal(process.NilValue))
+				Expect(p.LockedRound).To(Equal(process.InvalidRound))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+	})
 })
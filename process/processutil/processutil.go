@@ -53,6 +53,25 @@ func (committer CommitterCallback) Commit(height process.Height, value process.V
 	committer.Callback(height, value)
 }
 
+// CertifiedCommitterCallback provides a callback function to test the
+// CertifiedCommitter behaviour supported by a Process
+type CertifiedCommitterCallback struct {
+	Callback func(process.CommitCertificate)
+}
+
+// Commit does nothing, because a Process will always call CommitWithProof
+// instead
+func (committer CertifiedCommitterCallback) Commit(height process.Height, value process.Value) {
+}
+
+// CommitWithProof passes the commit certificate to the commit callback, if present
+func (committer CertifiedCommitterCallback) CommitWithProof(cert process.CommitCertificate) {
+	if committer.Callback == nil {
+		return
+	}
+	committer.Callback(cert)
+}
+
 // MockProposer is a mock implementation of the Proposer interface
 // It always proposes the value MockValue
 type MockProposer struct {
@@ -66,6 +85,26 @@ func (p MockProposer) Propose(height process.Height, round process.Round) proces
 	return p.MockValue()
 }
 
+// AsyncProposerCallback provides a callback function to test the
+// AsyncProposer behaviour supported by a Process
+type AsyncProposerCallback struct {
+	Callback func(process.Height, process.Round)
+}
+
+// Propose returns the nil value, because a Process will always call
+// ProposeAsync instead
+func (p AsyncProposerCallback) Propose(height process.Height, round process.Round) process.Value {
+	return process.NilValue
+}
+
+// ProposeAsync passes the height and round to the callback, if present
+func (p AsyncProposerCallback) ProposeAsync(height process.Height, round process.Round) {
+	if p.Callback == nil {
+		return
+	}
+	p.Callback(height, round)
+}
+
 // MockValidator is a mock implementation of the Validator interface
 // It always returns the MockValid value as its validation check
 type MockValidator struct {
@@ -87,6 +126,7 @@ type CatcherCallbacks struct {
 	CatchDoublePrevoteCallback    func(process.Prevote, process.Prevote)
 	CatchDoublePrecommitCallback  func(process.Precommit, process.Precommit)
 	CatchOutOfTurnProposeCallback func(process.Propose)
+	CatchAmnesiaCallback          func(process.Precommit, process.Prevote)
 }
 
 // CatchDoublePropose implements the interface method of handling the event when
@@ -129,6 +169,68 @@ func (catcher CatcherCallbacks) CatchOutOfTurnPropose(propose process.Propose) {
 	catcher.CatchOutOfTurnProposeCallback(propose)
 }
 
+// CatchAmnesia implements the interface method of handling the event when a
+// process prevotes for a different value after locking on a value. In this
+// case, it simply passes those to the appropriate callback function
+func (catcher CatcherCallbacks) CatchAmnesia(precommit process.Precommit, prevote process.Prevote) {
+	if catcher.CatchAmnesiaCallback == nil {
+		return
+	}
+	catcher.CatchAmnesiaCallback(precommit, prevote)
+}
+
+// ObserverCallbacks provide callback functions to test the Observer interface
+// of a Process
+type ObserverCallbacks struct {
+	OnStepChangedCallback       func(process.Height, process.Round, process.Step)
+	OnLockedCallback            func(process.Height, process.Round, process.Value)
+	OnValidValueUpdatedCallback func(process.Height, process.Round, process.Value)
+	OnRoundSkippedCallback      func(process.Height, process.Round, process.Round)
+	OnTimeoutScheduledCallback  func(process.Height, process.Round, process.Step)
+}
+
+// OnStepChanged passes the step change to the appropriate callback function
+func (observer ObserverCallbacks) OnStepChanged(height process.Height, round process.Round, step process.Step) {
+	if observer.OnStepChangedCallback == nil {
+		return
+	}
+	observer.OnStepChangedCallback(height, round, step)
+}
+
+// OnLocked passes the lock to the appropriate callback function
+func (observer ObserverCallbacks) OnLocked(height process.Height, round process.Round, value process.Value) {
+	if observer.OnLockedCallback == nil {
+		return
+	}
+	observer.OnLockedCallback(height, round, value)
+}
+
+// OnValidValueUpdated passes the valid value update to the appropriate callback
+// function
+func (observer ObserverCallbacks) OnValidValueUpdated(height process.Height, round process.Round, value process.Value) {
+	if observer.OnValidValueUpdatedCallback == nil {
+		return
+	}
+	observer.OnValidValueUpdatedCallback(height, round, value)
+}
+
+// OnRoundSkipped passes the round skip to the appropriate callback function
+func (observer ObserverCallbacks) OnRoundSkipped(height process.Height, from, to process.Round) {
+	if observer.OnRoundSkippedCallback == nil {
+		return
+	}
+	observer.OnRoundSkippedCallback(height, from, to)
+}
+
+// OnTimeoutScheduled passes the scheduled timeout to the appropriate callback
+// function
+func (observer ObserverCallbacks) OnTimeoutScheduled(height process.Height, round process.Round, step process.Step) {
+	if observer.OnTimeoutScheduledCallback == nil {
+		return
+	}
+	observer.OnTimeoutScheduledCallback(height, round, step)
+}
+
 // RandomHeight consumes a source of randomness and returns a random height
 // for the consensus mechanism. It returns a truly random height 70% of the times,
 // whereas for the other 30% of the times it returns heights for edge scenarios
@@ -202,6 +304,18 @@ func RandomValue(r *rand.Rand) process.Value {
 	}
 }
 
+// RandomPayload consumes a source of randomness and returns a random payload,
+// which might be nil.
+func RandomPayload(r *rand.Rand) []byte {
+	n := r.Intn(100)
+	if n%2 == 0 {
+		return nil
+	}
+	payload := make([]byte, n)
+	r.Read(payload)
+	return payload
+}
+
 // RandomState consumes a source of randomness and returns a random state of
 // a process in the consensus mechanism.
 func RandomState(r *rand.Rand) process.State {
@@ -277,6 +391,7 @@ func RandomPropose(r *rand.Rand) process.Propose {
 		}
 		msg.From = privKey.Signatory()
 		msg.Signature = signature
+		msg.Payload = RandomPayload(r)
 		return msg
 	}
 }
@@ -384,3 +499,20 @@ func RandomPrecommit(r *rand.Rand) process.Precommit {
 		return msg
 	}
 }
+
+// RandomCommitCertificate consumes a source of randomness and returns a random
+// commit certificate. The precommits in the certificate are random, and are not
+// guaranteed to be valid for the height, round, and value of the certificate.
+func RandomCommitCertificate(r *rand.Rand) process.CommitCertificate {
+	precommits := make([]process.Precommit, r.Intn(10))
+	for i := range precommits {
+		precommits[i] = RandomPrecommit(r)
+	}
+	return process.CommitCertificate{
+		Height:     RandomHeight(r),
+		Round:      RandomRound(r),
+		Value:      RandomValue(r),
+		Precommits: precommits,
+		Payload:    RandomPayload(r),
+	}
+}
@@ -0,0 +1,90 @@
+package process
+
+// retainRound returns true if the messages of the Round must be kept in the
+// message logs. When there is a round retention, only the Rounds within the
+// retention of the current Round are kept, together with the Rounds that are
+// needed by the consensus algorithm: the LockedRound and ValidRound of the
+// Process, the ValidRounds referenced by the Proposes that are kept (see L28),
+// and the Rounds in which the Propose might still be committed (see L49).
+// Otherwise, all Rounds are kept.
+func (p *Process) retainRound(round Round) bool {
+	if p.roundRetention <= 0 || p.withinRetention(round) {
+		return true
+	}
+	if round == p.LockedRound || round == p.ValidRound {
+		return true
+	}
+	if p.committable(round) {
+		return true
+	}
+	for proposeRound, propose := range p.ProposeLogs {
+		if propose.ValidRound == round && p.withinRetention(proposeRound) {
+			return true
+		}
+	}
+	return false
+}
+
+// committable returns true if the Round has a Propose, and its Value has been
+// precommitted by at least f+1 Processes. At least one of them is correct, so
+// the Value might be committed once the remaining Precommits arrive, even after
+// the Process has moved far away from the Round.
+func (p *Process) committable(round Round) bool {
+	propose, ok := p.ProposeLogs[round]
+	if !ok {
+		return false
+	}
+	precommitsForValue := uint64(0)
+	for _, precommit := range p.PrecommitLogs[round] {
+		if precommit.Value.Equal(&propose.Value) {
+			precommitsForValue += p.power(precommit.From)
+		}
+	}
+	return p.hasMinority(precommitsForValue)
+}
+
+// withinRetention returns true if the Round is no more than the round
+// retention away from the current Round.
+func (p *Process) withinRetention(round Round) bool {
+	retention := Round(p.roundRetention)
+	return round >= p.CurrentRound-retention && round <= p.CurrentRound+retention
+}
+
+// pruneRounds removes all Rounds that are no longer retained from the message
+// logs and OnceFlags. It must be called whenever the current Round changes.
+func (p *Process) pruneRounds() {
+	if p.roundRetention <= 0 {
+		return
+	}
+
+	// Find the Rounds to prune before pruning any of them, because the Rounds
+	// that are retained depend on the Proposes that are in the logs.
+	pruned := map[Round]struct{}{}
+	for round := range p.ProposeLogs {
+		if !p.retainRound(round) {
+			pruned[round] = struct{}{}
+		}
+	}
+	for round := range p.PrevoteLogs {
+		if !p.retainRound(round) {
+			pruned[round] = struct{}{}
+		}
+	}
+	for round := range p.PrecommitLogs {
+		if !p.retainRound(round) {
+			pruned[round] = struct{}{}
+		}
+	}
+	for round := range p.OnceFlags {
+		if !p.retainRound(round) {
+			pruned[round] = struct{}{}
+		}
+	}
+
+	for round := range pruned {
+		delete(p.ProposeLogs, round)
+		delete(p.PrevoteLogs, round)
+		delete(p.PrecommitLogs, round)
+		delete(p.OnceFlags, round)
+	}
+}
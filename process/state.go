@@ -240,6 +240,20 @@ const (
 	Precommitting = Step(2)
 )
 
+// String returns the name of the Step.
+func (step Step) String() string {
+	switch step {
+	case Proposing:
+		return "propose"
+	case Prevoting:
+		return "prevote"
+	case Precommitting:
+		return "precommit"
+	default:
+		return fmt.Sprintf("step(%d)", uint8(step))
+	}
+}
+
 // Height defines a typedef for int64 values that represent the height of a
 // Value at which the consensus algorithm is attempting to reach consensus.
 type Height int64
@@ -0,0 +1,228 @@
+package replica
+
+import (
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/id"
+)
+
+// An AsyncProposer is used to propose new Values without blocking the Replica.
+// It returns a channel to which the Value will be sent once it is ready. The
+// same rules apply as for a Proposer.
+type AsyncProposer interface {
+	Propose(process.Height, process.Round) <-chan process.Value
+}
+
+// An AsyncValidator is used to validate proposed Values without blocking the
+// Replica. It returns a channel to which the validity of the Value will be
+// sent once it is known.
+type AsyncValidator interface {
+	Valid(process.Height, process.Value) <-chan bool
+}
+
+// A proposeResult is a Value that was proposed asynchronously.
+type proposeResult struct {
+	height process.Height
+	round  process.Round
+	value  process.Value
+}
+
+// A validationKey identifies a Value that is validated asynchronously. Values
+// are validated separately at every Height.
+type validationKey struct {
+	height process.Height
+	value  process.Value
+}
+
+// A validateResult is the validity of a Value that was validated
+// asynchronously.
+type validateResult struct {
+	key   validationKey
+	valid bool
+}
+
+// NewAsync instantiates and returns a pointer to a new Hyperdrive replica
+// machine that proposes and validates Values asynchronously, so that slow
+// application work does not stop the Replica from handling messages and
+// timeouts.
+//
+// While a Value is being proposed, the Replica times out as if it was waiting
+// for a Propose from another Replica, and a Value that arrives after the
+// Replica has moved on is dropped. Proposes are only passed to the Process once
+// their Value has been validated, and Proposes that are validated after the
+// Replica has moved past their Height are dropped. Only Proposes for the
+// current and next Heights, from the scheduled proposer of their Round, are
+// validated, and at most Options.MaxValidations Values from each signatory are
+// validated at the same time.
+func NewAsync(
+	opts Options,
+	whoami id.Signatory,
+	signatories []id.Signatory,
+	propose AsyncProposer,
+	validate AsyncValidator,
+	commit process.Committer,
+	catch process.Catcher,
+	broadcast process.Broadcaster,
+	didHandleMessage DidHandleMessage,
+) *Replica {
+	replica := newReplica(opts, whoami, signatories, broadcast, didHandleMessage)
+	var proposer process.Proposer
+	if propose != nil {
+		proposer = asyncProposer{replica: replica, proposer: propose}
+	}
+	var validator process.Validator
+	if validate != nil {
+		replica.validator = validate
+		replica.validity = make(map[validationKey]bool)
+		replica.validating = make(map[validationKey][]process.Propose)
+		validator = asyncValidator{replica: replica}
+	}
+	replica.init(proposer, validator, commit, catch)
+	return replica
+}
+
+// filterValidity returns false if the Propose must not be passed to the
+// Process yet, because its Value has not been validated. Proposes that are
+// waiting for their Value to be validated are kept until the validity is known
+// (see handleValidateResult). Only Values proposed by the scheduled proposer
+// are validated, and Proposes from a signatory that already has too many
+// Values being validated are dropped, so that other signatories cannot make
+// the Validator do unbounded work.
+func (replica *Replica) filterValidity(propose process.Propose) bool {
+	if replica.validator == nil {
+		return true
+	}
+	key := validationKey{height: propose.Height, value: propose.Value}
+	if _, ok := replica.validity[key]; ok {
+		return true
+	}
+	if propose.Height > replica.proc.CurrentHeight+1 {
+		return false
+	}
+	if propose.Round < 0 {
+		replica.dropped("propose", propose.Height, propose.Round, propose.From, "round")
+		return false
+	}
+	if proposer := replica.proposer(propose.Height, propose.Round); !proposer.Equal(&propose.From) {
+		replica.dropped("propose", propose.Height, propose.Round, propose.From, "proposer")
+		return false
+	}
+	if proposes, ok := replica.validating[key]; ok {
+		replica.validating[key] = append(proposes, propose)
+		return false
+	}
+
+	n := 0
+	for _, proposes := range replica.validating {
+		if proposes[0].From.Equal(&propose.From) {
+			n++
+		}
+	}
+	if n >= replica.opts.MaxValidations {
+		replica.dropped("propose", propose.Height, propose.Round, propose.From, "validations")
+		return false
+	}
+	replica.validating[key] = []process.Propose{propose}
+
+	valid := replica.validator.Valid(propose.Height, propose.Value)
+	done := replica.done
+	go func() {
+		select {
+		case <-done:
+		case result, ok := <-valid:
+			select {
+			case <-done:
+			case replica.onValidateResult <- validateResult{key: key, valid: ok && result}:
+			}
+		}
+	}()
+	return false
+}
+
+// handleValidateResult remembers the validity of the Value, and inserts all of
+// the Proposes that were waiting for it into the MessageQueue. Results for
+// Heights that the Process has already left are dropped.
+func (replica *Replica) handleValidateResult(result validateResult) {
+	proposes := replica.validating[result.key]
+	delete(replica.validating, result.key)
+	if result.key.height < replica.proc.CurrentHeight {
+		return
+	}
+	replica.validity[result.key] = result.valid
+	for _, propose := range proposes {
+		replica.mq.InsertPropose(propose)
+	}
+}
+
+// handleProposeResult gives the asynchronously proposed Value to the Process,
+// if it is still waiting for it.
+func (replica *Replica) handleProposeResult(result proposeResult) {
+	if result.height != replica.proposeHeight || result.round != replica.proposeRound {
+		return
+	}
+	replica.proposeHeight, replica.proposeRound = 0, process.InvalidRound
+	replica.proc.OnPropose(result.height, result.round, result.value)
+}
+
+// forgetValidity up to, and including, the Height.
+func (replica *Replica) forgetValidity(height process.Height) {
+	for key := range replica.validity {
+		if key.height <= height {
+			delete(replica.validity, key)
+		}
+	}
+	for key := range replica.validating {
+		if key.height <= height {
+			delete(replica.validating, key)
+		}
+	}
+}
+
+// An asyncProposer wraps an AsyncProposer so that it can be used as the
+// AsyncProposer of a Process. The Value is sent back to the Replica, so that
+// it is given to the Process by the goroutine that runs the Replica.
+type asyncProposer struct {
+	replica  *Replica
+	proposer AsyncProposer
+}
+
+// Propose waits for the AsyncProposer to propose a Value. This is never called
+// by the Process, because the asyncProposer implements the AsyncProposer
+// interface, but it is required by the Proposer interface.
+func (p asyncProposer) Propose(height process.Height, round process.Round) process.Value {
+	return <-p.proposer.Propose(height, round)
+}
+
+// ProposeAsync asks the AsyncProposer for a Value, and sends the Value to the
+// Replica once it is ready. Only the latest request is remembered, so Values
+// for earlier requests are dropped.
+func (p asyncProposer) ProposeAsync(height process.Height, round process.Round) {
+	p.replica.proposeHeight, p.replica.proposeRound = height, round
+
+	value := p.proposer.Propose(height, round)
+	done := p.replica.done
+	go func() {
+		select {
+		case <-done:
+		case value, ok := <-value:
+			if !ok {
+				return
+			}
+			select {
+			case <-done:
+			case p.replica.onProposeResult <- proposeResult{height: height, round: round, value: value}:
+			}
+		}
+	}()
+}
+
+// An asyncValidator is used as the Validator of a Process when Values are
+// validated asynchronously. Proposes are only passed to the Process once their
+// Value has been validated, so the validity is always known.
+type asyncValidator struct {
+	replica *Replica
+}
+
+// Valid returns the validity of the Value at the current Height.
+func (v asyncValidator) Valid(value process.Value) bool {
+	return v.replica.validity[validationKey{height: v.replica.proc.CurrentHeight, value: value}]
+}
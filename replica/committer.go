@@ -0,0 +1,59 @@
+package replica
+
+import (
+	"github.com/renproject/hyperdrive/process"
+)
+
+// A committer wraps a Committer and notifies the Replica whenever a Value is
+// committed, so that the Replica can remember the CommitCertificate and learn
+// about the next Epoch. It always implements the CertifiedCommitter interface,
+// so that CommitCertificates are still passed to the wrapped Committer when it
+// wants them.
+//
+// If the Replica is pipelined, then the CommitCertificate is queued, and the
+// wrapped Committer is called by the goroutine that runs the pipeline.
+type committer struct {
+	replica   *Replica
+	committer process.Committer
+}
+
+// Commit the Value using the wrapped Committer. This is never called by the
+// Process, because the committer implements the CertifiedCommitter interface,
+// but it is required by the Committer interface.
+func (c committer) Commit(height process.Height, value process.Value) {
+	c.committer.Commit(height, value)
+}
+
+// CommitWithProof commits the Value in the CommitCertificate using the wrapped
+// Committer (or queues it to be committed), and then notifies the Replica.
+func (c committer) CommitWithProof(cert process.CommitCertificate) {
+	// Payloads are attached now, because the wrapped Committer might be called
+	// by the pipeline, which must not read the state of the Replica.
+	if c.replica.payloads != nil && len(cert.Payload) == 0 {
+		cert.Payload, _ = c.replica.payload(cert.Value)
+	}
+	if c.replica.pipeline != nil {
+		c.replica.pipeline <- cert
+	} else {
+		c.commit(cert)
+	}
+	c.replica.didCommit(cert)
+}
+
+func (c committer) commit(cert process.CommitCertificate) {
+	if committer, ok := c.committer.(process.CertifiedCommitter); ok {
+		committer.CommitWithProof(cert)
+	} else {
+		c.committer.Commit(cert.Height, cert.Value)
+	}
+}
+
+// runPipeline commits the queued CommitCertificates, in order, until the queue
+// is closed. The queue is closed once the Replica has stopped running, so all
+// Values that were decided are committed before the pipeline stops.
+func (c committer) runPipeline(pipeline <-chan process.CommitCertificate, done chan<- struct{}) {
+	defer close(done)
+	for cert := range pipeline {
+		c.commit(cert)
+	}
+}
@@ -0,0 +1,62 @@
+package replica
+
+import (
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/hyperdrive/scheduler"
+	"github.com/renproject/id"
+)
+
+// An Epoch is a set of signatories that is responsible for consensus from a
+// specific Height onwards. If the VotingPower of an Epoch is nil, then every
+// signatory in the Epoch has an equal vote.
+type Epoch struct {
+	Height      process.Height
+	Signatories []id.Signatory
+	VotingPower process.VotingPower
+}
+
+// An EpochProvider is used by a Replica to learn about changes to its set of
+// signatories. Epochs must be derived solely from committed Values, so that all
+// correct Replicas agree on when each Epoch begins.
+type EpochProvider interface {
+	// NextEpoch is called after a Value is committed. If the Value begins a new
+	// Epoch, then it returns the Epoch and true, otherwise it returns false.
+	// The Height of the Epoch must be greater than the Height of the Value.
+	NextEpoch(process.Height, process.Value) (Epoch, bool)
+}
+
+// f returns the maximum number of malicious signatories that the Epoch can
+// withstand.
+func (epoch Epoch) f() int {
+	return len(epoch.Signatories) / 3
+}
+
+// scheduler returns the Scheduler used to select proposers during the Epoch,
+// when signatories are not demoted for failing to propose.
+func (epoch Epoch) scheduler() process.Scheduler {
+	if epoch.VotingPower != nil {
+		return scheduler.NewWeighted(epoch.VotingPower)
+	}
+	return scheduler.NewRoundRobin(epoch.Signatories)
+}
+
+// procsAllowed returns the set of signatories from which messages will be
+// accepted during the Epoch.
+func (epoch Epoch) procsAllowed() map[id.Signatory]bool {
+	procsAllowed := make(map[id.Signatory]bool, len(epoch.Signatories))
+	for _, signatory := range epoch.Signatories {
+		procsAllowed[signatory] = true
+	}
+	return procsAllowed
+}
+
+// verify that a CommitCertificate proves that its Value was committed by the
+// signatories of the Epoch.
+func (epoch Epoch) verify(cert process.CommitCertificate) error {
+	if epoch.VotingPower != nil {
+		_, err := process.VerifyWeightedCommitCertificate(cert, epoch.VotingPower)
+		return err
+	}
+	_, err := process.VerifyCommitCertificate(cert, epoch.Signatories)
+	return err
+}
@@ -0,0 +1,97 @@
+package replica
+
+import (
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/id"
+
+	"go.uber.org/zap"
+)
+
+// dropped logs a message that was dropped before it reached the MessageQueue,
+// and counts it when the Replica has Metrics. The reason is also used as the
+// label of the count.
+func (replica *Replica) dropped(kind string, height process.Height, round process.Round, from id.Signatory, reason string, fields ...zap.Field) {
+	if replica.opts.Metrics != nil {
+		replica.opts.Metrics.Filtered.With(reason).Inc()
+	}
+	if entry := replica.logger.Check(zap.DebugLevel, "dropped "+kind); entry != nil {
+		entry.Write(append([]zap.Field{
+			zap.Int64("height", int64(height)),
+			zap.Int64("round", int64(round)),
+			zap.Stringer("from", from),
+			zap.String("reason", reason),
+		}, fields...)...)
+	}
+}
+
+// timedOut logs a timeout that has fired, before it is given to the Process.
+func (replica *Replica) timedOut(step process.Step, height process.Height, round process.Round) {
+	replica.logger.Debug("timed out",
+		zap.Int64("height", int64(height)),
+		zap.Int64("round", int64(round)),
+		zap.Stringer("step", step),
+	)
+}
+
+// A catcher logs the misbehaviour that is caught by the Process, counts it
+// when the Replica has Metrics, and passes it to the wrapped Catcher, if there
+// is one.
+type catcher struct {
+	logger  *zap.Logger
+	metrics *Metrics
+	catcher process.Catcher
+}
+
+// caught logs and counts misbehaviour of the kind.
+func (c catcher) caught(kind string, height process.Height, round process.Round, from id.Signatory) {
+	if c.metrics != nil {
+		c.metrics.Caught.With(kind).Inc()
+	}
+	c.logger.Warn("caught misbehaviour",
+		zap.String("kind", kind),
+		zap.Int64("height", int64(height)),
+		zap.Int64("round", int64(round)),
+		zap.Stringer("from", from),
+	)
+}
+
+// CatchDoublePropose logs the double propose.
+func (c catcher) CatchDoublePropose(propose, conflicting process.Propose) {
+	c.caught("double_propose", propose.Height, propose.Round, propose.From)
+	if c.catcher != nil {
+		c.catcher.CatchDoublePropose(propose, conflicting)
+	}
+}
+
+// CatchDoublePrevote logs the double prevote.
+func (c catcher) CatchDoublePrevote(prevote, conflicting process.Prevote) {
+	c.caught("double_prevote", prevote.Height, prevote.Round, prevote.From)
+	if c.catcher != nil {
+		c.catcher.CatchDoublePrevote(prevote, conflicting)
+	}
+}
+
+// CatchDoublePrecommit logs the double precommit.
+func (c catcher) CatchDoublePrecommit(precommit, conflicting process.Precommit) {
+	c.caught("double_precommit", precommit.Height, precommit.Round, precommit.From)
+	if c.catcher != nil {
+		c.catcher.CatchDoublePrecommit(precommit, conflicting)
+	}
+}
+
+// CatchOutOfTurnPropose logs the out of turn propose.
+func (c catcher) CatchOutOfTurnPropose(propose process.Propose) {
+	c.caught("out_of_turn_propose", propose.Height, propose.Round, propose.From)
+	if c.catcher != nil {
+		c.catcher.CatchOutOfTurnPropose(propose)
+	}
+}
+
+// CatchAmnesia logs the amnesia, using the Round of the Prevote, and passes it
+// to the wrapped Catcher if it is an AmnesiaCatcher.
+func (c catcher) CatchAmnesia(precommit process.Precommit, prevote process.Prevote) {
+	c.caught("amnesia", prevote.Height, prevote.Round, prevote.From)
+	if catcher, ok := c.catcher.(process.AmnesiaCatcher); ok {
+		catcher.CatchAmnesia(precommit, prevote)
+	}
+}
@@ -0,0 +1,112 @@
+package replica
+
+import (
+	"time"
+
+	"github.com/renproject/hyperdrive/metrics"
+	"github.com/renproject/hyperdrive/mq"
+	"github.com/renproject/hyperdrive/process"
+)
+
+// Metrics of a Replica. They are registered with a Registry, which exports
+// them in the Prometheus text format.
+type Metrics struct {
+	Height          *metrics.Gauge
+	Round           *metrics.Gauge
+	RoundChanges    *metrics.Counter
+	RoundsPerHeight *metrics.Histogram
+	CommitLatency   *metrics.Histogram
+	StepDuration    *metrics.HistogramVec
+	Filtered        *metrics.CounterVec
+	Caught          *metrics.CounterVec
+	MessageQueue    *mq.Metrics
+}
+
+// NewMetrics registers the Metrics of a Replica, and of its MessageQueue, with
+// the Registry.
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		Height:          reg.NewGauge("hyperdrive_height", "Current height of the replica."),
+		Round:           reg.NewGauge("hyperdrive_round", "Current round of the replica."),
+		RoundChanges:    reg.NewCounter("hyperdrive_round_changes_total", "Number of times the replica moved to a later round in the same height."),
+		RoundsPerHeight: reg.NewHistogram("hyperdrive_rounds_per_height", "Number of rounds needed to commit a height.", []float64{1, 2, 3, 5, 10, 20, 50, 100}),
+		CommitLatency:   reg.NewHistogram("hyperdrive_commit_latency_seconds", "Time from starting a height to committing it.", metrics.DefaultDurationBuckets),
+		StepDuration:    reg.NewHistogramVec("hyperdrive_step_duration_seconds", "Time spent in each step.", "step", metrics.DefaultDurationBuckets),
+		Filtered:        reg.NewCounterVec("hyperdrive_messages_filtered_total", "Number of messages dropped before reaching the message queue.", "reason"),
+		Caught:          reg.NewCounterVec("hyperdrive_misbehaviour_caught_total", "Number of times misbehaviour was caught.", "kind"),
+		MessageQueue:    mq.NewMetrics(reg),
+	}
+}
+
+// A metricsObserver is the Observer of a Process when the Replica has
+// Metrics. It measures the Height, Round, and Step of the Process, and passes
+// all state transitions to the Observer in the options, if there is one.
+type metricsObserver struct {
+	metrics  *Metrics
+	observer process.Observer
+
+	height          process.Height
+	round           process.Round
+	step            process.Step
+	heightStartedAt time.Time
+	stepStartedAt   time.Time
+}
+
+// OnStepChanged measures the time spent in the previous Step, and updates the
+// Height and Round.
+func (o *metricsObserver) OnStepChanged(height process.Height, round process.Round, step process.Step) {
+	now := time.Now()
+	if !o.stepStartedAt.IsZero() {
+		o.metrics.StepDuration.With(o.step.String()).Observe(now.Sub(o.stepStartedAt).Seconds())
+	}
+	if height != o.height {
+		o.heightStartedAt = now
+	} else if round != o.round {
+		o.metrics.RoundChanges.Inc()
+	}
+	o.height, o.round, o.step, o.stepStartedAt = height, round, step, now
+	o.metrics.Height.Set(float64(height))
+	o.metrics.Round.Set(float64(round))
+
+	if o.observer != nil {
+		o.observer.OnStepChanged(height, round, step)
+	}
+}
+
+// OnLocked passes the lock to the Observer.
+func (o *metricsObserver) OnLocked(height process.Height, round process.Round, value process.Value) {
+	if o.observer != nil {
+		o.observer.OnLocked(height, round, value)
+	}
+}
+
+// OnValidValueUpdated passes the valid Value to the Observer.
+func (o *metricsObserver) OnValidValueUpdated(height process.Height, round process.Round, value process.Value) {
+	if o.observer != nil {
+		o.observer.OnValidValueUpdated(height, round, value)
+	}
+}
+
+// OnRoundSkipped passes the skipped Round to the Observer. The Round change is
+// measured when the Process starts the new Round.
+func (o *metricsObserver) OnRoundSkipped(height process.Height, from, to process.Round) {
+	if o.observer != nil {
+		o.observer.OnRoundSkipped(height, from, to)
+	}
+}
+
+// OnTimeoutScheduled passes the scheduled timeout to the Observer.
+func (o *metricsObserver) OnTimeoutScheduled(height process.Height, round process.Round, step process.Step) {
+	if o.observer != nil {
+		o.observer.OnTimeoutScheduled(height, round, step)
+	}
+}
+
+// didCommit measures the number of Rounds, and the time, that it took to
+// commit the Height.
+func (o *metricsObserver) didCommit(cert process.CommitCertificate) {
+	o.metrics.RoundsPerHeight.Observe(float64(cert.Round + 1))
+	if cert.Height == o.height && !o.heightStartedAt.IsZero() {
+		o.metrics.CommitLatency.Observe(time.Since(o.heightStartedAt).Seconds())
+	}
+}
@@ -0,0 +1,60 @@
+package replica
+
+import (
+	"github.com/renproject/hyperdrive/process"
+)
+
+// A stoppableTimer is the timer of a Process that can be stopped when the
+// Replica stops running.
+type stoppableTimer interface {
+	process.Timer
+	Stop()
+}
+
+// observers pass all state transitions of a Process to each Observer, in
+// order.
+type observers []process.Observer
+
+// withObserver returns the options with the Observer added before the Observer
+// that is already in the options (if any).
+func withObserver(opts process.Options, observer process.Observer) process.Options {
+	if opts.Observer == nil {
+		return opts.WithObserver(observer)
+	}
+	return opts.WithObserver(observers{observer, opts.Observer})
+}
+
+// OnStepChanged passes the Step to each Observer.
+func (obs observers) OnStepChanged(height process.Height, round process.Round, step process.Step) {
+	for _, o := range obs {
+		o.OnStepChanged(height, round, step)
+	}
+}
+
+// OnLocked passes the lock to each Observer.
+func (obs observers) OnLocked(height process.Height, round process.Round, value process.Value) {
+	for _, o := range obs {
+		o.OnLocked(height, round, value)
+	}
+}
+
+// OnValidValueUpdated passes the valid Value to each Observer.
+func (obs observers) OnValidValueUpdated(height process.Height, round process.Round, value process.Value) {
+	for _, o := range obs {
+		o.OnValidValueUpdated(height, round, value)
+	}
+}
+
+// OnRoundSkipped passes the skipped Round to each Observer.
+func (obs observers) OnRoundSkipped(height process.Height, from, to process.Round) {
+	for _, o := range obs {
+		o.OnRoundSkipped(height, from, to)
+	}
+}
+
+// OnTimeoutScheduled passes the scheduled timeout to each Observer.
+func (obs observers) OnTimeoutScheduled(height process.Height, round process.Round, step process.Step) {
+	for _, o := range obs {
+		o.OnTimeoutScheduled(height, round, step)
+	}
+}
@@ -1,35 +1,321 @@
 package replica
 
 import (
+	"time"
+
 	"github.com/renproject/hyperdrive/mq"
+	"github.com/renproject/hyperdrive/process"
 	"github.com/renproject/hyperdrive/timer"
+	"github.com/renproject/hyperdrive/wal"
+	"github.com/renproject/id"
 
 	"go.uber.org/zap"
 )
 
+const (
+	// DefaultSyncHistory is the number of CommitCertificates that are kept by
+	// default for syncing other Replicas.
+	DefaultSyncHistory = 100
+
+	// DefaultSyncWindow is the number of Heights, after the current Height, for
+	// which CommitCertificates are accepted by default while syncing.
+	DefaultSyncWindow = 100
+
+	// DefaultSyncInterval is the minimum time between two sync requests for
+	// the same Height set by default.
+	DefaultSyncInterval = 5 * time.Second
+
+	// DefaultRoundRequestInterval is the minimum time between two answers to
+	// round requests from the same signatory for the same Round set by
+	// default.
+	DefaultRoundRequestInterval = time.Second
+
+	// DefaultReputationWindow is the number of recent Heights for which the
+	// signatories that failed to propose are remembered set by default.
+	DefaultReputationWindow = 100
+
+	// DefaultMaxPayloadSize is the maximum size of the payload of a Propose in
+	// bytes set by default.
+	DefaultMaxPayloadSize = 1024 * 1024
+
+	// DefaultMaxPayloads is the maximum number of payloads that are remembered
+	// from each signatory set by default.
+	DefaultMaxPayloads = 10
+
+	// DefaultMaxValidations is the maximum number of Values from each
+	// signatory that are validated asynchronously at the same time set by
+	// default.
+	DefaultMaxValidations = 10
+)
+
 // Options represent the options for a Hyperdrive Replica
 type Options struct {
-	Logger           *zap.Logger
-	TimerOpts        timer.Options
-	MessageQueueOpts mq.Options
+	Logger               *zap.Logger
+	PrivKey              *id.PrivKey
+	EpochProvider        EpochProvider
+	WAL                  wal.WAL
+	Syncer               Syncer
+	SyncHistory          int
+	SyncWindow           int
+	SyncInterval         time.Duration
+	ResendInterval       time.Duration
+	Resender             Resender
+	RoundRequestInterval time.Duration
+	MaxPayloadSize       int
+	MaxPayloads          int
+	MaxValidations       int
+	PipelineDepth        int
+	AdaptiveTimer        bool
+	RoundProvider        RoundProvider
+	ReputationWindow     int
+	Metrics              *Metrics
+	ProcessOpts          process.Options
+	TimerOpts            timer.Options
+	MessageQueueOpts     mq.Options
 }
 
-// DefaultOptions returns the default options for a Hyperdrive Replica
+// DefaultOptions returns the default options for a Hyperdrive Replica. There
+// is no default private key, so one must be provided using WithPrivKey.
 func DefaultOptions() Options {
 	logger, err := zap.NewDevelopment()
 	if err != nil {
 		panic(err)
 	}
 	return Options{
-		Logger:           logger,
-		TimerOpts:        timer.DefaultOptions(),
-		MessageQueueOpts: mq.DefaultOptions(),
+		Logger:               logger,
+		SyncHistory:          DefaultSyncHistory,
+		SyncWindow:           DefaultSyncWindow,
+		SyncInterval:         DefaultSyncInterval,
+		RoundRequestInterval: DefaultRoundRequestInterval,
+		MaxPayloadSize:       DefaultMaxPayloadSize,
+		MaxPayloads:          DefaultMaxPayloads,
+		MaxValidations:       DefaultMaxValidations,
+		ReputationWindow:     DefaultReputationWindow,
+		ProcessOpts:          process.DefaultOptions(),
+		TimerOpts:            timer.DefaultOptions(),
+		MessageQueueOpts:     mq.DefaultOptions(),
 	}
 }
 
-// WithLogger updates the logger used in the Replica with the provided logger
+// WithLogger updates the logger used in the Replica with the provided logger.
+// It also updates the loggers of the Replica's timer and message queue. The
+// logger is given to the Replica's process, unless the process options already
+// have a logger.
 func (opts Options) WithLogger(logger *zap.Logger) Options {
 	opts.Logger = logger
+	opts.TimerOpts = opts.TimerOpts.WithLogger(logger)
+	opts.MessageQueueOpts = opts.MessageQueueOpts.WithLogger(logger)
+	return opts
+}
+
+// WithPrivKey updates the private key used by the Replica to sign the messages
+// that it broadcasts. The signatory of the private key must be the same as the
+// identity of the Replica.
+func (opts Options) WithPrivKey(privKey *id.PrivKey) Options {
+	opts.PrivKey = privKey
+	return opts
+}
+
+// WithEpochProvider updates the EpochProvider used by the Replica to learn
+// about changes to its set of signatories. By default, there is no
+// EpochProvider, and the set of signatories never changes.
+func (opts Options) WithEpochProvider(provider EpochProvider) Options {
+	opts.EpochProvider = provider
+	return opts
+}
+
+// WithWAL updates the write-ahead log used by the Replica to recover from
+// crashes. When a write-ahead log is set, the Replica resumes from the State
+// and messages in the log, instead of starting from the default State. The
+// Replica must be given the signatories for the Height at which it resumes. The
+// State is checkpointed as soon as the Replica moves to the next Height, so a
+// Value is only committed again if the Replica crashes while committing it. By
+// default, there is no write-ahead log.
+func (opts Options) WithWAL(wal wal.WAL) Options {
+	opts.WAL = wal
+	return opts
+}
+
+// WithSyncer updates the Syncer used by the Replica to catch up with other
+// Replicas. By default, there is no Syncer, and the Replica never syncs.
+func (opts Options) WithSyncer(syncer Syncer) Options {
+	opts.Syncer = syncer
+	return opts
+}
+
+// WithSyncHistory updates the number of recent CommitCertificates that the
+// Replica keeps for syncing other Replicas. A Replica that has fallen more than
+// this many Heights behind every other Replica cannot be synced, and must catch
+// up by other means (for example, by restoring the state of another Replica).
+// When the history is zero, the Replica does not help other Replicas to sync.
+func (opts Options) WithSyncHistory(history int) Options {
+	opts.SyncHistory = history
+	return opts
+}
+
+// WithSyncWindow updates the number of Heights, after the current Height, for
+// which the Replica keeps CommitCertificates while it is syncing. A
+// CommitCertificate for the current Height is always accepted, so a Replica
+// with a window of zero still syncs, one Height at a time.
+func (opts Options) WithSyncWindow(window int) Options {
+	opts.SyncWindow = window
+	return opts
+}
+
+// WithSyncInterval updates the minimum time between two sync requests for the
+// same Height.
+func (opts Options) WithSyncInterval(interval time.Duration) Options {
+	opts.SyncInterval = interval
+	return opts
+}
+
+// WithResendInterval updates the time that the Replica waits for its Process to
+// make progress before broadcasting its messages for the current Round again.
+// This is needed when messages can be lost, which is the case when using the
+// transport and gossip packages. By default, the interval is zero, and
+// messages are never resent.
+func (opts Options) WithResendInterval(interval time.Duration) Options {
+	opts.ResendInterval = interval
+	return opts
+}
+
+// WithResender updates the Resender used by the Replica to ask other Replicas
+// for their messages when it has stalled, and to answer their requests for its
+// own messages. Round requests are only sent at the resend interval. By
+// default, there is no Resender, and round requests are ignored.
+func (opts Options) WithResender(resender Resender) Options {
+	opts.Resender = resender
+	return opts
+}
+
+// WithRoundRequestInterval updates the minimum time between two answers to
+// round requests from the same signatory for the same Round. Requests that
+// arrive sooner are dropped.
+func (opts Options) WithRoundRequestInterval(interval time.Duration) Options {
+	opts.RoundRequestInterval = interval
+	return opts
+}
+
+// WithMaxPayloadSize updates the maximum size of the payload of a Propose in
+// bytes. Proposes with larger payloads are dropped.
+func (opts Options) WithMaxPayloadSize(size int) Options {
+	opts.MaxPayloadSize = size
+	return opts
+}
+
+// WithMaxPayloads updates the maximum number of payloads that are remembered
+// from each signatory, for the current and next Heights. Proposes with a
+// payload from a signatory that already has this many payloads remembered are
+// dropped.
+func (opts Options) WithMaxPayloads(max int) Options {
+	opts.MaxPayloads = max
+	return opts
+}
+
+// WithMaxValidations updates the maximum number of Values from each signatory
+// that are validated asynchronously at the same time. Proposes from a
+// signatory that already has this many Values being validated are dropped.
+func (opts Options) WithMaxValidations(max int) Options {
+	opts.MaxValidations = max
+	return opts
+}
+
+// WithPipelineDepth updates the number of Heights for which the Replica can
+// decide a Value before the Value has been committed. When the depth is
+// positive, the Replica moves to the next Height as soon as it has a
+// CommitCertificate, and Values are committed in the background, strictly in
+// order of Height. When the queue of decided Values is full, the Replica waits
+// for the Committer. The depth must be zero when the Replica has a write-ahead
+// log, otherwise New and NewAsync panic, because the State would be
+// checkpointed at the next Height before the Value of the previous Height has
+// been committed. By default, the depth is zero, and every Value is committed
+// before the Replica moves to the next Height.
+func (opts Options) WithPipelineDepth(depth int) Options {
+	opts.PipelineDepth = depth
+	return opts
+}
+
+// WithAdaptiveTimer updates whether the Replica computes its timeouts from the
+// time that it takes to complete each step in recent Heights, using an
+// AdaptiveTimer, instead of using a LinearTimer. Both timers are configured by
+// the timer options. By default, a LinearTimer is used.
+func (opts Options) WithAdaptiveTimer(adaptive bool) Options {
+	opts.AdaptiveTimer = adaptive
+	return opts
+}
+
+// WithRoundProvider updates the RoundProvider used by the Replica to learn the
+// Round in which each committed Value was proposed. When there is a
+// RoundProvider, proposers are scheduled using a scheduler.Reputation, so that
+// signatories that failed to propose in the reputation window are only
+// scheduled after the other signatories. Epochs with voting power always use
+// weighted scheduling. By default, there is no RoundProvider, and proposers are
+// scheduled in round-robin order.
+func (opts Options) WithRoundProvider(provider RoundProvider) Options {
+	opts.RoundProvider = provider
+	return opts
+}
+
+// WithReputationWindow updates the number of recent Heights for which the
+// Replica remembers the signatories that failed to propose, when it has a
+// RoundProvider.
+func (opts Options) WithReputationWindow(window int) Options {
+	opts.ReputationWindow = window
+	return opts
+}
+
+// WithMetrics updates the Metrics of the Replica, and of its MessageQueue
+// (unless the MessageQueue options already have Metrics). By default, there
+// are no Metrics.
+func (opts Options) WithMetrics(metrics *Metrics) Options {
+	opts.Metrics = metrics
+	return opts
+}
+
+// WithProcessOptions updates the Replica's process options with the provided
+// options
+func (opts Options) WithProcessOptions(processOpts process.Options) Options {
+	opts.ProcessOpts = processOpts
+	return opts
+}
+
+// WithVotingPower updates the voting power of the signatories. When voting
+// power is set, the Replica uses stake-weighted thresholds and a weighted
+// proposer schedule, instead of treating every signatory equally.
+func (opts Options) WithVotingPower(votingPower process.VotingPower) Options {
+	opts.ProcessOpts = opts.ProcessOpts.WithVotingPower(votingPower)
+	return opts
+}
+
+// WithHistoryHeights updates the number of recent Heights for which the
+// Replica keeps votes, so that it can catch double votes in Heights that it
+// has already left, and amnesia across Rounds.
+func (opts Options) WithHistoryHeights(heights int) Options {
+	opts.ProcessOpts = opts.ProcessOpts.WithHistoryHeights(heights)
+	return opts
+}
+
+// WithHistoryRounds updates the number of Rounds, before and after the latest
+// Round of each Height, for which the Replica keeps votes in its history.
+func (opts Options) WithHistoryRounds(rounds int) Options {
+	opts.ProcessOpts = opts.ProcessOpts.WithHistoryRounds(rounds)
+	return opts
+}
+
+// WithRoundRetention updates the number of Rounds, before and after the
+// current Round, that the Replica keeps in the message logs of its process.
+// Values that are committed by other Replicas in a Round that has been pruned
+// can only be learned from their CommitCertificates, so a Replica with a
+// positive retention must also have a Syncer (see WithSyncer).
+func (opts Options) WithRoundRetention(retention int) Options {
+	opts.ProcessOpts = opts.ProcessOpts.WithRoundRetention(retention)
+	return opts
+}
+
+// WithObserver updates the Observer that is notified about the state
+// transitions of the Replica's process.
+func (opts Options) WithObserver(observer process.Observer) Options {
+	opts.ProcessOpts = opts.ProcessOpts.WithObserver(observer)
 	return opts
 }
 
@@ -0,0 +1,236 @@
+package replica
+
+import (
+	"fmt"
+
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/hyperdrive/wal"
+	"github.com/renproject/id"
+)
+
+// A PayloadProposer is used to propose new payloads for consensus. It is the
+// payload equivalent of a Proposer, and the same rules apply: it must only
+// return valid payloads, and once it returns a payload, it must never return a
+// different payload for the same Height and Round.
+type PayloadProposer interface {
+	ProposePayload(process.Height, process.Round) []byte
+}
+
+// A PayloadValidator is used to validate the content of a proposed payload. It
+// is the payload equivalent of a Validator.
+type PayloadValidator interface {
+	ValidPayload(process.Height, []byte) bool
+}
+
+// A PayloadCommitter is used to emit payloads that are committed. It is the
+// payload equivalent of a Committer.
+type PayloadCommitter interface {
+	CommitPayload(process.Height, []byte)
+}
+
+// NewPayloadValue returns the Value that is agreed upon when the payload is
+// proposed. Payloads are attached to Proposes, and CommitCertificates, that
+// have this Value.
+func NewPayloadValue(payload []byte) process.Value {
+	return process.Value(id.NewHash(payload))
+}
+
+// A payloadEntry is a payload that has been proposed, and the Height, Round,
+// and signatory by which it was proposed.
+type payloadEntry struct {
+	height  process.Height
+	round   process.Round
+	from    id.Signatory
+	payload []byte
+}
+
+// NewWithPayloads instantiates and returns a pointer to a new Hyperdrive
+// replica machine that agrees on payloads, instead of Values. The Value of
+// every Propose is the hash of its payload (see NewPayloadValue), and the
+// payload is attached to the Propose when it is broadcast.
+//
+// Proposes with a payload that is larger than the maximum payload size in the
+// options, or that does not match their Value, are dropped. So are Proposes
+// from signatories that are not scheduled to propose, and Proposes from
+// signatories that already have the maximum number of payloads in the options
+// remembered. The payload of a Propose is given to the PayloadValidator before
+// the Value is voted for, and the payload of every committed Value is given to
+// the PayloadCommitter.
+//
+// The Process only knows the Value of a Propose, so payloads are kept by the
+// Replica (and appended to its write-ahead log, if it has one), instead of in
+// the State of the Process.
+func NewWithPayloads(
+	opts Options,
+	whoami id.Signatory,
+	signatories []id.Signatory,
+	propose PayloadProposer,
+	validate PayloadValidator,
+	commit PayloadCommitter,
+	catch process.Catcher,
+	broadcast process.Broadcaster,
+	didHandleMessage DidHandleMessage,
+) *Replica {
+	replica := newReplica(opts, whoami, signatories, broadcast, didHandleMessage)
+	replica.payloads = make(map[process.Value]payloadEntry)
+	replica.init(
+		payloadProposer{replica: replica, proposer: propose},
+		payloadValidator{replica: replica, validator: validate},
+		payloadCommitter{replica: replica, committer: commit},
+		catch,
+	)
+	return replica
+}
+
+// filterPayload returns false if the Propose must be dropped because of its
+// payload. Otherwise, the payload is remembered, so that it can be validated
+// and committed.
+//
+// Payloads are only remembered for the current and next Heights, and only
+// from the signatory that is scheduled to propose. Each signatory can only
+// have one payload remembered for each Round, and a bounded number of
+// payloads in total, so that the number of remembered payloads is bounded.
+func (replica *Replica) filterPayload(propose process.Propose) bool {
+	if len(propose.Payload) > replica.opts.MaxPayloadSize {
+		return false
+	}
+	if replica.payloads == nil {
+		return true
+	}
+	if value := NewPayloadValue(propose.Payload); !value.Equal(&propose.Value) {
+		return false
+	}
+	if propose.Height > replica.proc.CurrentHeight+1 {
+		return true
+	}
+	if propose.Round < 0 {
+		return false
+	}
+	if proposer := replica.proposer(propose.Height, propose.Round); !proposer.Equal(&propose.From) {
+		return false
+	}
+	if _, ok := replica.payloads[propose.Value]; ok {
+		return true
+	}
+
+	n := 0
+	for _, entry := range replica.payloads {
+		if !entry.from.Equal(&propose.From) {
+			continue
+		}
+		if entry.height == propose.Height && entry.round == propose.Round {
+			return false
+		}
+		n++
+	}
+	if n >= replica.opts.MaxPayloads {
+		return false
+	}
+
+	if replica.opts.WAL != nil {
+		if err := replica.opts.WAL.AppendPayload(wal.Payload{Height: propose.Height, Data: propose.Payload}); err != nil {
+			panic(fmt.Errorf("appending payload to wal: %v", err))
+		}
+	}
+	replica.payloads[propose.Value] = payloadEntry{height: propose.Height, round: propose.Round, from: propose.From, payload: propose.Payload}
+	return true
+}
+
+// payload returns the payload that has the Value as its hash, if it has been
+// proposed.
+func (replica *Replica) payload(value process.Value) ([]byte, bool) {
+	if entry, ok := replica.payloads[value]; ok {
+		return entry.payload, true
+	}
+	return nil, false
+}
+
+// forgetPayloads up to, and including, the Height.
+func (replica *Replica) forgetPayloads(height process.Height) {
+	for value, entry := range replica.payloads {
+		if entry.height <= height {
+			delete(replica.payloads, value)
+		}
+	}
+}
+
+// A payloadProposer wraps a PayloadProposer so that it can be used as the
+// Proposer of a Process.
+type payloadProposer struct {
+	replica  *Replica
+	proposer PayloadProposer
+}
+
+// Propose a payload, remember it, and return its Value.
+func (p payloadProposer) Propose(height process.Height, round process.Round) process.Value {
+	payload := p.proposer.ProposePayload(height, round)
+	value := NewPayloadValue(payload)
+	p.replica.payloads[value] = payloadEntry{height: height, round: round, from: p.replica.whoami, payload: payload}
+	return value
+}
+
+// A payloadValidator wraps a PayloadValidator so that it can be used as the
+// Validator of a Process.
+type payloadValidator struct {
+	replica   *Replica
+	validator PayloadValidator
+}
+
+// Valid returns true if the payload of the Value is known, and valid. Values
+// without a known payload cannot be validated, so they are invalid.
+func (v payloadValidator) Valid(value process.Value) bool {
+	payload, ok := v.replica.payload(value)
+	if !ok {
+		return false
+	}
+	return v.validator.ValidPayload(v.replica.proc.CurrentHeight, payload)
+}
+
+// A payloadCommitter wraps a PayloadCommitter so that it can be used as the
+// Committer of a Process.
+type payloadCommitter struct {
+	replica   *Replica
+	committer PayloadCommitter
+}
+
+// Commit the payload of the Value. This is never called by the Replica,
+// because the payloadCommitter implements the CertifiedCommitter interface,
+// but it is required by the Committer interface.
+func (c payloadCommitter) Commit(height process.Height, value process.Value) {
+	payload, _ := c.replica.payload(value)
+	c.committer.CommitPayload(height, payload)
+}
+
+// CommitWithProof commits the payload in the CommitCertificate. The Replica
+// attaches the payload of its Value before the CommitCertificate is committed,
+// so that the payload never has to be looked up by the pipeline.
+func (c payloadCommitter) CommitWithProof(cert process.CommitCertificate) {
+	c.committer.CommitPayload(cert.Height, cert.Payload)
+}
+
+// A payloadAttacher wraps a Broadcaster and attaches payloads to Proposes
+// before passing them to the wrapped Broadcaster. The Process does not know
+// about payloads, so all Proposes that it produces are without one.
+type payloadAttacher struct {
+	replica     *Replica
+	broadcaster process.Broadcaster
+}
+
+// BroadcastPropose attaches the payload of its Value to the Propose and then
+// broadcasts it.
+func (a payloadAttacher) BroadcastPropose(propose process.Propose) {
+	if len(propose.Payload) == 0 {
+		propose.Payload, _ = a.replica.payload(propose.Value)
+	}
+	a.broadcaster.BroadcastPropose(propose)
+}
+
+// BroadcastPrevote broadcasts the Prevote.
+func (a payloadAttacher) BroadcastPrevote(prevote process.Prevote) {
+	a.broadcaster.BroadcastPrevote(prevote)
+}
+
+// BroadcastPrecommit broadcasts the Precommit.
+func (a payloadAttacher) BroadcastPrecommit(precommit process.Precommit) {
+	a.broadcaster.BroadcastPrecommit(precommit)
+}
@@ -2,40 +2,177 @@ package replica
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/renproject/hyperdrive/mq"
 	"github.com/renproject/hyperdrive/process"
-	"github.com/renproject/hyperdrive/scheduler"
 	"github.com/renproject/hyperdrive/timer"
 	"github.com/renproject/id"
+
+	"go.uber.org/zap"
 )
 
 // DidHandleMessage is called by the Replica after it has finished handling an
-// input message (i.e. Propose, Prevote, or Precommit), or timeout.
+// input message (i.e. Propose, Prevote, or Precommit), timeout, request from
+// another Replica, or asynchronously proposed or validated Value.
 type DidHandleMessage func()
 
 // A Replica represents one Process in a replicated state machine that is bound
 // to a specific Shard. It signs Messages before sending them to other Replicas,
-// and verifies Messages before accepting them from other Replicas.
+// and verifies Messages before accepting them from other Replicas. Messages
+// that are not signed by their sender are dropped before they reach the
+// MessageQueue.
+//
+// If a Replica has a write-ahead log, then it appends every message to the log
+// before broadcasting it, and saves the State of its Process whenever its
+// Height, Round, Step, or locks change. When such a Replica is run after a
+// crash, it resumes from the log.
+//
+// The signatories of a Replica can change at Height boundaries, by using an
+// EpochProvider. Messages from signatories that are not part of the Epoch for
+// the Height of the message are dropped.
+//
+// If a Replica has a Syncer, then it asks other Replicas for CommitCertificates
+// whenever it sees that it has fallen behind, and uses them to catch up.
+//
+// If a Replica has a resend interval, then it broadcasts its messages for the
+// current Round again whenever its Process has not made progress for that
+// interval. This allows a stalled Round to recover after messages are lost.
+//
+// If a Replica has a pipeline depth, then it moves to the next Height as soon
+// as it has a CommitCertificate for the current Height, and commits Values in
+// the background. Values are always committed in order of Height.
+//
+// If a Replica has Metrics, then it measures its Process, its MessageQueue,
+// and the messages that it drops. The Metrics can be scraped by Prometheus by
+// serving the Registry that they were registered with.
+//
+// A Replica logs the messages that it drops and the timeouts that fire at the
+// debug level, the Values that it commits at the info level, and the
+// misbehaviour that it catches at the warn level. Its logger is also given to
+// its Process, unless the process options already have a logger.
+//
+// A Replica can be asked for its Status, paused and resumed, and shut down,
+// while it is running.
+//
+// A Replica created using NewWithPayloads agrees on payloads, instead of
+// Values, by attaching the payload to every Propose that it broadcasts. A
+// Replica created using NewAsync proposes and validates Values without
+// blocking.
 type Replica struct {
-	opts Options
+	opts   Options
+	logger *zap.Logger
+
+	whoami      id.Signatory
+	broadcaster process.Broadcaster
 
 	proc         process.Process
+	epoch        Epoch
 	procsAllowed map[id.Signatory]bool
+	scheduler    process.Scheduler
+
+	// rounds are the Rounds in which the Values at recent Heights were
+	// proposed, which are recorded in the Scheduler of every new Epoch when
+	// the Replica has a RoundProvider.
+	rounds map[process.Height]process.Round
+
+	// nextEpoch is the Epoch that will begin once the Process reaches its
+	// Height, nextProcsAllowed is the set of signatories from which messages
+	// will be accepted during that Epoch, and nextScheduler is its Scheduler.
+	// All are nil when there is no pending Epoch.
+	nextEpoch        *Epoch
+	nextProcsAllowed map[id.Signatory]bool
+	nextScheduler    process.Scheduler
+
+	// checkpointed is the last State saved to the write-ahead log.
+	checkpointed process.State
+
+	// certs are the CommitCertificates for recently committed Heights, used to
+	// answer sync requests from other Replicas. pendingCerts are the
+	// CommitCertificates received from other Replicas for Heights that have
+	// not been committed yet.
+	certs               map[process.Height]process.CommitCertificate
+	pendingCerts        map[process.Height]process.CommitCertificate
+	syncRequestedHeight process.Height
+	syncRequestedAt     time.Time
+
+	// The Height, Round, and Step of the Process when it last made progress,
+	// and the time at which it made progress (or last resent its messages).
+	resendHeight process.Height
+	resendRound  process.Round
+	resendStep   process.Step
+	resendAt     time.Time
+
+	// roundRequests are the times at which the round requests of other
+	// Replicas were last answered, for the current Height.
+	roundRequests map[roundRequest]time.Time
+
+	// payloads are the payloads that have been proposed, by their Value. It is
+	// nil unless the Replica agrees on payloads.
+	payloads map[process.Value]payloadEntry
 
-	onTimeoutPropose   <-chan timer.Timeout
-	onTimeoutPrevote   <-chan timer.Timeout
-	onTimeoutPrecommit <-chan timer.Timeout
+	// validator validates Values asynchronously, and is nil unless the
+	// Replica was created using NewAsync. validity is the validity of the
+	// Values that have been validated, and validating are the Proposes that
+	// are waiting for their Value to be validated. The proposeHeight and
+	// proposeRound are the Height and Round for which a Value is being
+	// proposed asynchronously.
+	validator     AsyncValidator
+	validity      map[validationKey]bool
+	validating    map[validationKey][]process.Propose
+	proposeHeight process.Height
+	proposeRound  process.Round
+
+	// committer commits the Values decided by the Process, and pipeline is the
+	// queue of CommitCertificates that it has not committed yet. The pipeline
+	// is nil unless the Replica is pipelined and running.
+	committer committer
+	pipeline  chan process.CommitCertificate
+
+	// observer measures the Process. It is nil unless the Replica has
+	// Metrics.
+	observer *metricsObserver
+
+	// timer schedules the timeouts of the Process, and is stopped when the
+	// Replica stops running.
+	timer stoppableTimer
+
+	// done is closed when the Replica stops running, so that asynchronous
+	// work can stop waiting to send its results to the Replica.
+	done <-chan struct{}
+
+	// paused is one while the Replica is paused, and is accessed atomically.
+	// The Replica is woken up by onPauseChanged whenever it changes.
+	paused          int32
+	onPauseChanged  chan struct{}
+	onStatusRequest chan chan<- Status
+	onShutdown      chan chan<- shutdownResult
+
+	onTimeoutPropose   chan timer.Timeout
+	onTimeoutPrevote   chan timer.Timeout
+	onTimeoutPrecommit chan timer.Timeout
 
 	onPropose   chan process.Propose
 	onPrevote   chan process.Prevote
 	onPrecommit chan process.Precommit
 	mq          mq.MessageQueue
 
+	onSyncRequest       chan syncRequest
+	onCommitCertificate chan process.CommitCertificate
+	onRoundRequest      chan roundRequest
+
+	onProposeResult  chan proposeResult
+	onValidateResult chan validateResult
+
 	didHandleMessage DidHandleMessage
 }
 
-// New instantiates and returns a pointer to a new Hyperdrive replica machine
+// New instantiates and returns a pointer to a new Hyperdrive replica machine.
+// The options must contain the private key of the given identity, because it
+// is used to sign all messages broadcast by the replica. The given signatories
+// are responsible for consensus until the EpochProvider in the options (if
+// any) returns a new Epoch.
 func New(
 	opts Options,
 	whoami id.Signatory,
@@ -47,97 +184,314 @@ func New(
 	broadcast process.Broadcaster,
 	didHandleMessage DidHandleMessage,
 ) *Replica {
-	f := len(signatories) / 3
-	onTimeoutPropose := make(chan timer.Timeout, 10)
-	onTimeoutPrevote := make(chan timer.Timeout, 10)
-	onTimeoutPrecommit := make(chan timer.Timeout, 10)
-	timer := timer.NewLinearTimer(opts.TimerOpts, onTimeoutPropose, onTimeoutPrevote, onTimeoutPrecommit)
-	scheduler := scheduler.NewRoundRobin(signatories)
-	proc := process.New(
-		whoami,
-		f,
-		timer,
-		scheduler,
-		propose,
-		validate,
-		broadcast,
-		commit,
-		catch,
-	)
+	replica := newReplica(opts, whoami, signatories, broadcast, didHandleMessage)
+	replica.init(propose, validate, commit, catch)
+	return replica
+}
+
+// newReplica returns a Replica without a Process. The Process must be created
+// by calling init.
+func newReplica(
+	opts Options,
+	whoami id.Signatory,
+	signatories []id.Signatory,
+	broadcast process.Broadcaster,
+	didHandleMessage DidHandleMessage,
+) *Replica {
+	if opts.PrivKey == nil {
+		panic("private key not set")
+	}
+	if signatory := opts.PrivKey.Signatory(); !signatory.Equal(&whoami) {
+		panic(fmt.Errorf("private key does not match identity: expected %v, got %v", whoami, signatory))
+	}
+	if opts.PipelineDepth > 0 && opts.WAL != nil {
+		// The State would be checkpointed at the next Height while the Value
+		// of the previous Height is still queued, so a crash would lose it.
+		panic("pipeline depth must be zero when there is a write-ahead log")
+	}
 
-	procsAllowed := make(map[id.Signatory]bool)
-	for _, signatory := range signatories {
-		procsAllowed[signatory] = true
+	if opts.Metrics != nil && opts.MessageQueueOpts.Metrics == nil {
+		opts.MessageQueueOpts = opts.MessageQueueOpts.WithMetrics(opts.Metrics.MessageQueue)
 	}
 
+	logger := opts.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	logger = logger.With(zap.Stringer("whoami", whoami))
+	if opts.ProcessOpts.Logger == nil {
+		opts.ProcessOpts = opts.ProcessOpts.WithLogger(logger)
+	}
+
+	epoch := Epoch{
+		Height:      1,
+		Signatories: signatories,
+		VotingPower: opts.ProcessOpts.VotingPower,
+	}
 	return &Replica{
-		opts: opts,
+		opts:   opts,
+		logger: logger,
 
-		proc:         proc,
-		procsAllowed: procsAllowed,
+		whoami:      whoami,
+		broadcaster: broadcast,
 
-		onTimeoutPropose:   onTimeoutPropose,
-		onTimeoutPrevote:   onTimeoutPrevote,
-		onTimeoutPrecommit: onTimeoutPrecommit,
+		epoch:        epoch,
+		procsAllowed: epoch.procsAllowed(),
+		rounds:       make(map[process.Height]process.Round),
+
+		certs:        make(map[process.Height]process.CommitCertificate),
+		pendingCerts: make(map[process.Height]process.CommitCertificate),
+
+		roundRequests: make(map[roundRequest]time.Time),
+
+		onTimeoutPropose:   make(chan timer.Timeout, 10),
+		onTimeoutPrevote:   make(chan timer.Timeout, 10),
+		onTimeoutPrecommit: make(chan timer.Timeout, 10),
 
 		onPropose:   make(chan process.Propose, opts.MessageQueueOpts.MaxCapacity),
 		onPrevote:   make(chan process.Prevote, opts.MessageQueueOpts.MaxCapacity),
 		onPrecommit: make(chan process.Precommit, opts.MessageQueueOpts.MaxCapacity),
 		mq:          mq.New(opts.MessageQueueOpts),
 
+		onSyncRequest:       make(chan syncRequest, opts.MessageQueueOpts.MaxCapacity),
+		onCommitCertificate: make(chan process.CommitCertificate, opts.MessageQueueOpts.MaxCapacity),
+		onRoundRequest:      make(chan roundRequest, opts.MessageQueueOpts.MaxCapacity),
+
+		onPauseChanged:  make(chan struct{}, 1),
+		onStatusRequest: make(chan chan<- Status),
+		onShutdown:      make(chan chan<- shutdownResult),
+
+		proposeRound:     process.InvalidRound,
+		onProposeResult:  make(chan proposeResult, 1),
+		onValidateResult: make(chan validateResult, opts.MessageQueueOpts.MaxCapacity),
+
 		didHandleMessage: didHandleMessage,
 	}
 }
 
-// Run starts the Hyperdrive replica's process
+// init creates the Process of the Replica.
+func (replica *Replica) init(
+	propose process.Proposer,
+	validate process.Validator,
+	commit process.Committer,
+	catch process.Catcher,
+) {
+	// The messages broadcast by the Process are signed, and appended to the
+	// write-ahead log, before being broadcast. Messages that are resent have
+	// already been signed and appended, so they are broadcast directly.
+	broadcast := replica.broadcaster
+	if broadcast != nil {
+		if replica.opts.WAL != nil {
+			broadcast = newWALWriter(replica.opts.WAL, broadcast)
+		}
+		broadcast = newSigner(replica.opts.PrivKey, broadcast)
+		if replica.payloads != nil {
+			broadcast = payloadAttacher{replica: replica, broadcaster: broadcast}
+		}
+	}
+
+	// An adaptive timer observes the state transitions of the Process to learn
+	// how long each Step takes. The Process is measured by observing its state
+	// transitions, and its misbehaviour is logged and measured, before they are
+	// passed on.
+	processOpts := replica.opts.ProcessOpts
+	if replica.opts.AdaptiveTimer {
+		adaptiveTimer := timer.NewAdaptiveTimer(replica.opts.TimerOpts, replica.onTimeoutPropose, replica.onTimeoutPrevote, replica.onTimeoutPrecommit)
+		replica.timer = adaptiveTimer
+		processOpts = withObserver(processOpts, adaptiveTimer)
+	} else {
+		replica.timer = timer.NewLinearTimer(replica.opts.TimerOpts, replica.onTimeoutPropose, replica.onTimeoutPrevote, replica.onTimeoutPrecommit)
+	}
+	if replica.opts.WAL != nil {
+		processOpts = withObserver(processOpts, walCheckpointer{replica: replica})
+	}
+	if replica.opts.Metrics != nil {
+		replica.observer = &metricsObserver{metrics: replica.opts.Metrics, observer: processOpts.Observer}
+		processOpts = processOpts.WithObserver(replica.observer)
+	}
+	catch = catcher{logger: replica.logger, metrics: replica.opts.Metrics, catcher: catch}
+
+	replica.committer = committer{replica: replica, committer: commit}
+	replica.scheduler = replica.newScheduler(replica.epoch)
+	replica.proc = process.New(
+		processOpts,
+		replica.whoami,
+		replica.epoch.f(),
+		replica.timer,
+		replica.scheduler,
+		propose,
+		validate,
+		broadcast,
+		replica.committer,
+		catch,
+	)
+}
+
+// Run starts the Hyperdrive replica's process. If the replica has a
+// write-ahead log that contains a saved State, then the process is resumed
+// from the log instead. It returns when the context is done, or when the
+// replica is shut down, after which the replica must not be run again.
 func (replica *Replica) Run(ctx context.Context) {
-	replica.proc.Start()
+	// Stop all asynchronous work, and all timeouts, once the Replica stops
+	// running. If it was shut down, then this is done before its final State
+	// is returned.
+	done := make(chan struct{})
+	replica.done = done
+	var shutdown chan<- shutdownResult
+	defer func() {
+		close(done)
+		replica.timer.Stop()
+		if shutdown != nil {
+			shutdown <- replica.finalState()
+		}
+	}()
+
+	// Commit decided Values in the background, and wait for all of them to be
+	// committed before returning.
+	if replica.opts.PipelineDepth > 0 {
+		replica.pipeline = make(chan process.CommitCertificate, replica.opts.PipelineDepth)
+		pipelineDone := make(chan struct{})
+		go replica.committer.runPipeline(replica.pipeline, pipelineDone)
+		defer func() {
+			close(replica.pipeline)
+			replica.pipeline = nil
+			<-pipelineDone
+		}()
+	}
+
+	replica.start()
+
+	// Check for a stalled Process at every resend interval. Without a resend
+	// interval, the channel is nil and is never selected.
+	var onResend <-chan time.Time
+	if replica.opts.ResendInterval > 0 {
+		ticker := time.NewTicker(replica.opts.ResendInterval)
+		defer ticker.Stop()
+		onResend = ticker.C
+	}
 
 	isRunning := true
 	for isRunning {
 		func() {
 			defer func() {
+				replica.checkpoint()
 				if replica.didHandleMessage != nil {
 					replica.didHandleMessage()
 				}
 			}()
 
+			// While paused, the Replica only waits to be resumed, asked for
+			// its Status, or shut down.
+			if replica.isPaused() {
+				select {
+				case <-ctx.Done():
+					isRunning = false
+				case <-replica.onPauseChanged:
+				case status := <-replica.onStatusRequest:
+					status <- replica.status()
+				case result := <-replica.onShutdown:
+					shutdown = result
+					isRunning = false
+				}
+				return
+			}
+
 			select {
 			case <-ctx.Done():
 				isRunning = false
 				return
 
+			case <-replica.onPauseChanged:
+				return
+			case status := <-replica.onStatusRequest:
+				status <- replica.status()
+				return
+			case result := <-replica.onShutdown:
+				shutdown = result
+				isRunning = false
+				return
+
 			case timeout := <-replica.onTimeoutPropose:
+				replica.timedOut(process.Proposing, timeout.Height, timeout.Round)
 				replica.proc.OnTimeoutPropose(timeout.Height, timeout.Round)
 			case timeout := <-replica.onTimeoutPrevote:
+				replica.timedOut(process.Prevoting, timeout.Height, timeout.Round)
 				replica.proc.OnTimeoutPrevote(timeout.Height, timeout.Round)
 			case timeout := <-replica.onTimeoutPrecommit:
+				replica.timedOut(process.Precommitting, timeout.Height, timeout.Round)
 				replica.proc.OnTimeoutPrecommit(timeout.Height, timeout.Round)
 
 			case propose := <-replica.onPropose:
 				if !replica.filterHeight(propose.Height) {
+					replica.dropped("propose", propose.Height, propose.Round, propose.From, "height")
+					return
+				}
+				if !replica.filterFrom(propose.Height, propose.From) {
+					replica.dropped("propose", propose.Height, propose.Round, propose.From, "from")
+					return
+				}
+				if err := propose.Verify(); err != nil {
+					replica.dropped("propose", propose.Height, propose.Round, propose.From, "signature", zap.Error(err))
+					return
+				}
+				if !replica.filterPayload(propose) {
+					replica.dropped("propose", propose.Height, propose.Round, propose.From, "payload")
 					return
 				}
-				if !replica.filterFrom(propose.From) {
+				// The payload is kept by the Replica, so the Process (and its
+				// State) only needs to know the Value.
+				if replica.payloads != nil {
+					propose.Payload = nil
+				}
+				replica.trySync(propose.Height)
+				if !replica.filterValidity(propose) {
 					return
 				}
 				replica.mq.InsertPropose(propose)
 			case prevote := <-replica.onPrevote:
-				if !replica.filterHeight(prevote.Height) {
+				if !replica.filterVoteHeight(prevote.Height) {
+					replica.dropped("prevote", prevote.Height, prevote.Round, prevote.From, "height")
 					return
 				}
-				if !replica.filterFrom(prevote.From) {
+				if !replica.filterFrom(prevote.Height, prevote.From) {
+					replica.dropped("prevote", prevote.Height, prevote.Round, prevote.From, "from")
 					return
 				}
+				if err := prevote.Verify(); err != nil {
+					replica.dropped("prevote", prevote.Height, prevote.Round, prevote.From, "signature", zap.Error(err))
+					return
+				}
+				replica.trySync(prevote.Height)
 				replica.mq.InsertPrevote(prevote)
 			case precommit := <-replica.onPrecommit:
-				if !replica.filterHeight(precommit.Height) {
+				if !replica.filterVoteHeight(precommit.Height) {
+					replica.dropped("precommit", precommit.Height, precommit.Round, precommit.From, "height")
+					return
+				}
+				if !replica.filterFrom(precommit.Height, precommit.From) {
+					replica.dropped("precommit", precommit.Height, precommit.Round, precommit.From, "from")
 					return
 				}
-				if !replica.filterFrom(precommit.From) {
+				if err := precommit.Verify(); err != nil {
+					replica.dropped("precommit", precommit.Height, precommit.Round, precommit.From, "signature", zap.Error(err))
 					return
 				}
+				replica.trySync(precommit.Height)
 				replica.mq.InsertPrecommit(precommit)
+
+			case req := <-replica.onSyncRequest:
+				replica.handleSyncRequest(req)
+			case cert := <-replica.onCommitCertificate:
+				replica.handleCommitCertificate(cert)
+			case req := <-replica.onRoundRequest:
+				replica.handleRoundRequest(req, time.Now())
+			case now := <-onResend:
+				replica.tryResend(now)
+
+			case result := <-replica.onProposeResult:
+				replica.handleProposeResult(result)
+			case result := <-replica.onValidateResult:
+				replica.handleValidateResult(result)
 			}
 
 			replica.flush()
@@ -175,16 +529,152 @@ func (replica *Replica) Precommit(ctx context.Context, precommit process.Precomm
 	}
 }
 
+// start the process, or resume it from the write-ahead log.
+func (replica *Replica) start() {
+	if replica.opts.WAL == nil {
+		replica.proc.Start()
+		return
+	}
+
+	record, ok, err := replica.opts.WAL.Load()
+	if err != nil {
+		panic(fmt.Errorf("loading wal: %v", err))
+	}
+	if !ok {
+		// Save the default State before starting, so that messages broadcast
+		// while starting are never appended to the log without a State.
+		replica.checkpoint()
+		replica.proc.Start()
+		replica.checkpoint()
+		return
+	}
+	replica.proc.State = record.State
+	replica.checkpointed = record.State
+	if replica.payloads != nil {
+		for _, propose := range record.Proposes {
+			replica.payloads[propose.Value] = payloadEntry{height: propose.Height, round: propose.Round, from: propose.From, payload: propose.Payload}
+		}
+		for _, payload := range record.Payloads {
+			replica.payloads[NewPayloadValue(payload.Data)] = payloadEntry{height: payload.Height, round: process.InvalidRound, payload: payload.Data}
+		}
+	}
+	replica.restoreRounds()
+	replica.proc.Resume(record.Proposes, record.Prevotes, record.Precommits)
+	replica.checkpoint()
+}
+
+// checkpoint saves the State of the process to the write-ahead log, if it has
+// changed since it was last saved.
+func (replica *Replica) checkpoint() {
+	if replica.opts.WAL == nil {
+		return
+	}
+	if replica.proc.State.Equal(&replica.checkpointed) {
+		return
+	}
+	if err := replica.opts.WAL.Checkpoint(replica.proc.State); err != nil {
+		panic(fmt.Errorf("checkpointing wal: %v", err))
+	}
+	replica.checkpointed = replica.proc.State
+}
+
 func (replica *Replica) filterHeight(height process.Height) bool {
 	return height >= replica.proc.CurrentHeight
 }
 
-func (replica *Replica) filterFrom(from id.Signatory) bool {
+// filterVoteHeight is like filterHeight, but also accepts votes from the
+// recent Heights for which the process keeps a history, so that the process
+// can catch misbehaviour in them.
+func (replica *Replica) filterVoteHeight(height process.Height) bool {
+	return replica.filterHeight(height) || height > replica.proc.CurrentHeight-process.Height(replica.opts.ProcessOpts.HistoryHeights)
+}
+
+func (replica *Replica) filterFrom(height process.Height, from id.Signatory) bool {
+	if replica.nextEpoch != nil && height >= replica.nextEpoch.Height {
+		return replica.nextProcsAllowed[from]
+	}
 	return replica.procsAllowed[from]
 }
 
+// proposer returns the signatory that is scheduled to propose in the Round of
+// the Height, using the Scheduler of the Epoch at that Height.
+func (replica *Replica) proposer(height process.Height, round process.Round) id.Signatory {
+	if replica.nextEpoch != nil && height >= replica.nextEpoch.Height {
+		return replica.nextScheduler.Schedule(height, round)
+	}
+	return replica.scheduler.Schedule(height, round)
+}
+
+// didCommit is called whenever the process commits a Value. It remembers the
+// CommitCertificate, so that it can be sent to other Replicas, and asks the
+// EpochProvider (if any) for the next Epoch.
+func (replica *Replica) didCommit(cert process.CommitCertificate) {
+	replica.logger.Info("committed",
+		zap.Int64("height", int64(cert.Height)),
+		zap.Int64("round", int64(cert.Round)),
+		zap.Stringer("value", cert.Value),
+	)
+	if replica.observer != nil {
+		replica.observer.didCommit(cert)
+	}
+	if replica.opts.RoundProvider != nil {
+		replica.recordRound(cert.Height, replica.opts.RoundProvider.ProposedRound(cert.Height, cert.Value))
+	}
+	if replica.payloads != nil {
+		replica.forgetPayloads(cert.Height)
+	}
+	if replica.validator != nil {
+		replica.forgetValidity(cert.Height)
+	}
+	if replica.opts.Syncer != nil && replica.opts.SyncHistory > 0 {
+		replica.certs[cert.Height] = cert
+		delete(replica.certs, cert.Height-process.Height(replica.opts.SyncHistory))
+	}
+	if replica.opts.EpochProvider != nil {
+		if epoch, ok := replica.opts.EpochProvider.NextEpoch(cert.Height, cert.Value); ok {
+			replica.scheduleEpoch(epoch)
+		}
+	}
+}
+
+// scheduleEpoch reconfigures the Process so that the Epoch begins at its
+// Height, and starts accepting messages for that Height (and above) from the
+// signatories of the Epoch. It is called while the Process is committing a
+// Value, before the Process moves to the next Height.
+func (replica *Replica) scheduleEpoch(epoch Epoch) {
+	if epoch.Height <= replica.proc.CurrentHeight {
+		panic(fmt.Errorf("invalid epoch height: expected height>%v, got height=%v", replica.proc.CurrentHeight, epoch.Height))
+	}
+	scheduler := replica.newScheduler(epoch)
+	replica.proc.Reconfigure(epoch.Height, epoch.f(), epoch.VotingPower, scheduler)
+	replica.nextEpoch = &epoch
+	replica.nextProcsAllowed = epoch.procsAllowed()
+	replica.nextScheduler = scheduler
+}
+
+// tryEnterEpoch makes the pending Epoch the current Epoch, if the Process has
+// reached its Height. All messages from signatories that are not part of the
+// new Epoch are dropped from the MessageQueue.
+func (replica *Replica) tryEnterEpoch() {
+	if replica.nextEpoch == nil || replica.proc.CurrentHeight < replica.nextEpoch.Height {
+		return
+	}
+	for from := range replica.procsAllowed {
+		if !replica.nextProcsAllowed[from] {
+			replica.mq.DropMessagesFrom(from)
+		}
+	}
+	replica.epoch = *replica.nextEpoch
+	replica.procsAllowed = replica.nextProcsAllowed
+	replica.scheduler = replica.nextScheduler
+	replica.nextEpoch = nil
+	replica.nextProcsAllowed = nil
+	replica.nextScheduler = nil
+}
+
 func (replica *Replica) flush() {
 	for {
+		replica.tryEnterEpoch()
 		n := replica.mq.Consume(
 			replica.proc.CurrentHeight,
 			replica.proc.Propose,
@@ -3,14 +3,28 @@ package replica_test
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/renproject/hyperdrive/metrics"
 	"github.com/renproject/hyperdrive/process"
 	"github.com/renproject/hyperdrive/process/processutil"
 	"github.com/renproject/hyperdrive/replica"
+	"github.com/renproject/hyperdrive/scheduler"
 	"github.com/renproject/hyperdrive/timer"
+	"github.com/renproject/hyperdrive/wal"
 	"github.com/renproject/id"
+	"github.com/renproject/surge"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -75,7 +89,7 @@ var _ = Describe("Replica", func() {
 				replicaIndex := i
 
 				replicas[i] = replica.New(
-					replica.DefaultOptions(),
+					replica.DefaultOptions().WithPrivKey(privKeys[i]),
 					signatories[i],
 					signatories,
 					// Proposer
@@ -251,7 +265,7 @@ var _ = Describe("Replica", func() {
 				replicaIndex := i
 
 				replicas[i] = replica.New(
-					replica.DefaultOptions(),
+					replica.DefaultOptions().WithPrivKey(privKeys[i]),
 					signatories[i],
 					signatories,
 					// Proposer
@@ -381,7 +395,7 @@ var _ = Describe("Replica", func() {
 	})
 
 	Context("with 3f+1 replicas online, f replicas slowly go offline", func() {
-		It("should be able to reach consensus", func() {
+		reachConsensus := func(pipelineDepth int) {
 			// randomness seed
 			rSeed := time.Now().UnixNano()
 			r := rand.New(rand.NewSource(rSeed))
@@ -395,6 +409,7 @@ var _ = Describe("Replica", func() {
 
 			// commits from replicas
 			commits := make(map[int]map[process.Height]process.Value)
+			commitsMu := new(sync.Mutex)
 
 			// setup private keys for the replicas
 			// and their signatories
@@ -434,6 +449,8 @@ var _ = Describe("Replica", func() {
 
 				replicas[i] = replica.New(
 					replica.DefaultOptions().
+						WithPrivKey(privKeys[i]).
+						WithPipelineDepth(pipelineDepth).
 						WithTimerOptions(
 							timer.DefaultOptions().
 								WithTimeout(1*time.Second),
@@ -457,7 +474,9 @@ var _ = Describe("Replica", func() {
 					processutil.CommitterCallback{
 						Callback: func(height process.Height, value process.Value) {
 							// add commit to the commits map
+							commitsMu.Lock()
 							commits[replicaIndex][height] = value
+							commitsMu.Unlock()
 
 							// signal for completion if this is the target height
 							if height == targetHeight {
@@ -551,6 +570,8 @@ var _ = Describe("Replica", func() {
 				}
 
 				// ensure that all replicas have the same commits
+				commitsMu.Lock()
+				defer commitsMu.Unlock()
 				for i := 0; i < n; i++ {
 					if _, ok := killedReplicas[i]; !ok {
 						// from the first replica that's alive
@@ -623,12 +644,20 @@ var _ = Describe("Replica", func() {
 					}
 				}
 			}
+		}
+
+		It("should be able to reach consensus", func() {
+			reachConsensus(0)
+		})
+
+		It("should be able to reach consensus when pipelined", func() {
+			reachConsensus(1 + rand.Intn(3))
 		})
 	})
 
 	Context("with 3f+1 replicas online, f replicas behaving maliciously", func() {
 		Context("f replicas broadcasting malformed proposals", func() {
-			It("should be able to reach consensus", func() {
+			reachConsensus := func(pipelineDepth int) {
 				// randomness seed
 				rSeed := time.Now().UnixNano()
 				r := rand.New(rand.NewSource(rSeed))
@@ -642,6 +671,7 @@ var _ = Describe("Replica", func() {
 
 				// commits from replicas
 				commits := make(map[int]map[process.Height]process.Value)
+				commitsMu := new(sync.Mutex)
 
 				// setup private keys for the replicas
 				// and their signatories
@@ -670,6 +700,8 @@ var _ = Describe("Replica", func() {
 
 					replicas[i] = replica.New(
 						replica.DefaultOptions().
+							WithPrivKey(privKeys[i]).
+							WithPipelineDepth(pipelineDepth).
 							WithTimerOptions(
 								timer.DefaultOptions().
 									WithTimeout(1*time.Second),
@@ -703,7 +735,9 @@ var _ = Describe("Replica", func() {
 						processutil.CommitterCallback{
 							Callback: func(height process.Height, value process.Value) {
 								// add commit to the commits map
+								commitsMu.Lock()
 								commits[replicaIndex][height] = value
+								commitsMu.Unlock()
 
 								// signal for completion if this is the target height
 								if height == targetHeight {
@@ -781,6 +815,8 @@ var _ = Describe("Replica", func() {
 					}
 
 					// ensure that all replicas have the same commits
+					commitsMu.Lock()
+					defer commitsMu.Unlock()
 					referenceCommits := commits[0]
 					for j := 1; j < n; j++ {
 						for h := process.Height(1); h <= targetHeight; {
@@ -839,11 +875,19 @@ var _ = Describe("Replica", func() {
 						}
 					}
 				}
+			}
+
+			It("should be able to reach consensus", func() {
+				reachConsensus(0)
+			})
+
+			It("should be able to reach consensus when pipelined", func() {
+				reachConsensus(1 + rand.Intn(3))
 			})
 		})
 
 		Context("f replicas running misbehaving proposers and validators", func() {
-			It("should be able to reach consensus", func() {
+			reachConsensus := func(pipelineDepth int) {
 				// randomness seed
 				rSeed := time.Now().UnixNano()
 				r := rand.New(rand.NewSource(rSeed))
@@ -857,6 +901,7 @@ var _ = Describe("Replica", func() {
 
 				// commits from replicas
 				commits := make(map[int]map[process.Height]process.Value)
+				commitsMu := new(sync.Mutex)
 
 				// setup private keys for the replicas
 				// and their signatories
@@ -885,6 +930,8 @@ var _ = Describe("Replica", func() {
 
 					replicas[i] = replica.New(
 						replica.DefaultOptions().
+							WithPrivKey(privKeys[i]).
+							WithPipelineDepth(pipelineDepth).
 							WithTimerOptions(
 								timer.DefaultOptions().
 									WithTimeout(1*time.Second),
@@ -925,7 +972,9 @@ var _ = Describe("Replica", func() {
 						processutil.CommitterCallback{
 							Callback: func(height process.Height, value process.Value) {
 								// add commit to the commits map
+								commitsMu.Lock()
 								commits[replicaIndex][height] = value
+								commitsMu.Unlock()
 
 								// signal for completion if this is the target height
 								if height == targetHeight {
@@ -1003,6 +1052,8 @@ var _ = Describe("Replica", func() {
 					}
 
 					// ensure that all replicas have the same commits
+					commitsMu.Lock()
+					defer commitsMu.Unlock()
 					referenceCommits := commits[f]
 					for j := f + 1; j < n; j++ {
 						for h := process.Height(1); h <= targetHeight; {
@@ -1061,12 +1112,20 @@ var _ = Describe("Replica", func() {
 						}
 					}
 				}
+			}
+
+			It("should be able to reach consensus", func() {
+				reachConsensus(0)
+			})
+
+			It("should be able to reach consensus when pipelined", func() {
+				reachConsensus(1 + rand.Intn(3))
 			})
 		})
 	})
 
 	Context("with less than 2f+1 replicas online", func() {
-		It("should stall consensus and should not progress", func() {
+		stallConsensus := func(pipelineDepth int) {
 			// randomness seed
 			rSeed := time.Now().UnixNano()
 			r := rand.New(rand.NewSource(rSeed))
@@ -1096,7 +1155,9 @@ var _ = Describe("Replica", func() {
 			replicas := make([]*replica.Replica, n)
 			for i := range replicas {
 				replicas[i] = replica.New(
-					replica.DefaultOptions(),
+					replica.DefaultOptions().
+						WithPrivKey(privKeys[i]).
+						WithPipelineDepth(pipelineDepth),
 					signatories[i],
 					signatories,
 					// Proposer
@@ -1212,11 +1273,19 @@ var _ = Describe("Replica", func() {
 					}
 				}
 			}
+		}
+
+		It("should stall consensus and should not progress", func() {
+			stallConsensus(0)
+		})
+
+		It("should stall consensus and should not progress when pipelined", func() {
+			stallConsensus(1 + rand.Intn(3))
 		})
 	})
 
 	Context("with 2f+1 replicas online, and one of them goes offline", func() {
-		It("should stall consensus as soon as there are less than 2f+1 online", func() {
+		stallConsensus := func(pipelineDepth int) {
 			// randomness seed
 			rSeed := time.Now().UnixNano()
 			r := rand.New(rand.NewSource(rSeed))
@@ -1227,6 +1296,14 @@ var _ = Describe("Replica", func() {
 			n := 2*f + 1
 			intermTargetHeight := process.Height(6)
 
+			// when pipelined, the replicas can decide the values of the
+			// heights in the pipeline before the value at the intermediate
+			// target height is committed, and they stall after that
+			maxHeight := intermTargetHeight
+			if pipelineDepth > 0 {
+				maxHeight += process.Height(pipelineDepth + 1)
+			}
+
 			// setup private keys for the replicas
 			// and their signatories
 			privKeys := make([]*id.PrivKey, 3*f+1)
@@ -1250,6 +1327,8 @@ var _ = Describe("Replica", func() {
 			for i := range replicas {
 				replicas[i] = replica.New(
 					replica.DefaultOptions().
+						WithPrivKey(privKeys[i]).
+						WithPipelineDepth(pipelineDepth).
 						WithTimerOptions(
 							timer.DefaultOptions().
 								WithTimeout(1*time.Second),
@@ -1274,7 +1353,7 @@ var _ = Describe("Replica", func() {
 						Callback: func(height process.Height, value process.Value) {
 							// if consensus progresses and any commit above the intermediate
 							// target height is found, it is unexpected behaviour
-							if height > intermTargetHeight {
+							if height > maxHeight {
 								panic("consensus should have stalled")
 							}
 
@@ -1394,6 +1473,2898 @@ var _ = Describe("Replica", func() {
 					}
 				}
 			}
+		}
+
+		It("should stall consensus as soon as there are less than 2f+1 online", func() {
+			stallConsensus(0)
+		})
+
+		It("should stall consensus as soon as there are less than 2f+1 online when pipelined", func() {
+			stallConsensus(1 + rand.Intn(3))
 		})
 	})
-})
+
+	Context("with messages that are not signed by their sender", func() {
+		dropMessages := func(pipelineDepth int) {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every commit is sent to this channel
+			commits := make(chan process.Value, 1)
+
+			replica := replica.New(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithPipelineDepth(pipelineDepth),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				processutil.MockValidator{
+					MockValid: func(process.Value) bool {
+						return true
+					},
+				},
+				// Committer
+				processutil.CommitterCallback{
+					Callback: func(height process.Height, value process.Value) {
+						commits <- value
+					},
+				},
+				// Catcher
+				nil,
+				// Broadcaster
+				nil,
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			// the scheduled proposer for height 1 and round 0 proposes a value,
+			// and then 2f+1 replicas precommit to it
+			value := processutil.RandomGoodValue(r)
+			sendMessages := func(signWith func(int) *id.PrivKey) {
+				propose := process.Propose{
+					Height:     1,
+					Round:      0,
+					ValidRound: process.InvalidRound,
+					Value:      value,
+					From:       signatories[1],
+				}
+				Expect(propose.Sign(signWith(1))).To(Succeed())
+				replica.Propose(ctx, propose)
+				for i := 1; i < 4; i++ {
+					precommit := process.Precommit{
+						Height: 1,
+						Round:  0,
+						Value:  value,
+						From:   signatories[i],
+					}
+					Expect(precommit.Sign(signWith(i))).To(Succeed())
+					replica.Precommit(ctx, precommit)
+				}
+			}
+
+			// messages signed by the wrong private keys must be dropped
+			sendMessages(func(int) *id.PrivKey { return id.NewPrivKey() })
+			select {
+			case <-commits:
+				Fail("committed a value from messages with bad signatures")
+			case <-time.After(time.Second):
+			}
+
+			// messages signed by the correct private keys must be accepted
+			sendMessages(func(i int) *id.PrivKey { return privKeys[i] })
+			select {
+			case committed := <-commits:
+				Expect(committed).To(Equal(value))
+			case <-time.After(5 * time.Second):
+				Fail("failed to commit a value from messages with good signatures")
+			}
+		}
+
+		It("should drop the messages and not commit", func() {
+			dropMessages(0)
+		})
+
+		It("should drop the messages and not commit when pipelined", func() {
+			dropMessages(1 + rand.Intn(3))
+		})
+	})
+	Context("with a history of votes", func() {
+		It("should catch double votes at heights that have been committed", func() {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every commit, and every double precommit, is sent to a channel
+			commits := make(chan process.Value, 1)
+			doublePrecommits := make(chan process.Precommit, 1)
+
+			replica := replica.New(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithHistoryHeights(2),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				processutil.MockValidator{
+					MockValid: func(process.Value) bool {
+						return true
+					},
+				},
+				// Committer
+				processutil.CommitterCallback{
+					Callback: func(height process.Height, value process.Value) {
+						commits <- value
+					},
+				},
+				// Catcher
+				processutil.CatcherCallbacks{
+					CatchDoublePrecommitCallback: func(precommit, conflicting process.Precommit) {
+						doublePrecommits <- precommit
+					},
+				},
+				// Broadcaster
+				nil,
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			// the scheduled proposer for height 1 and round 0 proposes a value,
+			// and then 2f+1 replicas precommit to it
+			value := processutil.RandomGoodValue(r)
+			propose := process.Propose{
+				Height:     1,
+				Round:      0,
+				ValidRound: process.InvalidRound,
+				Value:      value,
+				From:       signatories[1],
+			}
+			Expect(propose.Sign(privKeys[1])).To(Succeed())
+			replica.Propose(ctx, propose)
+			for i := 1; i < 4; i++ {
+				precommit := process.Precommit{
+					Height: 1,
+					Round:  0,
+					Value:  value,
+					From:   signatories[i],
+				}
+				Expect(precommit.Sign(privKeys[i])).To(Succeed())
+				replica.Precommit(ctx, precommit)
+			}
+			select {
+			case committed := <-commits:
+				Expect(committed).To(Equal(value))
+			case <-time.After(5 * time.Second):
+				Fail("failed to commit")
+			}
+
+			// a precommit for a different value at the committed height must
+			// be caught
+			conflicting := process.Precommit{
+				Height: 1,
+				Round:  0,
+				Value:  processutil.RandomGoodValue(r),
+				From:   signatories[2],
+			}
+			Expect(conflicting.Sign(privKeys[2])).To(Succeed())
+			replica.Precommit(ctx, conflicting)
+			select {
+			case precommit := <-doublePrecommits:
+				Expect(precommit.From).To(Equal(signatories[2]))
+				Expect(precommit.Value).To(Equal(conflicting.Value))
+			case <-time.After(5 * time.Second):
+				Fail("failed to catch the double precommit")
+			}
+		})
+	})
+
+	Context("with metrics", func() {
+		It("should export the metrics of the replica in the prometheus text format", func() {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every commit is sent to this channel
+			commits := make(chan process.Value, 1)
+
+			// the metrics are scraped from a local server
+			reg := metrics.NewRegistry()
+			server := httptest.NewServer(reg)
+			defer server.Close()
+			scrape := func() string {
+				resp, err := http.Get(server.URL)
+				Expect(err).ToNot(HaveOccurred())
+				defer resp.Body.Close()
+				body, err := ioutil.ReadAll(resp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				return string(body)
+			}
+
+			replica := replica.New(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithMetrics(replica.NewMetrics(reg)),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				processutil.MockValidator{
+					MockValid: func(process.Value) bool {
+						return true
+					},
+				},
+				// Committer
+				processutil.CommitterCallback{
+					Callback: func(height process.Height, value process.Value) {
+						commits <- value
+					},
+				},
+				// Catcher
+				nil,
+				// Broadcaster
+				nil,
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			// the scheduled proposer for height 1 and round 0 proposes a value,
+			// and then 2f+1 replicas precommit to it
+			value := processutil.RandomGoodValue(r)
+			propose := process.Propose{
+				Height:     1,
+				Round:      0,
+				ValidRound: process.InvalidRound,
+				Value:      value,
+				From:       signatories[1],
+			}
+			Expect(propose.Sign(privKeys[1])).To(Succeed())
+			replica.Propose(ctx, propose)
+			for i := 1; i < 4; i++ {
+				precommit := process.Precommit{
+					Height: 1,
+					Round:  0,
+					Value:  value,
+					From:   signatories[i],
+				}
+				Expect(precommit.Sign(privKeys[i])).To(Succeed())
+				replica.Precommit(ctx, precommit)
+			}
+			select {
+			case committed := <-commits:
+				Expect(committed).To(Equal(value))
+			case <-time.After(5 * time.Second):
+				Fail("failed to commit")
+			}
+
+			// messages from past heights, and from unknown signatories, are
+			// filtered
+			replica.Propose(ctx, propose)
+			unknown := id.NewPrivKey()
+			prevote := process.Prevote{
+				Height: 2,
+				Round:  0,
+				Value:  value,
+				From:   unknown.Signatory(),
+			}
+			Expect(prevote.Sign(unknown)).To(Succeed())
+			replica.Prevote(ctx, prevote)
+
+			// double precommits are caught
+			for i := 0; i < 2; i++ {
+				precommit := process.Precommit{
+					Height: 2,
+					Round:  1,
+					Value:  processutil.RandomGoodValue(r),
+					From:   signatories[1],
+				}
+				Expect(precommit.Sign(privKeys[1])).To(Succeed())
+				replica.Precommit(ctx, precommit)
+			}
+
+			Eventually(scrape).Should(And(
+				ContainSubstring("hyperdrive_height 2\n"),
+				ContainSubstring("hyperdrive_round 0\n"),
+				ContainSubstring("hyperdrive_rounds_per_height_count 1\n"),
+				ContainSubstring("hyperdrive_commit_latency_seconds_count 1\n"),
+				ContainSubstring(`hyperdrive_step_duration_seconds_count{step="propose"} 1`),
+				ContainSubstring(`hyperdrive_messages_filtered_total{reason="height"} 1`),
+				ContainSubstring(`hyperdrive_messages_filtered_total{reason="from"} 1`),
+				ContainSubstring(`hyperdrive_misbehaviour_caught_total{kind="double_precommit"} 1`),
+				ContainSubstring(fmt.Sprintf(`hyperdrive_mq_depth{sender="%v"} 0`, signatories[1])),
+			))
+		})
+	})
+
+	Context("with a logger", func() {
+		It("should log the commits, dropped messages, and caught misbehaviour of the replica", func() {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every commit is sent to this channel
+			commits := make(chan process.Value, 1)
+
+			// all log entries are observed
+			core, logs := observer.New(zap.DebugLevel)
+			entries := func(msg string, level zapcore.Level) []observer.LoggedEntry {
+				filtered := []observer.LoggedEntry{}
+				for _, entry := range logs.FilterMessage(msg).All() {
+					if entry.Level == level {
+						filtered = append(filtered, entry)
+					}
+				}
+				return filtered
+			}
+
+			replica := replica.New(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithLogger(zap.New(core)),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				processutil.MockValidator{
+					MockValid: func(process.Value) bool {
+						return true
+					},
+				},
+				// Committer
+				processutil.CommitterCallback{
+					Callback: func(height process.Height, value process.Value) {
+						commits <- value
+					},
+				},
+				// Catcher
+				nil,
+				// Broadcaster
+				nil,
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			// the scheduled proposer for height 1 and round 0 proposes a value,
+			// and then 2f+1 replicas precommit to it
+			value := processutil.RandomGoodValue(r)
+			propose := process.Propose{
+				Height:     1,
+				Round:      0,
+				ValidRound: process.InvalidRound,
+				Value:      value,
+				From:       signatories[1],
+			}
+			Expect(propose.Sign(privKeys[1])).To(Succeed())
+			replica.Propose(ctx, propose)
+			for i := 1; i < 4; i++ {
+				precommit := process.Precommit{
+					Height: 1,
+					Round:  0,
+					Value:  value,
+					From:   signatories[i],
+				}
+				Expect(precommit.Sign(privKeys[i])).To(Succeed())
+				replica.Precommit(ctx, precommit)
+			}
+			select {
+			case committed := <-commits:
+				Expect(committed).To(Equal(value))
+			case <-time.After(5 * time.Second):
+				Fail("failed to commit")
+			}
+
+			// messages from past heights are dropped
+			replica.Propose(ctx, propose)
+
+			// double precommits are caught
+			for i := 0; i < 2; i++ {
+				precommit := process.Precommit{
+					Height: 2,
+					Round:  1,
+					Value:  processutil.RandomGoodValue(r),
+					From:   signatories[1],
+				}
+				Expect(precommit.Sign(privKeys[1])).To(Succeed())
+				replica.Precommit(ctx, precommit)
+			}
+
+			Eventually(func() int { return len(entries("caught misbehaviour", zap.WarnLevel)) }).Should(Equal(1))
+			cancel()
+
+			committed := entries("committed", zap.InfoLevel)
+			Expect(committed).To(HaveLen(1))
+			Expect(committed[0].ContextMap()).To(And(
+				HaveKeyWithValue("whoami", signatories[0].String()),
+				HaveKeyWithValue("height", int64(1)),
+				HaveKeyWithValue("round", int64(0)),
+				HaveKeyWithValue("value", value.String()),
+			))
+
+			dropped := entries("dropped propose", zap.DebugLevel)
+			Expect(dropped).To(HaveLen(1))
+			Expect(dropped[0].ContextMap()).To(And(
+				HaveKeyWithValue("height", int64(1)),
+				HaveKeyWithValue("from", signatories[1].String()),
+				HaveKeyWithValue("reason", "height"),
+			))
+
+			caught := entries("caught misbehaviour", zap.WarnLevel)
+			Expect(caught[0].ContextMap()).To(And(
+				HaveKeyWithValue("kind", "double_precommit"),
+				HaveKeyWithValue("height", int64(2)),
+				HaveKeyWithValue("round", int64(1)),
+				HaveKeyWithValue("from", signatories[1].String()),
+			))
+
+			// the process logs its transition decisions using the same
+			// logger
+			Expect(entries("committing", zap.DebugLevel)).To(HaveLen(1))
+			Expect(entries("moved to step", zap.DebugLevel)[0].ContextMap()).To(HaveKeyWithValue("whoami", signatories[0].String()))
+		})
+	})
+
+	Context("when pausing, resuming, and shutting down", func() {
+		It("should report its status, only handle messages while not paused, and return its final state", func() {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every commit is sent to this channel
+			commits := make(chan process.Value, 1)
+
+			replica := replica.New(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithLogger(zap.NewNop()),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				processutil.MockValidator{
+					MockValid: func(process.Value) bool {
+						return true
+					},
+				},
+				// Committer
+				processutil.CommitterCallback{
+					Callback: func(height process.Height, value process.Value) {
+						commits <- value
+					},
+				},
+				// Catcher
+				nil,
+				// Broadcaster
+				nil,
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				replica.Run(ctx)
+			}()
+
+			status, err := replica.Status(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status.Height).To(Equal(process.Height(1)))
+			Expect(status.Round).To(Equal(process.Round(0)))
+			Expect(status.Step).To(Equal(process.Proposing))
+			Expect(status.LockedRound).To(Equal(process.InvalidRound))
+			Expect(status.LockedValue).To(Equal(process.NilValue))
+			Expect(status.ValidRound).To(Equal(process.InvalidRound))
+			Expect(status.ValidValue).To(Equal(process.NilValue))
+			Expect(status.Paused).To(BeFalse())
+
+			// once the status shows that the replica is paused, it does not
+			// handle any more messages
+			replica.Pause()
+			status, err = replica.Status(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status.Paused).To(BeTrue())
+
+			// the scheduled proposer for height 1 and round 0 proposes a value,
+			// and then 2f+1 replicas precommit to it
+			value := processutil.RandomGoodValue(r)
+			propose := process.Propose{
+				Height:     1,
+				Round:      0,
+				ValidRound: process.InvalidRound,
+				Value:      value,
+				From:       signatories[1],
+			}
+			Expect(propose.Sign(privKeys[1])).To(Succeed())
+			replica.Propose(ctx, propose)
+			for i := 1; i < 4; i++ {
+				precommit := process.Precommit{
+					Height: 1,
+					Round:  0,
+					Value:  value,
+					From:   signatories[i],
+				}
+				Expect(precommit.Sign(privKeys[i])).To(Succeed())
+				replica.Precommit(ctx, precommit)
+			}
+			Consistently(commits, 100*time.Millisecond).ShouldNot(Receive())
+			status, err = replica.Status(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status.Height).To(Equal(process.Height(1)))
+			Expect(status.Pending).To(Equal(4))
+
+			// once resumed, the replica handles the messages and commits
+			replica.Resume()
+			select {
+			case committed := <-commits:
+				Expect(committed).To(Equal(value))
+			case <-time.After(5 * time.Second):
+				Fail("failed to commit")
+			}
+			status, err = replica.Status(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status.Height).To(Equal(process.Height(2)))
+			Expect(status.Paused).To(BeFalse())
+			Eventually(func() int {
+				status, err := replica.Status(ctx)
+				Expect(err).ToNot(HaveOccurred())
+				return status.Pending
+			}).Should(Equal(0))
+
+			// the final state is returned once the replica has stopped running
+			data, err := replica.Shutdown(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(stopped).Should(BeClosed())
+			state := process.State{}
+			Expect(surge.FromBinary(&state, data)).To(Succeed())
+			Expect(state.CurrentHeight).To(Equal(process.Height(2)))
+			Expect(state.CurrentRound).To(Equal(process.Round(0)))
+
+			// a replica that is not running cannot be asked for its status
+			timeoutCtx, timeoutCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+			defer timeoutCancel()
+			_, err = replica.Status(timeoutCtx)
+			Expect(err).To(Equal(context.DeadlineExceeded))
+		})
+	})
+
+	Context("with a manual clock", func() {
+		It("should only time out once the clock has been advanced by the timeout", func() {
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every prevote is sent to this channel
+			prevotes := make(chan process.Prevote, 1)
+
+			clock := timer.NewManualClock(time.Now())
+			replica := replica.New(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithTimerOptions(timer.DefaultOptions().
+						WithClock(clock).
+						WithTimeout(time.Second).
+						WithTimeoutScaling(0)).
+					WithLogger(zap.NewNop()),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				nil,
+				// Committer
+				nil,
+				// Catcher
+				nil,
+				// Broadcaster
+				processutil.BroadcasterCallbacks{
+					BroadcastPrevoteCallback: func(prevote process.Prevote) {
+						prevotes <- prevote
+					},
+				},
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			// the replica is not the proposer for height 1 and round 0, so it
+			// waits for the propose timeout
+			Eventually(clock.Waiting).Should(Equal(1))
+			clock.Advance(time.Second - 1)
+			Consistently(prevotes).ShouldNot(Receive())
+
+			// once the timeout has passed, the replica prevotes nil
+			clock.Advance(1)
+			var prevote process.Prevote
+			Eventually(prevotes).Should(Receive(&prevote))
+			Expect(prevote.Height).To(Equal(process.Height(1)))
+			Expect(prevote.Round).To(Equal(process.Round(0)))
+			Expect(prevote.Value).To(Equal(process.NilValue))
+		})
+	})
+
+	Context("with an adaptive timer", func() {
+		It("should time out, and still notify the observer in the options", func() {
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every prevote, and every step change, is sent to these channels
+			prevotes := make(chan process.Prevote, 1)
+			steps := make(chan process.Step, 10)
+
+			clock := timer.NewManualClock(time.Now())
+			replica := replica.New(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithTimerOptions(timer.DefaultOptions().
+						WithClock(clock).
+						WithTimeout(2*time.Second).
+						WithMinTimeout(time.Second)).
+					WithAdaptiveTimer(true).
+					WithObserver(processutil.ObserverCallbacks{
+						OnStepChangedCallback: func(height process.Height, round process.Round, step process.Step) {
+							steps <- step
+						},
+					}).
+					WithLogger(zap.NewNop()),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				nil,
+				// Committer
+				nil,
+				// Catcher
+				nil,
+				// Broadcaster
+				processutil.BroadcasterCallbacks{
+					BroadcastPrevoteCallback: func(prevote process.Prevote) {
+						prevotes <- prevote
+					},
+				},
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			// no step durations have been observed, so the replica waits for
+			// the timeout in the options
+			Eventually(steps).Should(Receive(Equal(process.Proposing)))
+			Eventually(clock.Waiting).Should(Equal(1))
+			clock.Advance(2*time.Second - 1)
+			Consistently(prevotes).ShouldNot(Receive())
+
+			// once the timeout has passed, the replica prevotes nil
+			clock.Advance(1)
+			var prevote process.Prevote
+			Eventually(prevotes).Should(Receive(&prevote))
+			Expect(prevote.Value).To(Equal(process.NilValue))
+			Eventually(steps).Should(Receive(Equal(process.Prevoting)))
+		})
+	})
+
+	Context("with voting power", func() {
+		It("should commit once more than 2/3 of the voting power has precommitted", func() {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// the second replica has more voting power than all other replicas
+			// combined, but less than 2/3 of the total voting power
+			votingPower := process.VotingPower{
+				signatories[0]: 1,
+				signatories[1]: 4,
+				signatories[2]: 1,
+				signatories[3]: 1,
+			}
+
+			// every commit is sent to this channel
+			commits := make(chan process.Value, 1)
+
+			replica := replica.New(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithVotingPower(votingPower),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				processutil.MockValidator{
+					MockValid: func(process.Value) bool {
+						return true
+					},
+				},
+				// Committer
+				processutil.CommitterCallback{
+					Callback: func(height process.Height, value process.Value) {
+						commits <- value
+					},
+				},
+				// Catcher
+				nil,
+				// Broadcaster
+				nil,
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			// the proposer scheduled by voting power for height 1 and round 0
+			// proposes a value
+			value := processutil.RandomGoodValue(r)
+			proposer := scheduler.NewWeighted(votingPower).Schedule(1, 0)
+			for i := range signatories {
+				if signatories[i].Equal(&proposer) {
+					propose := process.Propose{
+						Height:     1,
+						Round:      0,
+						ValidRound: process.InvalidRound,
+						Value:      value,
+						From:       signatories[i],
+					}
+					Expect(propose.Sign(privKeys[i])).To(Succeed())
+					replica.Propose(ctx, propose)
+				}
+			}
+			precommit := func(i int) {
+				precommit := process.Precommit{
+					Height: 1,
+					Round:  0,
+					Value:  value,
+					From:   signatories[i],
+				}
+				Expect(precommit.Sign(privKeys[i])).To(Succeed())
+				replica.Precommit(ctx, precommit)
+			}
+
+			// a precommit from the second replica is not enough
+			precommit(1)
+			select {
+			case <-commits:
+				Fail("committed a value with less than 2/3 of the voting power")
+			case <-time.After(time.Second):
+			}
+
+			// a precommit from any other replica is enough, even though
+			// there are less than 2f+1 precommits
+			precommit(2)
+			select {
+			case committed := <-commits:
+				Expect(committed).To(Equal(value))
+			case <-time.After(5 * time.Second):
+				Fail("failed to commit a value with more than 2/3 of the voting power")
+			}
+		})
+	})
+	Context("with an epoch that replaces a signatory", func() {
+		It("should drop messages from the departed signatory and accept messages from the new signatory", func() {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+
+			// setup private keys for the replicas and their signatories, where
+			// the last signatory replaces the fourth signatory at height 2
+			privKeys := make([]*id.PrivKey, 5)
+			signatories := make([]id.Signatory, 5)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+			oldSignatories := []id.Signatory{signatories[0], signatories[1], signatories[2], signatories[3]}
+			newSignatories := []id.Signatory{signatories[0], signatories[1], signatories[2], signatories[4]}
+
+			// every commit is sent to this channel
+			commits := make(chan process.Value, 1)
+
+			replica := replica.New(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithEpochProvider(mockEpochProvider(func(height process.Height, value process.Value) (replica.Epoch, bool) {
+						if height != 1 {
+							return replica.Epoch{}, false
+						}
+						return replica.Epoch{Height: 2, Signatories: newSignatories}, true
+					})),
+				signatories[0],
+				oldSignatories,
+				// Proposer
+				nil,
+				// Validator
+				processutil.MockValidator{
+					MockValid: func(process.Value) bool {
+						return true
+					},
+				},
+				// Committer
+				processutil.CommitterCallback{
+					Callback: func(height process.Height, value process.Value) {
+						commits <- value
+					},
+				},
+				// Catcher
+				nil,
+				// Broadcaster
+				nil,
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			propose := func(height process.Height, i int, value process.Value) {
+				propose := process.Propose{
+					Height:     height,
+					Round:      0,
+					ValidRound: process.InvalidRound,
+					Value:      value,
+					From:       signatories[i],
+				}
+				Expect(propose.Sign(privKeys[i])).To(Succeed())
+				replica.Propose(ctx, propose)
+			}
+			precommit := func(height process.Height, i int, value process.Value) {
+				precommit := process.Precommit{
+					Height: height,
+					Round:  0,
+					Value:  value,
+					From:   signatories[i],
+				}
+				Expect(precommit.Sign(privKeys[i])).To(Succeed())
+				replica.Precommit(ctx, precommit)
+			}
+
+			// the departed signatory precommits at height 2 before the epoch
+			// is known, so its precommit is queued
+			value := processutil.RandomGoodValue(r)
+			precommit(2, 3, value)
+
+			// the old signatories commit a value at height 1, which begins
+			// the new epoch
+			valueAtHeight1 := processutil.RandomGoodValue(r)
+			propose(1, 1, valueAtHeight1)
+			for i := 1; i < 4; i++ {
+				precommit(1, i, valueAtHeight1)
+			}
+			select {
+			case committed := <-commits:
+				Expect(committed).To(Equal(valueAtHeight1))
+			case <-time.After(5 * time.Second):
+				Fail("failed to commit a value at height 1")
+			}
+
+			// the precommit from the departed signatory, and any new precommit
+			// from the departed signatory, must be dropped
+			propose(2, 2, value)
+			precommit(2, 1, value)
+			precommit(2, 2, value)
+			precommit(2, 3, value)
+			select {
+			case <-commits:
+				Fail("committed a value using a precommit from a departed signatory")
+			case <-time.After(time.Second):
+			}
+
+			// the precommit from the new signatory is accepted
+			precommit(2, 4, value)
+			select {
+			case committed := <-commits:
+				Expect(committed).To(Equal(value))
+			case <-time.After(5 * time.Second):
+				Fail("failed to commit a value at height 2")
+			}
+		})
+	})
+	Context("with a write-ahead log", func() {
+		It("should resume from the log after crashing", func() {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			dir, err := ioutil.TempDir("", "hyperdrive-replica")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+			w := wal.NewFileWAL(filepath.Join(dir, "wal"))
+
+			// every commit and prevote is sent to these channels
+			commits := make(chan process.Value, 1)
+			prevotes := make(chan process.Prevote, 1)
+
+			newReplica := func() *replica.Replica {
+				return replica.New(
+					replica.DefaultOptions().
+						WithPrivKey(privKeys[0]).
+						WithWAL(w),
+					signatories[0],
+					signatories,
+					// Proposer
+					nil,
+					// Validator
+					processutil.MockValidator{
+						MockValid: func(process.Value) bool {
+							return true
+						},
+					},
+					// Committer
+					processutil.CommitterCallback{
+						Callback: func(height process.Height, value process.Value) {
+							commits <- value
+						},
+					},
+					// Catcher
+					nil,
+					// Broadcaster
+					processutil.BroadcasterCallbacks{
+						BroadcastPrevoteCallback: func(prevote process.Prevote) {
+							prevotes <- prevote
+						},
+					},
+					// Flusher
+					nil,
+				)
+			}
+
+			// the replica prevotes for a proposed value, and then crashes
+			value := processutil.RandomGoodValue(r)
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			crashingReplica := newReplica()
+			go func() {
+				defer close(done)
+				crashingReplica.Run(ctx)
+			}()
+
+			propose := process.Propose{
+				Height:     1,
+				Round:      0,
+				ValidRound: process.InvalidRound,
+				Value:      value,
+				From:       signatories[1],
+			}
+			Expect(propose.Sign(privKeys[1])).To(Succeed())
+			crashingReplica.Propose(ctx, propose)
+
+			var prevote process.Prevote
+			select {
+			case prevote = <-prevotes:
+				Expect(prevote.Value).To(Equal(value))
+			case <-time.After(5 * time.Second):
+				Fail("failed to prevote")
+			}
+			cancel()
+			<-done
+
+			// after restarting, the replica broadcasts the same prevote again
+			ctx, cancel = context.WithCancel(context.Background())
+			done = make(chan struct{})
+			resumedReplica := newReplica()
+			go func() {
+				defer close(done)
+				resumedReplica.Run(ctx)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			select {
+			case resumedPrevote := <-prevotes:
+				Expect(resumedPrevote.Equal(&prevote)).To(BeTrue())
+			case <-time.After(5 * time.Second):
+				Fail("failed to broadcast the prevote again")
+			}
+
+			// the replica still knows about the proposed value, and so can
+			// commit it
+			for i := 1; i < 4; i++ {
+				precommit := process.Precommit{
+					Height: 1,
+					Round:  0,
+					Value:  value,
+					From:   signatories[i],
+				}
+				Expect(precommit.Sign(privKeys[i])).To(Succeed())
+				resumedReplica.Precommit(ctx, precommit)
+			}
+			select {
+			case committed := <-commits:
+				Expect(committed).To(Equal(value))
+			case <-time.After(5 * time.Second):
+				Fail("failed to commit after resuming")
+			}
+		})
+
+		It("should checkpoint the next height before broadcasting for it", func() {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			dir, err := ioutil.TempDir("", "hyperdrive-replica")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+			w := wal.NewFileWAL(filepath.Join(dir, "wal"))
+			crashing := &crashingWAL{WAL: w, height: 2}
+
+			// every commit and propose is sent to these channels
+			commits := make(chan process.Height, 2)
+			proposes := make(chan process.Propose, 2)
+
+			// the replica is the proposer at height 2
+			nextValue := processutil.RandomGoodValue(r)
+			newReplica := func(w wal.WAL) *replica.Replica {
+				return replica.New(
+					replica.DefaultOptions().
+						WithPrivKey(privKeys[2]).
+						WithWAL(w),
+					signatories[2],
+					signatories,
+					// Proposer
+					processutil.MockProposer{
+						MockValue: func() process.Value {
+							return nextValue
+						},
+					},
+					// Validator
+					processutil.MockValidator{
+						MockValid: func(process.Value) bool {
+							return true
+						},
+					},
+					// Committer
+					processutil.CommitterCallback{
+						Callback: func(height process.Height, value process.Value) {
+							commits <- height
+						},
+					},
+					// Catcher
+					nil,
+					// Broadcaster
+					processutil.BroadcasterCallbacks{
+						BroadcastProposeCallback: func(propose process.Propose) {
+							proposes <- propose
+						},
+					},
+					// Flusher
+					nil,
+				)
+			}
+
+			// the replica commits height 1, proposes at height 2, and then
+			// crashes
+			value := processutil.RandomGoodValue(r)
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			crashingReplica := newReplica(crashing)
+			go func() {
+				defer close(done)
+				crashingReplica.Run(ctx)
+			}()
+
+			propose := process.Propose{
+				Height:     1,
+				Round:      0,
+				ValidRound: process.InvalidRound,
+				Value:      value,
+				From:       signatories[1],
+			}
+			Expect(propose.Sign(privKeys[1])).To(Succeed())
+			crashingReplica.Propose(ctx, propose)
+			for _, i := range []int{0, 1, 3} {
+				precommit := process.Precommit{
+					Height: 1,
+					Round:  0,
+					Value:  value,
+					From:   signatories[i],
+				}
+				Expect(precommit.Sign(privKeys[i])).To(Succeed())
+				crashingReplica.Precommit(ctx, precommit)
+			}
+			Eventually(commits, 5*time.Second).Should(Receive(Equal(process.Height(1))))
+
+			var nextPropose process.Propose
+			Eventually(proposes, 5*time.Second).Should(Receive(&nextPropose))
+			Expect(nextPropose.Height).To(Equal(process.Height(2)))
+			cancel()
+			<-done
+
+			// the log contains the state at height 2, and the propose
+			record, ok, err := w.Load()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(record.State.CurrentHeight).To(Equal(process.Height(2)))
+			Expect(record.Proposes).To(HaveLen(1))
+			Expect(record.Proposes[0].Equal(&nextPropose)).To(BeTrue())
+
+			// after restarting, the replica broadcasts the same propose again,
+			// and does not commit height 1 again
+			ctx, cancel = context.WithCancel(context.Background())
+			done = make(chan struct{})
+			resumedReplica := newReplica(w)
+			go func() {
+				defer close(done)
+				resumedReplica.Run(ctx)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			var resumedPropose process.Propose
+			Eventually(proposes, 5*time.Second).Should(Receive(&resumedPropose))
+			Expect(resumedPropose.Equal(&nextPropose)).To(BeTrue())
+			Consistently(commits, time.Second).ShouldNot(Receive())
+		})
+	})
+	Context("with a syncer", func() {
+		It("should catch up using commit certificates from other replicas", func() {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every commit, sync request, and sync response is sent to these
+			// channels
+			commits := make(chan process.Value, 3)
+			syncRequests := make(chan process.Height, 1)
+			syncResponses := make(chan []process.CommitCertificate, 1)
+			syncer := mockSyncer{
+				requestSync: func(from process.Height) {
+					syncRequests <- from
+				},
+				sync: func(to id.Signatory, certs []process.CommitCertificate) {
+					Expect(to).To(Equal(signatories[2]))
+					syncResponses <- certs
+				},
+			}
+
+			replica := replica.New(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithSyncer(syncer),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				nil,
+				// Committer
+				processutil.CommitterCallback{
+					Callback: func(height process.Height, value process.Value) {
+						commits <- value
+					},
+				},
+				// Catcher
+				nil,
+				// Broadcaster
+				nil,
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			// the other replicas have committed values at heights 1, 2, and 3
+			certs := make([]process.CommitCertificate, 3)
+			for i := range certs {
+				certs[i] = process.CommitCertificate{
+					Height: process.Height(i + 1),
+					Round:  0,
+					Value:  processutil.RandomGoodValue(r),
+				}
+				for j := 1; j < 4; j++ {
+					precommit := process.Precommit{
+						Height: certs[i].Height,
+						Round:  certs[i].Round,
+						Value:  certs[i].Value,
+						From:   signatories[j],
+					}
+					Expect(precommit.Sign(privKeys[j])).To(Succeed())
+					certs[i].Precommits = append(certs[i].Precommits, precommit)
+				}
+			}
+
+			// a message from height 4 shows that the replica has fallen
+			// behind, so it requests a sync from its current height
+			prevote := process.Prevote{
+				Height: 4,
+				Round:  0,
+				Value:  processutil.RandomGoodValue(r),
+				From:   signatories[1],
+			}
+			Expect(prevote.Sign(privKeys[1])).To(Succeed())
+			replica.Prevote(ctx, prevote)
+			select {
+			case from := <-syncRequests:
+				Expect(from).To(Equal(process.Height(1)))
+			case <-time.After(5 * time.Second):
+				Fail("failed to request a sync")
+			}
+
+			// a commit certificate without enough precommits is ignored
+			invalidCert := certs[0]
+			invalidCert.Precommits = invalidCert.Precommits[1:]
+			replica.SyncCommitCertificate(ctx, invalidCert)
+			select {
+			case <-commits:
+				Fail("committed a value from an invalid commit certificate")
+			case <-time.After(time.Second):
+			}
+
+			// valid commit certificates are committed in order, even when they
+			// are received out of order
+			for i := len(certs) - 1; i >= 0; i-- {
+				replica.SyncCommitCertificate(ctx, certs[i])
+			}
+			for i := range certs {
+				select {
+				case committed := <-commits:
+					Expect(committed).To(Equal(certs[i].Value))
+				case <-time.After(5 * time.Second):
+					Fail("failed to commit a value from a valid commit certificate")
+				}
+			}
+
+			// the replica can now help other replicas to sync
+			replica.SyncRequest(ctx, signatories[2], 1)
+			select {
+			case synced := <-syncResponses:
+				Expect(synced).To(HaveLen(len(certs)))
+				for i := range synced {
+					Expect(synced[i].Equal(&certs[i])).To(BeTrue())
+				}
+			case <-time.After(5 * time.Second):
+				Fail("failed to respond to a sync request")
+			}
+		})
+
+		It("should only keep commit certificates within the sync window", func() {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every commit is sent to this channel
+			commits := make(chan process.Value, 3)
+			syncer := mockSyncer{
+				requestSync: func(process.Height) {},
+				sync:        func(id.Signatory, []process.CommitCertificate) {},
+			}
+
+			// the replica keeps no history, which must not stop it from
+			// syncing
+			replica := replica.New(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithSyncer(syncer).
+					WithSyncHistory(0).
+					WithSyncWindow(1),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				nil,
+				// Committer
+				processutil.CommitterCallback{
+					Callback: func(height process.Height, value process.Value) {
+						commits <- value
+					},
+				},
+				// Catcher
+				nil,
+				// Broadcaster
+				nil,
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			// the other replicas have committed values at heights 1, 2, and 3
+			certs := make([]process.CommitCertificate, 3)
+			for i := range certs {
+				certs[i] = process.CommitCertificate{
+					Height: process.Height(i + 1),
+					Round:  0,
+					Value:  processutil.RandomGoodValue(r),
+				}
+				for j := 1; j < 4; j++ {
+					precommit := process.Precommit{
+						Height: certs[i].Height,
+						Round:  certs[i].Round,
+						Value:  certs[i].Value,
+						From:   signatories[j],
+					}
+					Expect(precommit.Sign(privKeys[j])).To(Succeed())
+					certs[i].Precommits = append(certs[i].Precommits, precommit)
+				}
+			}
+
+			// the commit certificate for height 3 is beyond the window, so it
+			// is dropped, but the one for height 2 is kept until height 1 is
+			// committed
+			for i := len(certs) - 1; i >= 0; i-- {
+				replica.SyncCommitCertificate(ctx, certs[i])
+			}
+			for i := 0; i < 2; i++ {
+				select {
+				case committed := <-commits:
+					Expect(committed).To(Equal(certs[i].Value))
+				case <-time.After(5 * time.Second):
+					Fail("failed to commit a value from a valid commit certificate")
+				}
+			}
+			select {
+			case <-commits:
+				Fail("committed a value from a commit certificate beyond the window")
+			case <-time.After(time.Second):
+			}
+
+			// the commit certificate for height 3 is accepted once it is within
+			// the window
+			replica.SyncCommitCertificate(ctx, certs[2])
+			select {
+			case committed := <-commits:
+				Expect(committed).To(Equal(certs[2].Value))
+			case <-time.After(5 * time.Second):
+				Fail("failed to commit a value from a valid commit certificate")
+			}
+		})
+	})
+
+	Context("with a lossy network", func() {
+		It("should resend messages and reach consensus", func() {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+			rMu := new(sync.Mutex)
+
+			// f is the maximum no. of adversaries
+			// n is the number of honest replicas online
+			// h is the target minimum consensus height
+			f := 1
+			n := 3*f + 1
+			targetHeight := process.Height(5)
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, n)
+			signatories := make([]id.Signatory, n)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every replica sends this signal when they reach the target
+			// consensus height
+			completionSignal := make(chan bool, n)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// every message sent to another replica is lost with some
+			// probability, and delivered asynchronously otherwise
+			replicas := make([]*replica.Replica, n)
+			deliver := func(from int, deliverTo func(*replica.Replica)) {
+				for j := range replicas {
+					rMu.Lock()
+					lost := j != from && r.Intn(3) == 0
+					rMu.Unlock()
+					if lost {
+						continue
+					}
+					go deliverTo(replicas[j])
+				}
+			}
+
+			// build replicas
+			for i := range replicas {
+				replicaIndex := i
+
+				// replicas that fall behind by a whole height, because they
+				// lost messages from a height that the others have committed,
+				// catch up by syncing
+				syncer := mockSyncer{
+					requestSync: func(from process.Height) {
+						for j := range replicas {
+							if j != replicaIndex {
+								go replicas[j].SyncRequest(ctx, signatories[replicaIndex], from)
+							}
+						}
+					},
+					sync: func(to id.Signatory, certs []process.CommitCertificate) {
+						for j := range replicas {
+							if signatories[j].Equal(&to) {
+								for _, cert := range certs {
+									go replicas[j].SyncCommitCertificate(ctx, cert)
+								}
+							}
+						}
+					},
+				}
+
+				replicas[i] = replica.New(
+					replica.DefaultOptions().
+						WithPrivKey(privKeys[i]).
+						WithResendInterval(100*time.Millisecond).
+						WithSyncer(syncer).
+						WithSyncInterval(100*time.Millisecond).
+						// timeouts are too long to be the reason that
+						// consensus recovers from lost messages
+						WithTimerOptions(timer.DefaultOptions().WithTimeout(time.Hour)),
+					signatories[i],
+					signatories,
+					// Proposer
+					processutil.MockProposer{
+						MockValue: func() process.Value {
+							rMu.Lock()
+							defer rMu.Unlock()
+							return processutil.RandomGoodValue(r)
+						},
+					},
+					// Validator
+					processutil.MockValidator{
+						MockValid: func(process.Value) bool {
+							return true
+						},
+					},
+					// Committer
+					processutil.CommitterCallback{
+						Callback: func(height process.Height, value process.Value) {
+							if height == targetHeight {
+								completionSignal <- true
+							}
+						},
+					},
+					// Catcher
+					nil,
+					// Broadcaster
+					processutil.BroadcasterCallbacks{
+						BroadcastProposeCallback: func(propose process.Propose) {
+							deliver(replicaIndex, func(replica *replica.Replica) { replica.Propose(ctx, propose) })
+						},
+						BroadcastPrevoteCallback: func(prevote process.Prevote) {
+							deliver(replicaIndex, func(replica *replica.Replica) { replica.Prevote(ctx, prevote) })
+						},
+						BroadcastPrecommitCallback: func(precommit process.Precommit) {
+							deliver(replicaIndex, func(replica *replica.Replica) { replica.Precommit(ctx, precommit) })
+						},
+					},
+					// Flusher
+					nil,
+				)
+			}
+			for i := range replicas {
+				go replicas[i].Run(ctx)
+			}
+
+			for i := 0; i < n; i++ {
+				select {
+				case <-completionSignal:
+				case <-time.After(30 * time.Second):
+					Fail("failed to reach consensus with lost messages")
+				}
+			}
+		})
+
+		It("should send its messages again, only to the replica that requested them", func() {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every prevote broadcast by the replica is sent to this channel,
+			// and every prevote that is resent is sent to the other channel,
+			// along with the signatory that it is resent to
+			prevotes := make(chan process.Prevote, 1)
+			resent := make(chan resentPrevote, 10)
+
+			replica := replica.New(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithRoundRequestInterval(time.Hour).
+					WithResender(mockResender{
+						resendPrevote: func(to id.Signatory, prevote process.Prevote) {
+							resent <- resentPrevote{to: to, prevote: prevote}
+						},
+					}),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				processutil.MockValidator{
+					MockValid: func(process.Value) bool {
+						return true
+					},
+				},
+				// Committer
+				nil,
+				// Catcher
+				nil,
+				// Broadcaster
+				processutil.BroadcasterCallbacks{
+					BroadcastPrevoteCallback: func(prevote process.Prevote) {
+						prevotes <- prevote
+					},
+				},
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			// the scheduled proposer for height 1 and round 0 proposes a value,
+			// and the replica prevotes for it
+			propose := process.Propose{
+				Height:     1,
+				Round:      0,
+				ValidRound: process.InvalidRound,
+				Value:      processutil.RandomGoodValue(r),
+				From:       signatories[1],
+			}
+			Expect(propose.Sign(privKeys[1])).To(Succeed())
+			replica.Propose(ctx, propose)
+			var prevote process.Prevote
+			select {
+			case prevote = <-prevotes:
+				Expect(prevote.Value).To(Equal(propose.Value))
+			case <-time.After(5 * time.Second):
+				Fail("failed to prevote")
+			}
+
+			// the prevote is delivered back to the replica
+			replica.Prevote(ctx, prevote)
+
+			// requests for other heights, and requests from signatories that
+			// are not in the epoch, are ignored
+			replica.RoundRequest(ctx, signatories[2], 2, 0)
+			replica.RoundRequest(ctx, id.NewPrivKey().Signatory(), 1, 0)
+			select {
+			case req := <-resent:
+				Fail(fmt.Sprintf("resent a prevote to %v", req.to))
+			case <-time.After(time.Second):
+			}
+
+			// requests for the current height and round are answered with the
+			// signed prevote, only to the signatory that requested it, and
+			// only once per interval
+			for i := 0; i < 2; i++ {
+				replica.RoundRequest(ctx, signatories[2], 1, 0)
+				replica.RoundRequest(ctx, signatories[3], 1, 0)
+			}
+			for _, to := range signatories[2:] {
+				select {
+				case req := <-resent:
+					Expect(req.to).To(Equal(to))
+					Expect(req.prevote.Equal(&prevote)).To(BeTrue())
+					Expect(req.prevote.Verify()).To(Succeed())
+				case <-time.After(5 * time.Second):
+					Fail("failed to resend the prevote")
+				}
+			}
+			select {
+			case req := <-resent:
+				Fail(fmt.Sprintf("resent the prevote to %v again", req.to))
+			case <-time.After(time.Second):
+			}
+			select {
+			case <-prevotes:
+				Fail("broadcast the prevote again")
+			default:
+			}
+		})
+	})
+
+	Context("with payloads", func() {
+		It("should reach consensus and commit the payloads", func() {
+			f := 1
+			n := 3*f + 1
+			targetHeight := process.Height(5)
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, n)
+			signatories := make([]id.Signatory, n)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every committed payload is sent to this channel, and every
+			// replica sends the completion signal when it reaches the target
+			// consensus height
+			type commit struct {
+				height  process.Height
+				payload []byte
+			}
+			commits := make(chan commit, n*int(targetHeight))
+			completionSignal := make(chan bool, n)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			replicas := make([]*replica.Replica, n)
+			for i := range replicas {
+				replicas[i] = replica.NewWithPayloads(
+					replica.DefaultOptions().WithPrivKey(privKeys[i]),
+					signatories[i],
+					signatories,
+					// Proposer
+					mockPayloadProposer(func(height process.Height, round process.Round) []byte {
+						return []byte(fmt.Sprintf("block at height=%v round=%v", height, round))
+					}),
+					// Validator
+					mockPayloadValidator(func(height process.Height, payload []byte) bool {
+						return strings.HasPrefix(string(payload), fmt.Sprintf("block at height=%v ", height))
+					}),
+					// Committer
+					mockPayloadCommitter(func(height process.Height, payload []byte) {
+						commits <- commit{height: height, payload: payload}
+						if height == targetHeight {
+							completionSignal <- true
+						}
+					}),
+					// Catcher
+					nil,
+					// Broadcaster
+					processutil.BroadcasterCallbacks{
+						BroadcastProposeCallback: func(propose process.Propose) {
+							for j := range replicas {
+								go replicas[j].Propose(ctx, propose)
+							}
+						},
+						BroadcastPrevoteCallback: func(prevote process.Prevote) {
+							for j := range replicas {
+								go replicas[j].Prevote(ctx, prevote)
+							}
+						},
+						BroadcastPrecommitCallback: func(precommit process.Precommit) {
+							for j := range replicas {
+								go replicas[j].Precommit(ctx, precommit)
+							}
+						},
+					},
+					// Flusher
+					nil,
+				)
+			}
+			for i := range replicas {
+				go replicas[i].Run(ctx)
+			}
+
+			for i := 0; i < n; i++ {
+				select {
+				case <-completionSignal:
+				case <-time.After(30 * time.Second):
+					Fail("failed to reach consensus")
+				}
+			}
+
+			// all replicas must have committed the same valid payload at every
+			// height
+			committed := map[process.Height]string{}
+			for i := 0; i < n*int(targetHeight); i++ {
+				commit := <-commits
+				Expect(string(commit.payload)).To(HavePrefix(fmt.Sprintf("block at height=%v ", commit.height)))
+				if payload, ok := committed[commit.height]; ok {
+					Expect(string(commit.payload)).To(Equal(payload))
+				}
+				committed[commit.height] = string(commit.payload)
+			}
+		})
+
+		It("should drop proposes with bad payloads", func() {
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every payload validated, and every prevote broadcast, by the
+			// replica is sent to these channels
+			validated := make(chan []byte, 1)
+			prevotes := make(chan process.Prevote, 1)
+
+			newPayloadValue := replica.NewPayloadValue
+			replica := replica.NewWithPayloads(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithMaxPayloadSize(16),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				mockPayloadValidator(func(height process.Height, payload []byte) bool {
+					validated <- payload
+					return true
+				}),
+				// Committer
+				nil,
+				// Catcher
+				nil,
+				// Broadcaster
+				processutil.BroadcasterCallbacks{
+					BroadcastPrevoteCallback: func(prevote process.Prevote) {
+						prevotes <- prevote
+					},
+				},
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			// the scheduled proposer for height 1 and round 0 proposes a
+			// payload
+			sendPropose := func(value process.Value, payload []byte) {
+				propose := process.Propose{
+					Height:     1,
+					Round:      0,
+					ValidRound: process.InvalidRound,
+					Value:      value,
+					From:       signatories[1],
+					Payload:    payload,
+				}
+				Expect(propose.Sign(privKeys[1])).To(Succeed())
+				replica.Propose(ctx, propose)
+			}
+
+			// proposes with payloads that do not match their value, or that
+			// are too large, must be dropped
+			sendPropose(newPayloadValue([]byte("other")), []byte("payload"))
+			tooLarge := []byte("a payload that is too large")
+			sendPropose(newPayloadValue(tooLarge), tooLarge)
+			select {
+			case <-validated:
+				Fail("validated a bad payload")
+			case <-prevotes:
+				Fail("prevoted for a bad payload")
+			case <-time.After(time.Second):
+			}
+
+			// proposes with good payloads must be validated, and the replica
+			// must prevote for them
+			payload := []byte("payload")
+			sendPropose(newPayloadValue(payload), payload)
+			select {
+			case got := <-validated:
+				Expect(got).To(Equal(payload))
+			case <-time.After(5 * time.Second):
+				Fail("failed to validate the payload")
+			}
+			select {
+			case prevote := <-prevotes:
+				Expect(prevote.Value).To(Equal(newPayloadValue(payload)))
+			case <-time.After(5 * time.Second):
+				Fail("failed to prevote")
+			}
+		})
+
+		It("should only remember a bounded number of payloads from the scheduled proposer", func() {
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every payload validated by the replica is sent to this channel
+			validated := make(chan []byte, 1)
+
+			newPayloadValue := replica.NewPayloadValue
+			replica := replica.NewWithPayloads(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithMaxPayloads(1),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				mockPayloadValidator(func(height process.Height, payload []byte) bool {
+					validated <- payload
+					return true
+				}),
+				// Committer
+				nil,
+				// Catcher
+				nil,
+				// Broadcaster
+				nil,
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			sendPropose := func(from int, round process.Round, payload []byte) {
+				propose := process.Propose{
+					Height:     1,
+					Round:      round,
+					ValidRound: process.InvalidRound,
+					Value:      newPayloadValue(payload),
+					From:       signatories[from],
+					Payload:    payload,
+				}
+				Expect(propose.Sign(privKeys[from])).To(Succeed())
+				replica.Propose(ctx, propose)
+			}
+
+			// signatories[1] is scheduled to propose in rounds 0 and 4 of
+			// height 1, so the payload from signatories[2] is dropped, and so
+			// is the second payload from signatories[1]
+			sendPropose(2, 0, []byte("unscheduled"))
+			sendPropose(1, 4, []byte("future"))
+			sendPropose(1, 0, []byte("payload"))
+			timeout := time.After(time.Second)
+			for {
+				select {
+				case payload := <-validated:
+					Expect(payload).To(Equal([]byte("future")))
+					continue
+				case <-timeout:
+				}
+				break
+			}
+		})
+
+		It("should keep payloads out of the state", func() {
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			dir, err := ioutil.TempDir("", "hyperdrive-replica")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "wal")
+
+			// every prevote broadcast by the replica is sent to this channel
+			prevotes := make(chan process.Prevote, 1)
+
+			newPayloadValue := replica.NewPayloadValue
+			replica := replica.NewWithPayloads(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithWAL(wal.NewFileWAL(path)),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				mockPayloadValidator(func(height process.Height, payload []byte) bool {
+					return true
+				}),
+				// Committer
+				nil,
+				// Catcher
+				nil,
+				// Broadcaster
+				processutil.BroadcasterCallbacks{
+					BroadcastPrevoteCallback: func(prevote process.Prevote) {
+						prevotes <- prevote
+					},
+				},
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				replica.Run(ctx)
+			}()
+
+			payload := []byte("payload")
+			propose := process.Propose{
+				Height:     1,
+				Round:      0,
+				ValidRound: process.InvalidRound,
+				Value:      newPayloadValue(payload),
+				From:       signatories[1],
+				Payload:    payload,
+			}
+			Expect(propose.Sign(privKeys[1])).To(Succeed())
+			replica.Propose(ctx, propose)
+			Eventually(prevotes, 5*time.Second).Should(Receive())
+			cancel()
+			<-done
+
+			// the state only has the value of the propose, and the payload is
+			// appended to the log separately
+			record, ok, err := wal.NewFileWAL(path).Load()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(record.State.ProposeLogs).To(HaveKey(process.Round(0)))
+			Expect(record.State.ProposeLogs[0].Value).To(Equal(propose.Value))
+			Expect(record.State.ProposeLogs[0].Payload).To(BeEmpty())
+			Expect(record.Payloads).To(HaveLen(1))
+			Expect(record.Payloads[0].Data).To(Equal(payload))
+		})
+	})
+
+	Context("with an asynchronous proposer and validator", func() {
+		It("should reach consensus", func() {
+			f := 1
+			n := 3*f + 1
+			targetHeight := process.Height(5)
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, n)
+			signatories := make([]id.Signatory, n)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every replica sends this signal when they reach the target
+			// consensus height
+			completionSignal := make(chan bool, n)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// values take some time to be proposed and validated
+			proposed := new(sync.Map)
+			replicas := make([]*replica.Replica, n)
+			for i := range replicas {
+				replicas[i] = replica.NewAsync(
+					replica.DefaultOptions().WithPrivKey(privKeys[i]),
+					signatories[i],
+					signatories,
+					// Proposer
+					mockAsyncProposer(func(height process.Height, round process.Round) <-chan process.Value {
+						values := make(chan process.Value, 1)
+						go func() {
+							time.Sleep(10 * time.Millisecond)
+							value := process.Value(id.NewHash([]byte(fmt.Sprintf("height=%v round=%v", height, round))))
+							proposed.Store(value, true)
+							values <- value
+						}()
+						return values
+					}),
+					// Validator
+					mockAsyncValidator(func(height process.Height, value process.Value) <-chan bool {
+						valid := make(chan bool, 1)
+						go func() {
+							time.Sleep(10 * time.Millisecond)
+							_, ok := proposed.Load(value)
+							valid <- ok
+						}()
+						return valid
+					}),
+					// Committer
+					processutil.CommitterCallback{
+						Callback: func(height process.Height, value process.Value) {
+							_, ok := proposed.Load(value)
+							Expect(ok).To(BeTrue())
+							if height == targetHeight {
+								completionSignal <- true
+							}
+						},
+					},
+					// Catcher
+					nil,
+					// Broadcaster
+					processutil.BroadcasterCallbacks{
+						BroadcastProposeCallback: func(propose process.Propose) {
+							for j := range replicas {
+								go replicas[j].Propose(ctx, propose)
+							}
+						},
+						BroadcastPrevoteCallback: func(prevote process.Prevote) {
+							for j := range replicas {
+								go replicas[j].Prevote(ctx, prevote)
+							}
+						},
+						BroadcastPrecommitCallback: func(precommit process.Precommit) {
+							for j := range replicas {
+								go replicas[j].Precommit(ctx, precommit)
+							}
+						},
+					},
+					// Flusher
+					nil,
+				)
+			}
+			for i := range replicas {
+				go replicas[i].Run(ctx)
+			}
+
+			for i := 0; i < n; i++ {
+				select {
+				case <-completionSignal:
+				case <-time.After(30 * time.Second):
+					Fail("failed to reach consensus")
+				}
+			}
+		})
+
+		It("should handle timeouts while a value is being validated", func() {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every prevote broadcast by the replica is sent to this channel,
+			// and the validity of the proposed value is sent by the test
+			prevotes := make(chan process.Prevote, 2)
+			validity := make(chan bool, 1)
+
+			replica := replica.NewAsync(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithTimerOptions(timer.DefaultOptions().WithTimeout(100*time.Millisecond)),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				mockAsyncValidator(func(process.Height, process.Value) <-chan bool {
+					return validity
+				}),
+				// Committer
+				nil,
+				// Catcher
+				nil,
+				// Broadcaster
+				processutil.BroadcasterCallbacks{
+					BroadcastPrevoteCallback: func(prevote process.Prevote) {
+						prevotes <- prevote
+					},
+				},
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			// the scheduled proposer for height 1 and round 0 proposes a value
+			propose := process.Propose{
+				Height:     1,
+				Round:      0,
+				ValidRound: process.InvalidRound,
+				Value:      processutil.RandomGoodValue(r),
+				From:       signatories[1],
+			}
+			Expect(propose.Sign(privKeys[1])).To(Succeed())
+			replica.Propose(ctx, propose)
+
+			// the replica times out while the value is being validated
+			select {
+			case prevote := <-prevotes:
+				Expect(prevote.Round).To(Equal(process.Round(0)))
+				Expect(prevote.Value).To(Equal(process.NilValue))
+			case <-time.After(5 * time.Second):
+				Fail("failed to time out")
+			}
+
+			// the validity arrives after the replica has prevoted, so it must
+			// not prevote again
+			validity <- true
+			select {
+			case prevote := <-prevotes:
+				Fail(fmt.Sprintf("prevoted again for value=%v", prevote.Value))
+			case <-time.After(time.Second):
+			}
+		})
+
+		It("should only validate values from the scheduled proposer, and bound the number of validations", func() {
+			// randomness seed
+			rSeed := time.Now().UnixNano()
+			r := rand.New(rand.NewSource(rSeed))
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, 4)
+			signatories := make([]id.Signatory, 4)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every value given to the validator is sent to this channel, and
+			// the validity is never known
+			validating := make(chan process.Value, 100)
+
+			replica := replica.NewAsync(
+				replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithMaxValidations(3),
+				signatories[0],
+				signatories,
+				// Proposer
+				nil,
+				// Validator
+				mockAsyncValidator(func(height process.Height, value process.Value) <-chan bool {
+					validating <- value
+					return make(chan bool)
+				}),
+				// Committer
+				nil,
+				// Catcher
+				nil,
+				// Broadcaster
+				nil,
+				// Flusher
+				nil,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go replica.Run(ctx)
+
+			// the second signatory is scheduled to propose in rounds 0, 4, 8,
+			// and so on, at height 1, and the third signatory proposes in
+			// rounds in which it is not scheduled
+			for i := 0; i < 10; i++ {
+				for j := 1; j <= 2; j++ {
+					propose := process.Propose{
+						Height:     1,
+						Round:      process.Round(4 * i),
+						ValidRound: process.InvalidRound,
+						Value:      processutil.RandomGoodValue(r),
+						From:       signatories[j],
+					}
+					Expect(propose.Sign(privKeys[j])).To(Succeed())
+					replica.Propose(ctx, propose)
+				}
+			}
+
+			// only the first values proposed by the scheduled proposer are
+			// validated
+			for i := 0; i < 3; i++ {
+				select {
+				case <-validating:
+				case <-time.After(5 * time.Second):
+					Fail("failed to validate")
+				}
+			}
+			select {
+			case value := <-validating:
+				Fail(fmt.Sprintf("validated value=%v", value))
+			case <-time.After(time.Second):
+			}
+		})
+	})
+
+	Context("with a round provider", func() {
+		It("should stop scheduling an offline signatory to propose first", func() {
+			f := 1
+			n := 3*f + 1
+			targetHeight := process.Height(12)
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, n)
+			signatories := make([]id.Signatory, n)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// the round in which each value was proposed, and the round of
+			// the value committed by the first replica at every height
+			rounds := new(sync.Map)
+			committed := make(chan process.Round, targetHeight)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// the last signatory is offline, so only the first 2f+1 replicas
+			// are run
+			replicas := make([]*replica.Replica, n-1)
+			for i := range replicas {
+				i := i
+				replicas[i] = replica.New(
+					replica.DefaultOptions().
+						WithPrivKey(privKeys[i]).
+						WithTimerOptions(timer.DefaultOptions().WithTimeout(200*time.Millisecond)).
+						WithRoundProvider(mockRoundProvider{
+							proposedRound: func(height process.Height, value process.Value) process.Round {
+								round, ok := rounds.Load(value)
+								Expect(ok).To(BeTrue())
+								return round.(process.Round)
+							},
+						}),
+					signatories[i],
+					signatories,
+					// Proposer
+					mockProposer(func(height process.Height, round process.Round) process.Value {
+						value := process.Value(id.NewHash([]byte(fmt.Sprintf("height=%v round=%v", height, round))))
+						rounds.Store(value, round)
+						return value
+					}),
+					// Validator
+					processutil.MockValidator{
+						MockValid: func(process.Value) bool {
+							return true
+						},
+					},
+					// Committer
+					processutil.CommitterCallback{
+						Callback: func(height process.Height, value process.Value) {
+							if i != 0 || height > targetHeight {
+								return
+							}
+							round, ok := rounds.Load(value)
+							Expect(ok).To(BeTrue())
+							committed <- round.(process.Round)
+						},
+					},
+					// Catcher
+					nil,
+					// Broadcaster
+					processutil.BroadcasterCallbacks{
+						BroadcastProposeCallback: func(propose process.Propose) {
+							for j := range replicas {
+								go replicas[j].Propose(ctx, propose)
+							}
+						},
+						BroadcastPrevoteCallback: func(prevote process.Prevote) {
+							for j := range replicas {
+								go replicas[j].Prevote(ctx, prevote)
+							}
+						},
+						BroadcastPrecommitCallback: func(precommit process.Precommit) {
+							for j := range replicas {
+								go replicas[j].Precommit(ctx, precommit)
+							}
+						},
+					},
+					// Flusher
+					nil,
+				)
+			}
+			for i := range replicas {
+				go replicas[i].Run(ctx)
+			}
+
+			// the offline signatory is first scheduled to propose at height 3,
+			// which must time out, but it must not be scheduled to propose
+			// first at any later height (such as height 7 and 11)
+			roundRobin := scheduler.NewRoundRobin(signatories)
+			for height := process.Height(1); height <= targetHeight; height++ {
+				select {
+				case round := <-committed:
+					proposer := roundRobin.Schedule(height, 0)
+					switch {
+					case height < 3:
+						Expect(round).To(Equal(process.Round(0)))
+					case height == 3:
+						Expect(proposer).To(Equal(signatories[n-1]))
+						Expect(round).To(BeNumerically(">", 0))
+					default:
+						Expect(round).To(Equal(process.Round(0)), fmt.Sprintf("height=%v", height))
+					}
+				case <-time.After(30 * time.Second):
+					Fail(fmt.Sprintf("failed to commit at height=%v", height))
+				}
+			}
+		})
+
+		Context("when values are synced", func() {
+			// setup private keys for the replicas
+			// and their signatories
+			var privKeys []*id.PrivKey
+			var signatories []id.Signatory
+
+			// the round in which each value was proposed, and the round of
+			// the value committed at each height
+			var rounds, committed *sync.Map
+			var certs []process.CommitCertificate
+			var proposes chan process.Propose
+
+			BeforeEach(func() {
+				privKeys = make([]*id.PrivKey, 4)
+				signatories = make([]id.Signatory, 4)
+				for i := range privKeys {
+					privKeys[i] = id.NewPrivKey()
+					signatories[i] = privKeys[i].Signatory()
+				}
+				rounds, committed = new(sync.Map), new(sync.Map)
+				proposes = make(chan process.Propose, 10)
+
+				// the other replicas have committed values at heights 1 to 6,
+				// and the last signatory failed to propose at height 3, where
+				// it was the first proposer in round-robin order
+				certs = make([]process.CommitCertificate, 6)
+				for i := range certs {
+					height := process.Height(i + 1)
+					round := process.Round(0)
+					if height == 3 {
+						round = 1
+					}
+					value := process.Value(id.NewHash([]byte(fmt.Sprintf("height=%v round=%v", height, round))))
+					rounds.Store(value, round)
+					certs[i] = process.CommitCertificate{Height: height, Round: round, Value: value}
+					for j := 1; j < 4; j++ {
+						precommit := process.Precommit{Height: height, Round: round, Value: value, From: signatories[j]}
+						Expect(precommit.Sign(privKeys[j])).To(Succeed())
+						certs[i].Precommits = append(certs[i].Precommits, precommit)
+					}
+				}
+			})
+
+			newReplica := func(w wal.WAL) *replica.Replica {
+				opts := replica.DefaultOptions().
+					WithPrivKey(privKeys[0]).
+					WithTimerOptions(timer.DefaultOptions().WithTimeout(time.Hour)).
+					WithRoundProvider(mockRoundProvider{
+						proposedRound: func(height process.Height, value process.Value) process.Round {
+							round, ok := rounds.Load(value)
+							Expect(ok).To(BeTrue())
+							return round.(process.Round)
+						},
+						committedRound: func(height process.Height) (process.Round, bool) {
+							round, ok := committed.Load(height)
+							if !ok {
+								return 0, false
+							}
+							return round.(process.Round), true
+						},
+					})
+				if w != nil {
+					opts = opts.WithWAL(w)
+				}
+				return replica.New(
+					opts,
+					signatories[0],
+					signatories,
+					// Proposer
+					mockProposer(func(height process.Height, round process.Round) process.Value {
+						return process.Value(id.NewHash([]byte(fmt.Sprintf("height=%v round=%v", height, round))))
+					}),
+					// Validator
+					nil,
+					// Committer
+					processutil.CommitterCallback{
+						Callback: func(height process.Height, value process.Value) {
+							round, ok := rounds.Load(value)
+							Expect(ok).To(BeTrue())
+							committed.Store(height, round)
+						},
+					},
+					// Catcher
+					nil,
+					// Broadcaster
+					processutil.BroadcasterCallbacks{
+						BroadcastProposeCallback: func(propose process.Propose) {
+							proposes <- propose
+						},
+					},
+					// Flusher
+					nil,
+				)
+			}
+
+			// expectPropose expects the replica to propose at height 7 in
+			// round 0. The last signatory is the first proposer of height 7 in
+			// round-robin order, but it is demoted because of its failure at
+			// height 3, so the replica takes its place. Proposes at lower
+			// heights (such as height 4, where the replica is the first
+			// proposer in round-robin order) are ignored.
+			expectPropose := func() {
+				Expect(scheduler.NewRoundRobin(signatories).Schedule(7, 0)).To(Equal(signatories[3]))
+				for {
+					select {
+					case propose := <-proposes:
+						if propose.Height < 7 {
+							continue
+						}
+						Expect(propose.Height).To(Equal(process.Height(7)))
+						Expect(propose.Round).To(Equal(process.Round(0)))
+					case <-time.After(5 * time.Second):
+						Fail("failed to propose at height 7")
+					}
+					return
+				}
+			}
+
+			It("should arrive at the same schedule as the replicas that committed the values", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				replica := newReplica(nil)
+				go replica.Run(ctx)
+
+				for _, cert := range certs {
+					replica.SyncCommitCertificate(ctx, cert)
+				}
+				expectPropose()
+			})
+
+			It("should arrive at the same schedule after resuming from a write-ahead log", func() {
+				dir, err := ioutil.TempDir("", "hyperdrive-replica")
+				Expect(err).ToNot(HaveOccurred())
+				defer os.RemoveAll(dir)
+
+				// the replica syncs the values up to height 5, and stops
+				ctx, cancel := context.WithCancel(context.Background())
+				replica := newReplica(wal.NewFileWAL(filepath.Join(dir, "wal")))
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					replica.Run(ctx)
+				}()
+				for _, cert := range certs[:5] {
+					replica.SyncCommitCertificate(ctx, cert)
+				}
+				Eventually(func() bool {
+					_, ok := committed.Load(process.Height(5))
+					return ok
+				}).Should(BeTrue())
+				cancel()
+				<-done
+
+				// the replica resumes, and syncs the value at height 6
+				ctx, cancel = context.WithCancel(context.Background())
+				defer cancel()
+				replica = newReplica(wal.NewFileWAL(filepath.Join(dir, "wal")))
+				go replica.Run(ctx)
+				replica.SyncCommitCertificate(ctx, certs[5])
+				expectPropose()
+			})
+		})
+	})
+
+	Context("with a pipeline", func() {
+		It("should move to the next height before committing, and commit in order", func() {
+			f := 1
+			n := 3*f + 1
+			targetHeight := process.Height(5)
+
+			// setup private keys for the replicas
+			// and their signatories
+			privKeys := make([]*id.PrivKey, n)
+			signatories := make([]id.Signatory, n)
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+			}
+
+			// every replica sends this signal when they reach the target
+			// consensus height
+			completionSignal := make(chan bool, n)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// every replica closes its signal once it prevotes at the second
+			// height, and commits are checked to be in order
+			secondHeight := make([]chan struct{}, n)
+			secondHeightOnce := make([]sync.Once, n)
+			lastCommitted := make([]process.Height, n)
+			values := make([]map[process.Height]process.Value, n)
+			valuesMu := new(sync.Mutex)
+			for i := range secondHeight {
+				secondHeight[i] = make(chan struct{})
+				values[i] = map[process.Height]process.Value{}
+			}
+
+			replicas := make([]*replica.Replica, n)
+			for i := range replicas {
+				replicaIndex := i
+				replicas[i] = replica.New(
+					replica.DefaultOptions().
+						WithPrivKey(privKeys[i]).
+						WithPipelineDepth(2),
+					signatories[i],
+					signatories,
+					// Proposer
+					processutil.MockProposer{
+						MockValue: func() process.Value {
+							return process.Value(id.NewHash([]byte(time.Now().String())))
+						},
+					},
+					// Validator
+					processutil.MockValidator{
+						MockValid: func(process.Value) bool {
+							return true
+						},
+					},
+					// Committer
+					processutil.CommitterCallback{
+						Callback: func(height process.Height, value process.Value) {
+							// the first height is not committed until the
+							// replica has moved to the second height
+							if height == 1 {
+								select {
+								case <-secondHeight[replicaIndex]:
+								case <-time.After(10 * time.Second):
+									return
+								}
+							}
+							if height != lastCommitted[replicaIndex]+1 {
+								return
+							}
+							lastCommitted[replicaIndex] = height
+							valuesMu.Lock()
+							values[replicaIndex][height] = value
+							valuesMu.Unlock()
+							if height == targetHeight {
+								completionSignal <- true
+							}
+						},
+					},
+					// Catcher
+					nil,
+					// Broadcaster
+					processutil.BroadcasterCallbacks{
+						BroadcastProposeCallback: func(propose process.Propose) {
+							for j := range replicas {
+								go replicas[j].Propose(ctx, propose)
+							}
+						},
+						BroadcastPrevoteCallback: func(prevote process.Prevote) {
+							if prevote.Height == 2 {
+								secondHeightOnce[replicaIndex].Do(func() { close(secondHeight[replicaIndex]) })
+							}
+							for j := range replicas {
+								go replicas[j].Prevote(ctx, prevote)
+							}
+						},
+						BroadcastPrecommitCallback: func(precommit process.Precommit) {
+							for j := range replicas {
+								go replicas[j].Precommit(ctx, precommit)
+							}
+						},
+					},
+					// Flusher
+					nil,
+				)
+			}
+			for i := range replicas {
+				go replicas[i].Run(ctx)
+			}
+
+			// replicas only reach the target height if every height was
+			// committed in order
+			for i := 0; i < n; i++ {
+				select {
+				case <-completionSignal:
+				case <-time.After(30 * time.Second):
+					Fail("failed to reach consensus")
+				}
+			}
+			valuesMu.Lock()
+			defer valuesMu.Unlock()
+			for i := 1; i < n; i++ {
+				for h := process.Height(1); h <= targetHeight; h++ {
+					Expect(values[i][h]).To(Equal(values[0][h]))
+				}
+			}
+		})
+		It("should not be used with a write-ahead log", func() {
+			privKey := id.NewPrivKey()
+			signatory := privKey.Signatory()
+			Expect(func() {
+				replica.New(
+					replica.DefaultOptions().
+						WithPrivKey(privKey).
+						WithPipelineDepth(2).
+						WithWAL(wal.NewFileWAL(filepath.Join(os.TempDir(), "hyperdrive-pipeline-wal"))),
+					signatory,
+					[]id.Signatory{signatory},
+					nil, nil, nil, nil, nil, nil,
+				)
+			}).To(Panic())
+		})
+	})
+})
+
+type mockEpochProvider func(process.Height, process.Value) (replica.Epoch, bool)
+
+func (provider mockEpochProvider) NextEpoch(height process.Height, value process.Value) (replica.Epoch, bool) {
+	return provider(height, value)
+}
+
+// A crashingWAL stops writing to the wrapped WAL once a Propose has been
+// appended for the given Height, as if the Replica crashed immediately after
+// broadcasting it.
+type crashingWAL struct {
+	wal.WAL
+	height  process.Height
+	crashed bool
+}
+
+func (w *crashingWAL) Checkpoint(state process.State) error {
+	if w.crashed {
+		return nil
+	}
+	return w.WAL.Checkpoint(state)
+}
+
+func (w *crashingWAL) AppendPropose(propose process.Propose) error {
+	if w.crashed {
+		return nil
+	}
+	w.crashed = propose.Height == w.height
+	return w.WAL.AppendPropose(propose)
+}
+
+func (w *crashingWAL) AppendPrevote(prevote process.Prevote) error {
+	if w.crashed {
+		return nil
+	}
+	return w.WAL.AppendPrevote(prevote)
+}
+
+func (w *crashingWAL) AppendPrecommit(precommit process.Precommit) error {
+	if w.crashed {
+		return nil
+	}
+	return w.WAL.AppendPrecommit(precommit)
+}
+
+type mockSyncer struct {
+	requestSync func(process.Height)
+	sync        func(id.Signatory, []process.CommitCertificate)
+}
+
+func (syncer mockSyncer) RequestSync(from process.Height) {
+	syncer.requestSync(from)
+}
+
+func (syncer mockSyncer) Sync(to id.Signatory, certs []process.CommitCertificate) {
+	syncer.sync(to, certs)
+}
+
+type mockResender struct {
+	requestRound    func(process.Height, process.Round)
+	resendPropose   func(id.Signatory, process.Propose)
+	resendPrevote   func(id.Signatory, process.Prevote)
+	resendPrecommit func(id.Signatory, process.Precommit)
+}
+
+func (resender mockResender) RequestRound(height process.Height, round process.Round) {
+	if resender.requestRound != nil {
+		resender.requestRound(height, round)
+	}
+}
+
+func (resender mockResender) ResendPropose(to id.Signatory, propose process.Propose) {
+	if resender.resendPropose != nil {
+		resender.resendPropose(to, propose)
+	}
+}
+
+func (resender mockResender) ResendPrevote(to id.Signatory, prevote process.Prevote) {
+	if resender.resendPrevote != nil {
+		resender.resendPrevote(to, prevote)
+	}
+}
+
+func (resender mockResender) ResendPrecommit(to id.Signatory, precommit process.Precommit) {
+	if resender.resendPrecommit != nil {
+		resender.resendPrecommit(to, precommit)
+	}
+}
+
+type resentPrevote struct {
+	to      id.Signatory
+	prevote process.Prevote
+}
+
+type mockPayloadProposer func(process.Height, process.Round) []byte
+
+func (proposer mockPayloadProposer) ProposePayload(height process.Height, round process.Round) []byte {
+	return proposer(height, round)
+}
+
+type mockPayloadValidator func(process.Height, []byte) bool
+
+func (validator mockPayloadValidator) ValidPayload(height process.Height, payload []byte) bool {
+	return validator(height, payload)
+}
+
+type mockPayloadCommitter func(process.Height, []byte)
+
+func (committer mockPayloadCommitter) CommitPayload(height process.Height, payload []byte) {
+	committer(height, payload)
+}
+
+type mockProposer func(process.Height, process.Round) process.Value
+
+func (proposer mockProposer) Propose(height process.Height, round process.Round) process.Value {
+	return proposer(height, round)
+}
+
+type mockRoundProvider struct {
+	proposedRound  func(process.Height, process.Value) process.Round
+	committedRound func(process.Height) (process.Round, bool)
+}
+
+func (provider mockRoundProvider) ProposedRound(height process.Height, value process.Value) process.Round {
+	return provider.proposedRound(height, value)
+}
+
+func (provider mockRoundProvider) CommittedRound(height process.Height) (process.Round, bool) {
+	return provider.committedRound(height)
+}
+
+type mockAsyncProposer func(process.Height, process.Round) <-chan process.Value
+
+func (proposer mockAsyncProposer) Propose(height process.Height, round process.Round) <-chan process.Value {
+	return proposer(height, round)
+}
+
+type mockAsyncValidator func(process.Height, process.Value) <-chan bool
+
+func (validator mockAsyncValidator) Valid(height process.Height, value process.Value) <-chan bool {
+	return validator(height, value)
+}
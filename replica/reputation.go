@@ -0,0 +1,83 @@
+package replica
+
+import (
+	"sort"
+
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/hyperdrive/scheduler"
+)
+
+// A RoundProvider is used by a Replica to learn the Round in which each
+// committed Value was proposed, so that signatories that failed to propose can
+// be demoted. Because all correct Replicas must agree on the schedule, Rounds
+// must be derived solely from committed Values (for example, from a Round that
+// the proposer includes in the Value). An incorrect Round can only demote the
+// wrong signatories, which delays progress, but does not affect safety.
+type RoundProvider interface {
+	// ProposedRound is called after a Value is committed (or synced), and
+	// returns the Round in which the Value was proposed. It can be called
+	// before the Value is passed to a pipelined Committer.
+	ProposedRound(process.Height, process.Value) process.Round
+	// CommittedRound returns the Round in which the Value that was committed
+	// at the Height was proposed, and true, or false if no Value is known for
+	// the Height. It is called when the Replica resumes from a write-ahead
+	// log, for the recent Heights that were committed before it stopped.
+	CommittedRound(process.Height) (process.Round, bool)
+}
+
+// newScheduler returns the Scheduler used to select proposers during the
+// Epoch. When the Replica has a RoundProvider, and the Epoch has no voting
+// power, the Scheduler demotes signatories that failed to propose, and the
+// Rounds of the recent Heights (including Heights from earlier Epochs) are
+// recorded in it, so that Replicas that enter the Epoch and Replicas that
+// resume during the Epoch arrive at the same schedule.
+func (replica *Replica) newScheduler(epoch Epoch) process.Scheduler {
+	if epoch.VotingPower != nil || replica.opts.RoundProvider == nil || replica.opts.ReputationWindow <= 0 {
+		return epoch.scheduler()
+	}
+	rep := scheduler.NewReputation(epoch.Signatories, replica.opts.ReputationWindow)
+	heights := make([]process.Height, 0, len(replica.rounds))
+	for height := range replica.rounds {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	for _, height := range heights {
+		rep.Record(height, replica.rounds[height])
+	}
+	return rep
+}
+
+// recordRound remembers the Round in which the Value at the Height was
+// proposed, and records it in the Schedulers of the current and next Epochs.
+// It is called while the Process is committing the Value, so the Round is
+// recorded before the Process schedules the proposer of the next Height.
+func (replica *Replica) recordRound(height process.Height, round process.Round) {
+	if replica.opts.RoundProvider == nil || replica.opts.ReputationWindow <= 0 {
+		return
+	}
+	replica.rounds[height] = round
+	delete(replica.rounds, height-process.Height(replica.opts.ReputationWindow))
+	for _, s := range []process.Scheduler{replica.scheduler, replica.nextScheduler} {
+		if rep, ok := s.(*scheduler.Reputation); ok {
+			rep.Record(height, round)
+		}
+	}
+}
+
+// restoreRounds asks the RoundProvider for the Rounds of the Heights in the
+// reputation window before the current Height. It is called when the Replica
+// resumes from a write-ahead log, so that it arrives at the same schedule as
+// Replicas that did not stop.
+func (replica *Replica) restoreRounds() {
+	if replica.opts.RoundProvider == nil || replica.opts.ReputationWindow <= 0 {
+		return
+	}
+	for height := replica.proc.CurrentHeight - process.Height(replica.opts.ReputationWindow); height < replica.proc.CurrentHeight; height++ {
+		if height <= 0 {
+			continue
+		}
+		if round, ok := replica.opts.RoundProvider.CommittedRound(height); ok {
+			replica.recordRound(height, round)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package replica
+
+import (
+	"context"
+	"time"
+
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/id"
+)
+
+// A Resender is used by a Replica to ask other Replicas for the messages that
+// they broadcast in a Round, when its Process has stalled (for example,
+// because messages were dropped), and to send its own messages to the Replica
+// that asked for them. The messages are signed, so Resenders do not need to be
+// trusted.
+type Resender interface {
+	// RequestRound asks other Replicas for the messages that they broadcast
+	// in the given Height and Round. Other Replicas should pass the request
+	// to their RoundRequest method.
+	RequestRound(process.Height, process.Round)
+	// ResendPropose sends the Propose to the Replica that requested it. The
+	// receiving Replica should pass it to its Propose method.
+	ResendPropose(to id.Signatory, propose process.Propose)
+	// ResendPrevote sends the Prevote to the Replica that requested it. The
+	// receiving Replica should pass it to its Prevote method.
+	ResendPrevote(to id.Signatory, prevote process.Prevote)
+	// ResendPrecommit sends the Precommit to the Replica that requested it.
+	// The receiving Replica should pass it to its Precommit method.
+	ResendPrecommit(to id.Signatory, precommit process.Precommit)
+}
+
+// A roundRequest is a request, from another Replica, for the messages that
+// this Replica broadcast in the given Height and Round.
+type roundRequest struct {
+	from   id.Signatory
+	height process.Height
+	round  process.Round
+}
+
+// RoundRequest adds a request, from the given signatory, for the messages that
+// the replica broadcast in the given Height and Round. If the replica has any
+// of these messages in its logs, then they will be sent again to the
+// requesting signatory, using the replica's Resender. This is useful when
+// another replica has stalled because it missed some messages.
+func (replica *Replica) RoundRequest(ctx context.Context, from id.Signatory, height process.Height, round process.Round) {
+	select {
+	case <-ctx.Done():
+	case replica.onRoundRequest <- roundRequest{from: from, height: height, round: round}:
+	}
+}
+
+// tryResend broadcasts the messages of the current Round again, if the Process
+// has not changed its Height, Round, or Step for at least the resend interval.
+// The interval is restarted after resending, so that messages are resent
+// periodically for as long as the Process is stalled. Other Replicas do not
+// resend messages for Heights that they have already committed (and might not
+// have any messages to send at their next Height), so a stalled Replica also
+// asks them for CommitCertificates. If the Replica has a Resender, then it also
+// asks other Replicas for their messages of the current Round.
+func (replica *Replica) tryResend(now time.Time) {
+	if replica.resendHeight != replica.proc.CurrentHeight ||
+		replica.resendRound != replica.proc.CurrentRound ||
+		replica.resendStep != replica.proc.CurrentStep {
+		replica.resendHeight = replica.proc.CurrentHeight
+		replica.resendRound = replica.proc.CurrentRound
+		replica.resendStep = replica.proc.CurrentStep
+		replica.resendAt = now
+		return
+	}
+	if now.Sub(replica.resendAt) < replica.opts.ResendInterval {
+		return
+	}
+	replica.resendAt = now
+	replica.resend(replica.proc.CurrentHeight, replica.proc.CurrentRound)
+	if replica.opts.Resender != nil {
+		replica.opts.Resender.RequestRound(replica.proc.CurrentHeight, replica.proc.CurrentRound)
+	}
+	replica.requestSync(now)
+}
+
+// handleRoundRequest sends the requested messages again, but only to the
+// Replica that requested them. Only messages at the current Height are kept by
+// the Process, so requests for other Heights are ignored, and requests from
+// signatories that are not in the current Epoch are dropped. Every signatory
+// is answered at most once per round request interval for each Round, so that
+// it cannot make this Replica send its messages over and over again.
+func (replica *Replica) handleRoundRequest(req roundRequest, now time.Time) {
+	if replica.opts.Resender == nil || req.height != replica.proc.CurrentHeight {
+		return
+	}
+	if !replica.filterFrom(req.height, req.from) {
+		replica.dropped("round request", req.height, req.round, req.from, "from")
+		return
+	}
+	for key := range replica.roundRequests {
+		if key.height < replica.proc.CurrentHeight {
+			delete(replica.roundRequests, key)
+		}
+	}
+	if at, ok := replica.roundRequests[req]; ok && now.Sub(at) < replica.opts.RoundRequestInterval {
+		replica.dropped("round request", req.height, req.round, req.from, "throttled")
+		return
+	}
+	if replica.resendTo(req.from, req.height, req.round) {
+		replica.roundRequests[req] = now
+	}
+}
+
+// resendTo sends the Propose, Prevote, and Precommit that this Replica
+// broadcast in the given Round to the signatory, if they are in the logs of
+// the Process. It returns true if any message was sent.
+func (replica *Replica) resendTo(to id.Signatory, height process.Height, round process.Round) bool {
+	resender := replica.opts.Resender
+	whoami := replica.whoami
+	sent := false
+	if propose, ok := replica.proc.ProposeLogs[round]; ok && propose.Height == height && propose.From.Equal(&whoami) {
+		if replica.payloads != nil {
+			propose.Payload, _ = replica.payload(propose.Value)
+		}
+		resender.ResendPropose(to, propose)
+		sent = true
+	}
+	if prevote, ok := replica.proc.PrevoteLogs[round][whoami]; ok && prevote.Height == height {
+		resender.ResendPrevote(to, prevote)
+		sent = true
+	}
+	if precommit, ok := replica.proc.PrecommitLogs[round][whoami]; ok && precommit.Height == height {
+		resender.ResendPrecommit(to, precommit)
+		sent = true
+	}
+	return sent
+}
+
+// resend broadcasts the Propose, Prevote, and Precommit that this Replica
+// broadcast in the given Round, if they are in the logs of the Process. The
+// messages in the logs have already been signed, so they are passed directly
+// to the Broadcaster, without being signed or appended to the write-ahead log
+// again. Payloads are not kept in the logs, so they are attached again.
+func (replica *Replica) resend(height process.Height, round process.Round) {
+	if replica.broadcaster == nil {
+		return
+	}
+	whoami := replica.whoami
+	if propose, ok := replica.proc.ProposeLogs[round]; ok && propose.Height == height && propose.From.Equal(&whoami) {
+		if replica.payloads != nil {
+			propose.Payload, _ = replica.payload(propose.Value)
+		}
+		replica.broadcaster.BroadcastPropose(propose)
+	}
+	if prevote, ok := replica.proc.PrevoteLogs[round][whoami]; ok && prevote.Height == height {
+		replica.broadcaster.BroadcastPrevote(prevote)
+	}
+	if precommit, ok := replica.proc.PrecommitLogs[round][whoami]; ok && precommit.Height == height {
+		replica.broadcaster.BroadcastPrecommit(precommit)
+	}
+}
@@ -0,0 +1,49 @@
+package replica
+
+import (
+	"fmt"
+
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/id"
+)
+
+// A signer wraps a Broadcaster and signs all messages before passing them to
+// the wrapped Broadcaster. The Process does not know about private keys, so all
+// messages that it produces are unsigned.
+type signer struct {
+	privKey     *id.PrivKey
+	broadcaster process.Broadcaster
+}
+
+// newSigner returns a Broadcaster that signs all messages using the given
+// private key, before broadcasting them using the given Broadcaster.
+func newSigner(privKey *id.PrivKey, broadcaster process.Broadcaster) process.Broadcaster {
+	return signer{
+		privKey:     privKey,
+		broadcaster: broadcaster,
+	}
+}
+
+// BroadcastPropose signs the Propose and then broadcasts it.
+func (s signer) BroadcastPropose(propose process.Propose) {
+	if err := propose.Sign(s.privKey); err != nil {
+		panic(fmt.Errorf("invariant violation: signing propose: %v", err))
+	}
+	s.broadcaster.BroadcastPropose(propose)
+}
+
+// BroadcastPrevote signs the Prevote and then broadcasts it.
+func (s signer) BroadcastPrevote(prevote process.Prevote) {
+	if err := prevote.Sign(s.privKey); err != nil {
+		panic(fmt.Errorf("invariant violation: signing prevote: %v", err))
+	}
+	s.broadcaster.BroadcastPrevote(prevote)
+}
+
+// BroadcastPrecommit signs the Precommit and then broadcasts it.
+func (s signer) BroadcastPrecommit(precommit process.Precommit) {
+	if err := precommit.Sign(s.privKey); err != nil {
+		panic(fmt.Errorf("invariant violation: signing precommit: %v", err))
+	}
+	s.broadcaster.BroadcastPrecommit(precommit)
+}
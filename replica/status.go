@@ -0,0 +1,134 @@
+package replica
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/surge"
+)
+
+// Status is a snapshot of the state of a Replica.
+type Status struct {
+	Height      process.Height
+	Round       process.Round
+	Step        process.Step
+	LockedRound process.Round
+	LockedValue process.Value
+	ValidRound  process.Round
+	ValidValue  process.Value
+	Paused      bool
+
+	// Queued is the number of messages in the MessageQueue that are waiting
+	// for the process to reach their Height. Pending is the number of messages
+	// that have been received, but have not been filtered yet.
+	Queued  int
+	Pending int
+}
+
+// A shutdownResult is the final State of a Replica that has been shut down,
+// in binary.
+type shutdownResult struct {
+	state []byte
+	err   error
+}
+
+// Status returns a snapshot of the state of the replica. The snapshot is taken
+// by the replica while it is running, so it is consistent, and the replica
+// must be running (or paused) for Status to return. An error is returned if
+// the context is done first.
+func (replica *Replica) Status(ctx context.Context) (Status, error) {
+	status := make(chan Status, 1)
+	select {
+	case <-ctx.Done():
+		return Status{}, ctx.Err()
+	case replica.onStatusRequest <- status:
+	}
+	select {
+	case <-ctx.Done():
+		return Status{}, ctx.Err()
+	case s := <-status:
+		return s, nil
+	}
+}
+
+// Pause the replica. While it is paused, the replica does not handle messages,
+// timeouts, or requests from other replicas. They are kept in their channels
+// until the replica is resumed, so calls to Propose, Prevote, and Precommit
+// can block once the channels are full. The message being handled when the
+// replica is paused is handled to completion. A paused replica can still be
+// asked for its Status, and be shut down.
+func (replica *Replica) Pause() {
+	atomic.StoreInt32(&replica.paused, 1)
+	replica.notifyPauseChanged()
+}
+
+// Resume the replica after it has been paused. Timeouts that fired while the
+// replica was paused are handled, and ignored by the process if they are no
+// longer relevant.
+func (replica *Replica) Resume() {
+	atomic.StoreInt32(&replica.paused, 0)
+	replica.notifyPauseChanged()
+}
+
+// Shutdown stops the replica, and returns its final State in binary. The
+// replica stops handling messages, waits for its decided Values to be
+// committed, and stops its timer, dropping all timeouts that are in flight.
+// The State is saved to the write-ahead log (if any) before returning. The
+// replica must be running (or paused) for Shutdown to return, and it must not
+// be run again. An error is returned if the context is done first.
+func (replica *Replica) Shutdown(ctx context.Context) ([]byte, error) {
+	result := make(chan shutdownResult, 1)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case replica.onShutdown <- result:
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-result:
+		return r.state, r.err
+	}
+}
+
+func (replica *Replica) isPaused() bool {
+	return atomic.LoadInt32(&replica.paused) == 1
+}
+
+// notifyPauseChanged wakes up the replica, so that it can start (or stop)
+// handling messages. It does not block, because the replica will see the
+// latest value of paused whenever it wakes up.
+func (replica *Replica) notifyPauseChanged() {
+	select {
+	case replica.onPauseChanged <- struct{}{}:
+	default:
+	}
+}
+
+// status returns a snapshot of the state of the Replica.
+func (replica *Replica) status() Status {
+	return Status{
+		Height:      replica.proc.CurrentHeight,
+		Round:       replica.proc.CurrentRound,
+		Step:        replica.proc.CurrentStep,
+		LockedRound: replica.proc.LockedRound,
+		LockedValue: replica.proc.LockedValue,
+		ValidRound:  replica.proc.ValidRound,
+		ValidValue:  replica.proc.ValidValue,
+		Paused:      replica.isPaused(),
+
+		Queued:  replica.mq.Len(),
+		Pending: len(replica.onPropose) + len(replica.onPrevote) + len(replica.onPrecommit),
+	}
+}
+
+// finalState returns the State of the process in binary.
+func (replica *Replica) finalState() shutdownResult {
+	state, err := surge.ToBinary(replica.proc.State)
+	if err != nil {
+		return shutdownResult{err: fmt.Errorf("marshaling state: %v", err)}
+	}
+	return shutdownResult{state: state}
+}
@@ -0,0 +1,165 @@
+package replica
+
+import (
+	"context"
+	"time"
+
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/id"
+
+	"go.uber.org/zap"
+)
+
+// A Syncer is used by a Replica to catch up with other Replicas when it has
+// fallen behind (for example, because messages were dropped). Replicas exchange
+// CommitCertificates, which can be verified against the signatories of the
+// Replica, so Syncers do not need to be trusted.
+type Syncer interface {
+	// RequestSync asks other Replicas for the CommitCertificates of all
+	// Heights from the given Height onwards. Other Replicas should pass the
+	// request to their SyncRequest method.
+	RequestSync(from process.Height)
+	// Sync sends CommitCertificates to the Replica that requested them. The
+	// receiving Replica should pass each CommitCertificate to its
+	// SyncCommitCertificate method.
+	Sync(to id.Signatory, certs []process.CommitCertificate)
+}
+
+// A syncRequest is a request, from another Replica, for the CommitCertificates
+// of all Heights from the given Height onwards.
+type syncRequest struct {
+	from   id.Signatory
+	height process.Height
+}
+
+// SyncRequest adds a request for CommitCertificates to the replica. The request
+// will be answered, using the replica's Syncer, with the CommitCertificates
+// that the replica has for the requested Heights.
+func (replica *Replica) SyncRequest(ctx context.Context, from id.Signatory, height process.Height) {
+	select {
+	case <-ctx.Done():
+	case replica.onSyncRequest <- syncRequest{from: from, height: height}:
+	}
+}
+
+// SyncCommitCertificate adds a CommitCertificate, received from another
+// replica, to the replica. If the CommitCertificate is valid, then the replica
+// will commit its Value and move to the next Height. CommitCertificates for
+// future Heights are kept until the replica reaches their Height.
+func (replica *Replica) SyncCommitCertificate(ctx context.Context, cert process.CommitCertificate) {
+	select {
+	case <-ctx.Done():
+	case replica.onCommitCertificate <- cert:
+	}
+}
+
+// trySync asks other Replicas for CommitCertificates if a message shows that
+// they are at least one full Height ahead of this Replica.
+func (replica *Replica) trySync(height process.Height) {
+	if height <= replica.proc.CurrentHeight+1 {
+		return
+	}
+	replica.requestSync(time.Now())
+}
+
+// requestSync asks other Replicas for CommitCertificates from the current
+// Height onwards. Requests for the same Height are not repeated until the sync
+// interval has passed.
+func (replica *Replica) requestSync(now time.Time) {
+	if replica.opts.Syncer == nil {
+		return
+	}
+	if replica.syncRequestedHeight == replica.proc.CurrentHeight && now.Sub(replica.syncRequestedAt) < replica.opts.SyncInterval {
+		return
+	}
+	replica.syncRequestedHeight = replica.proc.CurrentHeight
+	replica.syncRequestedAt = now
+	replica.opts.Syncer.RequestSync(replica.proc.CurrentHeight)
+}
+
+// handleSyncRequest sends all consecutive CommitCertificates that this Replica
+// has, starting at (or after) the requested Height, to the Replica that
+// requested them.
+func (replica *Replica) handleSyncRequest(req syncRequest) {
+	if replica.opts.Syncer == nil || replica.opts.SyncHistory <= 0 {
+		return
+	}
+	// Only the most recent CommitCertificates are kept, so there is no need
+	// to look for older ones. The requesting Replica cannot be synced by this
+	// Replica alone, but other Replicas might have the missing Heights.
+	height := req.height
+	if oldest := replica.proc.CurrentHeight - process.Height(replica.opts.SyncHistory); height < oldest {
+		replica.logger.Warn("cannot sync: too far behind",
+			zap.Stringer("from", req.from),
+			zap.Int64("height", int64(req.height)),
+			zap.Int64("oldest", int64(oldest)),
+		)
+		height = oldest
+	}
+	certs := []process.CommitCertificate{}
+	for ; height < replica.proc.CurrentHeight; height++ {
+		cert, ok := replica.certs[height]
+		if !ok {
+			if len(certs) > 0 {
+				break
+			}
+			continue
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) > 0 {
+		replica.opts.Syncer.Sync(req.from, certs)
+	}
+}
+
+// handleCommitCertificate keeps the CommitCertificate until the Replica reaches
+// its Height, and then fast-forwards the process using all consecutive
+// CommitCertificates that are valid (including their payloads, if the Replica
+// agrees on payloads). CommitCertificates that are beyond the sync window are
+// dropped, to prevent running out of memory.
+func (replica *Replica) handleCommitCertificate(cert process.CommitCertificate) {
+	if cert.Height < replica.proc.CurrentHeight ||
+		cert.Height > replica.proc.CurrentHeight+process.Height(replica.opts.SyncWindow) {
+		return
+	}
+	replica.pendingCerts[cert.Height] = cert
+
+	for {
+		cert, ok := replica.pendingCerts[replica.proc.CurrentHeight]
+		if !ok {
+			break
+		}
+		delete(replica.pendingCerts, cert.Height)
+
+		// The CommitCertificate must be verified against the Epoch at its
+		// Height. Because the Replica is at that Height, this is the current
+		// Epoch.
+		if err := replica.epoch.verify(cert); err != nil {
+			break
+		}
+		if !replica.verifyPayload(cert) {
+			break
+		}
+		replica.proc.FastForward(cert)
+		replica.tryEnterEpoch()
+	}
+	for height := range replica.pendingCerts {
+		if height < replica.proc.CurrentHeight {
+			delete(replica.pendingCerts, height)
+		}
+	}
+}
+
+// verifyPayload returns true if the CommitCertificate has a valid payload, or
+// if the Replica does not agree on payloads. The payload is not covered by the
+// Precommits, so it must match the Value of the CommitCertificate.
+func (replica *Replica) verifyPayload(cert process.CommitCertificate) bool {
+	if replica.payloads == nil {
+		return true
+	}
+	if len(cert.Payload) > replica.opts.MaxPayloadSize {
+		return false
+	}
+	value := NewPayloadValue(cert.Payload)
+	return value.Equal(&cert.Value)
+}
@@ -0,0 +1,83 @@
+package replica
+
+import (
+	"fmt"
+
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/hyperdrive/wal"
+)
+
+// A walWriter wraps a Broadcaster and appends all messages to a write-ahead log
+// before passing them to the wrapped Broadcaster. This guarantees that a
+// Replica can recover every message that it might have broadcast, even if it
+// crashes immediately after broadcasting.
+type walWriter struct {
+	wal         wal.WAL
+	broadcaster process.Broadcaster
+}
+
+// newWALWriter returns a Broadcaster that appends all messages to the given
+// write-ahead log, before broadcasting them using the given Broadcaster.
+func newWALWriter(wal wal.WAL, broadcaster process.Broadcaster) process.Broadcaster {
+	return walWriter{
+		wal:         wal,
+		broadcaster: broadcaster,
+	}
+}
+
+// BroadcastPropose appends the Propose to the write-ahead log and then
+// broadcasts it.
+func (w walWriter) BroadcastPropose(propose process.Propose) {
+	if err := w.wal.AppendPropose(propose); err != nil {
+		panic(fmt.Errorf("appending propose to wal: %v", err))
+	}
+	w.broadcaster.BroadcastPropose(propose)
+}
+
+// BroadcastPrevote appends the Prevote to the write-ahead log and then
+// broadcasts it.
+func (w walWriter) BroadcastPrevote(prevote process.Prevote) {
+	if err := w.wal.AppendPrevote(prevote); err != nil {
+		panic(fmt.Errorf("appending prevote to wal: %v", err))
+	}
+	w.broadcaster.BroadcastPrevote(prevote)
+}
+
+// BroadcastPrecommit appends the Precommit to the write-ahead log and then
+// broadcasts it.
+func (w walWriter) BroadcastPrecommit(precommit process.Precommit) {
+	if err := w.wal.AppendPrecommit(precommit); err != nil {
+		panic(fmt.Errorf("appending precommit to wal: %v", err))
+	}
+	w.broadcaster.BroadcastPrecommit(precommit)
+}
+
+// A walCheckpointer observes the Process, and checkpoints its State as soon as
+// it moves to a new Height. The Process starts the first Round of the new
+// Height, and might broadcast messages for it, in the same call that commits
+// the previous Height. Checkpointing before then makes sure that messages for
+// a Height are never appended to the log before a State at that Height, and
+// that the Replica does not commit the previous Height again after a crash.
+type walCheckpointer struct {
+	replica *Replica
+}
+
+// OnStepChanged checkpoints the State if the Height has changed since the last
+// checkpoint.
+func (w walCheckpointer) OnStepChanged(height process.Height, round process.Round, step process.Step) {
+	if height != w.replica.checkpointed.CurrentHeight {
+		w.replica.checkpoint()
+	}
+}
+
+// OnLocked is ignored.
+func (w walCheckpointer) OnLocked(process.Height, process.Round, process.Value) {}
+
+// OnValidValueUpdated is ignored.
+func (w walCheckpointer) OnValidValueUpdated(process.Height, process.Round, process.Value) {}
+
+// OnRoundSkipped is ignored.
+func (w walCheckpointer) OnRoundSkipped(process.Height, process.Round, process.Round) {}
+
+// OnTimeoutScheduled is ignored.
+func (w walCheckpointer) OnTimeoutScheduled(process.Height, process.Round, process.Step) {}
@@ -13,6 +13,12 @@
 package scheduler
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"sync"
+
 	"github.com/renproject/hyperdrive/process"
 	"github.com/renproject/id"
 )
@@ -51,3 +57,201 @@ func (rr *RoundRobin) Schedule(height process.Height, round process.Round) id.Si
 	}
 	return rr.signatories[(uint64(height)+uint64(round))%uint64(len(rr.signatories))]
 }
+
+// Weighted holds a list of signatories, sorted by their bytes, and their
+// voting power. Signatories are selected with a probability that is
+// proportional to their voting power.
+type Weighted struct {
+	signatories []id.Signatory
+	power       []uint64
+	total       uint64
+}
+
+// NewWeighted returns a Scheduler that selects a proposer with a probability
+// that is proportional to its voting power. Signatories with no voting power
+// are never selected. Selection is a deterministic function of the height,
+// round, and voting power, so all processes with the same voting power will
+// arrive at the same schedule.
+func NewWeighted(votingPower process.VotingPower) process.Scheduler {
+	signatories := make([]id.Signatory, 0, len(votingPower))
+	for signatory, power := range votingPower {
+		if power > 0 {
+			signatories = append(signatories, signatory)
+		}
+	}
+	sort.Slice(signatories, func(i, j int) bool {
+		return bytes.Compare(signatories[i][:], signatories[j][:]) < 0
+	})
+	power := make([]uint64, len(signatories))
+	total := uint64(0)
+	for i, signatory := range signatories {
+		power[i] = votingPower[signatory]
+		total += power[i]
+	}
+	return &Weighted{
+		signatories: signatories,
+		power:       power,
+		total:       total,
+	}
+}
+
+// Schedule a proposer by hashing the height and round into a number that is
+// less than the total voting power, and then selecting the signatory whose
+// cumulative voting power range contains that number.
+func (w *Weighted) Schedule(height process.Height, round process.Round) id.Signatory {
+	if len(w.signatories) == 0 {
+		panic("no processes to schedule")
+	}
+	if height <= 0 {
+		panic("invalid height")
+	}
+	if round <= process.InvalidRound {
+		panic("invalid round")
+	}
+
+	var seed [16]byte
+	binary.BigEndian.PutUint64(seed[:8], uint64(height))
+	binary.BigEndian.PutUint64(seed[8:], uint64(round))
+	hash := sha256.Sum256(seed[:])
+	target := binary.BigEndian.Uint64(hash[:8]) % w.total
+
+	for i, power := range w.power {
+		if target < power {
+			return w.signatories[i]
+		}
+		target -= power
+	}
+	panic("invariant violation: target exceeds total voting power")
+}
+
+// Reputation holds a list of signatories that will participate in round robin
+// scheduling, and a record of the signatories that failed to propose at recent
+// heights. Signatories that failed to propose are demoted, so that they are
+// only scheduled after all of the signatories with fewer failures.
+type Reputation struct {
+	mu          sync.RWMutex
+	signatories []id.Signatory
+	window      int
+	latest      process.Height
+	failures    map[process.Height][]id.Signatory
+}
+
+// NewReputation returns a Scheduler that uses round-robin scheduling, but
+// demotes signatories that failed to propose in any of the recent window of
+// heights. This avoids waiting for a propose timeout at every height where an
+// offline signatory would have been the proposer. Demoted signatories are
+// forgiven once their failures are outside of the window. When no signatories
+// have failed, the schedule is the same as NewRoundRobin.
+//
+// Failures must be recorded using Record. Because all correct processes must
+// arrive at the same schedule, failures must only be derived from committed
+// Values, and must be recorded for a height before the schedule is needed for
+// the next height. The schedule at a height only depends on the rounds that
+// were recorded for the window of heights before it, so a process that
+// restarts only needs to record the rounds of the heights in the window again.
+func NewReputation(signatories []id.Signatory, window int) *Reputation {
+	copied := make([]id.Signatory, len(signatories))
+	copy(copied[:], signatories)
+	return &Reputation{
+		signatories: copied,
+		window:      window,
+		failures:    map[process.Height][]id.Signatory{},
+	}
+}
+
+// Record that the Value committed at the height was proposed in the round, so
+// the signatories in the first rounds of the round-robin order of the height
+// failed to propose (each at most once). Failures are attributed in round-robin
+// order, rather than in the order in which signatories were scheduled, so that
+// they only depend on the round (and not on failures at earlier heights). This
+// can attribute the failure of a signatory to a signatory that is already
+// demoted. The round must be derived from the committed Value, not from the
+// CommitCertificate, because correct processes can commit the same Value in
+// different rounds. Heights must be recorded in order, and before the next
+// height is scheduled. Heights that are not greater than the latest recorded
+// height are ignored.
+func (rep *Reputation) Record(height process.Height, round process.Round) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if len(rep.signatories) == 0 || height <= rep.latest || round < 0 {
+		return
+	}
+	n := uint64(len(rep.signatories))
+	if uint64(round) > n {
+		round = process.Round(n)
+	}
+	failed := make([]id.Signatory, 0, round)
+	for r := uint64(0); r < uint64(round); r++ {
+		failed = append(failed, rep.signatories[(uint64(height)+r)%n])
+	}
+	rep.failures[height] = failed
+	rep.latest = height
+
+	for h := range rep.failures {
+		if h <= height-process.Height(rep.window) {
+			delete(rep.failures, h)
+		}
+	}
+}
+
+// Schedule a proposer by ordering the signatories by the number of times that
+// they failed to propose in the window of heights before the height, and then
+// in round-robin order starting from the height, and using the round as an
+// index into this order. Failures are forgotten once they are outside of the
+// window of the height after the latest recorded height, so earlier heights
+// might not be scheduled in the same way as they were before.
+func (rep *Reputation) Schedule(height process.Height, round process.Round) id.Signatory {
+	if len(rep.signatories) == 0 {
+		panic("no processes to schedule")
+	}
+	if height <= 0 {
+		panic("invalid height")
+	}
+	if round <= process.InvalidRound {
+		panic("invalid round")
+	}
+
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	order := rep.order(height)
+	return order[uint64(round)%uint64(len(order))]
+}
+
+// order returns the signatories in the order in which they are scheduled at
+// the height. It must be called while holding the lock.
+func (rep *Reputation) order(height process.Height) []id.Signatory {
+	n := uint64(len(rep.signatories))
+	failures := map[id.Signatory]int{}
+	for h, failed := range rep.failures {
+		if h < height && h >= height-process.Height(rep.window) {
+			for _, signatory := range failed {
+				failures[signatory]++
+			}
+		}
+	}
+
+	// The position of a signatory in round-robin order, starting from the
+	// height, is used to break ties.
+	position := func(i int) uint64 {
+		return (uint64(i) + n - uint64(height)%n) % n
+	}
+	indices := make([]int, n)
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		fi, fj := failures[rep.signatories[indices[i]]], failures[rep.signatories[indices[j]]]
+		if fi != fj {
+			return fi < fj
+		}
+		return position(indices[i]) < position(indices[j])
+	})
+
+	order := make([]id.Signatory, n)
+	for i, index := range indices {
+		order[i] = rep.signatories[index]
+	}
+	return order
+}
@@ -135,4 +135,204 @@ var _ = Describe("Scheduler", func() {
 			Expect(quick.Check(loop, nil)).To(Succeed())
 		})
 	})
+
+	Context("when scheduling with voting power", func() {
+		It("should panic for an invalid height or round", func() {
+			weightedScheduler := scheduler.NewWeighted(process.VotingPower{
+				id.NewPrivKey().Signatory(): 1,
+			})
+			Expect(func() {
+				weightedScheduler.Schedule(process.Height(-rand.Int63()), process.Round(rand.Int63()))
+			}).To(PanicWith("invalid height"))
+			Expect(func() {
+				weightedScheduler.Schedule(process.Height(1+rand.Int63n(1000)), process.InvalidRound)
+			}).To(PanicWith("invalid round"))
+		})
+
+		It("should panic when no signatory has voting power", func() {
+			weightedScheduler := scheduler.NewWeighted(process.VotingPower{
+				id.NewPrivKey().Signatory(): 0,
+			})
+			Expect(func() {
+				weightedScheduler.Schedule(process.Height(1), process.Round(0))
+			}).To(PanicWith("no processes to schedule"))
+		})
+
+		It("should schedule deterministically", func() {
+			loop := func() bool {
+				n := 1 + rand.Intn(12)
+				votingPower := process.VotingPower{}
+				for i := 0; i < n; i++ {
+					votingPower[id.NewPrivKey().Signatory()] = uint64(1 + rand.Intn(100))
+				}
+				first := scheduler.NewWeighted(votingPower)
+				second := scheduler.NewWeighted(votingPower)
+
+				for t := 0; t <= 20; t++ {
+					height := process.Height(1 + rand.Int63n(1000))
+					round := process.Round(rand.Int63n(1000))
+					Expect(first.Schedule(height, round)).To(Equal(second.Schedule(height, round)))
+				}
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should schedule in proportion to voting power", func() {
+			heavy := id.NewPrivKey().Signatory()
+			light := id.NewPrivKey().Signatory()
+			none := id.NewPrivKey().Signatory()
+			weightedScheduler := scheduler.NewWeighted(process.VotingPower{
+				heavy: 3,
+				light: 1,
+				none:  0,
+			})
+
+			scheduled := map[id.Signatory]int{}
+			for height := process.Height(1); height <= 4000; height++ {
+				scheduled[weightedScheduler.Schedule(height, 0)]++
+			}
+			Expect(scheduled[none]).To(Equal(0))
+			Expect(scheduled[heavy]).To(BeNumerically("~", 3000, 200))
+			Expect(scheduled[light]).To(BeNumerically("~", 1000, 200))
+		})
+	})
+
+	Context("when scheduling with reputation", func() {
+		It("should panic for an invalid height or round", func() {
+			reputationScheduler := scheduler.NewReputation([]id.Signatory{id.NewPrivKey().Signatory()}, 10)
+			Expect(func() {
+				reputationScheduler.Schedule(process.Height(-rand.Int63()), process.Round(rand.Int63()))
+			}).To(PanicWith("invalid height"))
+			Expect(func() {
+				reputationScheduler.Schedule(process.Height(1+rand.Int63n(1000)), process.InvalidRound)
+			}).To(PanicWith("invalid round"))
+		})
+
+		It("should panic when there are no signatories", func() {
+			reputationScheduler := scheduler.NewReputation([]id.Signatory{}, 10)
+			reputationScheduler.Record(process.Height(1), process.Round(1))
+			Expect(func() {
+				reputationScheduler.Schedule(process.Height(1), process.Round(0))
+			}).To(PanicWith("no processes to schedule"))
+		})
+
+		It("should schedule the same as round robin when no signatory has failed", func() {
+			loop := func() bool {
+				n := 1 + rand.Intn(12)
+				signatories := make([]id.Signatory, n)
+				for i := 0; i < n; i++ {
+					signatories[i] = id.NewPrivKey().Signatory()
+				}
+				roundRobinScheduler := scheduler.NewRoundRobin(signatories)
+				reputationScheduler := scheduler.NewReputation(signatories, 10)
+
+				for height := process.Height(1); height <= 20; height++ {
+					for round := process.Round(0); round < 20; round++ {
+						Expect(reputationScheduler.Schedule(height, round)).To(Equal(roundRobinScheduler.Schedule(height, round)))
+					}
+					reputationScheduler.Record(height, 0)
+				}
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should demote signatories that failed to propose, until the failure is outside of the window", func() {
+			signatories := make([]id.Signatory, 4)
+			for i := range signatories {
+				signatories[i] = id.NewPrivKey().Signatory()
+			}
+			offline := signatories[2]
+			reputationScheduler := scheduler.NewReputation(signatories, 5)
+
+			// the offline signatory fails to propose at height 2, and the
+			// value is proposed in the next round
+			Expect(reputationScheduler.Schedule(1, 0)).To(Equal(signatories[1]))
+			reputationScheduler.Record(1, 0)
+			Expect(reputationScheduler.Schedule(2, 0)).To(Equal(offline))
+			Expect(reputationScheduler.Schedule(2, 1)).To(Equal(signatories[3]))
+			reputationScheduler.Record(2, 1)
+
+			// the offline signatory is scheduled after all other signatories
+			// while the failure is in the window
+			for height := process.Height(3); height <= 7; height++ {
+				for round := process.Round(0); round < 3; round++ {
+					Expect(reputationScheduler.Schedule(height, round)).ToNot(Equal(offline))
+				}
+				Expect(reputationScheduler.Schedule(height, 3)).To(Equal(offline))
+				if height == 6 {
+					// the next signatory takes the place of the offline
+					// signatory
+					Expect(reputationScheduler.Schedule(height, 0)).To(Equal(signatories[3]))
+				}
+				reputationScheduler.Record(height, 0)
+			}
+
+			// the offline signatory is forgiven once the failure is outside
+			// of the window
+			Expect(reputationScheduler.Schedule(8, 0)).To(Equal(signatories[0]))
+			Expect(reputationScheduler.Schedule(10, 0)).To(Equal(offline))
+		})
+
+		It("should only depend on the rounds recorded in the window", func() {
+			loop := func() bool {
+				n := 1 + rand.Intn(12)
+				window := 1 + rand.Intn(10)
+				signatories := make([]id.Signatory, n)
+				for i := 0; i < n; i++ {
+					signatories[i] = id.NewPrivKey().Signatory()
+				}
+
+				// the first scheduler records every height, and the second
+				// scheduler only records the heights in the window, as if it
+				// had just restarted
+				rounds := make([]process.Round, 50)
+				first := scheduler.NewReputation(signatories, window)
+				for height := range rounds {
+					rounds[height] = process.Round(rand.Intn(2 * n))
+					first.Record(process.Height(height+1), rounds[height])
+				}
+				second := scheduler.NewReputation(signatories, window)
+				for height := len(rounds) - window; height < len(rounds); height++ {
+					second.Record(process.Height(height+1), rounds[height])
+				}
+
+				next := process.Height(len(rounds) + 1)
+				for round := process.Round(0); round < 20; round++ {
+					Expect(first.Schedule(next, round)).To(Equal(second.Schedule(next, round)))
+				}
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		It("should schedule deterministically from the recorded failures", func() {
+			loop := func() bool {
+				n := 1 + rand.Intn(12)
+				signatories := make([]id.Signatory, n)
+				for i := 0; i < n; i++ {
+					signatories[i] = id.NewPrivKey().Signatory()
+				}
+				first := scheduler.NewReputation(signatories, 10)
+				second := scheduler.NewReputation(signatories, 10)
+
+				for height := process.Height(1); height <= 50; height++ {
+					round := process.Round(rand.Intn(3))
+					first.Record(height, round)
+					second.Record(height, round)
+
+					// heights that have already been recorded are ignored
+					second.Record(height, round+1)
+					second.Record(height-1, round+1)
+
+					for round := process.Round(0); round < 20; round++ {
+						Expect(first.Schedule(height+1, round)).To(Equal(second.Schedule(height+1, round)))
+					}
+				}
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+	})
 })
@@ -0,0 +1,202 @@
+package timer
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/renproject/hyperdrive/process"
+)
+
+// AdaptiveTimer defines a timer that computes its timeouts from the time that
+// it takes to complete each step (Propose, Prevote and Precommit) in recent
+// heights, instead of using a fixed timeout. It must be the Observer of the
+// Process that it is timing, so that it can observe when steps are completed.
+//
+// The timeout for a step is a percentile of the durations observed for that
+// step over the recent window of heights, plus a margin. Until a duration has
+// been observed for the step, the timeout of the step in the options is used
+// instead. The timeout grows with the number of rounds that have timed out
+// since the last commit (no matter how many of their steps timed out), so that
+// it grows while the Process is failing to make progress, and the growth is
+// reset whenever the Process moves to the next height. Timeouts are always clamped between the floor and ceiling
+// in the options. Steps that were completed by a timeout are not observed,
+// because their durations only reflect the timeout.
+//
+// Timeouts are emitted in the same way as the LinearTimer. It is safe for
+// concurrent use.
+type AdaptiveTimer struct {
+	opts  Options
+	clock Clock
+	queue *timeoutQueue
+
+	// mu protects the observed step durations, the step that is currently
+	// being observed, and the number of rounds that have timed out since the
+	// last commit. The failed round is the latest round that has been counted.
+	mu            sync.Mutex
+	samples       map[process.Step][]sample
+	height        process.Height
+	round         process.Round
+	step          process.Step
+	stepStartedAt time.Time
+	timedOut      bool
+	failures      int
+	failedRound   process.Round
+}
+
+// A sample is the duration of a step that was completed at a height.
+type sample struct {
+	height   process.Height
+	duration time.Duration
+}
+
+// NewAdaptiveTimer constructs a new Adaptive Timer from the input options and
+// channels
+func NewAdaptiveTimer(opts Options, onTimeoutPropose, onTimeoutPrevote, onTimeoutPrecommit chan<- Timeout) *AdaptiveTimer {
+	t := &AdaptiveTimer{
+		opts:        opts,
+		queue:       newTimeoutQueue(opts, onTimeoutPropose, onTimeoutPrevote, onTimeoutPrecommit),
+		samples:     map[process.Step][]sample{},
+		failedRound: process.InvalidRound,
+	}
+	t.clock = t.queue.clock
+	t.queue.emitted = t.emitted
+	return t
+}
+
+// TimeoutPropose schedules a propose timeout with a timeout period computed
+// from the observed propose durations
+func (t *AdaptiveTimer) TimeoutPropose(height process.Height, round process.Round) {
+	t.queue.schedule(process.Proposing, height, round, t.Duration(process.Proposing))
+}
+
+// TimeoutPrevote schedules a prevote timeout with a timeout period computed
+// from the observed prevote durations
+func (t *AdaptiveTimer) TimeoutPrevote(height process.Height, round process.Round) {
+	t.queue.schedule(process.Prevoting, height, round, t.Duration(process.Prevoting))
+}
+
+// TimeoutPrecommit schedules a precommit timeout with a timeout period computed
+// from the observed precommit durations
+func (t *AdaptiveTimer) TimeoutPrecommit(height process.Height, round process.Round) {
+	t.queue.schedule(process.Precommitting, height, round, t.Duration(process.Precommitting))
+}
+
+// Stop the AdaptiveTimer, drop all timeouts that have not been emitted, and
+// wait for the goroutine that emits timeouts to return. Timeouts that are
+// scheduled after the AdaptiveTimer has been stopped are ignored.
+func (t *AdaptiveTimer) Stop() {
+	t.queue.stop()
+}
+
+// Duration returns the timeout period that would be used if a timeout were
+// scheduled for the step now.
+func (t *AdaptiveTimer) Duration(step process.Step) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	duration := t.opts.baseTimeout(step)
+	if samples := t.samples[step]; len(samples) > 0 {
+		duration = percentile(samples, t.opts.Percentile) + t.opts.Margin
+	}
+	duration = t.opts.grow(duration, t.failures)
+	if duration < t.opts.MinTimeout {
+		duration = t.opts.MinTimeout
+	}
+	return duration
+}
+
+// OnStepChanged observes the duration of the previous step, if it was
+// completed in the same height and round without being timed out. Moving to
+// the next height completes the precommit step, and resets the growth of the
+// timeout.
+func (t *AdaptiveTimer) OnStepChanged(height process.Height, round process.Round, step process.Step) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clock.Now()
+	if !t.stepStartedAt.IsZero() && !t.timedOut {
+		sameRound := height == t.height && round == t.round && step > t.step
+		committed := height > t.height && t.step == process.Precommitting
+		if sameRound || committed {
+			t.observe(t.height, t.step, now.Sub(t.stepStartedAt))
+		}
+	}
+	if height > t.height {
+		t.failures, t.failedRound = 0, process.InvalidRound
+		t.prune(height)
+	}
+	t.height, t.round, t.step, t.stepStartedAt, t.timedOut = height, round, step, now, false
+}
+
+// OnLocked is ignored.
+func (t *AdaptiveTimer) OnLocked(process.Height, process.Round, process.Value) {}
+
+// OnValidValueUpdated is ignored.
+func (t *AdaptiveTimer) OnValidValueUpdated(process.Height, process.Round, process.Value) {}
+
+// OnRoundSkipped is ignored. The round change is observed when the Process
+// starts the new round.
+func (t *AdaptiveTimer) OnRoundSkipped(process.Height, process.Round, process.Round) {}
+
+// OnTimeoutScheduled is ignored.
+func (t *AdaptiveTimer) OnTimeoutScheduled(process.Height, process.Round, process.Step) {}
+
+// emitted counts the round of the timeout as a failure, if it has not been
+// counted yet, and stops the current step from being observed if the timeout is
+// for the current step.
+func (t *AdaptiveTimer) emitted(step process.Step, timeout Timeout) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if timeout.Height != t.height {
+		return
+	}
+	if timeout.Round > t.failedRound {
+		t.failures++
+		t.failedRound = timeout.Round
+	}
+	if timeout.Round == t.round && step == t.step {
+		t.timedOut = true
+	}
+}
+
+// observe the duration of a step. It must be called while holding the lock.
+func (t *AdaptiveTimer) observe(height process.Height, step process.Step, duration time.Duration) {
+	t.samples[step] = append(t.samples[step], sample{height: height, duration: duration})
+}
+
+// prune the durations that were observed outside of the window of recent
+// heights. It must be called while holding the lock.
+func (t *AdaptiveTimer) prune(height process.Height) {
+	for step, samples := range t.samples {
+		n := 0
+		for _, s := range samples {
+			if s.height > height-process.Height(t.opts.Window) {
+				samples[n] = s
+				n++
+			}
+		}
+		t.samples[step] = samples[:n]
+	}
+}
+
+// percentile returns the smallest duration that is at least as large as the
+// given fraction of the durations.
+func percentile(samples []sample, p float64) time.Duration {
+	durations := make([]time.Duration, len(samples))
+	for i, s := range samples {
+		durations[i] = s.duration
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	i := int(math.Ceil(p*float64(len(durations)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(durations) {
+		i = len(durations) - 1
+	}
+	return durations[i]
+}
@@ -0,0 +1,196 @@
+package timer_test
+
+import (
+	"time"
+
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/hyperdrive/timer"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Adaptive Timer", func() {
+	var clock *timer.ManualClock
+	var onTimeoutPropose, onTimeoutPrevote, onTimeoutPrecommit chan timer.Timeout
+	var opts timer.Options
+	var timers []*timer.AdaptiveTimer
+
+	BeforeEach(func() {
+		clock = timer.NewManualClock(time.Now())
+		onTimeoutPropose = make(chan timer.Timeout, 1)
+		onTimeoutPrevote = make(chan timer.Timeout, 1)
+		onTimeoutPrecommit = make(chan timer.Timeout, 1)
+		opts = timer.DefaultOptions().
+			WithClock(clock).
+			WithTimeout(10 * time.Second).
+			WithTimeoutScaling(1).
+			WithWindow(3).
+			WithPercentile(0.5).
+			WithMargin(time.Second).
+			WithMinTimeout(time.Second).
+			WithMaxTimeout(time.Minute)
+	})
+
+	AfterEach(func() {
+		for _, t := range timers {
+			t.Stop()
+		}
+		timers = nil
+	})
+
+	newTimer := func() *timer.AdaptiveTimer {
+		t := timer.NewAdaptiveTimer(opts, onTimeoutPropose, onTimeoutPrevote, onTimeoutPrecommit)
+		timers = append(timers, t)
+		return t
+	}
+
+	// completeHeight observes a height in which every step takes the given
+	// duration, and then moves to the next height.
+	completeHeight := func(t *timer.AdaptiveTimer, height process.Height, duration time.Duration) {
+		t.OnStepChanged(height, 0, process.Proposing)
+		clock.Advance(duration)
+		t.OnStepChanged(height, 0, process.Prevoting)
+		clock.Advance(duration)
+		t.OnStepChanged(height, 0, process.Precommitting)
+		clock.Advance(duration)
+		t.OnStepChanged(height+1, 0, process.Proposing)
+	}
+
+	Context("when no step durations have been observed", func() {
+		It("should use the timeout in the options", func() {
+			t := newTimer()
+			Expect(t.Duration(process.Proposing)).To(Equal(10 * time.Second))
+			Expect(t.Duration(process.Prevoting)).To(Equal(10 * time.Second))
+			Expect(t.Duration(process.Precommitting)).To(Equal(10 * time.Second))
+		})
+
+		It("should use the timeout for each step in the options", func() {
+			opts = opts.WithProposeTimeout(20 * time.Second).WithPrevoteTimeout(5 * time.Second)
+			t := newTimer()
+			Expect(t.Duration(process.Proposing)).To(Equal(20 * time.Second))
+			Expect(t.Duration(process.Prevoting)).To(Equal(5 * time.Second))
+			Expect(t.Duration(process.Precommitting)).To(Equal(10 * time.Second))
+		})
+	})
+
+	Context("when step durations have been observed", func() {
+		It("should use a percentile of the durations plus the margin", func() {
+			t := newTimer()
+			completeHeight(t, 1, 2*time.Second)
+			completeHeight(t, 2, 4*time.Second)
+			completeHeight(t, 3, 3*time.Second)
+			Expect(t.Duration(process.Proposing)).To(Equal(4 * time.Second))
+			Expect(t.Duration(process.Prevoting)).To(Equal(4 * time.Second))
+			Expect(t.Duration(process.Precommitting)).To(Equal(4 * time.Second))
+		})
+
+		It("should observe each step separately", func() {
+			t := newTimer()
+			t.OnStepChanged(1, 0, process.Proposing)
+			clock.Advance(time.Second)
+			t.OnStepChanged(1, 0, process.Prevoting)
+			clock.Advance(2 * time.Second)
+			t.OnStepChanged(1, 0, process.Precommitting)
+			clock.Advance(3 * time.Second)
+			t.OnStepChanged(2, 0, process.Proposing)
+			Expect(t.Duration(process.Proposing)).To(Equal(2 * time.Second))
+			Expect(t.Duration(process.Prevoting)).To(Equal(3 * time.Second))
+			Expect(t.Duration(process.Precommitting)).To(Equal(4 * time.Second))
+		})
+
+		It("should forget the durations observed outside of the window", func() {
+			t := newTimer()
+			completeHeight(t, 1, 30*time.Second)
+			completeHeight(t, 2, time.Second)
+			completeHeight(t, 3, time.Second)
+			Expect(t.Duration(process.Proposing)).To(Equal(2 * time.Second))
+			completeHeight(t, 4, time.Second)
+			completeHeight(t, 5, time.Second)
+			Expect(t.Duration(process.Proposing)).To(Equal(2 * time.Second))
+		})
+
+		It("should not observe steps that were left for another round", func() {
+			t := newTimer()
+			t.OnStepChanged(1, 0, process.Proposing)
+			clock.Advance(30 * time.Second)
+			t.OnStepChanged(1, 1, process.Proposing)
+			clock.Advance(time.Second)
+			t.OnStepChanged(1, 1, process.Prevoting)
+			Expect(t.Duration(process.Proposing)).To(Equal(2 * time.Second))
+		})
+	})
+
+	Context("when the timeout is outside of the floor and ceiling", func() {
+		It("should clamp the timeout", func() {
+			opts = opts.WithMargin(0).WithMinTimeout(3 * time.Second).WithMaxTimeout(5 * time.Second)
+			t := newTimer()
+			completeHeight(t, 1, time.Millisecond)
+			Expect(t.Duration(process.Proposing)).To(Equal(3 * time.Second))
+			completeHeight(t, 2, time.Minute)
+			completeHeight(t, 3, time.Minute)
+			Expect(t.Duration(process.Proposing)).To(Equal(5 * time.Second))
+		})
+	})
+
+	Context("when timeouts are triggered", func() {
+		It("should emit the timeouts", func() {
+			t := newTimer()
+			t.TimeoutPropose(1, 0)
+			Eventually(clock.Waiting).Should(Equal(1))
+			clock.Advance(10 * time.Second)
+			Eventually(onTimeoutPropose).Should(Receive(Equal(timer.Timeout{Height: 1, Round: 0})))
+		})
+
+		It("should grow the timeout until the next commit", func() {
+			t := newTimer()
+			completeHeight(t, 1, time.Second)
+			Expect(t.Duration(process.Prevoting)).To(Equal(2 * time.Second))
+
+			// Time out the propose step, which must not be observed.
+			t.TimeoutPropose(2, 0)
+			Eventually(clock.Waiting).Should(Equal(1))
+			clock.Advance(2 * time.Second)
+			Eventually(onTimeoutPropose).Should(Receive(Equal(timer.Timeout{Height: 2, Round: 0})))
+			Eventually(func() time.Duration { return t.Duration(process.Prevoting) }).Should(Equal(4 * time.Second))
+
+			t.OnStepChanged(2, 0, process.Prevoting)
+			Expect(t.Duration(process.Proposing)).To(Equal(4 * time.Second))
+
+			// Moving to the next height resets the scaling.
+			clock.Advance(time.Second)
+			t.OnStepChanged(2, 0, process.Precommitting)
+			clock.Advance(time.Second)
+			t.OnStepChanged(3, 0, process.Proposing)
+			Expect(t.Duration(process.Proposing)).To(Equal(2 * time.Second))
+			Expect(t.Duration(process.Prevoting)).To(Equal(2 * time.Second))
+		})
+
+		It("should grow the timeout once for every round that times out", func() {
+			t := newTimer()
+			completeHeight(t, 1, time.Second)
+
+			// Time out the propose and prevote steps of the same round.
+			t.TimeoutPropose(2, 0)
+			Eventually(clock.Waiting).Should(Equal(1))
+			clock.Advance(2 * time.Second)
+			Eventually(onTimeoutPropose).Should(Receive(Equal(timer.Timeout{Height: 2, Round: 0})))
+			Eventually(func() time.Duration { return t.Duration(process.Prevoting) }).Should(Equal(4 * time.Second))
+
+			t.OnStepChanged(2, 0, process.Prevoting)
+			t.TimeoutPrevote(2, 0)
+			Eventually(clock.Waiting).Should(Equal(1))
+			clock.Advance(4 * time.Second)
+			Eventually(onTimeoutPrevote).Should(Receive(Equal(timer.Timeout{Height: 2, Round: 0})))
+			Consistently(func() time.Duration { return t.Duration(process.Prevoting) }).Should(Equal(4 * time.Second))
+
+			// Time out the next round.
+			t.OnStepChanged(2, 1, process.Proposing)
+			t.TimeoutPropose(2, 1)
+			Eventually(clock.Waiting).Should(Equal(1))
+			clock.Advance(4 * time.Second)
+			Eventually(onTimeoutPropose).Should(Receive(Equal(timer.Timeout{Height: 2, Round: 1})))
+			Eventually(func() time.Duration { return t.Duration(process.Prevoting) }).Should(Equal(6 * time.Second))
+		})
+	})
+})
@@ -0,0 +1,147 @@
+package timer
+
+import (
+	"sync"
+	"time"
+)
+
+// A Clock tells the time, and waits for time to pass. It is used by timers, so
+// that tests can control the passing of time instead of depending on the wall
+// clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a ClockTimer that fires once the duration has passed.
+	NewTimer(time.Duration) ClockTimer
+}
+
+// A ClockTimer fires once, by sending the time on its channel, unless it is
+// stopped first.
+type ClockTimer interface {
+	// C returns the channel on which the time is sent when the ClockTimer
+	// fires.
+	C() <-chan time.Time
+	// Stop the ClockTimer. It returns false if the ClockTimer has already
+	// fired, or has already been stopped.
+	Stop() bool
+}
+
+// realClock is a Clock that uses the wall clock.
+type realClock struct{}
+
+// NewRealClock returns a Clock that uses the wall clock.
+func NewRealClock() Clock {
+	return realClock{}
+}
+
+// Now returns the current wall clock time.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer returns a ClockTimer that fires once the duration has passed on the
+// wall clock.
+func (realClock) NewTimer(d time.Duration) ClockTimer {
+	return realTimer{timer: time.NewTimer(d)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// A ManualClock is a Clock that only moves forward when it is advanced. Its
+// ClockTimers fire as soon as the ManualClock has been advanced past their
+// duration. It is intended for testing, and is safe for concurrent use.
+type ManualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers map[*manualTimer]struct{}
+}
+
+// NewManualClock returns a ManualClock that starts at the given time.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{
+		now:    now,
+		timers: map[*manualTimer]struct{}{},
+	}
+}
+
+// Now returns the current time of the ManualClock.
+func (clock *ManualClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+// NewTimer returns a ClockTimer that fires once the ManualClock has been
+// advanced by the duration. If the duration is not positive, then it fires
+// immediately.
+func (clock *ManualClock) NewTimer(d time.Duration) ClockTimer {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	timer := &manualTimer{
+		clock: clock,
+		at:    clock.now.Add(d),
+		c:     make(chan time.Time, 1),
+	}
+	if d <= 0 {
+		timer.c <- clock.now
+		return timer
+	}
+	clock.timers[timer] = struct{}{}
+	return timer
+}
+
+// Advance the ManualClock by the duration, and fire all ClockTimers that are
+// due.
+func (clock *ManualClock) Advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+
+	clock.now = clock.now.Add(d)
+	for timer := range clock.timers {
+		if !timer.at.After(clock.now) {
+			timer.c <- clock.now
+			delete(clock.timers, timer)
+		}
+	}
+}
+
+// Waiting returns the number of ClockTimers that have not fired, and have not
+// been stopped. Tests can use it to wait until a goroutine is waiting for the
+// ManualClock to be advanced.
+func (clock *ManualClock) Waiting() int {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return len(clock.timers)
+}
+
+type manualTimer struct {
+	clock *ManualClock
+	at    time.Time
+	c     chan time.Time
+}
+
+func (t *manualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	if _, ok := t.clock.timers[t]; !ok {
+		return false
+	}
+	delete(t.clock.timers, t)
+	return true
+}
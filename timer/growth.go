@@ -0,0 +1,73 @@
+package timer
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/renproject/hyperdrive/process"
+)
+
+// Growth defines how a timeout grows with the timeout scaling factor, as the
+// Process fails to make progress.
+type Growth uint8
+
+const (
+	// LinearGrowth adds the timeout, multiplied by the timeout scaling factor,
+	// for every failure.
+	LinearGrowth = Growth(0)
+	// ExponentialGrowth multiplies the timeout by one plus the timeout scaling
+	// factor for every failure.
+	ExponentialGrowth = Growth(1)
+)
+
+// String implements the Stringer interface for the Growth type.
+func (growth Growth) String() string {
+	switch growth {
+	case LinearGrowth:
+		return "linear"
+	case ExponentialGrowth:
+		return "exponential"
+	default:
+		return fmt.Sprintf("growth(%d)", growth)
+	}
+}
+
+// baseTimeout returns the timeout of the step, before it has grown.
+func (opts Options) baseTimeout(step process.Step) time.Duration {
+	var timeout time.Duration
+	switch step {
+	case process.Proposing:
+		timeout = opts.ProposeTimeout
+	case process.Prevoting:
+		timeout = opts.PrevoteTimeout
+	case process.Precommitting:
+		timeout = opts.PrecommitTimeout
+	}
+	if timeout == 0 {
+		timeout = opts.Timeout
+	}
+	return timeout
+}
+
+// grow the timeout after the number of failures, and cap it at the largest
+// timeout.
+func (opts Options) grow(timeout time.Duration, failures int) time.Duration {
+	var grown time.Duration
+	switch opts.TimeoutGrowth {
+	case ExponentialGrowth:
+		exp := float64(timeout) * math.Pow(1+opts.TimeoutScaling, float64(failures))
+		if exp >= math.MaxInt64 {
+			exp = math.MaxInt64
+		}
+		grown = time.Duration(exp)
+	default:
+		// The scaling is deliberately truncated to a whole number before it
+		// is multiplied, to keep the schedule of the original Linear Timer.
+		grown = timeout + timeout*time.Duration(float64(failures)*opts.TimeoutScaling)
+	}
+	if opts.MaxTimeout > 0 && grown > opts.MaxTimeout {
+		return opts.MaxTimeout
+	}
+	return grown
+}
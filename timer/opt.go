@@ -12,13 +12,48 @@ const (
 
 	// DefaultTimeoutScaling is the timeout scaling factor set by default
 	DefaultTimeoutScaling = 0.5
+
+	// DefaultWindow is the number of recent heights over which an Adaptive
+	// Timer observes step durations set by default
+	DefaultWindow = 10
+
+	// DefaultPercentile is the percentile of observed step durations used by
+	// an Adaptive Timer set by default
+	DefaultPercentile = 0.9
+
+	// DefaultMargin is the margin added to observed step durations by an
+	// Adaptive Timer set by default
+	DefaultMargin = 500 * time.Millisecond
+
+	// DefaultMinTimeout is the smallest timeout of an Adaptive Timer set by
+	// default
+	DefaultMinTimeout = 1 * time.Second
+
+	// DefaultMaxTimeout is the largest timeout of a timer set by default. It
+	// does not affect the first rounds with the default timeout and scaling,
+	// but stops the timeout from growing without bound while the Process
+	// fails to make progress.
+	DefaultMaxTimeout = 10 * time.Minute
 )
 
-// Options represent the options for a Linear Timer
+// Options represent the options for a Linear Timer. The ProposeTimeout,
+// PrevoteTimeout, and PrecommitTimeout override the Timeout for their step
+// when they are not zero. The Window, Percentile, Margin, and MinTimeout are
+// only used by an Adaptive Timer.
 type Options struct {
-	Logger         *zap.Logger
-	Timeout        time.Duration
-	TimeoutScaling float64
+	Logger           *zap.Logger
+	Clock            Clock
+	Timeout          time.Duration
+	ProposeTimeout   time.Duration
+	PrevoteTimeout   time.Duration
+	PrecommitTimeout time.Duration
+	TimeoutScaling   float64
+	TimeoutGrowth    Growth
+	Window           int
+	Percentile       float64
+	Margin           time.Duration
+	MinTimeout       time.Duration
+	MaxTimeout       time.Duration
 }
 
 // DefaultOptions returns the default options for a Linear Timer
@@ -29,8 +64,15 @@ func DefaultOptions() Options {
 	}
 	return Options{
 		Logger:         logger,
+		Clock:          NewRealClock(),
 		Timeout:        DefaultTimeout,
 		TimeoutScaling: DefaultTimeoutScaling,
+		TimeoutGrowth:  LinearGrowth,
+		Window:         DefaultWindow,
+		Percentile:     DefaultPercentile,
+		Margin:         DefaultMargin,
+		MinTimeout:     DefaultMinTimeout,
+		MaxTimeout:     DefaultMaxTimeout,
 	}
 }
 
@@ -40,14 +82,83 @@ func (opts Options) WithLogger(logger *zap.Logger) Options {
 	return opts
 }
 
+// WithClock updates the Clock used by the Linear Timer to wait for timeouts.
+// By default, the wall clock is used.
+func (opts Options) WithClock(clock Clock) Options {
+	opts.Clock = clock
+	return opts
+}
+
 // WithTimeout updates the timeout of the Linear Timer
 func (opts Options) WithTimeout(timeout time.Duration) Options {
 	opts.Timeout = timeout
 	return opts
 }
 
+// WithProposeTimeout updates the timeout of the propose step, which is used
+// instead of the timeout in the options. It is zero by default.
+func (opts Options) WithProposeTimeout(timeout time.Duration) Options {
+	opts.ProposeTimeout = timeout
+	return opts
+}
+
+// WithPrevoteTimeout updates the timeout of the prevote step, which is used
+// instead of the timeout in the options. It is zero by default.
+func (opts Options) WithPrevoteTimeout(timeout time.Duration) Options {
+	opts.PrevoteTimeout = timeout
+	return opts
+}
+
+// WithPrecommitTimeout updates the timeout of the precommit step, which is
+// used instead of the timeout in the options. It is zero by default.
+func (opts Options) WithPrecommitTimeout(timeout time.Duration) Options {
+	opts.PrecommitTimeout = timeout
+	return opts
+}
+
 // WithTimeoutScaling updates the timeout scaling factor of the Linear Timer
 func (opts Options) WithTimeoutScaling(timeoutScaling float64) Options {
 	opts.TimeoutScaling = timeoutScaling
 	return opts
 }
+
+// WithTimeoutGrowth updates how the timeout grows with the timeout scaling
+// factor. By default, it grows linearly.
+func (opts Options) WithTimeoutGrowth(growth Growth) Options {
+	opts.TimeoutGrowth = growth
+	return opts
+}
+
+// WithWindow updates the number of recent heights over which the Adaptive
+// Timer observes step durations
+func (opts Options) WithWindow(window int) Options {
+	opts.Window = window
+	return opts
+}
+
+// WithPercentile updates the percentile of observed step durations used by the
+// Adaptive Timer. It must be greater than zero, and no greater than one.
+func (opts Options) WithPercentile(percentile float64) Options {
+	opts.Percentile = percentile
+	return opts
+}
+
+// WithMargin updates the margin added to observed step durations by the
+// Adaptive Timer
+func (opts Options) WithMargin(margin time.Duration) Options {
+	opts.Margin = margin
+	return opts
+}
+
+// WithMinTimeout updates the smallest timeout of the Adaptive Timer
+func (opts Options) WithMinTimeout(minTimeout time.Duration) Options {
+	opts.MinTimeout = minTimeout
+	return opts
+}
+
+// WithMaxTimeout updates the largest timeout of the timer, which caps the
+// growth of the timeout. When it is zero, the growth is not capped.
+func (opts Options) WithMaxTimeout(maxTimeout time.Duration) Options {
+	opts.MaxTimeout = maxTimeout
+	return opts
+}
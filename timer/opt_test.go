@@ -47,5 +47,66 @@ var _ = Describe("Timer Opts", func() {
 			}
 			Expect(quick.Check(loop, nil)).To(Succeed())
 		})
+
+		Specify("with timeouts for each step", func() {
+			loop := func() bool {
+				proposeTimeout := time.Duration(rand.Intn(100)) * time.Second
+				prevoteTimeout := time.Duration(rand.Intn(100)) * time.Second
+				precommitTimeout := time.Duration(rand.Intn(100)) * time.Second
+				opts := timer.DefaultOptions().
+					WithProposeTimeout(proposeTimeout).
+					WithPrevoteTimeout(prevoteTimeout).
+					WithPrecommitTimeout(precommitTimeout)
+				Expect(opts.ProposeTimeout).To(Equal(proposeTimeout))
+				Expect(opts.PrevoteTimeout).To(Equal(prevoteTimeout))
+				Expect(opts.PrecommitTimeout).To(Equal(precommitTimeout))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		Specify("with timeout growth", func() {
+			Expect(timer.DefaultOptions().TimeoutGrowth).To(Equal(timer.LinearGrowth))
+			opts := timer.DefaultOptions().WithTimeoutGrowth(timer.ExponentialGrowth)
+			Expect(opts.TimeoutGrowth).To(Equal(timer.ExponentialGrowth))
+			Expect(opts.TimeoutGrowth.String()).To(Equal("exponential"))
+		})
+	})
+
+	Context("Adaptive Timer", func() {
+		Specify("with default options", func() {
+			defaultOpts := timer.DefaultOptions()
+			Expect(defaultOpts.Window).To(Equal(10))
+			Expect(defaultOpts.Percentile).To(Equal(0.9))
+			Expect(defaultOpts.Margin).To(Equal(500 * time.Millisecond))
+			Expect(defaultOpts.MinTimeout).To(Equal(time.Second))
+			Expect(defaultOpts.MaxTimeout).To(Equal(10 * time.Minute))
+		})
+
+		Specify("with window, percentile, and margin", func() {
+			loop := func() bool {
+				window := rand.Intn(100)
+				percentile := rand.Float64()
+				margin := time.Duration(rand.Intn(100)) * time.Millisecond
+				opts := timer.DefaultOptions().WithWindow(window).WithPercentile(percentile).WithMargin(margin)
+				Expect(opts.Window).To(Equal(window))
+				Expect(opts.Percentile).To(Equal(percentile))
+				Expect(opts.Margin).To(Equal(margin))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
+
+		Specify("with floor and ceiling", func() {
+			loop := func() bool {
+				minTimeout := time.Duration(rand.Intn(100)) * time.Second
+				maxTimeout := minTimeout + time.Duration(rand.Intn(100))*time.Second
+				opts := timer.DefaultOptions().WithMinTimeout(minTimeout).WithMaxTimeout(maxTimeout)
+				Expect(opts.MinTimeout).To(Equal(minTimeout))
+				Expect(opts.MaxTimeout).To(Equal(maxTimeout))
+				return true
+			}
+			Expect(quick.Check(loop, nil)).To(Succeed())
+		})
 	})
 })
@@ -0,0 +1,219 @@
+package timer
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/renproject/hyperdrive/process"
+
+	"go.uber.org/zap"
+)
+
+// A timeoutQueue emits timeouts once they are due. Timeouts are kept in a
+// heap, and are emitted by a single goroutine that only runs while there are
+// timeouts waiting to be emitted. Scheduling a timeout cancels all timeouts for
+// earlier heights and rounds, because the Process only schedules timeouts for
+// its current height and round, and ignores timeouts for heights and rounds
+// that it has left. Once the timeoutQueue has been stopped, no more timeouts
+// are emitted. It is safe for concurrent use.
+type timeoutQueue struct {
+	clock              Clock
+	logger             *zap.Logger
+	onTimeoutPropose   chan<- Timeout
+	onTimeoutPrevote   chan<- Timeout
+	onTimeoutPrecommit chan<- Timeout
+
+	// emitted is called, if it is not nil, after every timeout that has been
+	// emitted.
+	emitted func(process.Step, Timeout)
+
+	// mu protects the timeouts that are waiting to be emitted, whether or not
+	// the goroutine that emits them is running, and whether or not the
+	// timeoutQueue has been stopped.
+	mu       sync.Mutex
+	timeouts timeoutHeap
+	running  bool
+	stopped  bool
+
+	// wake is signalled whenever a timeout is scheduled, so that the running
+	// goroutine can wait for it if it is earlier than the others. done is
+	// closed when the timeoutQueue is stopped, and exited is done once the
+	// running goroutine has returned.
+	wake     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	exited   sync.WaitGroup
+}
+
+func newTimeoutQueue(opts Options, onTimeoutPropose, onTimeoutPrevote, onTimeoutPrecommit chan<- Timeout) *timeoutQueue {
+	clock := opts.Clock
+	if clock == nil {
+		clock = NewRealClock()
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &timeoutQueue{
+		clock:              clock,
+		logger:             logger,
+		onTimeoutPropose:   onTimeoutPropose,
+		onTimeoutPrevote:   onTimeoutPrevote,
+		onTimeoutPrecommit: onTimeoutPrecommit,
+		wake:               make(chan struct{}, 1),
+		done:               make(chan struct{}),
+	}
+}
+
+// stop the timeoutQueue, drop all timeouts that have not been emitted, and
+// wait for the goroutine that emits timeouts to return.
+func (q *timeoutQueue) stop() {
+	q.mu.Lock()
+	q.stopped = true
+	q.timeouts = nil
+	q.mu.Unlock()
+
+	q.stopOnce.Do(func() { close(q.done) })
+	q.exited.Wait()
+}
+
+// schedule a timeout, to be emitted once the duration has passed, unless it is
+// cancelled or the timeoutQueue is stopped first.
+func (q *timeoutQueue) schedule(step process.Step, height process.Height, round process.Round, duration time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stopped {
+		return
+	}
+	q.logger.Debug("scheduled timeout",
+		zap.Int64("height", int64(height)),
+		zap.Int64("round", int64(round)),
+		zap.Stringer("step", step),
+		zap.Duration("duration", duration),
+	)
+	q.cancelBefore(height, round)
+	heap.Push(&q.timeouts, timeoutEntry{
+		step:    step,
+		timeout: Timeout{Height: height, Round: round},
+		at:      q.clock.Now().Add(duration),
+	})
+
+	if !q.running {
+		q.running = true
+		q.exited.Add(1)
+		go q.run()
+		return
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// cancelBefore removes all timeouts for earlier heights, and earlier rounds in
+// the same height. It must be called while holding the lock.
+func (q *timeoutQueue) cancelBefore(height process.Height, round process.Round) {
+	n := 0
+	for _, entry := range q.timeouts {
+		if entry.timeout.Height > height || (entry.timeout.Height == height && entry.timeout.Round >= round) {
+			q.timeouts[n] = entry
+			n++
+		}
+	}
+	if n == len(q.timeouts) {
+		return
+	}
+	for i := n; i < len(q.timeouts); i++ {
+		q.timeouts[i] = timeoutEntry{}
+	}
+	q.timeouts = q.timeouts[:n]
+	heap.Init(&q.timeouts)
+}
+
+// run emits timeouts, in order, until there are no more timeouts waiting to be
+// emitted, or the timeoutQueue is stopped.
+func (q *timeoutQueue) run() {
+	defer q.exited.Done()
+
+	for {
+		entry, wait, ok := q.next()
+		if !ok {
+			return
+		}
+		if wait > 0 {
+			timer := q.clock.NewTimer(wait)
+			select {
+			case <-timer.C():
+			case <-q.wake:
+			case <-q.done:
+			}
+			timer.Stop()
+			continue
+		}
+
+		var onTimeout chan<- Timeout
+		switch entry.step {
+		case process.Proposing:
+			onTimeout = q.onTimeoutPropose
+		case process.Prevoting:
+			onTimeout = q.onTimeoutPrevote
+		case process.Precommitting:
+			onTimeout = q.onTimeoutPrecommit
+		}
+		select {
+		case onTimeout <- entry.timeout:
+		case <-q.done:
+			return
+		}
+		if q.emitted != nil {
+			q.emitted(entry.step, entry.timeout)
+		}
+	}
+}
+
+// next returns the earliest timeout. If it is due, it is removed from the heap
+// and the wait is zero. Otherwise, the wait is the time until it is due. If
+// there are no timeouts, or the timeoutQueue has been stopped, then false is
+// returned and the goroutine that emits timeouts must return.
+func (q *timeoutQueue) next() (timeoutEntry, time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stopped || len(q.timeouts) == 0 {
+		q.running = false
+		return timeoutEntry{}, 0, false
+	}
+	if wait := q.timeouts[0].at.Sub(q.clock.Now()); wait > 0 {
+		return q.timeouts[0], wait, true
+	}
+	return heap.Pop(&q.timeouts).(timeoutEntry), 0, true
+}
+
+// A timeoutEntry is a timeout that is waiting to be emitted at a time.
+type timeoutEntry struct {
+	step    process.Step
+	timeout Timeout
+	at      time.Time
+}
+
+// A timeoutHeap is a min-heap of timeouts, ordered by the time at which they
+// must be emitted. It implements heap.Interface.
+type timeoutHeap []timeoutEntry
+
+func (h timeoutHeap) Len() int           { return len(h) }
+func (h timeoutHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h timeoutHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *timeoutHeap) Push(x interface{}) {
+	*h = append(*h, x.(timeoutEntry))
+}
+
+func (h *timeoutHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = timeoutEntry{}
+	*h = old[:n-1]
+	return entry
+}
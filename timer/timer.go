@@ -15,52 +15,54 @@ type Timeout struct {
 
 // LinearTimer defines a timer that implements a timing out functionality.
 // The timeouts for different contexts (Propose, Prevote and Precommit) are
-// emitted via separate channels. The timeout scales linearly with the
-// consensus round
+// emitted via separate channels. The timeout of each step grows with the
+// consensus round, linearly by default, up to the largest timeout in the
+// options.
+//
+// Timeouts are kept in a heap, and are emitted by a single goroutine that only
+// runs while there are timeouts waiting to be emitted. Scheduling a timeout
+// cancels all timeouts for earlier heights and rounds, because the Process
+// only schedules timeouts for its current height and round, and ignores
+// timeouts for heights and rounds that it has left. Once the LinearTimer has
+// been stopped, no more timeouts are emitted. It is safe for concurrent use.
 type LinearTimer struct {
-	opts               Options
-	onTimeoutPropose   chan<- Timeout
-	onTimeoutPrevote   chan<- Timeout
-	onTimeoutPrecommit chan<- Timeout
+	opts  Options
+	queue *timeoutQueue
 }
 
 // NewLinearTimer constructs a new Linear Timer from the input options and channels
-func NewLinearTimer(opts Options, onTimeoutPropose, onTimeoutPrevote, onTimeoutPrecommit chan<- Timeout) process.Timer {
+func NewLinearTimer(opts Options, onTimeoutPropose, onTimeoutPrevote, onTimeoutPrecommit chan<- Timeout) *LinearTimer {
 	return &LinearTimer{
-		opts:               opts,
-		onTimeoutPropose:   onTimeoutPropose,
-		onTimeoutPrevote:   onTimeoutPrevote,
-		onTimeoutPrecommit: onTimeoutPrecommit,
+		opts:  opts,
+		queue: newTimeoutQueue(opts, onTimeoutPropose, onTimeoutPrevote, onTimeoutPrecommit),
 	}
 }
 
 // TimeoutPropose schedules a propose timeout with a timeout period appropriately
 // calculated for the consensus height and round
 func (t *LinearTimer) TimeoutPropose(height process.Height, round process.Round) {
-	go func() {
-		time.Sleep(t.timeoutDuration(height, round))
-		t.onTimeoutPropose <- Timeout{Height: height, Round: round}
-	}()
+	t.queue.schedule(process.Proposing, height, round, t.timeoutDuration(process.Proposing, round))
 }
 
 // TimeoutPrevote schedules a prevote timeout with a timeout period appropriately
 // calculated for the consensus height and round
 func (t *LinearTimer) TimeoutPrevote(height process.Height, round process.Round) {
-	go func() {
-		time.Sleep(t.timeoutDuration(height, round))
-		t.onTimeoutPrevote <- Timeout{Height: height, Round: round}
-	}()
+	t.queue.schedule(process.Prevoting, height, round, t.timeoutDuration(process.Prevoting, round))
 }
 
 // TimeoutPrecommit schedules a precommit timeout with a timeout period appropriately
 // calculated for the consensus height and round
 func (t *LinearTimer) TimeoutPrecommit(height process.Height, round process.Round) {
-	go func() {
-		time.Sleep(t.timeoutDuration(height, round))
-		t.onTimeoutPrecommit <- Timeout{Height: height, Round: round}
-	}()
+	t.queue.schedule(process.Precommitting, height, round, t.timeoutDuration(process.Precommitting, round))
 }
 
-func (t *LinearTimer) timeoutDuration(height process.Height, round process.Round) time.Duration {
-	return t.opts.Timeout + t.opts.Timeout*time.Duration(float64(round)*t.opts.TimeoutScaling)
+// Stop the LinearTimer, drop all timeouts that have not been emitted, and wait
+// for the goroutine that emits timeouts to return. Timeouts that are scheduled
+// after the LinearTimer has been stopped are ignored.
+func (t *LinearTimer) Stop() {
+	t.queue.stop()
+}
+
+func (t *LinearTimer) timeoutDuration(step process.Step, round process.Round) time.Duration {
+	return t.opts.grow(t.opts.baseTimeout(step), int(round))
 }
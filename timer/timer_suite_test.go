@@ -2,6 +2,7 @@ package timer_test
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -9,5 +10,9 @@ import (
 
 func TestTimer(t *testing.T) {
 	RegisterFailHandler(Fail)
+
+	// Timeouts are emitted as soon as the manual clock is advanced, so they
+	// can be polled for often.
+	SetDefaultEventuallyPollingInterval(time.Millisecond)
 	RunSpecs(t, "Timer Suite")
 }
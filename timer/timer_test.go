@@ -2,6 +2,7 @@ package timer_test
 
 import (
 	"math/rand"
+	"runtime"
 	"testing/quick"
 	"time"
 
@@ -16,6 +17,32 @@ import (
 var _ = Describe("Timer", func() {
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 
+	Context("Manual clock", func() {
+		Specify("timers should fire once the clock has been advanced past their duration", func() {
+			now := time.Now()
+			clock := timer.NewManualClock(now)
+			first := clock.NewTimer(time.Second)
+			second := clock.NewTimer(2 * time.Second)
+			stopped := clock.NewTimer(time.Second)
+			Expect(clock.NewTimer(0).C()).To(Receive(Equal(now)))
+			Expect(clock.Waiting()).To(Equal(3))
+
+			Expect(stopped.Stop()).To(BeTrue())
+			Expect(stopped.Stop()).To(BeFalse())
+			clock.Advance(time.Second)
+			Expect(clock.Now()).To(Equal(now.Add(time.Second)))
+			Expect(first.C()).To(Receive(Equal(now.Add(time.Second))))
+			Expect(first.Stop()).To(BeFalse())
+			Expect(second.C()).ToNot(Receive())
+			Expect(stopped.C()).ToNot(Receive())
+			Expect(clock.Waiting()).To(Equal(1))
+
+			clock.Advance(time.Second)
+			Expect(second.C()).To(Receive(Equal(now.Add(2 * time.Second))))
+			Expect(clock.Waiting()).To(Equal(0))
+		})
+	})
+
 	Context("Timer", func() {
 		Context("without a timeout scaling factor", func() {
 			Specify("on timeout propose", func() {
@@ -23,7 +50,9 @@ var _ = Describe("Timer", func() {
 					// 5 millisecond <= timeout <= 20 millisecond
 					timeout := time.Duration(5+r.Intn(16)) * time.Millisecond
 					timeoutScaling := 0.0
+					clock := timer.NewManualClock(time.Now())
 					opts := timer.DefaultOptions().
+						WithClock(clock).
 						WithTimeout(timeout).
 						WithTimeoutScaling(timeoutScaling)
 					onProposeTimeoutChan := make(chan timer.Timeout, 1)
@@ -37,8 +66,9 @@ var _ = Describe("Timer", func() {
 
 					constantTimer.TimeoutPropose(height, round)
 
-					// message will be received at least by that time
-					time.Sleep(timeout - (10 * time.Millisecond))
+					// message will not be received before the timeout has passed
+					Eventually(clock.Waiting).Should(Equal(1))
+					clock.Advance(timeout - 1)
 					select {
 					case _ = <-onProposeTimeoutChan:
 						// the channel is empty, so should not reach here
@@ -47,16 +77,9 @@ var _ = Describe("Timer", func() {
 						Expect(true).To(BeTrue())
 					}
 
-					// message will be received at least by that time
-					time.Sleep(20 * time.Millisecond)
-					select {
-					case timeoutFor := <-onProposeTimeoutChan:
-						Expect(timeoutFor.Height).To(Equal(height))
-						Expect(timeoutFor.Round).To(Equal(round))
-					default:
-						// this should not happen
-						Expect(true).ToNot(BeTrue())
-					}
+					// message will be received once the timeout has passed
+					clock.Advance(1)
+					Eventually(onProposeTimeoutChan).Should(Receive(Equal(timer.Timeout{Height: height, Round: round})))
 
 					// no other channel should have received any message
 					select {
@@ -78,7 +101,9 @@ var _ = Describe("Timer", func() {
 					// 5 millisecond <= timeout <= 20 millisecond
 					timeout := time.Duration(5+r.Intn(16)) * time.Millisecond
 					timeoutScaling := 0.0
+					clock := timer.NewManualClock(time.Now())
 					opts := timer.DefaultOptions().
+						WithClock(clock).
 						WithTimeout(timeout).
 						WithTimeoutScaling(timeoutScaling)
 					onProposeTimeoutChan := make(chan timer.Timeout, 1)
@@ -92,8 +117,9 @@ var _ = Describe("Timer", func() {
 
 					constantTimer.TimeoutPrevote(height, round)
 
-					// message will be received at least by that time
-					time.Sleep(timeout - (10 * time.Millisecond))
+					// message will not be received before the timeout has passed
+					Eventually(clock.Waiting).Should(Equal(1))
+					clock.Advance(timeout - 1)
 					select {
 					case _ = <-onPrevoteTimeoutChan:
 						// the channel is empty, so should not reach here
@@ -102,16 +128,9 @@ var _ = Describe("Timer", func() {
 						Expect(true).To(BeTrue())
 					}
 
-					// message will be received at least by that time
-					time.Sleep(20 * time.Millisecond)
-					select {
-					case timeoutFor := <-onPrevoteTimeoutChan:
-						Expect(timeoutFor.Height).To(Equal(height))
-						Expect(timeoutFor.Round).To(Equal(round))
-					default:
-						// this should not happen
-						Expect(true).ToNot(BeTrue())
-					}
+					// message will be received once the timeout has passed
+					clock.Advance(1)
+					Eventually(onPrevoteTimeoutChan).Should(Receive(Equal(timer.Timeout{Height: height, Round: round})))
 
 					// no other channel should have received any message
 					select {
@@ -133,7 +152,9 @@ var _ = Describe("Timer", func() {
 					// 5 millisecond <= timeout <= 20 millisecond
 					timeout := time.Duration(5+r.Intn(16)) * time.Millisecond
 					timeoutScaling := 0.0
+					clock := timer.NewManualClock(time.Now())
 					opts := timer.DefaultOptions().
+						WithClock(clock).
 						WithTimeout(timeout).
 						WithTimeoutScaling(timeoutScaling)
 					onProposeTimeoutChan := make(chan timer.Timeout, 1)
@@ -147,8 +168,9 @@ var _ = Describe("Timer", func() {
 
 					constantTimer.TimeoutPrecommit(height, round)
 
-					// message will be received at least by that time
-					time.Sleep(timeout - (10 * time.Millisecond))
+					// message will not be received before the timeout has passed
+					Eventually(clock.Waiting).Should(Equal(1))
+					clock.Advance(timeout - 1)
 					select {
 					case _ = <-onPrecommitTimeoutChan:
 						// the channel is empty, so should not reach here
@@ -157,16 +179,9 @@ var _ = Describe("Timer", func() {
 						Expect(true).To(BeTrue())
 					}
 
-					// message will be received at least by that time
-					time.Sleep(20 * time.Millisecond)
-					select {
-					case timeoutFor := <-onPrecommitTimeoutChan:
-						Expect(timeoutFor.Height).To(Equal(height))
-						Expect(timeoutFor.Round).To(Equal(round))
-					default:
-						// this should not happen
-						Expect(true).ToNot(BeTrue())
-					}
+					// message will be received once the timeout has passed
+					clock.Advance(1)
+					Eventually(onPrecommitTimeoutChan).Should(Receive(Equal(timer.Timeout{Height: height, Round: round})))
 
 					// no other channel should have received any message
 					select {
@@ -189,7 +204,9 @@ var _ = Describe("Timer", func() {
 				loop := func() bool {
 					timeout := 5 * time.Millisecond
 					timeoutScaling := r.Float64() / 2.0
+					clock := timer.NewManualClock(time.Now())
 					opts := timer.DefaultOptions().
+						WithClock(clock).
 						WithTimeout(timeout).
 						WithTimeoutScaling(timeoutScaling)
 					onProposeTimeoutChan := make(chan timer.Timeout, 1)
@@ -206,7 +223,8 @@ var _ = Describe("Timer", func() {
 					constantTimer.TimeoutPropose(height, round)
 
 					// message will not be received by that time
-					time.Sleep(expectedTimeout - (10 * time.Millisecond))
+					Eventually(clock.Waiting).Should(Equal(1))
+					clock.Advance(expectedTimeout - 1)
 					select {
 					case _ = <-onProposeTimeoutChan:
 						// the channel is empty, so should not reach here
@@ -215,16 +233,9 @@ var _ = Describe("Timer", func() {
 						Expect(true).To(BeTrue())
 					}
 
-					// message will be received at least by that time
-					time.Sleep(20 * time.Millisecond)
-					select {
-					case timeoutFor := <-onProposeTimeoutChan:
-						Expect(timeoutFor.Height).To(Equal(height))
-						Expect(timeoutFor.Round).To(Equal(round))
-					default:
-						// this should not happen
-						Expect(true).ToNot(BeTrue())
-					}
+					// message will be received once the timeout has passed
+					clock.Advance(1)
+					Eventually(onProposeTimeoutChan).Should(Receive(Equal(timer.Timeout{Height: height, Round: round})))
 
 					// no other channel should have received any message
 					select {
@@ -245,7 +256,9 @@ var _ = Describe("Timer", func() {
 				loop := func() bool {
 					timeout := 5 * time.Millisecond
 					timeoutScaling := r.Float64() / 2.0
+					clock := timer.NewManualClock(time.Now())
 					opts := timer.DefaultOptions().
+						WithClock(clock).
 						WithTimeout(timeout).
 						WithTimeoutScaling(timeoutScaling)
 					onProposeTimeoutChan := make(chan timer.Timeout, 1)
@@ -262,7 +275,8 @@ var _ = Describe("Timer", func() {
 					constantTimer.TimeoutPrevote(height, round)
 
 					// message will not be received by that time
-					time.Sleep(expectedTimeout - (10 * time.Millisecond))
+					Eventually(clock.Waiting).Should(Equal(1))
+					clock.Advance(expectedTimeout - 1)
 					select {
 					case _ = <-onPrevoteTimeoutChan:
 						// the channel is empty, so should not reach here
@@ -271,16 +285,9 @@ var _ = Describe("Timer", func() {
 						Expect(true).To(BeTrue())
 					}
 
-					// message will be received at least by that time
-					time.Sleep(20 * time.Millisecond)
-					select {
-					case timeoutFor := <-onPrevoteTimeoutChan:
-						Expect(timeoutFor.Height).To(Equal(height))
-						Expect(timeoutFor.Round).To(Equal(round))
-					default:
-						// this should not happen
-						Expect(true).ToNot(BeTrue())
-					}
+					// message will be received once the timeout has passed
+					clock.Advance(1)
+					Eventually(onPrevoteTimeoutChan).Should(Receive(Equal(timer.Timeout{Height: height, Round: round})))
 
 					// no other channel should have received any message
 					select {
@@ -301,7 +308,9 @@ var _ = Describe("Timer", func() {
 				loop := func() bool {
 					timeout := 5 * time.Millisecond
 					timeoutScaling := r.Float64() / 2.0
+					clock := timer.NewManualClock(time.Now())
 					opts := timer.DefaultOptions().
+						WithClock(clock).
 						WithTimeout(timeout).
 						WithTimeoutScaling(timeoutScaling)
 					onProposeTimeoutChan := make(chan timer.Timeout, 1)
@@ -318,7 +327,8 @@ var _ = Describe("Timer", func() {
 					constantTimer.TimeoutPrecommit(height, round)
 
 					// message will not be received by that time
-					time.Sleep(expectedTimeout - (10 * time.Millisecond))
+					Eventually(clock.Waiting).Should(Equal(1))
+					clock.Advance(expectedTimeout - 1)
 					select {
 					case _ = <-onPrecommitTimeoutChan:
 						// the channel is empty, so should not reach here
@@ -327,16 +337,9 @@ var _ = Describe("Timer", func() {
 						Expect(true).To(BeTrue())
 					}
 
-					// message will be received at least by that time
-					time.Sleep(20 * time.Millisecond)
-					select {
-					case timeoutFor := <-onPrecommitTimeoutChan:
-						Expect(timeoutFor.Height).To(Equal(height))
-						Expect(timeoutFor.Round).To(Equal(round))
-					default:
-						// this should not happen
-						Expect(true).ToNot(BeTrue())
-					}
+					// message will be received once the timeout has passed
+					clock.Advance(1)
+					Eventually(onPrecommitTimeoutChan).Should(Receive(Equal(timer.Timeout{Height: height, Round: round})))
 
 					// no other channel should have received any message
 					select {
@@ -353,5 +356,172 @@ var _ = Describe("Timer", func() {
 				Expect(quick.Check(loop, nil)).To(Succeed())
 			})
 		})
+
+		Context("when stopped", func() {
+			Specify("no timeouts should be emitted", func() {
+				clock := timer.NewManualClock(time.Now())
+				opts := timer.DefaultOptions().WithClock(clock).WithTimeout(10 * time.Millisecond)
+				onTimeoutChan := make(chan timer.Timeout, 3)
+				linearTimer := timer.NewLinearTimer(opts, onTimeoutChan, onTimeoutChan, onTimeoutChan)
+
+				// timeouts that are in flight are dropped
+				linearTimer.TimeoutPropose(1, 0)
+				linearTimer.TimeoutPrevote(1, 0)
+				Eventually(clock.Waiting).Should(Equal(1))
+				linearTimer.Stop()
+				Expect(clock.Waiting()).To(Equal(0))
+
+				// timeouts that are scheduled after stopping are ignored
+				linearTimer.TimeoutPrecommit(1, 0)
+				clock.Advance(time.Hour)
+				Consistently(onTimeoutChan).ShouldNot(Receive())
+			})
+
+			Specify("timeouts that cannot be emitted should be dropped", func() {
+				clock := timer.NewManualClock(time.Now())
+				opts := timer.DefaultOptions().WithClock(clock).WithTimeout(time.Millisecond)
+				onTimeoutChan := make(chan timer.Timeout)
+				linearTimer := timer.NewLinearTimer(opts, onTimeoutChan, onTimeoutChan, onTimeoutChan)
+
+				// nothing receives the timeout, so it waits to be emitted until
+				// the timer is stopped
+				linearTimer.TimeoutPropose(1, 0)
+				Eventually(clock.Waiting).Should(Equal(1))
+				clock.Advance(time.Millisecond)
+				Eventually(clock.Waiting).Should(Equal(0))
+
+				stopped := make(chan struct{})
+				go func() {
+					defer close(stopped)
+					linearTimer.Stop()
+				}()
+				Eventually(stopped).Should(BeClosed())
+				Expect(onTimeoutChan).ToNot(Receive())
+			})
+		})
+
+		Context("with timeouts for each step", func() {
+			Specify("each step should use its own timeout", func() {
+				clock := timer.NewManualClock(time.Now())
+				opts := timer.DefaultOptions().
+					WithClock(clock).
+					WithTimeout(20 * time.Millisecond).
+					WithProposeTimeout(30 * time.Millisecond).
+					WithPrevoteTimeout(10 * time.Millisecond)
+				onProposeTimeoutChan := make(chan timer.Timeout, 1)
+				onPrevoteTimeoutChan := make(chan timer.Timeout, 1)
+				onPrecommitTimeoutChan := make(chan timer.Timeout, 1)
+				linearTimer := timer.NewLinearTimer(opts, onProposeTimeoutChan, onPrevoteTimeoutChan, onPrecommitTimeoutChan)
+				defer linearTimer.Stop()
+
+				linearTimer.TimeoutPropose(1, 0)
+				linearTimer.TimeoutPrevote(1, 0)
+				linearTimer.TimeoutPrecommit(1, 0)
+
+				// the precommit step has no timeout of its own, so it uses
+				// the timeout in the options
+				Eventually(clock.Waiting).Should(Equal(1))
+				clock.Advance(10 * time.Millisecond)
+				Eventually(onPrevoteTimeoutChan).Should(Receive(Equal(timer.Timeout{Height: 1, Round: 0})))
+				Eventually(clock.Waiting).Should(Equal(1))
+				clock.Advance(10 * time.Millisecond)
+				Eventually(onPrecommitTimeoutChan).Should(Receive(Equal(timer.Timeout{Height: 1, Round: 0})))
+				Expect(onProposeTimeoutChan).ToNot(Receive())
+				Eventually(clock.Waiting).Should(Equal(1))
+				clock.Advance(10 * time.Millisecond)
+				Eventually(onProposeTimeoutChan).Should(Receive(Equal(timer.Timeout{Height: 1, Round: 0})))
+			})
+		})
+
+		Context("with exponential growth", func() {
+			Specify("the timeout should grow exponentially with round, up to the largest timeout", func() {
+				clock := timer.NewManualClock(time.Now())
+				opts := timer.DefaultOptions().
+					WithClock(clock).
+					WithTimeout(10 * time.Millisecond).
+					WithTimeoutScaling(1).
+					WithTimeoutGrowth(timer.ExponentialGrowth).
+					WithMaxTimeout(50 * time.Millisecond)
+				onProposeTimeoutChan := make(chan timer.Timeout, 1)
+				linearTimer := timer.NewLinearTimer(opts, onProposeTimeoutChan, nil, nil)
+				defer linearTimer.Stop()
+
+				expectedTimeouts := []time.Duration{
+					10 * time.Millisecond,
+					20 * time.Millisecond,
+					40 * time.Millisecond,
+					50 * time.Millisecond,
+					50 * time.Millisecond,
+				}
+				for round, expectedTimeout := range expectedTimeouts {
+					linearTimer.TimeoutPropose(1, process.Round(round))
+
+					// message will not be received by that time
+					Eventually(clock.Waiting).Should(Equal(1))
+					clock.Advance(expectedTimeout - 1)
+					Expect(onProposeTimeoutChan).ToNot(Receive())
+
+					// message will be received once the timeout has passed
+					clock.Advance(1)
+					Eventually(onProposeTimeoutChan).Should(Receive(Equal(timer.Timeout{Height: 1, Round: process.Round(round)})))
+				}
+			})
+		})
+
+		Context("when scheduling timeouts for later heights and rounds", func() {
+			Specify("timeouts for earlier heights and rounds should be cancelled", func() {
+				clock := timer.NewManualClock(time.Now())
+				opts := timer.DefaultOptions().WithClock(clock).WithTimeout(10 * time.Millisecond).WithTimeoutScaling(0)
+				onProposeTimeoutChan := make(chan timer.Timeout, 10)
+				onPrevoteTimeoutChan := make(chan timer.Timeout, 10)
+				onPrecommitTimeoutChan := make(chan timer.Timeout, 10)
+				linearTimer := timer.NewLinearTimer(opts, onProposeTimeoutChan, onPrevoteTimeoutChan, onPrecommitTimeoutChan)
+				defer linearTimer.Stop()
+
+				linearTimer.TimeoutPropose(1, 0)
+				linearTimer.TimeoutPrevote(1, 1)
+				linearTimer.TimeoutPropose(2, 0)
+				linearTimer.TimeoutPrevote(2, 0)
+				linearTimer.TimeoutPrecommit(2, 0)
+
+				// only the timeouts for the latest height and round are emitted
+				Eventually(clock.Waiting).Should(Equal(1))
+				clock.Advance(time.Hour)
+				Eventually(onProposeTimeoutChan).Should(Receive(Equal(timer.Timeout{Height: 2, Round: 0})))
+				Eventually(onPrevoteTimeoutChan).Should(Receive(Equal(timer.Timeout{Height: 2, Round: 0})))
+				Eventually(onPrecommitTimeoutChan).Should(Receive(Equal(timer.Timeout{Height: 2, Round: 0})))
+				Consistently(onProposeTimeoutChan).ShouldNot(Receive())
+				Expect(onPrevoteTimeoutChan).ToNot(Receive())
+				Expect(onPrecommitTimeoutChan).ToNot(Receive())
+			})
+
+			Specify("timeouts should be emitted in order by a single goroutine", func() {
+				clock := timer.NewManualClock(time.Now())
+				opts := timer.DefaultOptions().WithClock(clock).WithTimeout(10 * time.Millisecond).WithTimeoutScaling(1)
+				onTimeoutChan := make(chan timer.Timeout, 100)
+				linearTimer := timer.NewLinearTimer(opts, onTimeoutChan, onTimeoutChan, onTimeoutChan)
+				defer linearTimer.Stop()
+
+				// the timeouts are scheduled in reverse order of their
+				// periods, which grow with the round
+				goroutines := runtime.NumGoroutine()
+				for round := process.Round(0); round < 5; round++ {
+					linearTimer.TimeoutPrecommit(process.Height(5-round), round)
+				}
+				Expect(runtime.NumGoroutine()).To(BeNumerically("<=", goroutines+1))
+
+				// exactly one timeout is emitted every time that the clock is
+				// advanced by the timeout
+				for round := process.Round(0); round < 5; round++ {
+					Eventually(clock.Waiting).Should(Equal(1))
+					clock.Advance(10 * time.Millisecond)
+					Eventually(onTimeoutChan).Should(Receive(Equal(timer.Timeout{Height: process.Height(5 - round), Round: round})))
+					Expect(onTimeoutChan).ToNot(Receive())
+				}
+
+				// the goroutine returns once all timeouts have been emitted
+				Eventually(runtime.NumGoroutine).Should(BeNumerically("<=", goroutines))
+			})
+		})
 	})
 })
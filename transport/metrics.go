@@ -0,0 +1,19 @@
+package transport
+
+import (
+	"github.com/renproject/hyperdrive/metrics"
+)
+
+// Metrics of a Transport: the number of messages that have been dropped for
+// every peer (including the Transport itself), because the queue of the peer
+// was full.
+type Metrics struct {
+	Dropped *metrics.CounterVec
+}
+
+// NewMetrics registers the Metrics of a Transport with the Registry.
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		Dropped: reg.NewCounterVec("hyperdrive_transport_dropped_total", "Number of messages dropped because the queue of their peer was full.", "peer"),
+	}
+}
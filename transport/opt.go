@@ -0,0 +1,130 @@
+package transport
+
+import (
+	"time"
+
+	"github.com/renproject/id"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultQueueCapacity is the number of messages that can be queued for
+	// each peer, and for the Transport itself, set by default
+	DefaultQueueCapacity = 1000
+
+	// DefaultDialTimeout is the timeout for connecting to a peer set by
+	// default
+	DefaultDialTimeout = 5 * time.Second
+
+	// DefaultHandshakeTimeout is the timeout for authenticating a connection
+	// set by default
+	DefaultHandshakeTimeout = 5 * time.Second
+
+	// DefaultRedialInterval is the time between attempts to connect to a peer
+	// set by default
+	DefaultRedialInterval = time.Second
+
+	// DefaultWriteTimeout is the timeout for writing a message to a peer set
+	// by default
+	DefaultWriteTimeout = 5 * time.Second
+
+	// DefaultMaxMessageSize is the maximum size of a message in bytes set by
+	// default. It is large enough for Proposes with the default maximum
+	// payload size of a Replica.
+	DefaultMaxMessageSize = 4 * 1024 * 1024
+)
+
+// Options represent the options for a Transport
+type Options struct {
+	Logger           *zap.Logger
+	PrivKey          *id.PrivKey
+	QueueCapacity    int
+	DialTimeout      time.Duration
+	HandshakeTimeout time.Duration
+	RedialInterval   time.Duration
+	WriteTimeout     time.Duration
+	MaxMessageSize   int
+	Metrics          *Metrics
+}
+
+// DefaultOptions returns the default options for a Transport. There is no
+// default private key, so one must be provided using WithPrivKey.
+func DefaultOptions() Options {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		panic(err)
+	}
+	return Options{
+		Logger:           logger,
+		QueueCapacity:    DefaultQueueCapacity,
+		DialTimeout:      DefaultDialTimeout,
+		HandshakeTimeout: DefaultHandshakeTimeout,
+		RedialInterval:   DefaultRedialInterval,
+		WriteTimeout:     DefaultWriteTimeout,
+		MaxMessageSize:   DefaultMaxMessageSize,
+	}
+}
+
+// WithLogger updates the logger used in the Transport
+func (opts Options) WithLogger(logger *zap.Logger) Options {
+	opts.Logger = logger
+	return opts
+}
+
+// WithPrivKey updates the private key used to authenticate the Transport to
+// its peers
+func (opts Options) WithPrivKey(privKey *id.PrivKey) Options {
+	opts.PrivKey = privKey
+	return opts
+}
+
+// WithQueueCapacity updates the number of messages that can be queued for each
+// peer, and for the Transport itself. Once the queue for a peer is full, new
+// messages for that peer are dropped (and logged, and counted in the Metrics)
+// until the queue has been drained, so that a slow peer never blocks the
+// Replica.
+func (opts Options) WithQueueCapacity(capacity int) Options {
+	opts.QueueCapacity = capacity
+	return opts
+}
+
+// WithDialTimeout updates the timeout for connecting to a peer
+func (opts Options) WithDialTimeout(timeout time.Duration) Options {
+	opts.DialTimeout = timeout
+	return opts
+}
+
+// WithHandshakeTimeout updates the timeout for authenticating a connection.
+// Connections that are not authenticated in time are closed.
+func (opts Options) WithHandshakeTimeout(timeout time.Duration) Options {
+	opts.HandshakeTimeout = timeout
+	return opts
+}
+
+// WithRedialInterval updates the time between attempts to connect to a peer
+func (opts Options) WithRedialInterval(interval time.Duration) Options {
+	opts.RedialInterval = interval
+	return opts
+}
+
+// WithWriteTimeout updates the timeout for writing a message to a peer. If the
+// timeout is reached, then the connection is closed and opened again.
+func (opts Options) WithWriteTimeout(timeout time.Duration) Options {
+	opts.WriteTimeout = timeout
+	return opts
+}
+
+// WithMaxMessageSize updates the maximum size of a message in bytes. Peers that
+// send larger messages are disconnected.
+func (opts Options) WithMaxMessageSize(size int) Options {
+	opts.MaxMessageSize = size
+	return opts
+}
+
+// WithMetrics updates the Metrics of the Transport. By default, there are no
+// Metrics.
+func (opts Options) WithMetrics(metrics *Metrics) Options {
+	opts.Metrics = metrics
+	return opts
+}
@@ -0,0 +1,596 @@
+// Package transport sends messages between Replicas over TCP. A Transport is a
+// Broadcaster that can be given to a Replica, and it delivers the messages
+// that it receives from its peers to a Receiver (usually the same Replica). It
+// is also a Syncer and a Resender, so that Replicas can catch up with each
+// other.
+//
+// Every connection begins with a handshake that authenticates the peer that
+// opened it: the accepting Transport sends a random 32 byte challenge, and the
+// peer answers with its 32 byte signatory and the 65 byte signature of the
+// hash of the challenge and the signatory of the accepting Transport. Requests
+// for CommitCertificates and messages are only accepted from the signatory
+// that was authenticated, so that a peer cannot ask for responses to be sent
+// to another peer.
+//
+// After the handshake, every message is written as a frame: a 4 byte
+// big-endian length, followed by a 1 byte kind, followed by the surge
+// marshaled message. The length includes the kind.
+//
+// Messages are dropped (and logged, and counted in the Metrics) when a peer is
+// too slow to keep up, or offline for too long, and when the Receiver is too
+// slow to keep up with this Transport, so Replicas that use a Transport must be
+// given a resend interval (see replica.Options.WithResendInterval) to make
+// sure that their messages are eventually delivered.
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/id"
+	"github.com/renproject/surge"
+
+	"go.uber.org/zap"
+)
+
+// A Receiver receives the messages that are sent to a Transport. It is
+// implemented by the Replica.
+type Receiver interface {
+	Propose(context.Context, process.Propose)
+	Prevote(context.Context, process.Prevote)
+	Precommit(context.Context, process.Precommit)
+	SyncRequest(context.Context, id.Signatory, process.Height)
+	SyncCommitCertificate(context.Context, process.CommitCertificate)
+	RoundRequest(context.Context, id.Signatory, process.Height, process.Round)
+}
+
+// Enumerate the kinds of messages that can be sent by a Transport.
+const (
+	kindPropose           = byte(1)
+	kindPrevote           = byte(2)
+	kindPrecommit         = byte(3)
+	kindSyncRequest       = byte(4)
+	kindCommitCertificate = byte(5)
+	kindRoundRequest      = byte(6)
+)
+
+// A Transport sends messages to its peers over TCP. Every peer has its own
+// queue and connection, so a slow or offline peer does not delay messages to
+// other peers. Connections are opened again whenever they fail. Messages that
+// are broadcast are also delivered to this Transport, without using the
+// network.
+type Transport struct {
+	opts   Options
+	whoami id.Signatory
+	peers  map[id.Signatory]string
+	queues map[id.Signatory]chan []byte
+
+	// loopback are the frames that are waiting to be delivered to this
+	// Transport, and onLoopback is signalled whenever one is added. At most
+	// the queue capacity of frames are kept, and other frames are dropped.
+	loopbackMu sync.Mutex
+	loopback   [][]byte
+	onLoopback chan struct{}
+}
+
+// New returns a Transport for the given identity. The options must contain the
+// private key of the identity, because it is used to authenticate the
+// Transport to its peers. The peers map the signatory of every peer to its TCP
+// address. The address of the identity itself is ignored, if it is present.
+//
+// Messages can be dropped, so a Replica that uses the Transport must have a
+// resend interval (see replica.Options.WithResendInterval), and should use the
+// Transport as its Syncer and Resender.
+func New(opts Options, whoami id.Signatory, peers map[id.Signatory]string) *Transport {
+	if opts.PrivKey == nil {
+		panic("private key not set")
+	}
+	if signatory := opts.PrivKey.Signatory(); !signatory.Equal(&whoami) {
+		panic(fmt.Errorf("private key does not match identity: expected %v, got %v", whoami, signatory))
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+	queues := make(map[id.Signatory]chan []byte, len(peers))
+	for peer := range peers {
+		if peer.Equal(&whoami) {
+			continue
+		}
+		queues[peer] = make(chan []byte, opts.QueueCapacity)
+	}
+	return &Transport{
+		opts:       opts,
+		whoami:     whoami,
+		peers:      peers,
+		queues:     queues,
+		onLoopback: make(chan struct{}, 1),
+	}
+}
+
+// Run the Transport until the context is done. Connections from peers are
+// accepted using the listener, and all messages are delivered to the Receiver.
+// The listener, and all connections, are closed before Run returns.
+func (t *Transport) Run(ctx context.Context, listener net.Listener, receiver Receiver) {
+	wg := new(sync.WaitGroup)
+	defer wg.Wait()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	// Messages to this Transport are delivered directly.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.onLoopback:
+				t.loopbackMu.Lock()
+				frames := t.loopback
+				t.loopback = nil
+				t.loopbackMu.Unlock()
+				for _, frame := range frames {
+					t.deliver(ctx, receiver, t.whoami, frame[4], frame[5:])
+				}
+			}
+		}
+	}()
+
+	for peer, addr := range t.peers {
+		if peer.Equal(&t.whoami) {
+			continue
+		}
+		wg.Add(1)
+		go func(peer id.Signatory, addr string, queue chan []byte) {
+			defer wg.Done()
+			t.send(ctx, peer, addr, queue)
+		}(peer, addr, t.queues[peer])
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.receive(ctx, conn, receiver)
+		}()
+	}
+	<-ctx.Done()
+}
+
+// BroadcastPropose sends the Propose to all peers, and to this Transport.
+func (t *Transport) BroadcastPropose(propose process.Propose) {
+	t.broadcast(t.encode(kindPropose, propose))
+}
+
+// BroadcastPrevote sends the Prevote to all peers, and to this Transport.
+func (t *Transport) BroadcastPrevote(prevote process.Prevote) {
+	t.broadcast(t.encode(kindPrevote, prevote))
+}
+
+// BroadcastPrecommit sends the Precommit to all peers, and to this Transport.
+func (t *Transport) BroadcastPrecommit(precommit process.Precommit) {
+	t.broadcast(t.encode(kindPrecommit, precommit))
+}
+
+// RequestSync sends a request for CommitCertificates, from the given Height
+// onwards, to all peers.
+func (t *Transport) RequestSync(from process.Height) {
+	frame := t.encode(kindSyncRequest, syncRequest{From: t.whoami, Height: from})
+	for peer := range t.queues {
+		t.enqueue(peer, frame)
+	}
+}
+
+// Sync sends the CommitCertificates to the peer that requested them.
+func (t *Transport) Sync(to id.Signatory, certs []process.CommitCertificate) {
+	for _, cert := range certs {
+		t.enqueue(to, t.encode(kindCommitCertificate, cert))
+	}
+}
+
+// RequestRound sends a request for the messages of the given Height and Round
+// to all peers.
+func (t *Transport) RequestRound(height process.Height, round process.Round) {
+	frame := t.encode(kindRoundRequest, roundRequest{From: t.whoami, Height: height, Round: round})
+	for peer := range t.queues {
+		t.enqueue(peer, frame)
+	}
+}
+
+// ResendPropose sends the Propose to the peer that requested it.
+func (t *Transport) ResendPropose(to id.Signatory, propose process.Propose) {
+	t.enqueue(to, t.encode(kindPropose, propose))
+}
+
+// ResendPrevote sends the Prevote to the peer that requested it.
+func (t *Transport) ResendPrevote(to id.Signatory, prevote process.Prevote) {
+	t.enqueue(to, t.encode(kindPrevote, prevote))
+}
+
+// ResendPrecommit sends the Precommit to the peer that requested it.
+func (t *Transport) ResendPrecommit(to id.Signatory, precommit process.Precommit) {
+	t.enqueue(to, t.encode(kindPrecommit, precommit))
+}
+
+func (t *Transport) broadcast(frame []byte) {
+	t.loopbackMu.Lock()
+	full := len(t.loopback) >= t.opts.QueueCapacity
+	if !full {
+		t.loopback = append(t.loopback, frame)
+	}
+	t.loopbackMu.Unlock()
+	if full {
+		t.dropped(t.whoami, frame)
+	} else {
+		select {
+		case t.onLoopback <- struct{}{}:
+		default:
+		}
+	}
+
+	for peer := range t.queues {
+		t.enqueue(peer, frame)
+	}
+}
+
+// enqueue the frame for the peer. If the queue for the peer is full, then the
+// frame is dropped, so that a slow peer never blocks the Replica. Dropped
+// frames must be recovered by the Replica resending its messages.
+func (t *Transport) enqueue(peer id.Signatory, frame []byte) {
+	queue, ok := t.queues[peer]
+	if !ok {
+		return
+	}
+	select {
+	case queue <- frame:
+	default:
+		t.dropped(peer, frame)
+	}
+}
+
+// dropped logs and counts a frame that was dropped, because the queue for the
+// peer was full.
+func (t *Transport) dropped(peer id.Signatory, frame []byte) {
+	if t.opts.Metrics != nil {
+		t.opts.Metrics.Dropped.With(peer.String()).Inc()
+	}
+	t.opts.Logger.Warn("dropped message: queue is full", zap.Stringer("peer", peer), zap.Uint8("kind", frame[4]))
+}
+
+// encode the message as a frame. Messages are marshaled by the Transport
+// itself, so failing to marshal them is an invariant violation.
+func (t *Transport) encode(kind byte, v surge.Marshaler) []byte {
+	data, err := surge.ToBinary(v)
+	if err != nil {
+		panic(fmt.Errorf("invariant violation: marshaling message kind=%v: %v", kind, err))
+	}
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[:4], uint32(1+len(data)))
+	frame[4] = kind
+	return append(frame, data...)
+}
+
+// send the frames in the queue to the peer at the given address, until the
+// context is done. The connection is opened again whenever it, or the
+// handshake, fails, and the frame that was being written when it failed is
+// written again.
+func (t *Transport) send(ctx context.Context, peer id.Signatory, addr string, queue chan []byte) {
+	dialer := net.Dialer{Timeout: t.opts.DialTimeout}
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	var frame []byte
+	for {
+		if frame == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case frame = <-queue:
+			}
+		}
+		if conn == nil {
+			var err error
+			if conn, err = dialer.DialContext(ctx, "tcp", addr); err == nil {
+				if err = t.handshake(conn, peer); err != nil {
+					t.opts.Logger.Debug("handshake failed", zap.Stringer("peer", peer), zap.Error(err))
+					conn.Close()
+				}
+			}
+			if err != nil {
+				conn = nil
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(t.opts.RedialInterval):
+				}
+				continue
+			}
+		}
+		if err := t.write(conn, frame); err != nil {
+			conn.Close()
+			conn = nil
+			continue
+		}
+		frame = nil
+	}
+}
+
+// handshake authenticates this Transport to the peer that accepted the
+// connection, by signing the challenge sent by the peer.
+func (t *Transport) handshake(conn net.Conn, peer id.Signatory) error {
+	if err := conn.SetDeadline(time.Now().Add(t.opts.HandshakeTimeout)); err != nil {
+		return err
+	}
+	challenge := [32]byte{}
+	if _, err := io.ReadFull(conn, challenge[:]); err != nil {
+		return fmt.Errorf("reading challenge: %v", err)
+	}
+	hash := handshakeHash(challenge, peer)
+	signature, err := t.opts.PrivKey.Sign(&hash)
+	if err != nil {
+		return fmt.Errorf("signing challenge: %v", err)
+	}
+	response := make([]byte, 0, id.SizeHintSignatory+id.SizeHintSignature)
+	response = append(response, t.whoami[:]...)
+	response = append(response, signature[:]...)
+	if _, err := conn.Write(response); err != nil {
+		return fmt.Errorf("writing response: %v", err)
+	}
+	return conn.SetDeadline(time.Time{})
+}
+
+// accept authenticates the peer that opened the connection, by sending it a
+// random challenge, and verifying that the response is signed by a peer. It
+// returns the signatory of the peer.
+func (t *Transport) accept(conn net.Conn, reader io.Reader) (id.Signatory, error) {
+	if err := conn.SetDeadline(time.Now().Add(t.opts.HandshakeTimeout)); err != nil {
+		return id.Signatory{}, err
+	}
+	challenge := [32]byte{}
+	if _, err := rand.Read(challenge[:]); err != nil {
+		return id.Signatory{}, fmt.Errorf("generating challenge: %v", err)
+	}
+	if _, err := conn.Write(challenge[:]); err != nil {
+		return id.Signatory{}, fmt.Errorf("writing challenge: %v", err)
+	}
+	response := [id.SizeHintSignatory + id.SizeHintSignature]byte{}
+	if _, err := io.ReadFull(reader, response[:]); err != nil {
+		return id.Signatory{}, fmt.Errorf("reading response: %v", err)
+	}
+	from := id.Signatory{}
+	copy(from[:], response[:id.SizeHintSignatory])
+	signature := id.Signature{}
+	copy(signature[:], response[id.SizeHintSignatory:])
+	if _, ok := t.queues[from]; !ok {
+		return id.Signatory{}, fmt.Errorf("unknown peer=%v", from)
+	}
+	hash := handshakeHash(challenge, t.whoami)
+	signatory, err := signature.Signatory(&hash)
+	if err != nil {
+		return id.Signatory{}, fmt.Errorf("verifying response from=%v: %v", from, err)
+	}
+	if !signatory.Equal(&from) {
+		return id.Signatory{}, fmt.Errorf("verifying response from=%v: signed by %v", from, signatory)
+	}
+	return from, conn.SetDeadline(time.Time{})
+}
+
+// handshakeHash returns the hash that is signed by a peer to answer the
+// challenge of the Transport with the given signatory.
+func handshakeHash(challenge [32]byte, to id.Signatory) id.Hash {
+	data := make([]byte, 0, len(challenge)+len(to))
+	data = append(data, challenge[:]...)
+	data = append(data, to[:]...)
+	return id.NewHash(data)
+}
+
+func (t *Transport) write(conn net.Conn, frame []byte) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(t.opts.WriteTimeout)); err != nil {
+		return err
+	}
+	_, err := conn.Write(frame)
+	return err
+}
+
+// receive frames from the connection, and deliver them to the Receiver, until
+// the context is done or the connection fails. Connections that fail the
+// handshake, or send frames that are too large or that cannot be unmarshaled,
+// are closed.
+func (t *Transport) receive(ctx context.Context, conn net.Conn, receiver Receiver) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	from, err := t.accept(conn, reader)
+	if err != nil {
+		t.opts.Logger.Debug("handshake failed", zap.Stringer("addr", conn.RemoteAddr()), zap.Error(err))
+		return
+	}
+	header := [4]byte{}
+	for {
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(header[:])
+		if n == 0 || uint64(n) > uint64(t.opts.MaxMessageSize) {
+			return
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return
+		}
+		if !t.deliver(ctx, receiver, from, payload[0], payload[1:]) {
+			return
+		}
+	}
+}
+
+// deliver the message, received from the given signatory, to the Receiver. It
+// returns false if the message cannot be unmarshaled, or if it is a request
+// that claims to be from another signatory.
+func (t *Transport) deliver(ctx context.Context, receiver Receiver, from id.Signatory, kind byte, data []byte) bool {
+	switch kind {
+	case kindPropose:
+		propose := process.Propose{}
+		if err := surge.FromBinary(&propose, data); err != nil {
+			return false
+		}
+		receiver.Propose(ctx, propose)
+	case kindPrevote:
+		prevote := process.Prevote{}
+		if err := surge.FromBinary(&prevote, data); err != nil {
+			return false
+		}
+		receiver.Prevote(ctx, prevote)
+	case kindPrecommit:
+		precommit := process.Precommit{}
+		if err := surge.FromBinary(&precommit, data); err != nil {
+			return false
+		}
+		receiver.Precommit(ctx, precommit)
+	case kindSyncRequest:
+		req := syncRequest{}
+		if err := surge.FromBinary(&req, data); err != nil || !req.From.Equal(&from) {
+			return false
+		}
+		receiver.SyncRequest(ctx, req.From, req.Height)
+	case kindCommitCertificate:
+		cert := process.CommitCertificate{}
+		if err := surge.FromBinary(&cert, data); err != nil {
+			return false
+		}
+		receiver.SyncCommitCertificate(ctx, cert)
+	case kindRoundRequest:
+		req := roundRequest{}
+		if err := surge.FromBinary(&req, data); err != nil || !req.From.Equal(&from) {
+			return false
+		}
+		receiver.RoundRequest(ctx, req.From, req.Height, req.Round)
+	default:
+		return false
+	}
+	return true
+}
+
+// A syncRequest is a request for CommitCertificates from the given Height
+// onwards. The signatory of the sender is included, so that the response can
+// be sent back to it.
+type syncRequest struct {
+	From   id.Signatory
+	Height process.Height
+}
+
+// SizeHint returns the number of bytes required to represent this request in
+// binary.
+func (req syncRequest) SizeHint() int {
+	return surge.SizeHint(req.From) +
+		surge.SizeHint(req.Height)
+}
+
+// Marshal this request into binary.
+func (req syncRequest) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.Marshal(req.From, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling from=%v: %v", req.From, err)
+	}
+	buf, rem, err = surge.Marshal(req.Height, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling height=%v: %v", req.Height, err)
+	}
+	return buf, rem, nil
+}
+
+// Unmarshal binary into this request.
+func (req *syncRequest) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.Unmarshal(&req.From, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling from: %v", err)
+	}
+	buf, rem, err = surge.Unmarshal(&req.Height, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling height: %v", err)
+	}
+	return buf, rem, nil
+}
+
+// A roundRequest is a request for the messages of the given Height and Round.
+// The signatory of the sender is included, so that the response can be sent
+// back to it.
+type roundRequest struct {
+	From   id.Signatory
+	Height process.Height
+	Round  process.Round
+}
+
+// SizeHint returns the number of bytes required to represent this request in
+// binary.
+func (req roundRequest) SizeHint() int {
+	return surge.SizeHint(req.From) +
+		surge.SizeHint(req.Height) +
+		surge.SizeHint(req.Round)
+}
+
+// Marshal this request into binary.
+func (req roundRequest) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.Marshal(req.From, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling from=%v: %v", req.From, err)
+	}
+	buf, rem, err = surge.Marshal(req.Height, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling height=%v: %v", req.Height, err)
+	}
+	buf, rem, err = surge.Marshal(req.Round, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling round=%v: %v", req.Round, err)
+	}
+	return buf, rem, nil
+}
+
+// Unmarshal binary into this request.
+func (req *roundRequest) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.Unmarshal(&req.From, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling from: %v", err)
+	}
+	buf, rem, err = surge.Unmarshal(&req.Height, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling height: %v", err)
+	}
+	buf, rem, err = surge.Unmarshal(&req.Round, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling round: %v", err)
+	}
+	return buf, rem, nil
+}
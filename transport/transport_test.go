@@ -0,0 +1,502 @@
+package transport_test
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/renproject/hyperdrive/metrics"
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/hyperdrive/process/processutil"
+	"github.com/renproject/hyperdrive/replica"
+	"github.com/renproject/hyperdrive/transport"
+	"github.com/renproject/id"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// The Transport must be usable as the Broadcaster, Syncer, and Resender of a
+// Replica, and the Replica must be usable as the Receiver of a Transport.
+var (
+	_ process.Broadcaster = &transport.Transport{}
+	_ replica.Syncer      = &transport.Transport{}
+	_ replica.Resender    = &transport.Transport{}
+	_ transport.Receiver  = &replica.Replica{}
+)
+
+var _ = Describe("Transport", func() {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	opts := transport.DefaultOptions().
+		WithRedialInterval(10 * time.Millisecond)
+
+	listen := func() net.Listener {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		return listener
+	}
+
+	Context("when broadcasting", func() {
+		It("should deliver messages to all peers and to itself", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// setup transports that are connected to each other
+			n := 4
+			privKeys := make([]*id.PrivKey, n)
+			signatories := make([]id.Signatory, n)
+			listeners := make([]net.Listener, n)
+			peers := map[id.Signatory]string{}
+			for i := range signatories {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+				listeners[i] = listen()
+				peers[signatories[i]] = listeners[i].Addr().String()
+			}
+			transports := make([]*transport.Transport, n)
+			receivers := make([]*mockReceiver, n)
+			for i := range transports {
+				transports[i] = transport.New(opts.WithPrivKey(privKeys[i]), signatories[i], peers)
+				receivers[i] = newMockReceiver()
+				go transports[i].Run(ctx, listeners[i], receivers[i])
+			}
+
+			propose := processutil.RandomPropose(r)
+			prevote := processutil.RandomPrevote(r)
+			precommit := processutil.RandomPrecommit(r)
+			transports[0].BroadcastPropose(propose)
+			transports[0].BroadcastPrevote(prevote)
+			transports[0].BroadcastPrecommit(precommit)
+
+			// messages from one peer are received in order
+			for i := range receivers {
+				Eventually(receivers[i].proposes).Should(Receive(Equal(propose)))
+				Eventually(receivers[i].prevotes).Should(Receive(Equal(prevote)))
+				Eventually(receivers[i].precommits).Should(Receive(Equal(precommit)))
+			}
+		})
+	})
+
+	Context("when a peer is offline", func() {
+		It("should deliver messages once the peer is online", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// reserve an address for the offline peer
+			listener := listen()
+			addr := listener.Addr().String()
+			Expect(listener.Close()).To(Succeed())
+
+			senderKey := id.NewPrivKey()
+			sender := senderKey.Signatory()
+			senderListener := listen()
+			receiverKey := id.NewPrivKey()
+			receiver := receiverKey.Signatory()
+			peers := map[id.Signatory]string{
+				sender:   senderListener.Addr().String(),
+				receiver: addr,
+			}
+			t := transport.New(opts.WithPrivKey(senderKey), sender, peers)
+			go t.Run(ctx, senderListener, newMockReceiver())
+
+			prevote := processutil.RandomPrevote(r)
+			t.BroadcastPrevote(prevote)
+			time.Sleep(100 * time.Millisecond)
+
+			// the peer comes online at its address
+			listener, err := net.Listen("tcp", addr)
+			Expect(err).ToNot(HaveOccurred())
+			mock := newMockReceiver()
+			go transport.New(opts.WithPrivKey(receiverKey), receiver, peers).Run(ctx, listener, mock)
+			Eventually(mock.prevotes, 5*time.Second).Should(Receive(Equal(prevote)))
+		})
+	})
+
+	Context("when the queue of a peer is full", func() {
+		It("should drop and count the messages for the peer, and for itself", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// reserve an address for the offline peer
+			listener := listen()
+			addr := listener.Addr().String()
+			Expect(listener.Close()).To(Succeed())
+
+			senderKey := id.NewPrivKey()
+			sender := senderKey.Signatory()
+			senderListener := listen()
+			offline := id.NewPrivKey().Signatory()
+			peers := map[id.Signatory]string{
+				sender:  senderListener.Addr().String(),
+				offline: addr,
+			}
+			m := transport.NewMetrics(metrics.NewRegistry())
+			t := transport.New(opts.WithPrivKey(senderKey).WithQueueCapacity(1).WithMetrics(m), sender, peers)
+
+			// the queues are not drained until the transport is running, so
+			// only the first prevote is kept
+			numPrevotes := 20
+			prevotes := make([]process.Prevote, numPrevotes)
+			for i := range prevotes {
+				prevotes[i] = processutil.RandomPrevote(r)
+				t.BroadcastPrevote(prevotes[i])
+			}
+			Expect(m.Dropped.With(offline.String()).Value()).To(BeNumerically("==", numPrevotes-1))
+			Expect(m.Dropped.With(sender.String()).Value()).To(BeNumerically("==", numPrevotes-1))
+
+			mock := newMockReceiver()
+			go t.Run(ctx, senderListener, mock)
+			Eventually(mock.prevotes).Should(Receive(Equal(prevotes[0])))
+			Consistently(mock.prevotes).ShouldNot(Receive())
+		})
+	})
+
+	Context("when syncing", func() {
+		It("should deliver sync requests and commit certificates", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			privKeys := []*id.PrivKey{id.NewPrivKey(), id.NewPrivKey()}
+			signatories := []id.Signatory{
+				privKeys[0].Signatory(),
+				privKeys[1].Signatory(),
+			}
+			listeners := []net.Listener{listen(), listen()}
+			peers := map[id.Signatory]string{
+				signatories[0]: listeners[0].Addr().String(),
+				signatories[1]: listeners[1].Addr().String(),
+			}
+			receivers := []*mockReceiver{newMockReceiver(), newMockReceiver()}
+			transports := make([]*transport.Transport, 2)
+			for i := range transports {
+				transports[i] = transport.New(opts.WithPrivKey(privKeys[i]), signatories[i], peers)
+				go transports[i].Run(ctx, listeners[i], receivers[i])
+			}
+
+			// sync requests are only sent to peers
+			height := process.Height(1 + r.Int63n(1000))
+			transports[0].RequestSync(height)
+			Eventually(receivers[1].syncRequests).Should(Receive(Equal(mockSyncRequest{from: signatories[0], height: height})))
+			Consistently(receivers[0].syncRequests).ShouldNot(Receive())
+
+			// commit certificates are only sent to the requesting peer
+			certs := []process.CommitCertificate{
+				processutil.RandomCommitCertificate(r),
+				processutil.RandomCommitCertificate(r),
+			}
+			transports[1].Sync(signatories[0], certs)
+			for _, cert := range certs {
+				Eventually(receivers[0].certs).Should(Receive(Equal(cert)))
+			}
+			Consistently(receivers[1].certs).ShouldNot(Receive())
+		})
+	})
+
+	Context("when resending", func() {
+		It("should deliver round requests to all peers, and messages only to the requesting peer", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			n := 3
+			privKeys := make([]*id.PrivKey, n)
+			signatories := make([]id.Signatory, n)
+			listeners := make([]net.Listener, n)
+			peers := map[id.Signatory]string{}
+			for i := range signatories {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+				listeners[i] = listen()
+				peers[signatories[i]] = listeners[i].Addr().String()
+			}
+			receivers := make([]*mockReceiver, n)
+			transports := make([]*transport.Transport, n)
+			for i := range transports {
+				receivers[i] = newMockReceiver()
+				transports[i] = transport.New(opts.WithPrivKey(privKeys[i]), signatories[i], peers)
+				go transports[i].Run(ctx, listeners[i], receivers[i])
+			}
+
+			// round requests are only sent to peers
+			height := process.Height(1 + r.Int63n(1000))
+			round := process.Round(r.Int63n(1000))
+			transports[0].RequestRound(height, round)
+			for _, receiver := range receivers[1:] {
+				Eventually(receiver.roundRequests).Should(Receive(Equal(mockRoundRequest{from: signatories[0], height: height, round: round})))
+			}
+			Consistently(receivers[0].roundRequests).ShouldNot(Receive())
+
+			// messages are only sent to the requesting peer
+			propose := processutil.RandomPropose(r)
+			prevote := processutil.RandomPrevote(r)
+			precommit := processutil.RandomPrecommit(r)
+			transports[1].ResendPropose(signatories[0], propose)
+			transports[1].ResendPrevote(signatories[0], prevote)
+			transports[1].ResendPrecommit(signatories[0], precommit)
+			Eventually(receivers[0].proposes).Should(Receive(Equal(propose)))
+			Eventually(receivers[0].prevotes).Should(Receive(Equal(prevote)))
+			Eventually(receivers[0].precommits).Should(Receive(Equal(precommit)))
+			for _, receiver := range receivers[1:] {
+				Consistently(receiver.prevotes).ShouldNot(Receive())
+			}
+		})
+	})
+
+	Context("when a peer sends a message that is too large", func() {
+		It("should close the connection", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			listener := listen()
+			whoamiKey := id.NewPrivKey()
+			whoami := whoamiKey.Signatory()
+			peerKey := id.NewPrivKey()
+			peers := map[id.Signatory]string{peerKey.Signatory(): "127.0.0.1:0"}
+			t := transport.New(opts.WithPrivKey(whoamiKey).WithMaxMessageSize(64), whoami, peers)
+			go t.Run(ctx, listener, newMockReceiver())
+
+			conn := dial(listener.Addr().String(), peerKey, whoami)
+			defer conn.Close()
+
+			header := [4]byte{}
+			binary.BigEndian.PutUint32(header[:], 65)
+			_, err := conn.Write(header[:])
+			Expect(err).ToNot(HaveOccurred())
+			expectClosed(conn)
+		})
+	})
+
+	Context("when a peer connects", func() {
+		It("should close the connection if the peer cannot sign the challenge", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			listener := listen()
+			whoamiKey := id.NewPrivKey()
+			whoami := whoamiKey.Signatory()
+			peer := id.NewPrivKey().Signatory()
+			peers := map[id.Signatory]string{peer: "127.0.0.1:0"}
+			mock := newMockReceiver()
+			t := transport.New(opts.WithPrivKey(whoamiKey), whoami, peers)
+			go t.Run(ctx, listener, mock)
+
+			// another private key signs the challenge on behalf of the peer
+			conn := dialAs(listener.Addr().String(), peer, id.NewPrivKey(), whoami)
+			defer conn.Close()
+			expectClosed(conn)
+		})
+
+		It("should close the connection if the peer is unknown", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			listener := listen()
+			whoamiKey := id.NewPrivKey()
+			whoami := whoamiKey.Signatory()
+			t := transport.New(opts.WithPrivKey(whoamiKey), whoami, map[id.Signatory]string{})
+			go t.Run(ctx, listener, newMockReceiver())
+
+			conn := dial(listener.Addr().String(), id.NewPrivKey(), whoami)
+			defer conn.Close()
+			expectClosed(conn)
+		})
+
+		It("should close the connection if the peer sends a request on behalf of another peer", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			listener := listen()
+			whoamiKey := id.NewPrivKey()
+			whoami := whoamiKey.Signatory()
+			peerKey := id.NewPrivKey()
+			other := id.NewPrivKey().Signatory()
+			peers := map[id.Signatory]string{
+				peerKey.Signatory(): "127.0.0.1:0",
+				other:               "127.0.0.1:0",
+			}
+			mock := newMockReceiver()
+			t := transport.New(opts.WithPrivKey(whoamiKey), whoami, peers)
+			go t.Run(ctx, listener, mock)
+
+			conn := dial(listener.Addr().String(), peerKey, whoami)
+			defer conn.Close()
+
+			// a sync request that claims to be from the other peer (kind 4,
+			// followed by the signatory and the height)
+			data := append([]byte{4}, other[:]...)
+			data = append(data, make([]byte, 8)...)
+			header := [4]byte{}
+			binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+			_, err := conn.Write(append(header[:], data...))
+			Expect(err).ToNot(HaveOccurred())
+			expectClosed(conn)
+			Consistently(mock.syncRequests).ShouldNot(Receive())
+		})
+	})
+
+	Context("when replicas use transports", func() {
+		It("should reach consensus over localhost", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			f := 1
+			n := 3*f + 1
+			targetHeight := process.Height(5)
+
+			privKeys := make([]*id.PrivKey, n)
+			signatories := make([]id.Signatory, n)
+			listeners := make([]net.Listener, n)
+			peers := map[id.Signatory]string{}
+			for i := range privKeys {
+				privKeys[i] = id.NewPrivKey()
+				signatories[i] = privKeys[i].Signatory()
+				listeners[i] = listen()
+				peers[signatories[i]] = listeners[i].Addr().String()
+			}
+
+			// every replica sends this signal when they reach the target
+			// consensus height
+			completionSignal := make(chan bool, n)
+
+			for i := 0; i < n; i++ {
+				t := transport.New(opts.WithPrivKey(privKeys[i]), signatories[i], peers)
+				replica := replica.New(
+					replica.DefaultOptions().
+						WithPrivKey(privKeys[i]).
+						WithResendInterval(time.Second).
+						WithSyncer(t).
+						WithResender(t),
+					signatories[i],
+					signatories,
+					// Proposer
+					processutil.MockProposer{
+						MockValue: func() process.Value {
+							return process.Value(id.NewHash([]byte(time.Now().String())))
+						},
+					},
+					// Validator
+					processutil.MockValidator{
+						MockValid: func(process.Value) bool {
+							return true
+						},
+					},
+					// Committer
+					processutil.CommitterCallback{
+						Callback: func(height process.Height, value process.Value) {
+							if height == targetHeight {
+								completionSignal <- true
+							}
+						},
+					},
+					// Catcher
+					nil,
+					// Broadcaster
+					t,
+					// Flusher
+					nil,
+				)
+				go t.Run(ctx, listeners[i], replica)
+				go replica.Run(ctx)
+			}
+
+			for i := 0; i < n; i++ {
+				select {
+				case <-completionSignal:
+				case <-time.After(30 * time.Second):
+					Fail("failed to reach consensus")
+				}
+			}
+		})
+	})
+})
+
+type mockSyncRequest struct {
+	from   id.Signatory
+	height process.Height
+}
+
+type mockRoundRequest struct {
+	from   id.Signatory
+	height process.Height
+	round  process.Round
+}
+
+type mockReceiver struct {
+	proposes      chan process.Propose
+	prevotes      chan process.Prevote
+	precommits    chan process.Precommit
+	syncRequests  chan mockSyncRequest
+	certs         chan process.CommitCertificate
+	roundRequests chan mockRoundRequest
+}
+
+func newMockReceiver() *mockReceiver {
+	return &mockReceiver{
+		proposes:      make(chan process.Propose, 10),
+		prevotes:      make(chan process.Prevote, 10),
+		precommits:    make(chan process.Precommit, 10),
+		syncRequests:  make(chan mockSyncRequest, 10),
+		certs:         make(chan process.CommitCertificate, 10),
+		roundRequests: make(chan mockRoundRequest, 10),
+	}
+}
+
+func (receiver *mockReceiver) Propose(ctx context.Context, propose process.Propose) {
+	receiver.proposes <- propose
+}
+
+func (receiver *mockReceiver) Prevote(ctx context.Context, prevote process.Prevote) {
+	receiver.prevotes <- prevote
+}
+
+func (receiver *mockReceiver) Precommit(ctx context.Context, precommit process.Precommit) {
+	receiver.precommits <- precommit
+}
+
+func (receiver *mockReceiver) SyncRequest(ctx context.Context, from id.Signatory, height process.Height) {
+	receiver.syncRequests <- mockSyncRequest{from: from, height: height}
+}
+
+func (receiver *mockReceiver) SyncCommitCertificate(ctx context.Context, cert process.CommitCertificate) {
+	receiver.certs <- cert
+}
+
+func (receiver *mockReceiver) RoundRequest(ctx context.Context, from id.Signatory, height process.Height, round process.Round) {
+	receiver.roundRequests <- mockRoundRequest{from: from, height: height, round: round}
+}
+
+// dial the Transport at the address, and answer its challenge as the peer
+// with the private key.
+func dial(addr string, privKey *id.PrivKey, to id.Signatory) net.Conn {
+	return dialAs(addr, privKey.Signatory(), privKey, to)
+}
+
+// dialAs dials the Transport at the address, and answers its challenge as the
+// signatory, using the private key to sign the challenge.
+func dialAs(addr string, from id.Signatory, privKey *id.PrivKey, to id.Signatory) net.Conn {
+	conn, err := net.Dial("tcp", addr)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(conn.SetDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+	challenge := make([]byte, 32)
+	_, err = io.ReadFull(conn, challenge)
+	Expect(err).ToNot(HaveOccurred())
+	hash := id.NewHash(append(challenge, to[:]...))
+	signature, err := privKey.Sign(&hash)
+	Expect(err).ToNot(HaveOccurred())
+	_, err = conn.Write(append(from[:], signature[:]...))
+	Expect(err).ToNot(HaveOccurred())
+	return conn
+}
+
+// expectClosed expects the connection to be closed by the Transport.
+func expectClosed(conn net.Conn) {
+	Expect(conn.SetReadDeadline(time.Now().Add(5 * time.Second))).To(Succeed())
+	_, err := conn.Read(make([]byte, 1))
+	Expect(err).To(HaveOccurred())
+	if ne, ok := err.(net.Error); ok {
+		Expect(ne.Timeout()).To(BeFalse())
+	}
+}
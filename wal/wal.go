@@ -0,0 +1,319 @@
+// Package wal defines a write-ahead log that is used to recover a Process after
+// it crashes. Before a Process broadcasts a message, the message is appended to
+// the write-ahead log, and whenever the State of the Process changes, the State
+// is checkpointed. After a crash, the last checkpointed State and all messages
+// broadcast at its Height can be loaded, and used to resume the Process without
+// it equivocating.
+package wal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/renproject/hyperdrive/internal/fileutil"
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/surge"
+)
+
+// A WAL is a write-ahead log of the State of a Process, and the messages that
+// it has broadcast. Implementations must make sure that entries are durable
+// before returning.
+type WAL interface {
+	// Checkpoint the State of a Process. The checkpoint replaces any previous
+	// checkpoint, and messages from Heights lower than the Height of the State
+	// are discarded.
+	Checkpoint(process.State) error
+	// AppendPropose to the log. It must be called before the Propose is
+	// broadcast.
+	AppendPropose(process.Propose) error
+	// AppendPrevote to the log. It must be called before the Prevote is
+	// broadcast.
+	AppendPrevote(process.Prevote) error
+	// AppendPrecommit to the log. It must be called before the Precommit is
+	// broadcast.
+	AppendPrecommit(process.Precommit) error
+	// AppendPayload to the log. It must be called before a Propose with the
+	// Payload is passed to the Process.
+	AppendPayload(Payload) error
+	// Load the last checkpointed State, and all messages that have been
+	// appended to the log for its Height (and above). If no State has been
+	// checkpointed, then it returns false.
+	Load() (Record, bool, error)
+}
+
+// A Record is everything that has been saved in a WAL. It is used to resume a
+// Process.
+type Record struct {
+	State      process.State
+	Proposes   []process.Propose
+	Prevotes   []process.Prevote
+	Precommits []process.Precommit
+	Payloads   []Payload
+}
+
+// A Payload that was proposed by another Process at a Height. Payloads are not
+// kept in the State of a Process, which only knows their hashes, so they are
+// appended to the log separately.
+type Payload struct {
+	Height process.Height
+	Data   []byte
+}
+
+// SizeHint returns the number of bytes required to represent the Payload in
+// binary.
+func (payload Payload) SizeHint() int {
+	return surge.SizeHint(payload.Height) +
+		surge.SizeHint(payload.Data)
+}
+
+// Marshal the Payload into binary.
+func (payload Payload) Marshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.Marshal(payload.Height, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling height=%v: %v", payload.Height, err)
+	}
+	buf, rem, err = surge.Marshal(payload.Data, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("marshaling %v bytes of data: %v", len(payload.Data), err)
+	}
+	return buf, rem, nil
+}
+
+// Unmarshal binary into the Payload.
+func (payload *Payload) Unmarshal(buf []byte, rem int) ([]byte, int, error) {
+	buf, rem, err := surge.Unmarshal(&payload.Height, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling height: %v", err)
+	}
+	buf, rem, err = surge.Unmarshal(&payload.Data, buf, rem)
+	if err != nil {
+		return buf, rem, fmt.Errorf("unmarshaling data: %v", err)
+	}
+	return buf, rem, nil
+}
+
+// Enumerate the kinds of entries that can be written to a FileWAL.
+const (
+	kindState     = byte(0)
+	kindPropose   = byte(1)
+	kindPrevote   = byte(2)
+	kindPrecommit = byte(3)
+	kindPayload   = byte(4)
+)
+
+// A FileWAL is a WAL that is backed by a single file. Every entry is written as
+// a length-prefixed and checksummed frame, so that an entry that is only
+// partially written (because of a crash) can be detected and ignored.
+//
+// Checkpoints at the Height of the previous checkpoint are appended to the
+// file, and the last one is loaded. When the Height changes, or when the
+// checkpoints that have been appended would be larger than the file was after
+// it was last rotated, the file is rotated: it is replaced atomically by one
+// that contains only the new State, and the messages for its Height (and
+// above). This bounds the size of the file when the State is checkpointed many
+// times at the same Height, without rotating it for every checkpoint. The
+// messages are remembered since the last rotation, so the file never needs to
+// be read again after it has been loaded. A FileWAL is not safe for concurrent
+// use.
+type FileWAL struct {
+	path string
+
+	// loaded is true once the file has been read. If a State has been
+	// checkpointed, then height is its Height, and entries are the messages
+	// that have been written since the file was last rotated. The rotated
+	// size is the size of the file after it was last rotated, and the
+	// appended size is the size of the checkpoints that have been appended
+	// since then.
+	loaded       bool
+	checkpointed bool
+	height       process.Height
+	entries      []entry
+	rotatedSize  int
+	appendedSize int
+}
+
+// An entry is a message that has been written to a FileWAL.
+type entry struct {
+	height process.Height
+	kind   byte
+	data   []byte
+}
+
+// NewFileWAL returns a FileWAL that stores its entries in the file at the given
+// path. The file, and its parent directory, will be created if they do not
+// exist.
+func NewFileWAL(path string) *FileWAL {
+	return &FileWAL{path: path}
+}
+
+// Checkpoint the State. If the State is at the same Height as the previous
+// checkpoint, then it is appended to the file, unless the file has grown too
+// much since it was last rotated. Otherwise, the file is rotated by atomically
+// replacing it with one that contains the State, and the messages that have
+// been appended to the log for the Height of the State (and above).
+func (w *FileWAL) Checkpoint(state process.State) error {
+	if !w.loaded {
+		if _, _, err := w.Load(); err != nil {
+			return fmt.Errorf("loading: %v", err)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writeFrame(buf, kindState, state); err != nil {
+		return fmt.Errorf("writing state: %v", err)
+	}
+	if w.checkpointed && w.height == state.CurrentHeight && w.appendedSize+buf.Len() <= w.rotatedSize {
+		if err := fileutil.Append(w.path, buf.Bytes()); err != nil {
+			return err
+		}
+		w.appendedSize += buf.Len()
+		return nil
+	}
+
+	entries := make([]entry, 0, len(w.entries))
+	for _, e := range w.entries {
+		if e.height >= state.CurrentHeight {
+			if err := fileutil.WriteFrame(buf, e.kind, e.data); err != nil {
+				return fmt.Errorf("writing entry: %v", err)
+			}
+			entries = append(entries, e)
+		}
+	}
+	if err := fileutil.WriteAtomic(w.path, buf.Bytes()); err != nil {
+		return err
+	}
+	w.checkpointed = true
+	w.height = state.CurrentHeight
+	w.entries = entries
+	w.rotatedSize = buf.Len()
+	w.appendedSize = 0
+	return nil
+}
+
+// AppendPropose to the end of the file.
+func (w *FileWAL) AppendPropose(propose process.Propose) error {
+	return w.append(propose.Height, kindPropose, propose)
+}
+
+// AppendPrevote to the end of the file.
+func (w *FileWAL) AppendPrevote(prevote process.Prevote) error {
+	return w.append(prevote.Height, kindPrevote, prevote)
+}
+
+// AppendPrecommit to the end of the file.
+func (w *FileWAL) AppendPrecommit(precommit process.Precommit) error {
+	return w.append(precommit.Height, kindPrecommit, precommit)
+}
+
+// AppendPayload to the end of the file.
+func (w *FileWAL) AppendPayload(payload Payload) error {
+	return w.append(payload.Height, kindPayload, payload)
+}
+
+// Load the State and messages from the file. Reading stops at the first frame
+// that is incomplete or corrupt, because it can only have been caused by a
+// crash while appending. Such a frame is truncated from the file, so that
+// entries appended later can be read.
+func (w *FileWAL) Load() (Record, bool, error) {
+	record := Record{}
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			w.loaded, w.checkpointed, w.entries = true, false, nil
+			return record, false, nil
+		}
+		return record, false, fmt.Errorf("reading %v: %v", w.path, err)
+	}
+
+	ok := false
+	size := len(data)
+	entries := []entry{}
+	for {
+		kind, frame, rest, more := fileutil.ReadFrame(data)
+		if !more {
+			break
+		}
+		data = rest
+
+		switch kind {
+		case kindState:
+			if err := surge.FromBinary(&record.State, frame); err != nil {
+				return record, false, fmt.Errorf("unmarshaling state: %v", err)
+			}
+			ok = true
+		case kindPropose:
+			propose := process.Propose{}
+			if err := surge.FromBinary(&propose, frame); err != nil {
+				return record, false, fmt.Errorf("unmarshaling propose: %v", err)
+			}
+			record.Proposes = append(record.Proposes, propose)
+			entries = append(entries, entry{height: propose.Height, kind: kind, data: frame})
+		case kindPrevote:
+			prevote := process.Prevote{}
+			if err := surge.FromBinary(&prevote, frame); err != nil {
+				return record, false, fmt.Errorf("unmarshaling prevote: %v", err)
+			}
+			record.Prevotes = append(record.Prevotes, prevote)
+			entries = append(entries, entry{height: prevote.Height, kind: kind, data: frame})
+		case kindPrecommit:
+			precommit := process.Precommit{}
+			if err := surge.FromBinary(&precommit, frame); err != nil {
+				return record, false, fmt.Errorf("unmarshaling precommit: %v", err)
+			}
+			record.Precommits = append(record.Precommits, precommit)
+			entries = append(entries, entry{height: precommit.Height, kind: kind, data: frame})
+		case kindPayload:
+			payload := Payload{}
+			if err := surge.FromBinary(&payload, frame); err != nil {
+				return record, false, fmt.Errorf("unmarshaling payload: %v", err)
+			}
+			record.Payloads = append(record.Payloads, payload)
+			entries = append(entries, entry{height: payload.Height, kind: kind, data: frame})
+		default:
+			return record, false, fmt.Errorf("unexpected entry kind=%v", kind)
+		}
+	}
+	if len(data) > 0 {
+		if err := os.Truncate(w.path, int64(size-len(data))); err != nil {
+			return record, false, fmt.Errorf("truncating %v: %v", w.path, err)
+		}
+	}
+
+	// The size of the file after it was last rotated is not known, so the
+	// next checkpoint rotates it.
+	w.loaded = true
+	w.checkpointed = ok
+	w.height = record.State.CurrentHeight
+	w.entries = entries
+	w.rotatedSize = 0
+	w.appendedSize = 0
+	return record, ok, nil
+}
+
+func (w *FileWAL) append(height process.Height, kind byte, v surge.Marshaler) error {
+	data, err := surge.ToBinary(v)
+	if err != nil {
+		return fmt.Errorf("marshaling: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := fileutil.WriteFrame(buf, kind, data); err != nil {
+		return fmt.Errorf("writing frame: %v", err)
+	}
+	if err := fileutil.Append(w.path, buf.Bytes()); err != nil {
+		return err
+	}
+	w.entries = append(w.entries, entry{height: height, kind: kind, data: data})
+	return nil
+}
+
+// writeFrame marshals the value, and writes it as a frame of the kind.
+func writeFrame(w io.Writer, kind byte, v surge.Marshaler) error {
+	data, err := surge.ToBinary(v)
+	if err != nil {
+		return fmt.Errorf("marshaling: %v", err)
+	}
+	return fileutil.WriteFrame(w, kind, data)
+}
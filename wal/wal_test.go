@@ -0,0 +1,264 @@
+package wal_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing/quick"
+	"time"
+
+	"github.com/renproject/hyperdrive/process"
+	"github.com/renproject/hyperdrive/process/processutil"
+	"github.com/renproject/hyperdrive/wal"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WAL", func() {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "hyperdrive-wal")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Context("when nothing has been checkpointed", func() {
+		It("should load nothing", func() {
+			w := wal.NewFileWAL(filepath.Join(dir, "wal"))
+			_, ok, err := w.Load()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("when checkpointing and appending", func() {
+		It("should load the last checkpoint and the messages appended at its height", func() {
+			loop := func() bool {
+				w := wal.NewFileWAL(filepath.Join(dir, fmt.Sprintf("wal-%v", r.Int())))
+
+				state := processutil.RandomState(r)
+				state.CurrentHeight = process.Height(1 + r.Int63n(1000))
+				Expect(w.Checkpoint(processutil.RandomState(r))).To(Succeed())
+				Expect(w.Checkpoint(state)).To(Succeed())
+
+				propose := processutil.RandomPropose(r)
+				propose.Height = state.CurrentHeight
+				prevote := processutil.RandomPrevote(r)
+				prevote.Height = state.CurrentHeight
+				precommit := processutil.RandomPrecommit(r)
+				precommit.Height = state.CurrentHeight
+				Expect(w.AppendPropose(propose)).To(Succeed())
+				Expect(w.AppendPrevote(prevote)).To(Succeed())
+				Expect(w.AppendPrecommit(precommit)).To(Succeed())
+
+				record, ok, err := w.Load()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ok).To(BeTrue())
+				Expect(record.State.Equal(&state)).To(BeTrue())
+				Expect(record.Proposes).To(HaveLen(1))
+				Expect(record.Proposes[0].Equal(&propose)).To(BeTrue())
+				Expect(record.Prevotes).To(HaveLen(1))
+				Expect(record.Prevotes[0].Equal(&prevote)).To(BeTrue())
+				Expect(record.Precommits).To(HaveLen(1))
+				Expect(record.Precommits[0].Equal(&precommit)).To(BeTrue())
+
+				// checkpointing at the same height keeps the messages
+				state.CurrentRound++
+				Expect(w.Checkpoint(state)).To(Succeed())
+				record, ok, err = w.Load()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ok).To(BeTrue())
+				Expect(record.State.Equal(&state)).To(BeTrue())
+				Expect(record.Proposes).To(HaveLen(1))
+				Expect(record.Prevotes).To(HaveLen(1))
+				Expect(record.Precommits).To(HaveLen(1))
+
+				// checkpointing at the next height discards the messages
+				state.CurrentHeight++
+				Expect(w.Checkpoint(state)).To(Succeed())
+				record, ok, err = w.Load()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ok).To(BeTrue())
+				Expect(record.State.Equal(&state)).To(BeTrue())
+				Expect(record.Proposes).To(BeEmpty())
+				Expect(record.Prevotes).To(BeEmpty())
+				Expect(record.Precommits).To(BeEmpty())
+				return true
+			}
+			Expect(quick.Check(loop, &quick.Config{MaxCount: 20})).To(Succeed())
+		})
+	})
+
+	Context("when appending payloads", func() {
+		It("should load the payloads until the height changes", func() {
+			w := wal.NewFileWAL(filepath.Join(dir, "wal"))
+
+			state := processutil.RandomState(r)
+			state.CurrentHeight = process.Height(1 + r.Int63n(1000))
+			Expect(w.Checkpoint(state)).To(Succeed())
+			payload := wal.Payload{Height: state.CurrentHeight, Data: []byte("payload")}
+			Expect(w.AppendPayload(payload)).To(Succeed())
+
+			record, ok, err := w.Load()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(record.Payloads).To(Equal([]wal.Payload{payload}))
+
+			state.CurrentHeight++
+			Expect(w.Checkpoint(state)).To(Succeed())
+			record, ok, err = w.Load()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(record.Payloads).To(BeEmpty())
+		})
+	})
+
+	Context("when the last entry is only partially written", func() {
+		It("should ignore the last entry", func() {
+			loop := func() bool {
+				path := filepath.Join(dir, fmt.Sprintf("wal-%v", r.Int()))
+				w := wal.NewFileWAL(path)
+
+				state := processutil.RandomState(r)
+				Expect(w.Checkpoint(state)).To(Succeed())
+				prevote := processutil.RandomPrevote(r)
+				prevote.Height = state.CurrentHeight
+				Expect(w.AppendPrevote(prevote)).To(Succeed())
+				data, err := ioutil.ReadFile(path)
+				Expect(err).ToNot(HaveOccurred())
+
+				// simulate a crash while appending a precommit
+				precommit := processutil.RandomPrecommit(r)
+				precommit.Height = state.CurrentHeight
+				Expect(w.AppendPrecommit(precommit)).To(Succeed())
+				torn, err := ioutil.ReadFile(path)
+				Expect(err).ToNot(HaveOccurred())
+				torn = torn[:len(data)+r.Intn(len(torn)-len(data))]
+				Expect(ioutil.WriteFile(path, torn, 0600)).To(Succeed())
+
+				record, ok, err := w.Load()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ok).To(BeTrue())
+				Expect(record.State.Equal(&state)).To(BeTrue())
+				Expect(record.Prevotes).To(HaveLen(1))
+				Expect(record.Precommits).To(BeEmpty())
+				return true
+			}
+			Expect(quick.Check(loop, &quick.Config{MaxCount: 20})).To(Succeed())
+		})
+
+		It("should append entries that are written after the partial entry", func() {
+			path := filepath.Join(dir, "wal")
+			w := wal.NewFileWAL(path)
+
+			state := processutil.RandomState(r)
+			Expect(w.Checkpoint(state)).To(Succeed())
+			data, err := ioutil.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(path, append(data, 1, 2, 3), 0600)).To(Succeed())
+
+			// simulate a restart
+			w = wal.NewFileWAL(path)
+			_, ok, err := w.Load()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			prevote := processutil.RandomPrevote(r)
+			prevote.Height = state.CurrentHeight
+			Expect(w.AppendPrevote(prevote)).To(Succeed())
+
+			record, ok, err := w.Load()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(record.Prevotes).To(HaveLen(1))
+			Expect(record.Prevotes[0].Equal(&prevote)).To(BeTrue())
+		})
+	})
+
+	Context("when checkpointing many times", func() {
+		It("should append checkpoints, and rotate the file when the height changes", func() {
+			path := filepath.Join(dir, "wal")
+			w := wal.NewFileWAL(path)
+			size := func() int64 {
+				info, err := os.Stat(path)
+				Expect(err).ToNot(HaveOccurred())
+				return info.Size()
+			}
+
+			state := processutil.RandomState(r)
+			state.CurrentHeight = process.Height(1 + r.Int63n(1000))
+			Expect(w.Checkpoint(state)).To(Succeed())
+			rotated := size()
+			prevote := processutil.RandomPrevote(r)
+			prevote.Height = state.CurrentHeight
+			Expect(w.AppendPrevote(prevote)).To(Succeed())
+			for i := 0; i < 10; i++ {
+				state.CurrentRound++
+				Expect(w.Checkpoint(state)).To(Succeed())
+			}
+			Expect(size()).To(BeNumerically(">", rotated))
+
+			// messages are kept without reading the file again
+			w2 := wal.NewFileWAL(path)
+			record, ok, err := w2.Load()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(record.State.Equal(&state)).To(BeTrue())
+			Expect(record.Prevotes).To(HaveLen(1))
+
+			future := processutil.RandomPrecommit(r)
+			future.Height = state.CurrentHeight + 1
+			Expect(w.AppendPrecommit(future)).To(Succeed())
+			state.CurrentHeight++
+			Expect(w.Checkpoint(state)).To(Succeed())
+			record, ok, err = w.Load()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(record.State.Equal(&state)).To(BeTrue())
+			Expect(record.Prevotes).To(BeEmpty())
+			Expect(record.Precommits).To(HaveLen(1))
+			Expect(record.Precommits[0].Equal(&future)).To(BeTrue())
+		})
+
+		It("should bound the size of the file when the height does not change", func() {
+			path := filepath.Join(dir, "wal")
+			w := wal.NewFileWAL(path)
+			size := func() int64 {
+				info, err := os.Stat(path)
+				Expect(err).ToNot(HaveOccurred())
+				return info.Size()
+			}
+
+			state := processutil.RandomState(r)
+			state.CurrentHeight = process.Height(1 + r.Int63n(1000))
+			prevote := processutil.RandomPrevote(r)
+			prevote.Height = state.CurrentHeight
+			Expect(w.AppendPrevote(prevote)).To(Succeed())
+			Expect(w.Checkpoint(state)).To(Succeed())
+			rotated := size()
+
+			// the file is rotated before it has doubled in size, and the
+			// messages at the height are kept when it is rotated
+			for i := 0; i < 100; i++ {
+				state.CurrentRound++
+				Expect(w.Checkpoint(state)).To(Succeed())
+				Expect(size()).To(BeNumerically("<=", 2*rotated))
+			}
+			record, ok, err := wal.NewFileWAL(path).Load()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(record.State.Equal(&state)).To(BeTrue())
+			Expect(record.Prevotes).To(HaveLen(1))
+			Expect(record.Prevotes[0].Equal(&prevote)).To(BeTrue())
+		})
+	})
+})